@@ -440,10 +440,14 @@ type DatabaseUploadResponse struct {
 
 /*
 A MongoUploader uploads files to a MongoDB database. This struct
-satisfies the DatabaseUploader interface
+satisfies the DatabaseUploader interface. When Validate is set, every
+upload is passed to it before anything is written. It returns the reader
+to store, or an error to refuse the upload. images.UploadValidator
+builds one that only accepts images within a set of limits.
 */
 type MongoUploader struct {
-	DB Database
+	DB       Database
+	Validate func(reader io.Reader) (io.Reader, error)
 }
 
 /*
@@ -461,6 +465,15 @@ func (u *MongoUploader) Upload(reader io.Reader, name, path string) (*DatabaseUp
 	buffer := make([]byte, 2048)
 	name = u.sanitizeFileName(name)
 
+	/*
+	 * Validate the upload before anything is stored
+	 */
+	if u.Validate != nil {
+		if reader, err = u.Validate(reader); err != nil {
+			return result, fmt.Errorf("Error validating file '%s': %w", name, err)
+		}
+	}
+
 	/*
 	 * Create the file in GridFS
 	 */
@@ -476,15 +489,24 @@ func (u *MongoUploader) Upload(reader io.Reader, name, path string) (*DatabaseUp
 	for {
 		bytesRead, err = reader.Read(buffer)
 
-		if err == nil {
-			if bytesRead > 0 {
-				if bytesWritten, err = file.Write(buffer); err != nil {
-					result.BytesWritten = bytesWritten
-					return result, fmt.Errorf("Error writing file bytes to GridFS: %w", err)
-				}
-
-				totalBytesWritten += bytesWritten
+		/*
+		 * A reader may return data along with io.EOF, so write before
+		 * checking the error. A read error is returned again by the next
+		 * Read once the data is written.
+		 */
+		if bytesRead > 0 {
+			if bytesWritten, err = file.Write(buffer[:bytesRead]); err != nil {
+				result.BytesWritten = totalBytesWritten + bytesWritten
+				return result, fmt.Errorf("Error writing file bytes to GridFS: %w", err)
 			}
+
+			totalBytesWritten += bytesWritten
+			continue
+		}
+
+		if err != nil && err != io.EOF {
+			result.BytesWritten = totalBytesWritten
+			return result, fmt.Errorf("Error reading file '%s': %w", name, err)
 		}
 
 		if err == io.EOF {
@@ -13,7 +13,7 @@ import (
 var address string = "localhost:27017"
 
 func setup() {
-	s := database.Dial(address)
+	s, _ := database.Dial(address)
 	db := s.DB("test_kit_database")
 	collection := db.C("test_collection")
 	collection.DropCollection()
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package database_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/app-nerds/kit/v6/database"
+	"github.com/globalsign/mgo/bson"
+)
+
+func newMockGridFS(written *bytes.Buffer) *database.DatabaseMock {
+	id := bson.NewObjectId()
+
+	return &database.DatabaseMock{
+		GridFSFunc: func(prefix string) database.GridFS {
+			return &database.GridFSMock{
+				CreateFunc: func(name string) (database.GridFile, error) {
+					return &database.GridFileMock{
+						CloseFunc: func() error { return nil },
+						IdFunc:    func() interface{} { return id },
+						WriteFunc: written.Write,
+					}, nil
+				},
+			}
+		},
+	}
+}
+
+func TestMongoUploader_WritesOnlyTheBytesRead(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 300)
+	written := &bytes.Buffer{}
+	uploader := &database.MongoUploader{DB: newMockGridFS(written)}
+
+	// DataErrReader returns the last chunk along with io.EOF
+	result, err := uploader.Upload(iotest.DataErrReader(bytes.NewReader(data)), "../file.txt", "fs")
+
+	if err != nil {
+		t.Fatalf("unexpected error from Upload: %v", err)
+	}
+
+	if !bytes.Equal(written.Bytes(), data) {
+		t.Errorf("expected %d bytes written to GridFS but got %d", len(data), written.Len())
+	}
+
+	if result.BytesWritten != len(data) || result.FileName != "file.txt" {
+		t.Errorf("expected %d bytes written to file.txt but got %+v", len(data), result)
+	}
+}
+
+func TestMongoUploader_RefusesInvalidUploads(t *testing.T) {
+	refused := fmt.Errorf("not an image")
+	written := &bytes.Buffer{}
+	uploader := &database.MongoUploader{
+		DB: newMockGridFS(written),
+		Validate: func(reader io.Reader) (io.Reader, error) {
+			return nil, refused
+		},
+	}
+
+	if _, err := uploader.Upload(strings.NewReader("<html></html>"), "file.png", "fs"); !errors.Is(err, refused) {
+		t.Errorf("expected the validation error but got %v", err)
+	}
+
+	if written.Len() != 0 {
+		t.Errorf("expected nothing written to GridFS but got %d bytes", written.Len())
+	}
+}
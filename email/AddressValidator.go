@@ -0,0 +1,461 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"strings"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+//go:embed disposable_domains.txt
+var disposableDomainList string
+
+/*
+DefaultRoleAccounts are local parts that usually belong to a role or
+team rather than a person
+*/
+var DefaultRoleAccounts = []string{
+	"abuse", "accounts", "admin", "administrator", "all", "billing", "careers",
+	"contact", "customerservice", "dev", "devnull", "enquiries", "everyone",
+	"feedback", "hello", "help", "hostmaster", "hr", "info", "inquiries", "jobs",
+	"legal", "mail", "mailer-daemon", "marketing", "media", "newsletter",
+	"no-reply", "noc", "noreply", "office", "postmaster", "press", "privacy",
+	"root", "sales", "security", "staff", "support", "team", "webmaster",
+}
+
+/*
+DefaultSuggestionDomains are common mail domains used to suggest
+corrections for typos, such as gmial.com
+*/
+var DefaultSuggestionDomains = []string{
+	"aol.com", "comcast.net", "gmail.com", "gmx.com", "gmx.de", "googlemail.com",
+	"hotmail.co.uk", "hotmail.com", "icloud.com", "live.com", "mac.com", "mail.com",
+	"me.com", "msn.com", "outlook.com", "proton.me", "protonmail.com", "yahoo.co.uk",
+	"yahoo.com", "yandex.com", "zoho.com",
+}
+
+/*
+MXResolver looks up the DNS records used to decide if a domain can
+receive mail. *net.Resolver satisfies this interface.
+*/
+type MXResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+/*
+AddressValidatorConfig configures an AddressValidator.
+
+  - CheckDomain turns on DNS lookups for MX, then A/AAAA, records
+  - Resolver performs the lookups. Defaults to net.DefaultResolver
+  - Timeout limits how long DNS lookups may take. Defaults to 5 seconds
+  - DisposableDomains are added to the bundled list of disposable domains
+  - RoleAccounts replaces DefaultRoleAccounts when provided
+  - SuggestionDomains replaces DefaultSuggestionDomains when provided
+*/
+type AddressValidatorConfig struct {
+	CheckDomain       bool
+	DisposableDomains []string
+	Resolver          MXResolver
+	RoleAccounts      []string
+	SuggestionDomains []string
+	Timeout           time.Duration
+}
+
+/*
+AddressValidationResult describes everything learned about an address.
+Address is the normalized addr-spec, with the domain lowercased and
+converted to its ASCII (punycode) form. UnicodeDomain holds the domain as
+it was provided. SyntaxError is set when the address
+is malformed, in which case no other checks are run. DomainError is set
+when CheckDomain is on and the domain has no MX or A/AAAA records, or the
+lookup failed. Suggestion holds a corrected address when the domain looks
+like a typo of a common mail domain.
+*/
+type AddressValidationResult struct {
+	Address       string
+	Domain        string
+	DomainChecked bool
+	DomainError   error
+	HasA          bool
+	HasMX         bool
+	IsDisposable  bool
+	IsRoleAccount bool
+	LocalPart     string
+	Suggestion    string
+	SyntaxError   error
+	UnicodeDomain string
+}
+
+/*
+Valid returns true when the address is well formed and, if the domain was
+checked, the domain can receive mail. Disposable and role accounts are
+still considered valid. Check IsDisposable and IsRoleAccount to reject them.
+*/
+func (r AddressValidationResult) Valid() bool {
+	if r.SyntaxError != nil {
+		return false
+	}
+
+	return !r.DomainChecked || r.DomainError == nil
+}
+
+/*
+AddressValidator performs deep validation of email addresses
+*/
+type AddressValidator struct {
+	checkDomain       bool
+	disposableDomains map[string]bool
+	resolver          MXResolver
+	roleAccounts      map[string]bool
+	suggestionDomains []string
+	timeout           time.Duration
+}
+
+/*
+NewAddressValidator creates a new address validator
+*/
+func NewAddressValidator(config AddressValidatorConfig) *AddressValidator {
+	result := &AddressValidator{
+		checkDomain:       config.CheckDomain,
+		disposableDomains: map[string]bool{},
+		resolver:          config.Resolver,
+		roleAccounts:      map[string]bool{},
+		suggestionDomains: config.SuggestionDomains,
+		timeout:           config.Timeout,
+	}
+
+	if result.resolver == nil {
+		result.resolver = net.DefaultResolver
+	}
+
+	if result.timeout <= 0 {
+		result.timeout = 5 * time.Second
+	}
+
+	if len(result.suggestionDomains) == 0 {
+		result.suggestionDomains = DefaultSuggestionDomains
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(disposableDomainList))
+
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			result.disposableDomains[line] = true
+		}
+	}
+
+	for _, domain := range config.DisposableDomains {
+		result.disposableDomains[strings.ToLower(domain)] = true
+	}
+
+	roleAccounts := config.RoleAccounts
+
+	if len(roleAccounts) == 0 {
+		roleAccounts = DefaultRoleAccounts
+	}
+
+	for _, account := range roleAccounts {
+		result.roleAccounts[strings.ToLower(account)] = true
+	}
+
+	return result
+}
+
+/*
+Validate checks an address and returns a structured result
+*/
+func (v *AddressValidator) Validate(ctx context.Context, address string) AddressValidationResult {
+	result := parseAddressSyntax(address)
+
+	if result.SyntaxError != nil {
+		return result
+	}
+
+	result.IsDisposable = v.isDisposable(result.Domain)
+	result.IsRoleAccount = v.isRoleAccount(result.LocalPart)
+	result.Suggestion = v.suggest(result.LocalPart, result.Domain)
+
+	if v.checkDomain && !strings.HasPrefix(result.Domain, "[") {
+		v.lookupDomain(ctx, &result)
+	}
+
+	return result
+}
+
+func (v *AddressValidator) isDisposable(domain string) bool {
+	for {
+		if v.disposableDomains[domain] {
+			return true
+		}
+
+		dot := strings.Index(domain, ".")
+
+		if dot < 0 {
+			return false
+		}
+
+		domain = domain[dot+1:]
+	}
+}
+
+func (v *AddressValidator) isRoleAccount(localPart string) bool {
+	localPart = strings.ToLower(localPart)
+
+	if plus := strings.Index(localPart, "+"); plus > 0 {
+		localPart = localPart[:plus]
+	}
+
+	return v.roleAccounts[localPart]
+}
+
+func (v *AddressValidator) lookupDomain(ctx context.Context, result *AddressValidationResult) {
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	result.DomainChecked = true
+
+	records, err := v.resolver.LookupMX(ctx, result.Domain)
+
+	/*
+	 * A single MX record of "." is a null MX (RFC 7505), meaning the
+	 * domain explicitly does not accept mail
+	 */
+	if err == nil && len(records) == 1 && (records[0].Host == "." || records[0].Host == "") {
+		result.DomainError = ErrDomainDoesNotAcceptMail
+		return
+	}
+
+	if err == nil && len(records) > 0 {
+		result.HasMX = true
+		return
+	}
+
+	var dnsErr *net.DNSError
+
+	if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		result.DomainError = fmt.Errorf("error looking up MX records for '%s': %w", result.Domain, err)
+		return
+	}
+
+	/*
+	 * With no MX records, mail is delivered to the domain's A/AAAA records
+	 */
+	hosts, err := v.resolver.LookupHost(ctx, result.Domain)
+
+	if err == nil && len(hosts) > 0 {
+		result.HasA = true
+		return
+	}
+
+	if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		result.DomainError = fmt.Errorf("error looking up address records for '%s': %w", result.Domain, err)
+		return
+	}
+
+	result.DomainError = ErrDomainDoesNotAcceptMail
+}
+
+/*
+suggest returns a corrected address when domain is within a small edit
+distance of a common mail domain
+*/
+func (v *AddressValidator) suggest(localPart, domain string) string {
+	best := ""
+	bestDistance := 3
+
+	for _, candidate := range v.suggestionDomains {
+		if candidate == domain {
+			return ""
+		}
+
+		/*
+		 * Short domains are too easily "close" to something
+		 */
+		if len(domain) < 5 {
+			continue
+		}
+
+		if distance := editDistance(domain, candidate); distance < bestDistance {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+
+	if best == "" {
+		return ""
+	}
+
+	return localPart + "@" + best
+}
+
+/*
+parseAddressSyntax validates an address against RFC 5322 and the DNS
+rules for host names. Internationalized domains are converted to their
+ASCII form.
+*/
+func parseAddressSyntax(address string) AddressValidationResult {
+	var (
+		err    error
+		parsed *mail.Address
+	)
+
+	result := AddressValidationResult{}
+	address = strings.TrimSpace(address)
+
+	if parsed, err = mail.ParseAddress(address); err != nil {
+		result.SyntaxError = fmt.Errorf("%w: %s", ErrInvalidAddressSyntax, err.Error())
+		return result
+	}
+
+	if parsed.Name != "" || strings.ContainsAny(address, "<>") {
+		result.SyntaxError = fmt.Errorf("%w: expected a bare address without a display name", ErrInvalidAddressSyntax)
+		return result
+	}
+
+	return parseAddrSpec(parsed)
+}
+
+/*
+parseAddrSpec validates the addr-spec of an already parsed address
+against the length limits and the DNS rules for host names
+*/
+func parseAddrSpec(parsed *mail.Address) AddressValidationResult {
+	var err error
+
+	result := AddressValidationResult{}
+	at := strings.LastIndex(parsed.Address, "@")
+	result.LocalPart = parsed.Address[:at]
+	result.UnicodeDomain = strings.ToLower(parsed.Address[at+1:])
+
+	if len(result.LocalPart) > 64 {
+		result.SyntaxError = fmt.Errorf("%w: local part is longer than 64 characters", ErrInvalidAddressSyntax)
+		return result
+	}
+
+	if strings.HasPrefix(result.UnicodeDomain, "[") {
+		literal := strings.TrimPrefix(strings.TrimSuffix(result.UnicodeDomain, "]"), "[")
+		literal = strings.TrimPrefix(literal, "ipv6:")
+
+		if net.ParseIP(literal) == nil {
+			result.SyntaxError = fmt.Errorf("%w: invalid domain literal", ErrInvalidAddressSyntax)
+			return result
+		}
+
+		result.Domain = result.UnicodeDomain
+	} else {
+		if result.Domain, err = idna.Lookup.ToASCII(result.UnicodeDomain); err != nil {
+			result.SyntaxError = fmt.Errorf("%w: invalid domain: %s", ErrInvalidAddressSyntax, err.Error())
+			return result
+		}
+
+		if err = validateHostName(result.Domain); err != nil {
+			result.SyntaxError = err
+			return result
+		}
+	}
+
+	result.Address = result.LocalPart + "@" + result.Domain
+
+	if len(result.Address) > 254 {
+		result.SyntaxError = fmt.Errorf("%w: address is longer than 254 characters", ErrInvalidAddressSyntax)
+		return result
+	}
+
+	return result
+}
+
+func validateHostName(domain string) error {
+	if len(domain) > 253 {
+		return fmt.Errorf("%w: domain is longer than 253 characters", ErrInvalidAddressSyntax)
+	}
+
+	labels := strings.Split(domain, ".")
+
+	if len(labels) < 2 {
+		return fmt.Errorf("%w: domain must have at least two labels", ErrInvalidAddressSyntax)
+	}
+
+	for _, label := range labels {
+		if label == "" || len(label) > 63 {
+			return fmt.Errorf("%w: domain labels must be 1 to 63 characters", ErrInvalidAddressSyntax)
+		}
+
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("%w: domain labels cannot start or end with a hyphen", ErrInvalidAddressSyntax)
+		}
+
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return fmt.Errorf("%w: domain contains invalid character '%c'", ErrInvalidAddressSyntax, r)
+			}
+		}
+	}
+
+	tld := labels[len(labels)-1]
+
+	if strings.Trim(tld, "0123456789") == "" {
+		return fmt.Errorf("%w: top level domain cannot be numeric", ErrInvalidAddressSyntax)
+	}
+
+	return nil
+}
+
+/*
+editDistance returns the optimal string alignment distance between a and b,
+which counts insertions, deletions, substitutions, and transpositions
+*/
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(ra)][len(rb)]
+}
+
+func minInt(values ...int) int {
+	result := values[0]
+
+	for _, v := range values[1:] {
+		if v < result {
+			result = v
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/email"
+)
+
+type fakeResolver struct {
+	hosts map[string][]string
+	mx    map[string][]*net.MX
+}
+
+func (r fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if result, ok := r.hosts[host]; ok {
+		return result, nil
+	}
+
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (r fakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if result, ok := r.mx[name]; ok {
+		return result, nil
+	}
+
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func TestIsValidEmailAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{address: "adam@example.com", want: true},
+		{address: "Adam <adam@example.com>", want: true},
+		{address: "adam@bücher.de", want: true},
+		{address: "a@b", want: false},
+		{address: "adam@exa_mple.com", want: false},
+		{address: "whatever", want: false},
+		{address: "", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := email.IsValidEmailAddress(tt.address); got != tt.want {
+			t.Errorf("IsValidEmailAddress(%q) = %v, want %v", tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestAddressValidator_ValidateSyntax(t *testing.T) {
+	validator := email.NewAddressValidator(email.AddressValidatorConfig{})
+
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{address: "adam@example.com", want: true},
+		{address: "adam+tag@sub.example.co.uk", want: true},
+		{address: "\"adam smith\"@example.com", want: true},
+		{address: "adam@bücher.de", want: true},
+		{address: "a@b", want: false},
+		{address: "whatever", want: false},
+		{address: "adam@-example.com", want: false},
+		{address: "adam@example.123", want: false},
+		{address: "adam@exa_mple.com", want: false},
+		{address: "Adam <adam@example.com>", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := validator.Validate(context.Background(), tt.address).SyntaxError == nil; got != tt.want {
+			t.Errorf("Validate(%q) syntax valid = %v, want %v", tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestAddressValidator_Validate(t *testing.T) {
+	validator := email.NewAddressValidator(email.AddressValidatorConfig{
+		CheckDomain: true,
+		Resolver: fakeResolver{
+			hosts: map[string][]string{
+				"a-only.com": {"192.0.2.1"},
+			},
+			mx: map[string][]*net.MX{
+				"example.com":         {{Host: "mx.example.com.", Pref: 10}},
+				"gmail.com":           {{Host: "gmail-smtp-in.l.google.com.", Pref: 5}},
+				"mailinator.com":      {{Host: "mail.mailinator.com.", Pref: 10}},
+				"xn--bcher-kva.de":    {{Host: "mx.bücher.de.", Pref: 10}},
+				"null-mx.example.org": {{Host: ".", Pref: 0}},
+			},
+		},
+	})
+
+	ctx := context.Background()
+
+	result := validator.Validate(ctx, "adam@Bücher.de")
+
+	if !result.Valid() || !result.HasMX || result.Address != "adam@xn--bcher-kva.de" {
+		t.Errorf("expected IDN address to validate with an MX record but got %+v", result)
+	}
+
+	if result = validator.Validate(ctx, "adam@a-only.com"); !result.Valid() || result.HasMX || !result.HasA {
+		t.Errorf("expected fallback to A records but got %+v", result)
+	}
+
+	if result = validator.Validate(ctx, "adam@nowhere.example.net"); result.Valid() || !errors.Is(result.DomainError, email.ErrDomainDoesNotAcceptMail) {
+		t.Errorf("expected a domain without records to be invalid but got %+v", result)
+	}
+
+	if result = validator.Validate(ctx, "adam@null-mx.example.org"); result.Valid() {
+		t.Errorf("expected a null MX domain to be invalid but got %+v", result)
+	}
+
+	if result = validator.Validate(ctx, "someone@mailinator.com"); !result.IsDisposable {
+		t.Errorf("expected mailinator.com to be disposable")
+	}
+
+	if result = validator.Validate(ctx, "Support+tickets@example.com"); !result.IsRoleAccount {
+		t.Errorf("expected support@ to be a role account")
+	}
+
+	if result = validator.Validate(ctx, "adam@gmial.com"); result.Suggestion != "adam@gmail.com" {
+		t.Errorf("expected suggestion 'adam@gmail.com' but got '%s'", result.Suggestion)
+	}
+
+	if result = validator.Validate(ctx, "adam@gmail.com"); result.Suggestion != "" {
+		t.Errorf("expected no suggestion for a correct domain but got '%s'", result.Suggestion)
+	}
+
+	if result = validator.Validate(ctx, "a@b"); !errors.Is(result.SyntaxError, email.ErrInvalidAddressSyntax) {
+		t.Errorf("expected a syntax error for 'a@b' but got %+v", result)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+/*
+Handler returns an HTTP handler exposing the captured messages as a
+simple inbox API:
+
+  - GET /messages lists every message
+  - GET /messages/{id} returns a single message
+  - GET /messages/{id}/raw returns the raw message as message/rfc822
+  - GET /messages/{id}/attachments/{index} downloads an attachment
+  - DELETE /messages clears the inbox
+
+Mount it under a prefix with http.StripPrefix.
+*/
+func (s *CaptureServer) Handler() http.Handler {
+	router := mux.NewRouter()
+
+	router.HandleFunc("/messages", s.handleListMessages).Methods(http.MethodGet)
+	router.HandleFunc("/messages", s.handleClearMessages).Methods(http.MethodDelete)
+	router.HandleFunc("/messages/{id}", s.handleGetMessage).Methods(http.MethodGet)
+	router.HandleFunc("/messages/{id}/raw", s.handleGetRawMessage).Methods(http.MethodGet)
+	router.HandleFunc("/messages/{id}/attachments/{index}", s.handleGetAttachment).Methods(http.MethodGet)
+
+	return router
+}
+
+func (s *CaptureServer) handleListMessages(w http.ResponseWriter, r *http.Request) {
+	writeCaptureJSON(w, http.StatusOK, s.Messages())
+}
+
+func (s *CaptureServer) handleClearMessages(w http.ResponseWriter, r *http.Request) {
+	s.Clear()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *CaptureServer) handleGetMessage(w http.ResponseWriter, r *http.Request) {
+	message, ok := s.Message(mux.Vars(r)["id"])
+
+	if !ok {
+		http.Error(w, "message not found", http.StatusNotFound)
+		return
+	}
+
+	writeCaptureJSON(w, http.StatusOK, message)
+}
+
+func (s *CaptureServer) handleGetRawMessage(w http.ResponseWriter, r *http.Request) {
+	message, ok := s.Message(mux.Vars(r)["id"])
+
+	if !ok {
+		http.Error(w, "message not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "message/rfc822")
+	_, _ = w.Write(message.Raw)
+}
+
+func (s *CaptureServer) handleGetAttachment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	message, ok := s.Message(vars["id"])
+
+	if !ok {
+		http.Error(w, "message not found", http.StatusNotFound)
+		return
+	}
+
+	index, err := strconv.Atoi(vars["index"])
+
+	if err != nil || index < 0 || index >= len(message.Attachments) {
+		http.Error(w, "attachment not found", http.StatusNotFound)
+		return
+	}
+
+	attachment := message.Attachments[index]
+	w.Header().Set("Content-Type", attachment.ContentType)
+
+	if attachment.FileName != "" {
+		w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(attachment.FileName))
+	}
+
+	_, _ = w.Write(attachment.Data)
+}
+
+func writeCaptureJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
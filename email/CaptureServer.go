@@ -0,0 +1,507 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+CaptureServerConfig configures a CaptureServer.
+
+  - Address is the address to listen on. Defaults to 127.0.0.1:0, which picks a free port
+  - Hostname is announced in the greeting. Defaults to localhost
+  - MaxMessageBytes limits the size of a message. Defaults to 25MB
+  - OnMessage is called, if provided, for each message received
+  - TLSConfig turns on STARTTLS support when provided
+*/
+type CaptureServerConfig struct {
+	Address         string
+	Hostname        string
+	MaxMessageBytes int64
+	OnMessage       func(mail *ReceivedMail)
+	TLSConfig       *tls.Config
+}
+
+/*
+CaptureServer is an in-process SMTP server that accepts every message sent
+to it and keeps it in memory instead of delivering it. Use it in tests and
+development to see exactly what an application sends. Any credentials are
+accepted by AUTH PLAIN and AUTH LOGIN.
+*/
+type CaptureServer struct {
+	address         string
+	hostname        string
+	maxMessageBytes int64
+	onMessage       func(mail *ReceivedMail)
+	tlsConfig       *tls.Config
+
+	listener    net.Listener
+	lock        sync.RWMutex
+	messages    []*ReceivedMail
+	nextID      int
+	received    *sync.Cond
+	closed      bool
+	connLock    sync.Mutex
+	connections sync.WaitGroup
+	open        map[net.Conn]struct{}
+}
+
+/*
+NewCaptureServer creates a new SMTP capture server. Call Start to
+begin accepting connections.
+*/
+func NewCaptureServer(config CaptureServerConfig) *CaptureServer {
+	result := &CaptureServer{
+		address:         config.Address,
+		hostname:        config.Hostname,
+		maxMessageBytes: config.MaxMessageBytes,
+		onMessage:       config.OnMessage,
+		tlsConfig:       config.TLSConfig,
+
+		messages: []*ReceivedMail{},
+		open:     map[net.Conn]struct{}{},
+	}
+
+	result.received = sync.NewCond(result.lock.RLocker())
+
+	if result.address == "" {
+		result.address = "127.0.0.1:0"
+	}
+
+	if result.hostname == "" {
+		result.hostname = "localhost"
+	}
+
+	if result.maxMessageBytes <= 0 {
+		result.maxMessageBytes = 25 * 1024 * 1024
+	}
+
+	return result
+}
+
+/*
+Start begins listening for connections in the background
+*/
+func (s *CaptureServer) Start() error {
+	var err error
+
+	if s.listener, err = net.Listen("tcp", s.address); err != nil {
+		return fmt.Errorf("error starting SMTP capture server: %w", err)
+	}
+
+	go s.serve()
+	return nil
+}
+
+/*
+Close stops accepting connections, closes any open sessions, and waits
+for them to finish
+*/
+func (s *CaptureServer) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+
+	err := s.listener.Close()
+
+	s.connLock.Lock()
+	s.closed = true
+
+	for conn := range s.open {
+		_ = conn.Close()
+	}
+
+	s.connLock.Unlock()
+	s.connections.Wait()
+
+	return err
+}
+
+/*
+Addr returns the address the server is listening on
+*/
+func (s *CaptureServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+/*
+Config returns an email Config pointing at this server, ready to
+pass to NewMailService or NewSMTPTransport
+*/
+func (s *CaptureServer) Config() *Config {
+	host, port, _ := net.SplitHostPort(s.Addr())
+	portNumber, _ := strconv.Atoi(port)
+
+	return &Config{
+		Host: host,
+		Port: portNumber,
+	}
+}
+
+/*
+Messages returns every message received, oldest first
+*/
+func (s *CaptureServer) Messages() []*ReceivedMail {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return append([]*ReceivedMail{}, s.messages...)
+}
+
+/*
+Message returns a single message by ID
+*/
+func (s *CaptureServer) Message(id string) (*ReceivedMail, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, m := range s.messages {
+		if m.ID == id {
+			return m, true
+		}
+	}
+
+	return nil, false
+}
+
+/*
+Clear removes all received messages
+*/
+func (s *CaptureServer) Clear() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.messages = []*ReceivedMail{}
+}
+
+/*
+WaitForMessages blocks until at least count messages have been received,
+or timeout elapses. The messages received so far are always returned.
+*/
+func (s *CaptureServer) WaitForMessages(count int, timeout time.Duration) ([]*ReceivedMail, error) {
+	// The deadline must be set before the timer is armed, so that the
+	// timer's broadcast always comes after it has passed
+	deadline := time.Now().Add(timeout)
+
+	timer := time.AfterFunc(timeout, func() {
+		s.lock.Lock()
+		s.received.Broadcast()
+		s.lock.Unlock()
+	})
+
+	defer timer.Stop()
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for len(s.messages) < count {
+		if !time.Now().Before(deadline) {
+			return append([]*ReceivedMail{}, s.messages...), ErrCaptureTimeout
+		}
+
+		s.received.Wait()
+	}
+
+	return append([]*ReceivedMail{}, s.messages...), nil
+}
+
+func (s *CaptureServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		if !s.track(conn) {
+			_ = conn.Close()
+			return
+		}
+
+		go func() {
+			defer s.untrack(conn)
+			s.handleConnection(conn)
+		}()
+	}
+}
+
+/*
+track records an open connection so Close can end it. It returns false
+once the server is closed.
+*/
+func (s *CaptureServer) track(conn net.Conn) bool {
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.open[conn] = struct{}{}
+	s.connections.Add(1)
+	return true
+}
+
+func (s *CaptureServer) untrack(conn net.Conn) {
+	s.connLock.Lock()
+	delete(s.open, conn)
+	s.connLock.Unlock()
+
+	s.connections.Done()
+}
+
+func (s *CaptureServer) store(raw []byte, from string, recipients []string) {
+	parsed, err := ParseMessage(raw)
+
+	if err != nil {
+		/*
+		 * Keep unparseable messages so tests can still see that
+		 * something was sent
+		 */
+		parsed = &ReceivedMail{Raw: raw}
+	}
+
+	parsed.EnvelopeFrom = from
+	parsed.EnvelopeTo = recipients
+
+	s.lock.Lock()
+	s.nextID++
+	parsed.ID = strconv.Itoa(s.nextID)
+	s.messages = append(s.messages, parsed)
+	s.received.Broadcast()
+	s.lock.Unlock()
+
+	if s.onMessage != nil {
+		s.onMessage(parsed)
+	}
+}
+
+/*
+captureSession holds the state of a single SMTP conversation
+*/
+type captureSession struct {
+	conn       net.Conn
+	from       string
+	recipients []string
+	text       *textproto.Conn
+	tls        bool
+}
+
+func (s *CaptureServer) handleConnection(conn net.Conn) {
+	session := &captureSession{
+		conn: conn,
+		text: textproto.NewConn(conn),
+	}
+
+	defer func() {
+		_ = session.text.Close()
+	}()
+
+	session.reply(220, s.hostname+" ESMTP capture server ready")
+
+	for {
+		line, err := session.text.ReadLine()
+
+		if err != nil {
+			return
+		}
+
+		verb, args := line, ""
+
+		if space := strings.Index(line, " "); space > -1 {
+			verb, args = line[:space], strings.TrimSpace(line[space+1:])
+		}
+
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			session.reset()
+			session.reply(250, s.hostname)
+
+		case "EHLO":
+			session.reset()
+			extensions := []string{s.hostname, "PIPELINING", "8BITMIME", "SMTPUTF8", fmt.Sprintf("SIZE %d", s.maxMessageBytes), "AUTH PLAIN LOGIN"}
+
+			if s.tlsConfig != nil && !session.tls {
+				extensions = append(extensions, "STARTTLS")
+			}
+
+			session.replyLines(250, extensions)
+
+		case "STARTTLS":
+			if s.tlsConfig == nil || session.tls {
+				session.reply(502, "STARTTLS not available")
+				continue
+			}
+
+			session.reply(220, "Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+
+			if err = tlsConn.Handshake(); err != nil {
+				return
+			}
+
+			session.conn = tlsConn
+			session.text = textproto.NewConn(tlsConn)
+			session.tls = true
+			session.reset()
+
+		case "AUTH":
+			s.handleAuth(session, args)
+
+		case "MAIL":
+			if !strings.HasPrefix(strings.ToUpper(args), "FROM:") {
+				session.reply(501, "Syntax: MAIL FROM:<address>")
+				continue
+			}
+
+			session.reset()
+			session.from = extractSMTPPath(args[5:])
+			session.reply(250, "OK")
+
+		case "RCPT":
+			if !strings.HasPrefix(strings.ToUpper(args), "TO:") {
+				session.reply(501, "Syntax: RCPT TO:<address>")
+				continue
+			}
+
+			session.recipients = append(session.recipients, extractSMTPPath(args[3:]))
+			session.reply(250, "OK")
+
+		case "DATA":
+			if len(session.recipients) == 0 {
+				session.reply(503, "RCPT first")
+				continue
+			}
+
+			session.reply(354, "End data with <CR><LF>.<CR><LF>")
+
+			dotReader := session.text.DotReader()
+			raw, readErr := io.ReadAll(io.LimitReader(dotReader, s.maxMessageBytes+1))
+
+			if readErr != nil {
+				return
+			}
+
+			if int64(len(raw)) > s.maxMessageBytes {
+				_, _ = io.Copy(io.Discard, dotReader)
+				session.reply(552, "Message exceeds maximum size")
+				session.reset()
+				continue
+			}
+
+			s.store(raw, session.from, session.recipients)
+			session.reset()
+			session.reply(250, "OK: queued")
+
+		case "RSET":
+			session.reset()
+			session.reply(250, "OK")
+
+		case "NOOP":
+			session.reply(250, "OK")
+
+		case "VRFY":
+			session.reply(252, "Cannot VRFY user, but will accept message")
+
+		case "QUIT":
+			session.reply(221, "Bye")
+			return
+
+		default:
+			session.reply(502, "Command not implemented")
+		}
+	}
+}
+
+func (s *CaptureServer) handleAuth(session *captureSession, args string) {
+	parts := strings.Fields(args)
+
+	if len(parts) == 0 {
+		session.reply(501, "Syntax: AUTH mechanism")
+		return
+	}
+
+	switch strings.ToUpper(parts[0]) {
+	case "PLAIN":
+		if len(parts) == 1 {
+			session.reply(334, "")
+
+			if _, err := session.text.ReadLine(); err != nil {
+				return
+			}
+		}
+
+		session.reply(235, "Authentication successful")
+
+	case "LOGIN":
+		session.reply(334, base64.StdEncoding.EncodeToString([]byte("Username:")))
+
+		if _, err := session.text.ReadLine(); err != nil {
+			return
+		}
+
+		session.reply(334, base64.StdEncoding.EncodeToString([]byte("Password:")))
+
+		if _, err := session.text.ReadLine(); err != nil {
+			return
+		}
+
+		session.reply(235, "Authentication successful")
+
+	default:
+		session.reply(504, "Unrecognized authentication type")
+	}
+}
+
+func (session *captureSession) reset() {
+	session.from = ""
+	session.recipients = []string{}
+}
+
+func (session *captureSession) reply(code int, message string) {
+	_ = session.text.PrintfLine("%d %s", code, message)
+}
+
+func (session *captureSession) replyLines(code int, lines []string) {
+	for index, line := range lines {
+		separator := "-"
+
+		if index == len(lines)-1 {
+			separator = " "
+		}
+
+		_ = session.text.PrintfLine("%d%s%s", code, separator, line)
+	}
+}
+
+/*
+extractSMTPPath pulls the address out of a MAIL FROM or RCPT TO
+argument, ignoring any ESMTP parameters such as SIZE or BODY
+*/
+func extractSMTPPath(arg string) string {
+	arg = strings.TrimSpace(arg)
+
+	if start := strings.Index(arg, "<"); start > -1 {
+		if end := strings.Index(arg[start:], ">"); end > -1 {
+			return arg[start+1 : start+end]
+		}
+	}
+
+	if fields := strings.Fields(arg); len(fields) > 0 {
+		return fields[0]
+	}
+
+	return ""
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/app-nerds/kit/v6/email"
+	"gopkg.in/gomail.v2"
+)
+
+func startCaptureServer(t *testing.T) *email.CaptureServer {
+	t.Helper()
+
+	server := email.NewCaptureServer(email.CaptureServerConfig{})
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("unexpected error starting capture server: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	return server
+}
+
+func TestCaptureServer_CapturesMailServiceMessages(t *testing.T) {
+	server := startCaptureServer(t)
+	service := email.NewMailService(server.Config())
+
+	if err := service.Connect(); err != nil {
+		t.Fatalf("unexpected error connecting: %v", err)
+	}
+
+	defer service.Close()
+
+	err := service.Send(email.Mail{
+		Body:    "<p>Hello Bob</p>",
+		From:    email.Person{Name: "Adam", EmailAddress: "adam@example.com"},
+		Subject: "Héllo",
+		To: []email.Person{
+			{Name: "Bob", EmailAddress: "bob@example.com"},
+			{Name: "Carol", EmailAddress: "carol@example.com"},
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error sending: %v", err)
+	}
+
+	messages, err := server.WaitForMessages(1, 5*time.Second)
+
+	if err != nil {
+		t.Fatalf("expected a message but got %v", err)
+	}
+
+	got := messages[0]
+
+	if got.Subject != "Héllo" {
+		t.Errorf("expected subject 'Héllo' but got '%s'", got.Subject)
+	}
+
+	if got.From.Name != "Adam" || got.From.EmailAddress != "adam@example.com" {
+		t.Errorf("expected from Adam <adam@example.com> but got %+v", got.From)
+	}
+
+	if len(got.To) != 2 || len(got.EnvelopeTo) != 2 {
+		t.Errorf("expected 2 recipients but got %v and envelope %v", got.To, got.EnvelopeTo)
+	}
+
+	if strings.TrimSpace(got.HTMLBody) != "<p>Hello Bob</p>" {
+		t.Errorf("expected HTML body but got '%s'", got.HTMLBody)
+	}
+}
+
+func TestCaptureServer_ParsesAttachmentsAndServesInbox(t *testing.T) {
+	server := startCaptureServer(t)
+	transport := email.NewSMTPTransport(email.SMTPTransportConfig{Config: server.Config()})
+
+	defer transport.Close()
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", "adam@example.com")
+	m.SetHeader("To", "bob@example.com")
+	m.SetHeader("Subject", "Report")
+	m.SetBody("text/plain", "See attached")
+	m.AddAlternative("text/html", "<p>See attached</p>")
+	m.Attach("report.csv", gomail.SetCopyFunc(func(w io.Writer) error {
+		_, err := w.Write([]byte("a,b,c\n1,2,3\n"))
+		return err
+	}))
+
+	if err := gomail.Send(transport, m); err != nil {
+		t.Fatalf("unexpected error sending: %v", err)
+	}
+
+	messages, err := server.WaitForMessages(1, 5*time.Second)
+
+	if err != nil {
+		t.Fatalf("expected a message but got %v", err)
+	}
+
+	got := messages[0]
+
+	if got.TextBody != "See attached" || got.HTMLBody != "<p>See attached</p>" {
+		t.Errorf("expected text and HTML bodies but got '%s' and '%s'", got.TextBody, got.HTMLBody)
+	}
+
+	if len(got.Attachments) != 1 || got.Attachments[0].FileName != "report.csv" || string(got.Attachments[0].Data) != "a,b,c\n1,2,3\n" {
+		t.Fatalf("expected report.csv attachment but got %+v", got.Attachments)
+	}
+
+	inbox := httptest.NewServer(server.Handler())
+	defer inbox.Close()
+
+	response, err := http.Get(inbox.URL + "/messages")
+
+	if err != nil {
+		t.Fatalf("unexpected error listing messages: %v", err)
+	}
+
+	listed := []email.ReceivedMail{}
+	_ = json.NewDecoder(response.Body).Decode(&listed)
+	response.Body.Close()
+
+	if len(listed) != 1 || listed[0].Subject != "Report" {
+		t.Errorf("expected the inbox to list the report but got %+v", listed)
+	}
+
+	response, err = http.Get(inbox.URL + "/messages/" + got.ID + "/attachments/0")
+
+	if err != nil {
+		t.Fatalf("unexpected error downloading attachment: %v", err)
+	}
+
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+
+	if string(body) != "a,b,c\n1,2,3\n" {
+		t.Errorf("expected attachment contents but got '%s'", body)
+	}
+}
+
+func TestCaptureServer_CloseEndsIdleSessions(t *testing.T) {
+	server := email.NewCaptureServer(email.CaptureServerConfig{})
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("unexpected error starting capture server: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", server.Addr())
+
+	if err != nil {
+		t.Fatalf("unexpected error connecting: %v", err)
+	}
+
+	defer conn.Close()
+
+	if _, err = textproto.NewReader(bufio.NewReader(conn)).ReadLine(); err != nil {
+		t.Fatalf("unexpected error reading the greeting: %v", err)
+	}
+
+	closed := make(chan struct{})
+
+	go func() {
+		_ = server.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected Close to end an idle session")
+	}
+}
+
+func TestCaptureServer_WaitForMessagesTimesOut(t *testing.T) {
+	server := startCaptureServer(t)
+
+	messages, err := server.WaitForMessages(1, 10*time.Millisecond)
+
+	if !errors.Is(err, email.ErrCaptureTimeout) {
+		t.Errorf("expected ErrCaptureTimeout but got %v", err)
+	}
+
+	if len(messages) != 0 {
+		t.Errorf("expected no messages but got %d", len(messages))
+	}
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+/*
+charsetReader returns a reader that converts input from the named
+character set to UTF-8. It is used to decode encoded-word headers.
+*/
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	if isUTF8Charset(charset) {
+		return input, nil
+	}
+
+	enc, err := lookupCharset(charset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return transform.NewReader(input, enc.NewDecoder()), nil
+}
+
+/*
+decodeCharset converts data from the named character set to a UTF-8
+string. Unknown character sets are returned as-is, with invalid UTF-8
+sequences replaced.
+*/
+func decodeCharset(data []byte, charset string) string {
+	if isUTF8Charset(charset) {
+		return strings.ToValidUTF8(string(data), string(utf8.RuneError))
+	}
+
+	enc, err := lookupCharset(charset)
+
+	if err != nil {
+		return strings.ToValidUTF8(string(data), string(utf8.RuneError))
+	}
+
+	decoded, _, err := transform.Bytes(enc.NewDecoder(), data)
+
+	if err != nil {
+		return strings.ToValidUTF8(string(data), string(utf8.RuneError))
+	}
+
+	return string(decoded)
+}
+
+func isUTF8Charset(charset string) bool {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return true
+	}
+
+	return false
+}
+
+func lookupCharset(charset string) (encoding.Encoding, error) {
+	enc, err := htmlindex.Get(strings.TrimSpace(charset))
+
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("unsupported charset '%s'", charset)
+	}
+
+	return enc, nil
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"bytes"
+	"strings"
+)
+
+/*
+dkimHeader is a single header field of a message. Raw holds the field
+exactly as it appears in the message, including folding, but without the
+final CRLF.
+*/
+type dkimHeader struct {
+	Name string
+	Raw  string
+}
+
+/*
+splitDKIMMessage normalizes line endings to CRLF and splits a message
+into its header fields and body
+*/
+func splitDKIMMessage(message []byte) ([]dkimHeader, []byte) {
+	normalized := bytes.ReplaceAll(message, []byte("\r\n"), []byte("\n"))
+	normalized = bytes.ReplaceAll(normalized, []byte("\n"), []byte("\r\n"))
+
+	var (
+		headerBlock []byte
+		body        []byte
+	)
+
+	if bytes.HasPrefix(normalized, []byte("\r\n")) {
+		body = normalized[2:]
+	} else if index := bytes.Index(normalized, []byte("\r\n\r\n")); index > -1 {
+		headerBlock = normalized[:index+2]
+		body = normalized[index+4:]
+	} else {
+		headerBlock = normalized
+	}
+
+	headers := []dkimHeader{}
+	lines := strings.Split(strings.TrimSuffix(string(headerBlock), "\r\n"), "\r\n")
+
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+
+		if (line[0] == ' ' || line[0] == '\t') && len(headers) > 0 {
+			headers[len(headers)-1].Raw += "\r\n" + line
+			continue
+		}
+
+		name := line
+
+		if colon := strings.Index(line, ":"); colon > -1 {
+			name = line[:colon]
+		}
+
+		headers = append(headers, dkimHeader{
+			Name: strings.TrimSpace(name),
+			Raw:  line,
+		})
+	}
+
+	return headers, body
+}
+
+/*
+canonicalizeDKIMHeader applies the "relaxed" or "simple" header
+canonicalization algorithm from RFC 6376 section 3.4. The result
+includes a trailing CRLF.
+*/
+func canonicalizeDKIMHeader(raw, algorithm string) string {
+	if algorithm == "simple" {
+		return raw + "\r\n"
+	}
+
+	name := raw
+	value := ""
+
+	if colon := strings.Index(raw, ":"); colon > -1 {
+		name = raw[:colon]
+		value = raw[colon+1:]
+	}
+
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = collapseDKIMWhitespace(value)
+
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(value) + "\r\n"
+}
+
+/*
+canonicalizeDKIMBody applies the "relaxed" or "simple" body
+canonicalization algorithm from RFC 6376 section 3.4. The body must
+already use CRLF line endings.
+*/
+func canonicalizeDKIMBody(body []byte, algorithm string) []byte {
+	lines := strings.Split(string(body), "\r\n")
+
+	if algorithm != "simple" {
+		for index, line := range lines {
+			lines[index] = strings.TrimRight(collapseDKIMWhitespace(line), " ")
+		}
+	}
+
+	/*
+	 * Remove empty lines at the end of the body. The split leaves an
+	 * empty string after the final CRLF, which is removed here as well
+	 */
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) == 0 {
+		if algorithm == "simple" {
+			return []byte("\r\n")
+		}
+
+		return []byte{}
+	}
+
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func collapseDKIMWhitespace(s string) string {
+	b := &strings.Builder{}
+	inWhitespace := false
+
+	for _, r := range s {
+		if r == ' ' || r == '\t' {
+			if !inWhitespace {
+				b.WriteByte(' ')
+			}
+
+			inWhitespace = true
+			continue
+		}
+
+		inWhitespace = false
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+/*
+selectDKIMHeaders returns the headers to sign, in the order given by
+names. When a header appears more than once, instances are consumed from
+the bottom of the message up, as described in RFC 6376 section 5.4.2.
+Names with no remaining instance are skipped.
+*/
+func selectDKIMHeaders(headers []dkimHeader, names []string) []dkimHeader {
+	used := map[int]bool{}
+	result := []dkimHeader{}
+
+	for _, name := range names {
+		for index := len(headers) - 1; index >= 0; index-- {
+			if used[index] || !strings.EqualFold(headers[index].Name, name) {
+				continue
+			}
+
+			used[index] = true
+			result = append(result, headers[index])
+			break
+		}
+	}
+
+	return result
+}
+
+/*
+parseDKIMTags parses a tag=value list such as a DKIM-Signature header
+value or a DKIM DNS record
+*/
+func parseDKIMTags(s string) map[string]string {
+	result := map[string]string{}
+
+	for _, part := range strings.Split(s, ";") {
+		equals := strings.Index(part, "=")
+
+		if equals < 0 {
+			continue
+		}
+
+		name := strings.TrimSpace(part[:equals])
+		value := strings.Join(strings.Fields(part[equals+1:]), "")
+
+		if name != "" {
+			result[name] = value
+		}
+	}
+
+	return result
+}
+
+/*
+stripDKIMSignatureValue empties the b= tag of a raw DKIM-Signature
+header, leaving everything else, including whitespace, untouched
+*/
+func stripDKIMSignatureValue(raw string) string {
+	parts := strings.Split(raw, ";")
+
+	for index, part := range parts {
+		equals := strings.Index(part, "=")
+
+		if equals < 0 {
+			continue
+		}
+
+		name := part[:equals]
+
+		if index == 0 {
+			if colon := strings.Index(name, ":"); colon > -1 {
+				name = name[colon+1:]
+			}
+		}
+
+		if strings.TrimSpace(name) == "b" {
+			parts[index] = part[:equals+1]
+		}
+	}
+
+	return strings.Join(parts, ";")
+}
@@ -0,0 +1,294 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+/*
+DefaultDKIMHeaders is the list of headers signed when DKIMConfig.Headers
+is empty. Headers missing from a message are not signed.
+*/
+var DefaultDKIMHeaders = []string{
+	"From",
+	"Reply-To",
+	"Subject",
+	"Date",
+	"To",
+	"Cc",
+	"Message-ID",
+	"MIME-Version",
+	"Content-Type",
+	"Content-Transfer-Encoding",
+}
+
+/*
+DKIMConfig configures DKIM signing. Domain and Selector identify the DNS
+record holding the public key (<selector>._domainkey.<domain>). PrivateKey
+must be an *rsa.PrivateKey or ed25519.PrivateKey. Headers is the list of
+headers to sign, and defaults to DefaultDKIMHeaders. From is always
+signed. Expiration, when set, adds an x= tag that far in the future.
+*/
+type DKIMConfig struct {
+	Domain     string
+	Expiration time.Duration
+	Headers    []string
+	PrivateKey crypto.Signer
+	Selector   string
+}
+
+/*
+DKIMSigner signs messages per RFC 6376 using relaxed/relaxed
+canonicalization. RSA keys sign with rsa-sha256, and Ed25519 keys
+with ed25519-sha256 (RFC 8463).
+*/
+type DKIMSigner struct {
+	algorithm  string
+	domain     string
+	expiration time.Duration
+	headers    []string
+	privateKey crypto.Signer
+	selector   string
+
+	now func() time.Time
+}
+
+/*
+NewDKIMSigner creates a new signer. An error is returned if the
+configuration is incomplete or the key type is unsupported.
+*/
+func NewDKIMSigner(config DKIMConfig) (*DKIMSigner, error) {
+	var algorithm string
+
+	switch config.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+		algorithm = "rsa-sha256"
+
+	case ed25519.PrivateKey:
+		algorithm = "ed25519-sha256"
+
+	default:
+		return nil, ErrDKIMUnsupportedKey
+	}
+
+	if config.Domain == "" || config.Selector == "" {
+		return nil, fmt.Errorf("DKIM signing requires a domain and selector")
+	}
+
+	headers := config.Headers
+
+	if len(headers) == 0 {
+		headers = DefaultDKIMHeaders
+	}
+
+	hasFrom := false
+
+	for _, h := range headers {
+		if strings.EqualFold(h, "From") {
+			hasFrom = true
+		}
+	}
+
+	if !hasFrom {
+		headers = append([]string{"From"}, headers...)
+	}
+
+	return &DKIMSigner{
+		algorithm:  algorithm,
+		domain:     config.Domain,
+		expiration: config.Expiration,
+		headers:    headers,
+		privateKey: config.PrivateKey,
+		selector:   config.Selector,
+
+		now: time.Now,
+	}, nil
+}
+
+/*
+ParseDKIMPrivateKey parses a PEM encoded RSA (PKCS #1 or PKCS #8) or
+Ed25519 (PKCS #8) private key
+*/
+func ParseDKIMPrivateKey(pemBytes []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(pemBytes)
+
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in DKIM private key")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing DKIM private key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+
+	if !ok {
+		return nil, ErrDKIMUnsupportedKey
+	}
+
+	switch signer.(type) {
+	case *rsa.PrivateKey, ed25519.PrivateKey:
+		return signer, nil
+	}
+
+	return nil, ErrDKIMUnsupportedKey
+}
+
+/*
+PublicKeyRecord returns the TXT record value to publish at
+<selector>._domainkey.<domain> for the signer's key
+*/
+func (s *DKIMSigner) PublicKeyRecord() (string, error) {
+	switch key := s.privateKey.Public().(type) {
+	case *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(key)
+
+		if err != nil {
+			return "", fmt.Errorf("error encoding DKIM public key: %w", err)
+		}
+
+		return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der), nil
+
+	case ed25519.PublicKey:
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(key), nil
+	}
+
+	return "", ErrDKIMUnsupportedKey
+}
+
+/*
+Sign returns the message with a DKIM-Signature header prepended. Line
+endings in the result are normalized to CRLF.
+*/
+func (s *DKIMSigner) Sign(message []byte) ([]byte, error) {
+	var (
+		err       error
+		signature []byte
+	)
+
+	headers, body := splitDKIMMessage(message)
+	signed := selectDKIMHeaders(headers, s.headers)
+
+	if len(selectDKIMHeaders(signed, []string{"From"})) == 0 {
+		return nil, ErrDKIMMissingFrom
+	}
+
+	bodyHash := sha256.Sum256(canonicalizeDKIMBody(body, "relaxed"))
+	names := make([]string, 0, len(signed))
+
+	for _, h := range signed {
+		names = append(names, strings.ToLower(h.Name))
+	}
+
+	now := s.now().Unix()
+	tags := fmt.Sprintf("v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s;\r\n\tt=%d;", s.algorithm, s.domain, s.selector, now)
+
+	if s.expiration > 0 {
+		tags += fmt.Sprintf(" x=%d;", now+int64(s.expiration/time.Second))
+	}
+
+	tags += fmt.Sprintf(" h=%s;\r\n\tbh=%s;\r\n\tb=", strings.Join(names, ":"), base64.StdEncoding.EncodeToString(bodyHash[:]))
+	unsigned := "DKIM-Signature: " + tags
+
+	hash := sha256.New()
+
+	for _, h := range signed {
+		io.WriteString(hash, canonicalizeDKIMHeader(h.Raw, "relaxed"))
+	}
+
+	io.WriteString(hash, strings.TrimSuffix(canonicalizeDKIMHeader(unsigned, "relaxed"), "\r\n"))
+	digest := hash.Sum(nil)
+
+	switch key := s.privateKey.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)
+
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, digest)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error creating DKIM signature: %w", err)
+	}
+
+	result := &bytes.Buffer{}
+	result.WriteString(unsigned)
+	result.WriteString(foldDKIMValue(base64.StdEncoding.EncodeToString(signature)))
+	result.WriteString("\r\n")
+
+	for _, h := range headers {
+		result.WriteString(h.Raw + "\r\n")
+	}
+
+	result.WriteString("\r\n")
+	result.Write(body)
+
+	return result.Bytes(), nil
+}
+
+/*
+wrap returns a message that is signed as it is written
+*/
+func (s *DKIMSigner) wrap(msg io.WriterTo) io.WriterTo {
+	return &dkimSignedMessage{message: msg, signer: s}
+}
+
+type dkimSignedMessage struct {
+	message io.WriterTo
+	signer  *DKIMSigner
+}
+
+func (m *dkimSignedMessage) WriteTo(w io.Writer) (int64, error) {
+	buffer := &bytes.Buffer{}
+
+	if _, err := m.message.WriteTo(buffer); err != nil {
+		return 0, err
+	}
+
+	signed, err := m.signer.Sign(buffer.Bytes())
+
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(signed)
+	return int64(n), err
+}
+
+/*
+foldDKIMValue breaks a long base64 value into lines so the header
+stays within the recommended line length
+*/
+func foldDKIMValue(value string) string {
+	const lineLength = 72
+	parts := []string{}
+
+	for len(value) > lineLength {
+		parts = append(parts, value[:lineLength])
+		value = value[lineLength:]
+	}
+
+	parts = append(parts, value)
+	return strings.Join(parts, "\r\n\t ")
+}
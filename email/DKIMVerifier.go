@@ -0,0 +1,259 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+DKIMTXTLookup returns the TXT records for a DNS name. net.LookupTXT
+satisfies this, and tests can provide their own.
+*/
+type DKIMTXTLookup func(name string) ([]string, error)
+
+/*
+DKIMVerification is the result of checking a single DKIM-Signature
+header. Err is nil when the signature is valid.
+*/
+type DKIMVerification struct {
+	Domain   string
+	Err      error
+	Selector string
+}
+
+/*
+Valid returns true when the signature verified
+*/
+func (v DKIMVerification) Valid() bool {
+	return v.Err == nil
+}
+
+/*
+DKIMVerifier verifies DKIM signatures on messages. It supports rsa-sha256
+and ed25519-sha256 signatures with simple or relaxed canonicalization.
+*/
+type DKIMVerifier struct {
+	lookupTXT DKIMTXTLookup
+	now       func() time.Time
+}
+
+/*
+NewDKIMVerifier creates a verifier that fetches public keys with lookupTXT.
+When lookupTXT is nil, DNS is queried with net.LookupTXT.
+*/
+func NewDKIMVerifier(lookupTXT DKIMTXTLookup) *DKIMVerifier {
+	if lookupTXT == nil {
+		lookupTXT = net.LookupTXT
+	}
+
+	return &DKIMVerifier{
+		lookupTXT: lookupTXT,
+		now:       time.Now,
+	}
+}
+
+/*
+Verify checks every DKIM-Signature header in the message and returns
+one result per signature. ErrDKIMNoSignature is returned when the
+message is not signed.
+*/
+func (v *DKIMVerifier) Verify(message []byte) ([]DKIMVerification, error) {
+	headers, body := splitDKIMMessage(message)
+	result := []DKIMVerification{}
+
+	for _, h := range headers {
+		if !strings.EqualFold(h.Name, "DKIM-Signature") {
+			continue
+		}
+
+		result = append(result, v.verifySignature(h, headers, body))
+	}
+
+	if len(result) == 0 {
+		return result, ErrDKIMNoSignature
+	}
+
+	return result, nil
+}
+
+func (v *DKIMVerifier) verifySignature(signatureHeader dkimHeader, headers []dkimHeader, body []byte) DKIMVerification {
+	var (
+		err       error
+		publicKey crypto.PublicKey
+		signature []byte
+	)
+
+	value := signatureHeader.Raw[strings.Index(signatureHeader.Raw, ":")+1:]
+	tags := parseDKIMTags(value)
+
+	result := DKIMVerification{
+		Domain:   tags["d"],
+		Selector: tags["s"],
+	}
+
+	fail := func(format string, args ...interface{}) DKIMVerification {
+		result.Err = fmt.Errorf("%w: "+format, append([]interface{}{ErrDKIMVerificationFailed}, args...)...)
+		return result
+	}
+
+	if tags["v"] != "1" {
+		return fail("unsupported version '%s'", tags["v"])
+	}
+
+	for _, required := range []string{"a", "b", "bh", "d", "h", "s"} {
+		if tags[required] == "" {
+			return fail("missing required tag '%s'", required)
+		}
+	}
+
+	if _, ok := tags["l"]; ok {
+		return fail("body length limits are not supported")
+	}
+
+	if x, ok := tags["x"]; ok {
+		expiration, parseErr := strconv.ParseInt(x, 10, 64)
+
+		if parseErr != nil || v.now().Unix() > expiration {
+			return fail("signature has expired")
+		}
+	}
+
+	headerCanonicalization, bodyCanonicalization := "simple", "simple"
+
+	if c, ok := tags["c"]; ok {
+		parts := strings.SplitN(c, "/", 2)
+		headerCanonicalization = parts[0]
+
+		if len(parts) == 2 {
+			bodyCanonicalization = parts[1]
+		}
+	}
+
+	for _, c := range []string{headerCanonicalization, bodyCanonicalization} {
+		if c != "simple" && c != "relaxed" {
+			return fail("unsupported canonicalization '%s'", c)
+		}
+	}
+
+	bodyHash := sha256.Sum256(canonicalizeDKIMBody(body, bodyCanonicalization))
+
+	if base64.StdEncoding.EncodeToString(bodyHash[:]) != tags["bh"] {
+		return fail("body hash does not match")
+	}
+
+	names := strings.Split(tags["h"], ":")
+
+	if len(selectDKIMHeaders([]dkimHeader{{Name: "From"}}, names)) == 0 {
+		return fail("From header is not signed")
+	}
+
+	hash := sha256.New()
+
+	for _, h := range selectDKIMHeaders(headers, names) {
+		io.WriteString(hash, canonicalizeDKIMHeader(h.Raw, headerCanonicalization))
+	}
+
+	stripped := stripDKIMSignatureValue(signatureHeader.Raw)
+	io.WriteString(hash, strings.TrimSuffix(canonicalizeDKIMHeader(stripped, headerCanonicalization), "\r\n"))
+	digest := hash.Sum(nil)
+
+	if signature, err = base64.StdEncoding.DecodeString(tags["b"]); err != nil {
+		return fail("signature is not valid base64")
+	}
+
+	if publicKey, err = v.lookupPublicKey(tags["s"], tags["d"]); err != nil {
+		return fail("%s", err.Error())
+	}
+
+	switch tags["a"] {
+	case "rsa-sha256":
+		key, ok := publicKey.(*rsa.PublicKey)
+
+		if !ok {
+			return fail("key type does not match algorithm")
+		}
+
+		if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, signature); err != nil {
+			return fail("signature does not match")
+		}
+
+	case "ed25519-sha256":
+		key, ok := publicKey.(ed25519.PublicKey)
+
+		if !ok {
+			return fail("key type does not match algorithm")
+		}
+
+		if !ed25519.Verify(key, digest, signature) {
+			return fail("signature does not match")
+		}
+
+	default:
+		return fail("unsupported algorithm '%s'", tags["a"])
+	}
+
+	return result
+}
+
+func (v *DKIMVerifier) lookupPublicKey(selector, domain string) (crypto.PublicKey, error) {
+	var (
+		err     error
+		records []string
+		key     []byte
+	)
+
+	name := selector + "._domainkey." + domain
+
+	if records, err = v.lookupTXT(name); err != nil {
+		return nil, fmt.Errorf("error looking up DKIM key '%s': %w", name, err)
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no DKIM key found at '%s'", name)
+	}
+
+	/*
+	 * Long TXT records may be split into several strings
+	 */
+	tags := parseDKIMTags(strings.Join(records, ""))
+
+	if tags["p"] == "" {
+		return nil, fmt.Errorf("DKIM key at '%s' has been revoked", name)
+	}
+
+	if key, err = base64.StdEncoding.DecodeString(tags["p"]); err != nil {
+		return nil, fmt.Errorf("DKIM key at '%s' is not valid base64", name)
+	}
+
+	if tags["k"] == "ed25519" {
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("DKIM key at '%s' is not a valid Ed25519 key", name)
+		}
+
+		return ed25519.PublicKey(key), nil
+	}
+
+	if parsed, parseErr := x509.ParsePKIXPublicKey(key); parseErr == nil {
+		return parsed, nil
+	}
+
+	if parsed, parseErr := x509.ParsePKCS1PublicKey(key); parseErr == nil {
+		return parsed, nil
+	}
+
+	return nil, fmt.Errorf("DKIM key at '%s' could not be parsed", name)
+}
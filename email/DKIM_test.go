@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/email"
+)
+
+type capturingTransport struct {
+	messages [][]byte
+}
+
+func (t *capturingTransport) Send(from string, to []string, msg io.WriterTo) error {
+	buffer := &bytes.Buffer{}
+
+	if _, err := msg.WriteTo(buffer); err != nil {
+		return err
+	}
+
+	t.messages = append(t.messages, buffer.Bytes())
+	return nil
+}
+
+func (t *capturingTransport) Close() error {
+	return nil
+}
+
+func newTestSigner(t *testing.T, key crypto.Signer) (*email.DKIMSigner, email.DKIMTXTLookup) {
+	t.Helper()
+
+	signer, err := email.NewDKIMSigner(email.DKIMConfig{
+		Domain:     "example.com",
+		PrivateKey: key,
+		Selector:   "mail",
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error creating signer: %v", err)
+	}
+
+	record, err := signer.PublicKeyRecord()
+
+	if err != nil {
+		t.Fatalf("unexpected error creating public key record: %v", err)
+	}
+
+	lookup := func(name string) ([]string, error) {
+		if name != "mail._domainkey.example.com" {
+			return nil, fmt.Errorf("no such record '%s'", name)
+		}
+
+		return []string{record}, nil
+	}
+
+	return signer, lookup
+}
+
+func TestDKIM_SignAndVerify(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	keys := map[string]crypto.Signer{
+		"rsa":     rsaKey,
+		"ed25519": edKey,
+	}
+
+	for name, key := range keys {
+		t.Run(name, func(t *testing.T) {
+			signer, lookup := newTestSigner(t, key)
+			transport := &capturingTransport{}
+
+			service := email.NewMailServiceWithTransport(transport)
+			service.DKIM = signer
+
+			err := service.Send(email.Mail{
+				Body:    "<p>Hello   there</p>\n\n\n",
+				From:    email.Person{Name: "Adam", EmailAddress: "adam@example.com"},
+				Subject: "A rather long subject line that is long enough to make sure that folding happens somewhere",
+				To:      []email.Person{{Name: "Bob", EmailAddress: "bob@example.org"}},
+			})
+
+			if err != nil {
+				t.Fatalf("unexpected error sending: %v", err)
+			}
+
+			message := transport.messages[0]
+
+			if !bytes.HasPrefix(message, []byte("DKIM-Signature: ")) {
+				t.Fatalf("expected message to start with a DKIM-Signature header but got:\n%s", message)
+			}
+
+			results, err := email.NewDKIMVerifier(lookup).Verify(message)
+
+			if err != nil {
+				t.Fatalf("unexpected error verifying: %v", err)
+			}
+
+			if len(results) != 1 || !results[0].Valid() {
+				t.Fatalf("expected a single valid signature but got %+v", results)
+			}
+
+			/*
+			 * Whitespace changes are tolerated by relaxed canonicalization
+			 */
+			reformatted := bytes.Replace(message, []byte("Subject: "), []byte("subject:    "), 1)
+
+			if results, _ = email.NewDKIMVerifier(lookup).Verify(reformatted); !results[0].Valid() {
+				t.Errorf("expected signature to survive header whitespace changes but got %v", results[0].Err)
+			}
+
+			tampered := bytes.Replace(message, []byte("Hello"), []byte("Howdy"), 1)
+			results, _ = email.NewDKIMVerifier(lookup).Verify(tampered)
+
+			if results[0].Valid() || !errors.Is(results[0].Err, email.ErrDKIMVerificationFailed) {
+				t.Errorf("expected tampered body to fail verification")
+			}
+
+			tampered = bytes.Replace(message, []byte("bob@example.org"), []byte("eve@example.org"), 1)
+			results, _ = email.NewDKIMVerifier(lookup).Verify(tampered)
+
+			if results[0].Valid() {
+				t.Errorf("expected tampered header to fail verification")
+			}
+		})
+	}
+}
+
+func TestDKIM_VerifyUnsignedMessage(t *testing.T) {
+	message := strings.Join([]string{
+		"From: adam@example.com",
+		"Subject: unsigned",
+		"",
+		"body",
+	}, "\r\n")
+
+	_, err := email.NewDKIMVerifier(nil).Verify([]byte(message))
+
+	if !errors.Is(err, email.ErrDKIMNoSignature) {
+		t.Errorf("expected ErrDKIMNoSignature but got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"time"
+)
+
+/*
+DeliveryEventType describes what happened to a queued mail
+*/
+type DeliveryEventType string
+
+const (
+	// DeliveryEventQueued is emitted when mail is added to the queue
+	DeliveryEventQueued DeliveryEventType = "queued"
+
+	// DeliveryEventSent is emitted when mail is delivered
+	DeliveryEventSent DeliveryEventType = "sent"
+
+	// DeliveryEventRetrying is emitted when a delivery attempt fails and will be retried
+	DeliveryEventRetrying DeliveryEventType = "retrying"
+
+	// DeliveryEventDeadLettered is emitted when mail fails permanently or runs out of attempts
+	DeliveryEventDeadLettered DeliveryEventType = "dead-lettered"
+
+	// DeliveryEventStoreError is emitted when the outcome of a delivery could not be saved. The save is retried on the next poll
+	DeliveryEventStoreError DeliveryEventType = "store-error"
+)
+
+/*
+A DeliveryEvent reports a change in the delivery status of a queued mail.
+Error is set for failed attempts and store errors. NextAttempt is only
+set for attempts that will be retried.
+*/
+type DeliveryEvent struct {
+	Attempt     int
+	Error       error
+	ID          string
+	NextAttempt time.Time
+	Time        time.Time
+	Type        DeliveryEventType
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import "fmt"
+
+// ErrTransportClosed is returned when sending through a transport that has been closed
+var ErrTransportClosed = fmt.Errorf("transport is closed")
+
+// ErrQueuedMailNotFound is returned when a queue store has no mail with the requested ID
+var ErrQueuedMailNotFound = fmt.Errorf("queued mail not found")
+
+// ErrQueuedMailNotDead is returned when requeueing mail that has not been dead-lettered
+var ErrQueuedMailNotDead = fmt.Errorf("only dead-lettered mail can be requeued")
+
+// ErrDKIMUnsupportedKey is returned when a DKIM key is neither RSA nor Ed25519
+var ErrDKIMUnsupportedKey = fmt.Errorf("unsupported DKIM key type. Keys must be RSA or Ed25519")
+
+// ErrDKIMMissingFrom is returned when signing a message that has no From header
+var ErrDKIMMissingFrom = fmt.Errorf("cannot DKIM sign a message without a From header")
+
+// ErrDKIMNoSignature is returned when verifying a message that has no DKIM-Signature header
+var ErrDKIMNoSignature = fmt.Errorf("message has no DKIM signature")
+
+// ErrDKIMVerificationFailed is wrapped by every DKIM verification failure
+var ErrDKIMVerificationFailed = fmt.Errorf("DKIM verification failed")
+
+// ErrInvalidAddressSyntax is wrapped by every address syntax error
+var ErrInvalidAddressSyntax = fmt.Errorf("invalid email address")
+
+// ErrDomainDoesNotAcceptMail is returned when an address's domain has no MX or A/AAAA records
+var ErrDomainDoesNotAcceptMail = fmt.Errorf("domain does not accept mail")
+
+// ErrCaptureTimeout is returned when waiting for captured messages takes too long
+var ErrCaptureTimeout = fmt.Errorf("timed out waiting for messages")
+
+// ErrInboundMailMissing is returned when an inbound mail request does not contain a message
+var ErrInboundMailMissing = fmt.Errorf("no message found in request")
+
+// ErrInboundMailNoCallback is returned when an inbound mail handler is created without OnMail
+var ErrInboundMailNoCallback = fmt.Errorf("an OnMail callback is required")
@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+FileSystemQueueStore persists queued mail as one JSON file per message
+in a directory of a filesystem.FileSystem. When the file system cannot
+remove files, delivered mail is kept with a status of QueueStatusSent.
+*/
+type FileSystemQueueStore struct {
+	fs   filesystem.FileSystem
+	dir  string
+	lock sync.Mutex
+}
+
+/*
+NewFileSystemQueueStore creates a queue store that keeps its files in dir.
+The directory is created if it does not exist.
+*/
+func NewFileSystemQueueStore(fileSystem filesystem.FileSystem, dir string) (*FileSystemQueueStore, error) {
+	if err := fileSystem.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating queue directory '%s': %w", dir, err)
+	}
+
+	return &FileSystemQueueStore{
+		fs:  fileSystem,
+		dir: dir,
+	}, nil
+}
+
+func (s *FileSystemQueueStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	item, err := s.read(s.fileName(id))
+
+	if err != nil {
+		return err
+	}
+
+	if err = filesystem.Remove(s.fs, s.fileName(id)); err != nil {
+		if errors.Is(err, filesystem.ErrNotSupported) {
+			item.Status = QueueStatusSent
+			return s.write(item)
+		}
+
+		return fmt.Errorf("error removing queued mail '%s': %w", id, err)
+	}
+
+	return nil
+}
+
+func (s *FileSystemQueueStore) Get(id string) (*QueuedMail, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.read(s.fileName(id))
+}
+
+func (s *FileSystemQueueStore) List(status QueueStatus) ([]*QueuedMail, error) {
+	var (
+		err     error
+		entries []fs.DirEntry
+		item    *QueuedMail
+	)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if entries, err = s.fs.ReadDir(s.dir); err != nil {
+		return nil, fmt.Errorf("error reading queue directory '%s': %w", s.dir, err)
+	}
+
+	result := make([]*QueuedMail, 0, len(entries))
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		if item, err = s.read(filepath.Join(s.dir, filepath.Base(entry.Name()))); err != nil {
+			return nil, err
+		}
+
+		if item.Status == status {
+			result = append(result, item)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+
+	return result, nil
+}
+
+func (s *FileSystemQueueStore) Save(item *QueuedMail) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.write(item)
+}
+
+func (s *FileSystemQueueStore) fileName(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id)+".json")
+}
+
+func (s *FileSystemQueueStore) read(fileName string) (*QueuedMail, error) {
+	var (
+		err  error
+		data []byte
+	)
+
+	if data, err = s.fs.ReadFile(fileName); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrQueuedMailNotFound
+		}
+
+		return nil, fmt.Errorf("error reading queued mail '%s': %w", fileName, err)
+	}
+
+	result := &QueuedMail{}
+
+	if err = json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("error decoding queued mail '%s': %w", fileName, err)
+	}
+
+	return result, nil
+}
+
+func (s *FileSystemQueueStore) write(item *QueuedMail) error {
+	var (
+		err  error
+		data []byte
+	)
+
+	if data, err = json.Marshal(item); err != nil {
+		return fmt.Errorf("error encoding queued mail '%s': %w", item.ID, err)
+	}
+
+	if err = s.fs.WriteFile(s.fileName(item.ID), data, 0644); err != nil {
+		return fmt.Errorf("error writing queued mail '%s': %w", item.ID, err)
+	}
+
+	return nil
+}
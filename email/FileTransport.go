@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+	"github.com/app-nerds/kit/v6/rand"
+)
+
+/*
+FileTransportMode describes how a FileTransport lays out captured messages
+*/
+type FileTransportMode string
+
+const (
+	// FileTransportModeEML writes each message to its own .eml file
+	FileTransportModeEML FileTransportMode = "eml"
+
+	// FileTransportModeMaildir writes each message into the "tmp" folder of a Maildir, then moves it to "new"
+	FileTransportModeMaildir FileTransportMode = "maildir"
+
+	// FileTransportModeMbox appends every message to a single mbox file
+	FileTransportModeMbox FileTransportMode = "mbox"
+)
+
+/*
+FileTransport captures outgoing mail to a file system instead of
+delivering it. This is useful for development and tests. In EML and
+Maildir modes Path is a directory. In Mbox mode Path is the mbox file.
+*/
+type FileTransport struct {
+	FS   filesystem.FileSystem
+	Mode FileTransportMode
+	Path string
+
+	counter uint64
+	lock    sync.Mutex
+}
+
+/*
+NewFileTransport creates a transport that writes messages to path on
+the provided file system
+*/
+func NewFileTransport(fileSystem filesystem.FileSystem, path string, mode FileTransportMode) *FileTransport {
+	if mode == "" {
+		mode = FileTransportModeEML
+	}
+
+	return &FileTransport{
+		FS:   fileSystem,
+		Mode: mode,
+		Path: path,
+	}
+}
+
+/*
+Send writes a message to the file system
+*/
+func (t *FileTransport) Send(from string, to []string, msg io.WriterTo) error {
+	buffer := &bytes.Buffer{}
+
+	if _, err := msg.WriteTo(buffer); err != nil {
+		return fmt.Errorf("error rendering message: %w", err)
+	}
+
+	switch t.Mode {
+	case FileTransportModeMaildir:
+		return t.writeMaildir(buffer.Bytes())
+
+	case FileTransportModeMbox:
+		return t.writeMbox(from, buffer.Bytes())
+
+	default:
+		return t.writeEML(buffer.Bytes())
+	}
+}
+
+/*
+Close does nothing. Files are closed after each message is written.
+*/
+func (t *FileTransport) Close() error {
+	return nil
+}
+
+func (t *FileTransport) writeEML(data []byte) error {
+	if err := t.FS.MkdirAll(t.Path, 0755); err != nil {
+		return fmt.Errorf("error creating mail capture directory '%s': %w", t.Path, err)
+	}
+
+	fileName := filepath.Join(t.Path, t.uniqueName()+".eml")
+
+	if err := t.FS.WriteFile(fileName, data, 0644); err != nil {
+		return fmt.Errorf("error writing captured mail '%s': %w", fileName, err)
+	}
+
+	return nil
+}
+
+func (t *FileTransport) writeMaildir(data []byte) error {
+	for _, dir := range []string{"tmp", "new", "cur"} {
+		if err := t.FS.MkdirAll(filepath.Join(t.Path, dir), 0755); err != nil {
+			return fmt.Errorf("error creating maildir folder '%s': %w", dir, err)
+		}
+	}
+
+	name := t.uniqueName()
+	tmpName := filepath.Join(t.Path, "tmp", name)
+	fileName := filepath.Join(t.Path, "new", name)
+
+	// Readers only look in new, so the message is written to tmp and
+	// moved once it is complete. They never see half a message.
+	if err := t.writeSynced(tmpName, bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))); err != nil {
+		_ = filesystem.Remove(t.FS, tmpName)
+		return fmt.Errorf("error writing maildir message '%s': %w", tmpName, err)
+	}
+
+	if err := filesystem.Rename(t.FS, tmpName, fileName); err != nil {
+		_ = filesystem.Remove(t.FS, tmpName)
+		return fmt.Errorf("error delivering maildir message '%s': %w", fileName, err)
+	}
+
+	return nil
+}
+
+/*
+writeSynced writes a file and syncs it to stable storage before closing it
+*/
+func (t *FileTransport) writeSynced(name string, data []byte) error {
+	file, err := t.FS.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (t *FileTransport) writeMbox(from string, data []byte) error {
+	var (
+		err  error
+		file filesystem.WritableFile
+	)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if dir := filepath.Dir(t.Path); dir != "." {
+		if err = t.FS.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("error creating mbox directory '%s': %w", dir, err)
+		}
+	}
+
+	if file, err = t.FS.OpenFile(t.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+		return fmt.Errorf("error opening mbox '%s': %w", t.Path, err)
+	}
+
+	defer file.Close()
+
+	entry := &strings.Builder{}
+	entry.WriteString(fmt.Sprintf("From %s %s\n", from, time.Now().UTC().Format(time.ANSIC)))
+
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			line = ">" + line
+		}
+
+		entry.WriteString(line + "\n")
+	}
+
+	entry.WriteString("\n")
+
+	if _, err = file.WriteString(entry.String()); err != nil {
+		return fmt.Errorf("error writing to mbox '%s': %w", t.Path, err)
+	}
+
+	return nil
+}
+
+/*
+uniqueName returns a file name following the Maildir convention of
+time.unique.host, which is also safe to use for .eml files
+*/
+func (t *FileTransport) uniqueName() string {
+	host, _ := os.Hostname()
+	host = strings.NewReplacer("/", "\\057", ":", "\\072").Replace(host)
+	sequence := atomic.AddUint64(&t.counter, 1)
+
+	return fmt.Sprintf("%d.M%dP%dQ%d_%s.%s", time.Now().Unix(), time.Now().Nanosecond()/1000, os.Getpid(), sequence, rand.String(8), host)
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/email"
+	"github.com/app-nerds/kit/v6/filesystem/localfs"
+	"gopkg.in/gomail.v2"
+)
+
+func TestFileTransport_DeliversMaildirMessagesThroughTmp(t *testing.T) {
+	dir := t.TempDir()
+	transport := email.NewFileTransport(localfs.NewLocalFS(), dir, email.FileTransportModeMaildir)
+
+	message := gomail.NewMessage()
+	message.SetHeader("From", "adam@example.com")
+	message.SetHeader("To", "bob@example.com")
+	message.SetHeader("Subject", "Hello")
+	message.SetBody("text/plain", "Hello Bob")
+
+	if err := transport.Send("adam@example.com", []string{"bob@example.com"}, message); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	fsys := localfs.NewLocalFS()
+	delivered, _ := fsys.ReadDir(dir + "/new")
+	pending, _ := fsys.ReadDir(dir + "/tmp")
+
+	if len(delivered) != 1 || len(pending) != 0 {
+		t.Fatalf("expected 1 message in new and none left in tmp but got %d and %d", len(delivered), len(pending))
+	}
+
+	data, err := fsys.ReadFile(dir + "/new/" + delivered[0].Name())
+
+	if err != nil || !strings.Contains(string(data), "Subject: Hello") || strings.Contains(string(data), "\r\n") {
+		t.Errorf("expected the message with LF line endings but got %q, %v", data, err)
+	}
+}
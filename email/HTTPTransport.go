@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/app-nerds/kit/v6/restclient"
+)
+
+/*
+HTTPTransportRequestBuilder turns a rendered message into an HTTP request
+for a mail provider's API
+*/
+type HTTPTransportRequestBuilder func(url, from string, to []string, message []byte) (*http.Request, error)
+
+/*
+HTTPTransportConfig configures an HTTP API transport. URL is the endpoint
+messages are posted to. Headers are added to every request, which is where
+API keys usually go. BuildRequest is optional, and lets you shape the
+request for a specific provider. By default the message is posted as JSON
+in the form of {"from": "", "to": [], "message": "<raw MIME>"}.
+*/
+type HTTPTransportConfig struct {
+	BuildRequest HTTPTransportRequestBuilder
+	HTTPClient   restclient.HTTPClientInterface
+	Headers      map[string]string
+	URL          string
+}
+
+/*
+HTTPTransport delivers mail by posting it to an HTTP API. Any response
+status outside of the 2xx range is treated as an error.
+*/
+type HTTPTransport struct {
+	buildRequest HTTPTransportRequestBuilder
+	httpClient   restclient.HTTPClientInterface
+	headers      map[string]string
+	url          string
+}
+
+/*
+HTTPTransportPayload is the JSON body sent by the default request builder
+*/
+type HTTPTransportPayload struct {
+	From    string   `json:"from"`
+	To      []string `json:"to"`
+	Message string   `json:"message"`
+}
+
+/*
+HTTPTransportError is returned when the API responds with a non-2xx status
+*/
+type HTTPTransportError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPTransportError) Error() string {
+	return fmt.Sprintf("mail API returned status %d: %s", e.StatusCode, e.Body)
+}
+
+/*
+NewHTTPTransport creates a new HTTP API transport
+*/
+func NewHTTPTransport(config HTTPTransportConfig) *HTTPTransport {
+	result := &HTTPTransport{
+		buildRequest: config.BuildRequest,
+		httpClient:   config.HTTPClient,
+		headers:      config.Headers,
+		url:          config.URL,
+	}
+
+	if result.buildRequest == nil {
+		result.buildRequest = DefaultHTTPTransportRequestBuilder
+	}
+
+	if result.httpClient == nil {
+		result.httpClient = &restclient.HTTPClient{
+			Client: &http.Client{Timeout: 30 * time.Second},
+		}
+	}
+
+	return result
+}
+
+/*
+DefaultHTTPTransportRequestBuilder builds a JSON POST request containing
+the sender, recipients, and raw message
+*/
+func DefaultHTTPTransportRequestBuilder(url, from string, to []string, message []byte) (*http.Request, error) {
+	var (
+		err     error
+		body    []byte
+		request *http.Request
+	)
+
+	payload := HTTPTransportPayload{
+		From:    from,
+		To:      to,
+		Message: string(message),
+	}
+
+	if body, err = json.Marshal(payload); err != nil {
+		return nil, fmt.Errorf("error marshaling mail payload: %w", err)
+	}
+
+	if request, err = http.NewRequest(http.MethodPost, url, bytes.NewReader(body)); err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	return request, nil
+}
+
+/*
+Send posts a message to the configured API
+*/
+func (t *HTTPTransport) Send(from string, to []string, msg io.WriterTo) error {
+	var (
+		err      error
+		request  *http.Request
+		response *http.Response
+	)
+
+	buffer := &bytes.Buffer{}
+
+	if _, err = msg.WriteTo(buffer); err != nil {
+		return fmt.Errorf("error rendering message: %w", err)
+	}
+
+	if request, err = t.buildRequest(t.url, from, to, buffer.Bytes()); err != nil {
+		return fmt.Errorf("error building mail API request: %w", err)
+	}
+
+	for key, value := range t.headers {
+		request.Header.Set(key, value)
+	}
+
+	if response, err = t.httpClient.Do(request); err != nil {
+		return fmt.Errorf("error calling mail API: %w", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+
+		return &HTTPTransportError{
+			StatusCode: response.StatusCode,
+			Body:       string(bytes.TrimSpace(body)),
+		}
+	}
+
+	_, _ = io.Copy(io.Discard, response.Body)
+	return nil
+}
+
+/*
+Close does nothing. HTTP connections are managed by the HTTP client.
+*/
+func (t *HTTPTransport) Close() error {
+	return nil
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/email"
+)
+
+func TestHTTPTransport_Send(t *testing.T) {
+	var (
+		gotPayload email.HTTPTransportPayload
+		gotAPIKey  string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAPIKey = r.Header.Get("X-API-Key")
+
+		if err := json.NewDecoder(r.Body).Decode(&gotPayload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	defer server.Close()
+
+	transport := email.NewHTTPTransport(email.HTTPTransportConfig{
+		Headers: map[string]string{"X-API-Key": "secret"},
+		URL:     server.URL,
+	})
+
+	service := email.NewMailServiceWithTransport(transport)
+
+	err := service.Send(email.Mail{
+		Body:    "<p>Hello</p>",
+		From:    email.Person{Name: "Adam", EmailAddress: "adam@example.com"},
+		Subject: "Greetings",
+		To: []email.Person{
+			{Name: "Bob", EmailAddress: "bob@example.com"},
+			{Name: "Carol", EmailAddress: "carol@example.com"},
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if gotAPIKey != "secret" {
+		t.Errorf("expected API key header 'secret' but got '%s'", gotAPIKey)
+	}
+
+	if gotPayload.From != "adam@example.com" {
+		t.Errorf("expected from 'adam@example.com' but got '%s'", gotPayload.From)
+	}
+
+	if len(gotPayload.To) != 2 || gotPayload.To[0] != "bob@example.com" || gotPayload.To[1] != "carol@example.com" {
+		t.Errorf("expected both recipients but got %v", gotPayload.To)
+	}
+
+	if !strings.Contains(gotPayload.Message, "Subject: Greetings") {
+		t.Errorf("expected raw message to contain the subject but got:\n%s", gotPayload.Message)
+	}
+}
+
+func TestHTTPTransport_SendReturnsErrorOnFailureStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte("bad key"))
+	}))
+
+	defer server.Close()
+
+	service := email.NewMailServiceWithTransport(email.NewHTTPTransport(email.HTTPTransportConfig{
+		URL: server.URL,
+	}))
+
+	err := service.Send(email.Mail{
+		Body:    "test",
+		From:    email.Person{EmailAddress: "adam@example.com"},
+		Subject: "test",
+		To:      []email.Person{{EmailAddress: "bob@example.com"}},
+	})
+
+	var apiErr *email.HTTPTransportError
+
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an HTTPTransportError but got %v", err)
+	}
+
+	if apiErr.StatusCode != http.StatusUnauthorized || apiErr.Body != "bad key" {
+		t.Errorf("expected 401 'bad key' but got %d '%s'", apiErr.StatusCode, apiErr.Body)
+	}
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"io"
+	"mime"
+	"net/http"
+)
+
+/*
+InboundMailHandlerConfig configures an inbound mail webhook.
+
+  - OnMail is called with each parsed message. Returning an error responds with a 500 so the sender retries. Required
+  - Authorize, when provided, must return true for the request to be accepted. Use it to check a shared secret or signature
+  - MaxBytes limits the size of a posted message. Defaults to 25MB
+  - FormFields are the multipart/form-data fields checked for a raw message. Defaults to "email", "message", and "mime"
+*/
+type InboundMailHandlerConfig struct {
+	Authorize  func(r *http.Request) bool
+	FormFields []string
+	MaxBytes   int64
+	OnMail     func(mail *ReceivedMail) error
+}
+
+/*
+InboundMailHandler is an http.Handler that accepts raw RFC 5322/MIME
+messages, parses them, and hands them to a callback. The message may be
+posted as the request body (message/rfc822, text/plain, or
+application/octet-stream), or as a field of a multipart/form-data
+or URL encoded form, which is how several mail providers deliver
+inbound mail.
+*/
+type InboundMailHandler struct {
+	authorize  func(r *http.Request) bool
+	formFields []string
+	maxBytes   int64
+	onMail     func(mail *ReceivedMail) error
+}
+
+/*
+NewInboundMailHandler creates a new inbound mail webhook handler.
+ErrInboundMailNoCallback is returned when OnMail is not provided.
+*/
+func NewInboundMailHandler(config InboundMailHandlerConfig) (*InboundMailHandler, error) {
+	if config.OnMail == nil {
+		return nil, ErrInboundMailNoCallback
+	}
+
+	result := &InboundMailHandler{
+		authorize:  config.Authorize,
+		formFields: config.FormFields,
+		maxBytes:   config.MaxBytes,
+		onMail:     config.OnMail,
+	}
+
+	if len(result.formFields) == 0 {
+		result.formFields = []string{"email", "message", "mime"}
+	}
+
+	if result.maxBytes <= 0 {
+		result.maxBytes = 25 * 1024 * 1024
+	}
+
+	return result, nil
+}
+
+func (h *InboundMailHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		raw    []byte
+		parsed *ReceivedMail
+	)
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.authorize != nil && !h.authorize(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body := &countingReadCloser{ReadCloser: http.MaxBytesReader(w, r.Body, h.maxBytes)}
+	r.Body = body
+
+	if raw, err = h.readMessage(r); err != nil {
+		if body.count >= h.maxBytes {
+			http.Error(w, "message too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if parsed, err = ParseMessage(raw); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = h.onMail(parsed); err != nil {
+		http.Error(w, "error processing message", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *InboundMailHandler) readMessage(r *http.Request) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(h.maxBytes); err != nil {
+			return nil, err
+		}
+
+		return h.readFormField(r)
+
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+
+		return h.readFormField(r)
+	}
+
+	raw, err := io.ReadAll(r.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) == 0 {
+		return nil, ErrInboundMailMissing
+	}
+
+	return raw, nil
+}
+
+func (h *InboundMailHandler) readFormField(r *http.Request) ([]byte, error) {
+	for _, field := range h.formFields {
+		if value := r.FormValue(field); value != "" {
+			return []byte(value), nil
+		}
+
+		if r.MultipartForm == nil || len(r.MultipartForm.File[field]) == 0 {
+			continue
+		}
+
+		file, err := r.MultipartForm.File[field][0].Open()
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer file.Close()
+		return io.ReadAll(file)
+	}
+
+	return nil, ErrInboundMailMissing
+}
+
+/*
+countingReadCloser counts the bytes read through it. When reading fails
+after MaxBytes have been read, the body was too large.
+*/
+type countingReadCloser struct {
+	io.ReadCloser
+	count int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.count += int64(n)
+
+	return n, err
+}
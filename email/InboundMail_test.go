@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email_test
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/email"
+)
+
+const inboundReply = "From: =?ISO-8859-1?Q?Andr=E9?= <andre@example.com>\r\n" +
+	"To: support@example.com\r\n" +
+	"Subject: =?UTF-8?B?UmU6IFRpY2tldCAjNDI=?=\r\n" +
+	"Message-ID: <reply-1@example.com>\r\n" +
+	"In-Reply-To: <ticket-42@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Voil=E0, the logs are attached.\r\n" +
+	"\r\n" +
+	"On Tue, Mar 7, 2023 at 10:00 AM Support <support@example.com> wrote:\r\n" +
+	"> Can you send us your logs?\r\n" +
+	"> Thanks\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>Voilà, the logs are attached.</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain; name=\"app.log\"\r\n" +
+	"Content-Disposition: attachment; filename=\"app.log\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"ZXJyb3I6IHNv\r\n" +
+	"bWV0aGluZyBicm9rZQ==\r\n" +
+	"--outer--\r\n"
+
+func TestParseMessage_Inbound(t *testing.T) {
+	got, err := email.ParseMessage([]byte(inboundReply))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.From.Name != "André" || got.From.EmailAddress != "andre@example.com" {
+		t.Errorf("expected encoded-word sender name to be decoded but got %+v", got.From)
+	}
+
+	if got.Subject != "Re: Ticket #42" {
+		t.Errorf("expected subject 'Re: Ticket #42' but got '%s'", got.Subject)
+	}
+
+	if got.InReplyTo != "<ticket-42@example.com>" {
+		t.Errorf("expected In-Reply-To to be captured but got '%s'", got.InReplyTo)
+	}
+
+	if !strings.HasPrefix(got.TextBody, "Voilà, the logs are attached.") {
+		t.Errorf("expected ISO-8859-1 text body to be converted to UTF-8 but got '%s'", got.TextBody)
+	}
+
+	if got.ReplyText != "Voilà, the logs are attached." {
+		t.Errorf("expected quoted reply to be stripped but got '%s'", got.ReplyText)
+	}
+
+	if strings.TrimSpace(got.HTMLBody) != "<p>Voilà, the logs are attached.</p>" {
+		t.Errorf("expected HTML body but got '%s'", got.HTMLBody)
+	}
+
+	if len(got.Attachments) != 1 || got.Attachments[0].FileName != "app.log" || string(got.Attachments[0].Data) != "error: something broke" {
+		t.Errorf("expected app.log attachment but got %+v", got.Attachments)
+	}
+}
+
+func TestStripQuotedReply(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "Gmail style",
+			text: "Sounds good.\n\nOn Mon, Jan 2, 2023 at 3:04 PM Adam <adam@example.com>\nwrote:\n> Lunch?\n",
+			want: "Sounds good.",
+		},
+		{
+			name: "Outlook style",
+			text: "Approved.\n\n________________________________\nFrom: Adam\nSent: Monday\nSubject: Budget\n\nPlease approve",
+			want: "Approved.",
+		},
+		{
+			name: "Signature",
+			text: "Thanks!\n-- \nAdam\nCEO",
+			want: "Thanks!",
+		},
+		{
+			name: "Inline reply keeps answers",
+			text: "> Question one?\nAnswer one.\n> Question two?\nAnswer two.",
+			want: "Answer one.\nAnswer two.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := email.StripQuotedReply(tt.text); got != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestInboundMailHandler(t *testing.T) {
+	var received *email.ReceivedMail
+
+	handler, err := email.NewInboundMailHandler(email.InboundMailHandlerConfig{
+		Authorize: func(r *http.Request) bool {
+			return r.Header.Get("X-Webhook-Secret") == "shh"
+		},
+		OnMail: func(mail *email.ReceivedMail) error {
+			received = mail
+			return nil
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error creating handler: %v", err)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/inbound", strings.NewReader(inboundReply))
+	request.Header.Set("Content-Type", "message/rfc822")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the secret but got %d", recorder.Code)
+	}
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	_ = form.WriteField("email", inboundReply)
+	_ = form.Close()
+
+	request = httptest.NewRequest(http.MethodPost, "/inbound", body)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	request.Header.Set("X-Webhook-Secret", "shh")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 but got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	if received == nil || received.Subject != "Re: Ticket #42" {
+		t.Errorf("expected the callback to receive the parsed message but got %+v", received)
+	}
+}
+
+func TestInboundMailHandler_RejectsLargeMessages(t *testing.T) {
+	handler, err := email.NewInboundMailHandler(email.InboundMailHandlerConfig{
+		MaxBytes: 64,
+		OnMail: func(mail *email.ReceivedMail) error {
+			return nil
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error creating handler: %v", err)
+	}
+
+	for _, contentType := range []string{"message/rfc822", "multipart/form-data; boundary=x"} {
+		request := httptest.NewRequest(http.MethodPost, "/inbound", strings.NewReader(inboundReply))
+		request.Header.Set("Content-Type", contentType)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected 413 for %s but got %d", contentType, recorder.Code)
+		}
+	}
+}
+
+func TestNewInboundMailHandler_RequiresOnMail(t *testing.T) {
+	if _, err := email.NewInboundMailHandler(email.InboundMailHandlerConfig{}); !errors.Is(err, email.ErrInboundMailNoCallback) {
+		t.Errorf("expected ErrInboundMailNoCallback but got %v", err)
+	}
+}
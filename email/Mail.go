@@ -13,3 +13,16 @@ type Mail struct {
 	Subject string
 	To      []Person
 }
+
+/*
+recipients returns the email addresses of everyone the mail is addressed to
+*/
+func (m Mail) recipients() []string {
+	result := make([]string, 0, len(m.To))
+
+	for _, p := range m.To {
+		result = append(result, p.EmailAddress)
+	}
+
+	return result
+}
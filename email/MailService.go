@@ -5,6 +5,9 @@
 package email
 
 import (
+	"fmt"
+	"io"
+
 	"gopkg.in/gomail.v2"
 )
 
@@ -17,12 +20,17 @@ type IMailService interface {
 }
 
 /*
-MailService provides methods for working with email
+MailService provides methods for working with email. When Transport is set
+messages are delivered through it. Otherwise Connect dials the SMTP server
+described by Config and messages are sent through that connection. When
+DKIM is set every message is signed before it is sent.
 */
 type MailService struct {
-	Config *Config
-	Dialer *gomail.Dialer
-	Sender gomail.SendCloser
+	Config    *Config
+	DKIM      *DKIMSigner
+	Dialer    *gomail.Dialer
+	Sender    gomail.SendCloser
+	Transport Transport
 }
 
 /*
@@ -49,33 +57,82 @@ func NewMailService(config *Config) *MailService {
 }
 
 /*
-Connect establishes a connections to an SMTP server
+NewMailServiceWithTransport creates a new instance of MailService that
+delivers mail through the provided transport
 */
-func (s MailService) Connect() error {
+func NewMailServiceWithTransport(transport Transport) *MailService {
+	return &MailService{
+		Transport: transport,
+	}
+}
+
+/*
+Connect establishes a connections to an SMTP server. When a Transport
+is configured this does nothing, as transports manage their own connections.
+*/
+func (s *MailService) Connect() error {
 	var err error
 
+	if s.Transport != nil {
+		return nil
+	}
+
 	s.Sender, err = s.Dialer.Dial()
 	return err
 }
 
+/*
+Close closes the transport or SMTP connection
+*/
+func (s *MailService) Close() error {
+	if s.Transport != nil {
+		return s.Transport.Close()
+	}
+
+	if s.Sender != nil {
+		return s.Sender.Close()
+	}
+
+	return nil
+}
+
 /*
 Send sends an email
 */
-func (s MailService) Send(mail ...Mail) error {
-	mailItems := make([]*gomail.Message, len(mail))
+func (s *MailService) Send(mail ...Mail) error {
+	var sender gomail.Sender = s.Sender
+
+	if s.Transport != nil {
+		sender = s.Transport
+	}
 
 	for index := 0; index < len(mail); index++ {
-		m := gomail.NewMessage()
-		m.SetAddressHeader("From", mail[index].From.EmailAddress, mail[index].From.Name)
-		m.SetHeader("Subject", mail[index].Subject)
-		m.SetBody("text/html", mail[index].Body)
+		var msg io.WriterTo = buildMessage(mail[index])
+
+		if s.DKIM != nil {
+			msg = s.DKIM.wrap(msg)
+		}
 
-		for _, p := range mail[index].To {
-			m.SetAddressHeader("To", p.EmailAddress, p.Name)
+		if err := sender.Send(mail[index].From.EmailAddress, mail[index].recipients(), msg); err != nil {
+			return fmt.Errorf("could not send email %d: %w", index+1, err)
 		}
+	}
+
+	return nil
+}
+
+func buildMessage(mail Mail) *gomail.Message {
+	m := gomail.NewMessage()
+	m.SetAddressHeader("From", mail.From.EmailAddress, mail.From.Name)
+	m.SetHeader("Subject", mail.Subject)
+	m.SetBody("text/html", mail.Body)
+
+	to := make([]string, 0, len(mail.To))
 
-		mailItems[index] = m
+	for _, p := range mail.To {
+		to = append(to, m.FormatAddress(p.EmailAddress, p.Name))
 	}
 
-	return gomail.Send(s.Sender, mailItems...)
+	m.SetHeader("To", to...)
+	return m
 }
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"sort"
+	"sync"
+)
+
+/*
+MemoryQueueStore keeps queued mail in memory. Mail does not survive a
+restart, so this is mostly useful for tests and development.
+*/
+type MemoryQueueStore struct {
+	lock  sync.RWMutex
+	items map[string]QueuedMail
+}
+
+/*
+NewMemoryQueueStore creates a new, empty in-memory queue store
+*/
+func NewMemoryQueueStore() *MemoryQueueStore {
+	return &MemoryQueueStore{
+		items: map[string]QueuedMail{},
+	}
+}
+
+func (s *MemoryQueueStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.items[id]; !ok {
+		return ErrQueuedMailNotFound
+	}
+
+	delete(s.items, id)
+	return nil
+}
+
+func (s *MemoryQueueStore) Get(id string) (*QueuedMail, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	item, ok := s.items[id]
+
+	if !ok {
+		return nil, ErrQueuedMailNotFound
+	}
+
+	return &item, nil
+}
+
+func (s *MemoryQueueStore) List(status QueueStatus) ([]*QueuedMail, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	result := make([]*QueuedMail, 0, len(s.items))
+
+	for _, item := range s.items {
+		if item.Status == status {
+			copied := item
+			result = append(result, &copied)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+
+	return result, nil
+}
+
+func (s *MemoryQueueStore) Save(item *QueuedMail) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.items[item.ID] = *item
+	return nil
+}
@@ -0,0 +1,242 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+/*
+ParseMessage parses a raw RFC 5322/MIME message. Multipart messages are
+walked recursively, and every leaf part is decoded from its transfer
+encoding. Text bodies are converted to UTF-8 from their declared charset.
+Encoded-word headers, such as subjects and names, are decoded. ReplyText
+is filled in with the text body minus any quoted reply.
+*/
+func ParseMessage(raw []byte) (*ReceivedMail, error) {
+	var (
+		err     error
+		message *mail.Message
+	)
+
+	if message, err = mail.ReadMessage(bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("error reading message: %w", err)
+	}
+
+	headers := textproto.MIMEHeader(message.Header)
+	wordDecoder := newWordDecoder()
+
+	result := &ReceivedMail{
+		Attachments: []Attachment{},
+		Headers:     headers,
+		InReplyTo:   strings.TrimSpace(headers.Get("In-Reply-To")),
+		MessageID:   strings.TrimSpace(headers.Get("Message-ID")),
+		Parts:       []MessagePart{},
+		Raw:         raw,
+		References:  strings.Fields(headers.Get("References")),
+	}
+
+	if result.Subject, err = wordDecoder.DecodeHeader(headers.Get("Subject")); err != nil {
+		result.Subject = headers.Get("Subject")
+	}
+
+	if date, dateErr := message.Header.Date(); dateErr == nil {
+		result.Date = date
+	}
+
+	if from := parseAddressHeader(headers.Get("From")); len(from) > 0 {
+		result.From = from[0]
+	}
+
+	result.To = parseAddressHeader(headers.Get("To"))
+	result.Cc = parseAddressHeader(headers.Get("Cc"))
+	result.ReplyTo = parseAddressHeader(headers.Get("Reply-To"))
+
+	if err = parseMessagePart(result, headers, message.Body); err != nil {
+		return result, err
+	}
+
+	result.ReplyText = StripQuotedReply(result.TextBody)
+	return result, nil
+}
+
+func parseMessagePart(result *ReceivedMail, headers textproto.MIMEHeader, body io.Reader) error {
+	var (
+		err       error
+		mediaType string
+		params    map[string]string
+		part      *multipart.Part
+	)
+
+	contentType := headers.Get("Content-Type")
+
+	if contentType == "" {
+		contentType = "text/plain; charset=us-ascii"
+	}
+
+	if mediaType, params, err = mime.ParseMediaType(contentType); err != nil {
+		mediaType = "application/octet-stream"
+		params = map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+		reader := multipart.NewReader(body, params["boundary"])
+
+		for {
+			if part, err = reader.NextRawPart(); err == io.EOF {
+				return nil
+			}
+
+			if err != nil {
+				return fmt.Errorf("error reading multipart section: %w", err)
+			}
+
+			if err = parseMessagePart(result, part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+
+	decoded, err := io.ReadAll(decodeTransferEncoding(body, headers.Get("Content-Transfer-Encoding")))
+
+	if err != nil {
+		return fmt.Errorf("error decoding message part: %w", err)
+	}
+
+	result.Parts = append(result.Parts, MessagePart{
+		Body:        decoded,
+		ContentType: mediaType,
+		Headers:     headers,
+	})
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(headers.Get("Content-Disposition"))
+	fileName := decodeHeaderValue(dispositionParams["filename"])
+
+	if fileName == "" {
+		fileName = decodeHeaderValue(params["name"])
+	}
+
+	isAttachment := disposition == "attachment" || fileName != "" || (headers.Get("Content-ID") != "" && !strings.HasPrefix(mediaType, "text/"))
+
+	if !isAttachment && mediaType == "text/plain" && result.TextBody == "" {
+		result.TextBody = decodeCharset(decoded, params["charset"])
+		return nil
+	}
+
+	if !isAttachment && mediaType == "text/html" && result.HTMLBody == "" {
+		result.HTMLBody = decodeCharset(decoded, params["charset"])
+		return nil
+	}
+
+	if !isAttachment && strings.HasPrefix(mediaType, "text/") {
+		return nil
+	}
+
+	result.Attachments = append(result.Attachments, Attachment{
+		ContentID:   strings.Trim(headers.Get("Content-ID"), "<> "),
+		ContentType: mediaType,
+		Data:        decoded,
+		FileName:    fileName,
+		Inline:      disposition == "inline",
+		Size:        len(decoded),
+	})
+
+	return nil
+}
+
+func decodeTransferEncoding(body io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &base64Cleaner{reader: bufio.NewReader(body)})
+
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+
+	return body
+}
+
+/*
+base64Cleaner strips line breaks and other whitespace from base64 data,
+which the standard decoder does not tolerate in every position
+*/
+type base64Cleaner struct {
+	reader *bufio.Reader
+}
+
+func (c *base64Cleaner) Read(p []byte) (int, error) {
+	n := 0
+
+	for n < len(p) {
+		b, err := c.reader.ReadByte()
+
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+
+			return 0, err
+		}
+
+		if b == '\r' || b == '\n' || b == ' ' || b == '\t' {
+			continue
+		}
+
+		p[n] = b
+		n++
+	}
+
+	return n, nil
+}
+
+func newWordDecoder() *mime.WordDecoder {
+	return &mime.WordDecoder{
+		CharsetReader: charsetReader,
+	}
+}
+
+func decodeHeaderValue(value string) string {
+	decoded, err := newWordDecoder().DecodeHeader(value)
+
+	if err != nil {
+		return value
+	}
+
+	return decoded
+}
+
+func parseAddressHeader(value string) []Person {
+	result := []Person{}
+
+	if strings.TrimSpace(value) == "" {
+		return result
+	}
+
+	parser := &mail.AddressParser{WordDecoder: newWordDecoder()}
+	addresses, err := parser.ParseList(value)
+
+	if err != nil {
+		return result
+	}
+
+	for _, address := range addresses {
+		result = append(result, Person{
+			Name:         address.Name,
+			EmailAddress: address.Address,
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"errors"
+	"net/http"
+	"net/textproto"
+)
+
+/*
+PermanentError marks a delivery error as one that will not succeed
+on retry, such as a rejected recipient. Transports and services can wrap
+errors in a PermanentError to have the mail queue dead-letter a message
+immediately.
+*/
+type PermanentError struct {
+	Err error
+}
+
+/*
+NewPermanentError wraps err in a PermanentError
+*/
+func NewPermanentError(err error) error {
+	return &PermanentError{Err: err}
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+/*
+IsPermanentDeliveryError reports whether err should not be retried. This
+is true for a PermanentError, SMTP 5xx replies, and HTTP API 4xx responses
+other than 408 (timeout) and 429 (too many requests).
+*/
+func IsPermanentDeliveryError(err error) bool {
+	var (
+		permanentErr *PermanentError
+		smtpErr      *textproto.Error
+		httpErr      *HTTPTransportError
+	)
+
+	if errors.As(err, &permanentErr) {
+		return true
+	}
+
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code >= 500 && smtpErr.Code < 600
+	}
+
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 400 &&
+			httpErr.StatusCode < 500 &&
+			httpErr.StatusCode != http.StatusRequestTimeout &&
+			httpErr.StatusCode != http.StatusTooManyRequests
+	}
+
+	return false
+}
@@ -0,0 +1,481 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/app-nerds/kit/v6/workerpool2"
+	"go.uber.org/ratelimit"
+)
+
+/*
+QueueConfig configures an outbound mail queue.
+
+  - Service delivers the mail. Use a MailService with a Transport, such as SMTPTransport, so dropped connections are re-established
+  - Store persists queued mail. Required
+  - MaxWorkers is the number of concurrent deliveries. Defaults to 4
+  - MaxAttempts is the number of delivery attempts before mail is dead-lettered. Defaults to 5
+  - InitialBackoff is the wait after the first failure. Each further failure doubles it, up to MaxBackoff. Defaults to 30 seconds and 1 hour
+  - PollInterval is how often the store is checked for mail that is due. Defaults to 5 seconds
+  - DomainRateLimit caps deliveries per second to each recipient domain. Zero means unlimited
+  - IsPermanentError decides which errors are dead-lettered immediately. Defaults to IsPermanentDeliveryError
+  - EventChan receives DeliveryEvents. This is optional, but when provided it must be drained or deliveries will block
+*/
+type QueueConfig struct {
+	DomainRateLimit  int
+	EventChan        chan DeliveryEvent
+	InitialBackoff   time.Duration
+	IsPermanentError func(err error) bool
+	MaxAttempts      int
+	MaxBackoff       time.Duration
+	MaxWorkers       int
+	PollInterval     time.Duration
+	Service          IMailService
+	Store            QueueStore
+}
+
+/*
+A Queue durably stores outbound mail and delivers it in the background.
+Failed deliveries are retried with exponential backoff. Mail that fails
+permanently, or runs out of attempts, is dead-lettered and kept in the
+store for inspection or requeueing.
+*/
+type Queue struct {
+	domainRateLimit  int
+	eventChan        chan DeliveryEvent
+	initialBackoff   time.Duration
+	isPermanentError func(err error) bool
+	maxAttempts      int
+	maxBackoff       time.Duration
+	maxWorkers       int
+	pollInterval     time.Duration
+	service          IMailService
+	store            QueueStore
+
+	limiterLock sync.Mutex
+	limiters    map[string]ratelimit.Limiter
+	now         func() time.Time
+	unsaved     map[string]*queueStoreError
+	unsavedLock sync.Mutex
+	wake        chan struct{}
+}
+
+/*
+queueStoreError is returned by a delivery job when the outcome of a
+delivery could not be written to the store. The item is kept so the
+write can be tried again.
+*/
+type queueStoreError struct {
+	delivered bool
+	err       error
+	item      *QueuedMail
+}
+
+func (e *queueStoreError) Error() string {
+	if e.delivered {
+		return fmt.Sprintf("error removing delivered mail '%s': %s", e.item.ID, e.err.Error())
+	}
+
+	return fmt.Sprintf("error saving failed mail '%s': %s", e.item.ID, e.err.Error())
+}
+
+func (e *queueStoreError) Unwrap() error {
+	return e.err
+}
+
+/*
+NewQueue creates a new outbound mail queue. Call Run to start delivering.
+*/
+func NewQueue(config QueueConfig) *Queue {
+	result := &Queue{
+		domainRateLimit:  config.DomainRateLimit,
+		eventChan:        config.EventChan,
+		initialBackoff:   config.InitialBackoff,
+		isPermanentError: config.IsPermanentError,
+		maxAttempts:      config.MaxAttempts,
+		maxBackoff:       config.MaxBackoff,
+		maxWorkers:       config.MaxWorkers,
+		pollInterval:     config.PollInterval,
+		service:          config.Service,
+		store:            config.Store,
+
+		limiters: map[string]ratelimit.Limiter{},
+		now:      func() time.Time { return time.Now().UTC() },
+		unsaved:  map[string]*queueStoreError{},
+		wake:     make(chan struct{}, 1),
+	}
+
+	if result.initialBackoff <= 0 {
+		result.initialBackoff = 30 * time.Second
+	}
+
+	if result.isPermanentError == nil {
+		result.isPermanentError = IsPermanentDeliveryError
+	}
+
+	if result.maxAttempts < 1 {
+		result.maxAttempts = 5
+	}
+
+	if result.maxBackoff <= 0 {
+		result.maxBackoff = time.Hour
+	}
+
+	if result.maxWorkers < 1 {
+		result.maxWorkers = 4
+	}
+
+	if result.pollInterval <= 0 {
+		result.pollInterval = 5 * time.Second
+	}
+
+	return result
+}
+
+/*
+Enqueue persists mail for delivery and returns the ID of each queued item
+*/
+func (q *Queue) Enqueue(mail ...Mail) ([]string, error) {
+	result := make([]string, 0, len(mail))
+	now := q.now()
+
+	for _, m := range mail {
+		item := &QueuedMail{
+			ID:          newQueuedMailID(),
+			CreatedAt:   now,
+			Mail:        m,
+			NextAttempt: now,
+			Status:      QueueStatusPending,
+			UpdatedAt:   now,
+		}
+
+		if err := q.store.Save(item); err != nil {
+			return result, fmt.Errorf("error queueing mail: %w", err)
+		}
+
+		result = append(result, item.ID)
+		q.emit(DeliveryEvent{ID: item.ID, Time: now, Type: DeliveryEventQueued})
+	}
+
+	q.signal()
+	return result, nil
+}
+
+/*
+DeadLetters returns all mail that has been dead-lettered
+*/
+func (q *Queue) DeadLetters() ([]*QueuedMail, error) {
+	return q.store.List(QueueStatusDead)
+}
+
+/*
+Requeue moves a dead-lettered mail back into the queue with
+its attempts reset. Only dead-lettered mail can be requeued. Anything
+else returns ErrQueuedMailNotDead, since it may be sent, or being sent,
+already.
+*/
+func (q *Queue) Requeue(id string) error {
+	item, err := q.store.Get(id)
+
+	if err != nil {
+		return err
+	}
+
+	if item.Status != QueueStatusDead {
+		return fmt.Errorf("%w: mail '%s' is %s", ErrQueuedMailNotDead, id, item.Status)
+	}
+
+	item.Attempts = 0
+	item.LastError = ""
+	item.NextAttempt = q.now()
+	item.Status = QueueStatusPending
+	item.UpdatedAt = q.now()
+
+	if err = q.store.Save(item); err != nil {
+		return fmt.Errorf("error requeueing mail '%s': %w", id, err)
+	}
+
+	q.signal()
+	return nil
+}
+
+/*
+Run delivers queued mail until the context is cancelled. Mail left in
+the sending state by a previous, interrupted run is picked up again.
+Run waits for in-flight deliveries to finish before returning.
+
+When the store fails while recording the outcome of a delivery, a
+DeliveryEventStoreError is emitted and the write is tried again on each
+poll until it succeeds.
+*/
+func (q *Queue) Run(ctx context.Context) error {
+	if err := q.recoverInterrupted(); err != nil {
+		return err
+	}
+
+	errorChan := make(chan error)
+	errorsHandled := make(chan struct{})
+
+	pool := workerpool2.NewPool(workerpool2.PoolConfig{
+		ErrorChan:  errorChan,
+		MaxWorkers: q.maxWorkers,
+	})
+
+	go func() {
+		for err := range errorChan {
+			q.handleJobError(err)
+		}
+
+		close(errorsHandled)
+	}()
+
+	pool.Start()
+
+	stop := func() {
+		pool.Wait()
+		pool.Shutdown()
+		close(errorChan)
+		<-errorsHandled
+	}
+
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := q.dispatch(ctx, pool); err != nil {
+			stop()
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			stop()
+			return nil
+
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+/*
+dispatch hands every pending mail that is due to the worker pool
+*/
+func (q *Queue) dispatch(ctx context.Context, pool workerpool2.PoolOrchestrator) error {
+	var (
+		err   error
+		items []*QueuedMail
+	)
+
+	q.retryUnsaved()
+
+	if items, err = q.store.List(QueueStatusPending); err != nil {
+		return fmt.Errorf("error reading pending mail: %w", err)
+	}
+
+	now := q.now()
+
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if item.NextAttempt.After(now) {
+			continue
+		}
+
+		item.Status = QueueStatusSending
+		item.UpdatedAt = now
+
+		if err = q.store.Save(item); err != nil {
+			return fmt.Errorf("error marking mail '%s' as sending: %w", item.ID, err)
+		}
+
+		pool.QueueJob(q.deliveryJob(item))
+	}
+
+	return nil
+}
+
+func (q *Queue) deliveryJob(item *QueuedMail) workerpool2.WorkerFunc {
+	return func() error {
+		q.throttle(item.Mail)
+
+		item.Attempts++
+		err := q.service.Send(item.Mail)
+		now := q.now()
+
+		if err == nil {
+			q.emit(DeliveryEvent{Attempt: item.Attempts, ID: item.ID, Time: now, Type: DeliveryEventSent})
+
+			if err = q.store.Delete(item.ID); err != nil && !errors.Is(err, ErrQueuedMailNotFound) {
+				return &queueStoreError{delivered: true, err: err, item: item}
+			}
+
+			return nil
+		}
+
+		event := DeliveryEvent{Attempt: item.Attempts, Error: err, ID: item.ID, Time: now}
+
+		item.LastError = err.Error()
+		item.UpdatedAt = now
+
+		if q.isPermanentError(err) || item.Attempts >= q.maxAttempts {
+			item.Status = QueueStatusDead
+			event.Type = DeliveryEventDeadLettered
+		} else {
+			item.Status = QueueStatusPending
+			item.NextAttempt = now.Add(q.backoff(item.Attempts))
+			event.NextAttempt = item.NextAttempt
+			event.Type = DeliveryEventRetrying
+		}
+
+		q.emit(event)
+
+		if saveErr := q.store.Save(item); saveErr != nil {
+			return &queueStoreError{err: saveErr, item: item}
+		}
+
+		return nil
+	}
+}
+
+/*
+handleJobError receives errors from the worker pool. Store failures are
+remembered so retryUnsaved can write them again.
+*/
+func (q *Queue) handleJobError(err error) {
+	event := DeliveryEvent{Error: err, Time: q.now(), Type: DeliveryEventStoreError}
+
+	var storeErr *queueStoreError
+
+	if errors.As(err, &storeErr) {
+		q.unsavedLock.Lock()
+		q.unsaved[storeErr.item.ID] = storeErr
+		q.unsavedLock.Unlock()
+
+		event.Attempt = storeErr.item.Attempts
+		event.ID = storeErr.item.ID
+	}
+
+	q.emit(event)
+}
+
+/*
+retryUnsaved writes the outcome of deliveries that the store failed to
+record earlier. Mail that is still unsaved stays in the sending state,
+so it is not delivered twice.
+*/
+func (q *Queue) retryUnsaved() {
+	q.unsavedLock.Lock()
+	defer q.unsavedLock.Unlock()
+
+	for id, storeErr := range q.unsaved {
+		var err error
+
+		if storeErr.delivered {
+			if err = q.store.Delete(id); errors.Is(err, ErrQueuedMailNotFound) {
+				err = nil
+			}
+		} else {
+			err = q.store.Save(storeErr.item)
+		}
+
+		if err == nil {
+			delete(q.unsaved, id)
+		}
+	}
+}
+
+/*
+backoff returns how long to wait after the given number of failed attempts
+*/
+func (q *Queue) backoff(attempts int) time.Duration {
+	wait := q.initialBackoff
+
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+
+		if wait >= q.maxBackoff {
+			return q.maxBackoff
+		}
+	}
+
+	return wait
+}
+
+/*
+throttle blocks until every recipient domain of the mail is under its rate limit
+*/
+func (q *Queue) throttle(mail Mail) {
+	if q.domainRateLimit <= 0 {
+		return
+	}
+
+	seen := map[string]bool{}
+
+	for _, to := range mail.To {
+		domain := strings.ToLower(to.EmailAddress[strings.LastIndex(to.EmailAddress, "@")+1:])
+
+		if seen[domain] {
+			continue
+		}
+
+		seen[domain] = true
+		q.limiter(domain).Take()
+	}
+}
+
+func (q *Queue) limiter(domain string) ratelimit.Limiter {
+	q.limiterLock.Lock()
+	defer q.limiterLock.Unlock()
+
+	result, ok := q.limiters[domain]
+
+	if !ok {
+		result = ratelimit.New(q.domainRateLimit)
+		q.limiters[domain] = result
+	}
+
+	return result
+}
+
+func (q *Queue) recoverInterrupted() error {
+	items, err := q.store.List(QueueStatusSending)
+
+	if err != nil {
+		return fmt.Errorf("error reading interrupted mail: %w", err)
+	}
+
+	for _, item := range items {
+		item.Status = QueueStatusPending
+		item.UpdatedAt = q.now()
+
+		if err = q.store.Save(item); err != nil {
+			return fmt.Errorf("error recovering interrupted mail '%s': %w", item.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (q *Queue) emit(event DeliveryEvent) {
+	if q.eventChan != nil {
+		q.eventChan <- event
+	}
+}
+
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,18 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+/*
+A QueueStore persists queued mail so that it survives restarts and
+outages. Save inserts or replaces a record by ID. List returns every
+record with the given status. Get and Delete return ErrQueuedMailNotFound
+when the ID is unknown.
+*/
+type QueueStore interface {
+	Delete(id string) error
+	Get(id string) (*QueuedMail, error)
+	List(status QueueStatus) ([]*QueuedMail, error)
+	Save(item *QueuedMail) error
+}
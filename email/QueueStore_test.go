@@ -0,0 +1,393 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/app-nerds/kit/v6/email"
+	"github.com/app-nerds/kit/v6/filesystem/memoryfs"
+	"github.com/app-nerds/kit/v6/sqldatabase"
+)
+
+/*
+fakeQueueTable is an in-memory stand-in for the email_queue table. It
+understands only the statements SQLQueueStore issues.
+*/
+type fakeQueueTable struct {
+	lock    sync.Mutex
+	queries []string
+	rows    map[string][]interface{}
+}
+
+func newFakeQueueDB(table *fakeQueueTable) sqldatabase.DB {
+	table.rows = map[string][]interface{}{}
+
+	return &sqldatabase.MockDB{
+		ExecFunc: func(query string, args ...interface{}) (sql.Result, error) {
+			table.lock.Lock()
+			defer table.lock.Unlock()
+
+			table.queries = append(table.queries, query)
+			affected := int64(0)
+
+			switch {
+			case strings.HasPrefix(query, "UPDATE"):
+				id := args[6].(string)
+
+				// Like MySQL, only rows that actually change are counted
+				if row, ok := table.rows[id]; ok {
+					updated := []interface{}{id, args[0], args[1], args[2], args[3], args[4], row[6], args[5]}
+
+					if fmt.Sprint(updated) != fmt.Sprint(row) {
+						affected = 1
+					}
+
+					table.rows[id] = updated
+				}
+
+			case strings.HasPrefix(query, "INSERT"):
+				if _, ok := table.rows[args[0].(string)]; ok {
+					return nil, fmt.Errorf("duplicate key '%s'", args[0])
+				}
+
+				table.rows[args[0].(string)] = args
+				affected = 1
+
+			case strings.HasPrefix(query, "DELETE"):
+				if _, ok := table.rows[args[0].(string)]; ok {
+					delete(table.rows, args[0].(string))
+					affected = 1
+				}
+
+			default:
+				return nil, fmt.Errorf("unexpected statement %q", query)
+			}
+
+			return &sqldatabase.MockResult{
+				RowsAffectedFunc: func() (int64, error) { return affected, nil },
+			}, nil
+		},
+
+		QueryRowFunc: func(query string, args ...interface{}) sqldatabase.Row {
+			table.lock.Lock()
+			defer table.lock.Unlock()
+
+			row, ok := table.rows[args[0].(string)]
+
+			if strings.HasPrefix(query, "SELECT 1 ") {
+				row = []interface{}{1}
+			}
+
+			return &sqldatabase.MockRow{
+				ErrFunc: func() error { return nil },
+				ScanFunc: func(dest ...interface{}) error {
+					if !ok {
+						return sql.ErrNoRows
+					}
+
+					return scanFakeRow(row, dest)
+				},
+			}
+		},
+
+		QueryFunc: func(query string, args ...interface{}) (sqldatabase.Rows, error) {
+			table.lock.Lock()
+			defer table.lock.Unlock()
+
+			matches := [][]interface{}{}
+
+			for _, row := range table.rows {
+				if row[1] == args[0] {
+					matches = append(matches, row)
+				}
+			}
+
+			sort.Slice(matches, func(i, j int) bool {
+				return matches[i][6].(time.Time).Before(matches[j][6].(time.Time))
+			})
+
+			index := -1
+
+			return &sqldatabase.MockRows{
+				CloseFunc: func() error { return nil },
+				ErrFunc:   func() error { return nil },
+				NextFunc: func() bool {
+					index++
+					return index < len(matches)
+				},
+				ScanFunc: func(dest ...interface{}) error {
+					return scanFakeRow(matches[index], dest)
+				},
+			}, nil
+		},
+	}
+}
+
+func scanFakeRow(row []interface{}, dest []interface{}) error {
+	for index, d := range dest {
+		switch target := d.(type) {
+		case *string:
+			*target = row[index].(string)
+		case *int:
+			*target = row[index].(int)
+		case *time.Time:
+			*target = row[index].(time.Time)
+		default:
+			return fmt.Errorf("unsupported scan target %T", d)
+		}
+	}
+
+	return nil
+}
+
+/*
+queueStoreFactories creates one of each QueueStore, so they can all be
+run through the same behaviour
+*/
+func queueStoreFactories(t *testing.T) map[string]func() email.QueueStore {
+	return map[string]func() email.QueueStore{
+		"MemoryQueueStore": func() email.QueueStore {
+			return email.NewMemoryQueueStore()
+		},
+		"FileSystemQueueStore": func() email.QueueStore {
+			store, err := email.NewFileSystemQueueStore(memoryfs.NewMemoryFS(), "queue")
+
+			if err != nil {
+				t.Fatalf("unexpected error from NewFileSystemQueueStore: %v", err)
+			}
+
+			return store
+		},
+		"SQLQueueStore": func() email.QueueStore {
+			return email.NewSQLQueueStore(email.SQLQueueStoreConfig{DB: newFakeQueueDB(&fakeQueueTable{})})
+		},
+	}
+}
+
+func newQueuedMail(id string, status email.QueueStatus, createdAt time.Time) *email.QueuedMail {
+	return &email.QueuedMail{
+		ID:          id,
+		CreatedAt:   createdAt,
+		Mail:        email.Mail{Body: "body", Subject: id, To: []email.Person{{EmailAddress: "bob@example.com"}}},
+		NextAttempt: createdAt,
+		Status:      status,
+		UpdatedAt:   createdAt,
+	}
+}
+
+func TestQueueStores(t *testing.T) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for name, factory := range queueStoreFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			store := factory()
+
+			second := newQueuedMail("second", email.QueueStatusPending, now.Add(time.Minute))
+			first := newQueuedMail("first", email.QueueStatusPending, now)
+			dead := newQueuedMail("dead", email.QueueStatusDead, now)
+
+			for _, item := range []*email.QueuedMail{second, first, dead} {
+				if err := store.Save(item); err != nil {
+					t.Fatalf("unexpected error from Save: %v", err)
+				}
+			}
+
+			pending, err := store.List(email.QueueStatusPending)
+
+			if err != nil {
+				t.Fatalf("unexpected error from List: %v", err)
+			}
+
+			if len(pending) != 2 || pending[0].ID != "first" || pending[1].ID != "second" {
+				t.Fatalf("expected first and second, oldest first, but got %+v", pending)
+			}
+
+			first.Attempts = 2
+			first.LastError = "connection reset"
+			first.Status = email.QueueStatusSending
+
+			if err = store.Save(first); err != nil {
+				t.Fatalf("unexpected error updating with Save: %v", err)
+			}
+
+			got, err := store.Get("first")
+
+			if err != nil {
+				t.Fatalf("unexpected error from Get: %v", err)
+			}
+
+			if got.Attempts != 2 || got.LastError != "connection reset" || got.Status != email.QueueStatusSending {
+				t.Errorf("expected the update to be saved but got %+v", got)
+			}
+
+			if got.Mail.Subject != "first" || len(got.Mail.To) != 1 || !got.CreatedAt.Equal(now) {
+				t.Errorf("expected the mail to round trip but got %+v", got)
+			}
+
+			if err = store.Save(first); err != nil {
+				t.Fatalf("unexpected error saving an unchanged item again: %v", err)
+			}
+
+			if pending, _ = store.List(email.QueueStatusPending); len(pending) != 1 {
+				t.Errorf("expected 1 pending after the update but got %d", len(pending))
+			}
+
+			if err = store.Delete("first"); err != nil {
+				t.Fatalf("unexpected error from Delete: %v", err)
+			}
+
+			if _, err = store.Get("first"); !errors.Is(err, email.ErrQueuedMailNotFound) {
+				t.Errorf("expected ErrQueuedMailNotFound from Get after Delete but got %v", err)
+			}
+
+			if err = store.Delete("missing"); !errors.Is(err, email.ErrQueuedMailNotFound) {
+				t.Errorf("expected ErrQueuedMailNotFound from Delete but got %v", err)
+			}
+		})
+	}
+}
+
+func TestQueueStores_DeliverThroughQueue(t *testing.T) {
+	for name, factory := range queueStoreFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			service := &fakeMailService{failures: []error{fmt.Errorf("connection reset")}}
+			store := factory()
+
+			runQueue(t, service, store, email.DeliveryEventSent)
+
+			if len(service.sent) != 1 {
+				t.Errorf("expected 1 sent mail but got %d", len(service.sent))
+			}
+
+			for _, status := range []email.QueueStatus{email.QueueStatusPending, email.QueueStatusSending, email.QueueStatusDead} {
+				if items, _ := store.List(status); len(items) != 0 {
+					t.Errorf("expected no %s mail but found %d", status, len(items))
+				}
+			}
+		})
+	}
+}
+
+func TestSQLQueueStore_NumberedPlaceholders(t *testing.T) {
+	table := &fakeQueueTable{}
+	store := email.NewSQLQueueStore(email.SQLQueueStoreConfig{
+		DB:                   newFakeQueueDB(table),
+		NumberedPlaceholders: true,
+		TableName:            "outbox",
+	})
+
+	if err := store.Save(newQueuedMail("id", email.QueueStatusPending, time.Now())); err != nil {
+		t.Fatalf("unexpected error from Save: %v", err)
+	}
+
+	want := "INSERT INTO outbox (id, status, attempts, next_attempt, last_error, mail, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+
+	if len(table.queries) != 1 || table.queries[0] != want {
+		t.Errorf("expected %q but got %q", want, table.queries)
+	}
+}
+
+/*
+flakyQueueStore fails the first Delete, as a database might during a
+brief outage
+*/
+type flakyQueueStore struct {
+	*email.MemoryQueueStore
+
+	lock   sync.Mutex
+	failed bool
+}
+
+func (s *flakyQueueStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.failed {
+		s.failed = true
+		return fmt.Errorf("database is unavailable")
+	}
+
+	return s.MemoryQueueStore.Delete(id)
+}
+
+func TestQueue_RetriesStoreErrors(t *testing.T) {
+	store := &flakyQueueStore{MemoryQueueStore: email.NewMemoryQueueStore()}
+	service := &fakeMailService{}
+	events := make(chan email.DeliveryEvent, 10)
+
+	queue := email.NewQueue(email.QueueConfig{
+		EventChan:    events,
+		PollInterval: 5 * time.Millisecond,
+		Service:      service,
+		Store:        store,
+	})
+
+	if _, err := queue.Enqueue(email.Mail{Body: "body", To: []email.Person{{EmailAddress: "bob@example.com"}}}); err != nil {
+		t.Fatalf("unexpected error from Enqueue: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- queue.Run(ctx)
+	}()
+
+	sawStoreError := false
+	timeout := time.After(5 * time.Second)
+
+	for !sawStoreError {
+		select {
+		case event := <-events:
+			if event.Type == email.DeliveryEventStoreError {
+				sawStoreError = true
+
+				if event.ID == "" || event.Error == nil {
+					t.Errorf("expected the store error event to name the mail and error but got %+v", event)
+				}
+			}
+
+		case <-timeout:
+			cancel()
+			t.Fatalf("timed out waiting for a store error event")
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		sending, _ := store.List(email.QueueStatusSending)
+
+		if len(sending) == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatalf("expected the delivered mail to be removed once the store recovered")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	if len(service.sent) != 1 {
+		t.Errorf("expected the mail to be sent exactly once but it was sent %d times", len(service.sent))
+	}
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/app-nerds/kit/v6/email"
+)
+
+type fakeMailService struct {
+	lock     sync.Mutex
+	failures []error
+	sent     []email.Mail
+}
+
+func (s *fakeMailService) Connect() error {
+	return nil
+}
+
+func (s *fakeMailService) Send(mail ...email.Mail) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.failures) > 0 {
+		err := s.failures[0]
+		s.failures = s.failures[1:]
+		return err
+	}
+
+	s.sent = append(s.sent, mail...)
+	return nil
+}
+
+func runQueue(t *testing.T, service email.IMailService, store email.QueueStore, until email.DeliveryEventType) []email.DeliveryEvent {
+	t.Helper()
+
+	events := make(chan email.DeliveryEvent, 10)
+	queue := email.NewQueue(email.QueueConfig{
+		EventChan:      events,
+		InitialBackoff: 5 * time.Millisecond,
+		MaxAttempts:    3,
+		PollInterval:   5 * time.Millisecond,
+		Service:        service,
+		Store:          store,
+	})
+
+	_, err := queue.Enqueue(email.Mail{
+		Body:    "body",
+		From:    email.Person{EmailAddress: "adam@example.com"},
+		Subject: "subject",
+		To:      []email.Person{{EmailAddress: "bob@example.com"}},
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error from Enqueue: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- queue.Run(ctx)
+	}()
+
+	result := []email.DeliveryEvent{}
+	timeout := time.After(5 * time.Second)
+
+	for {
+		select {
+		case event := <-events:
+			result = append(result, event)
+
+			if event.Type == until {
+				cancel()
+
+				if err := <-done; err != nil {
+					t.Fatalf("unexpected error from Run: %v", err)
+				}
+
+				return result
+			}
+
+		case <-timeout:
+			cancel()
+			t.Fatalf("timed out waiting for '%s' event. Got %v", until, result)
+		}
+	}
+}
+
+func TestQueue_RetriesTemporaryFailures(t *testing.T) {
+	service := &fakeMailService{
+		failures: []error{fmt.Errorf("connection reset"), fmt.Errorf("connection reset")},
+	}
+
+	store := email.NewMemoryQueueStore()
+	events := runQueue(t, service, store, email.DeliveryEventSent)
+
+	want := []email.DeliveryEventType{
+		email.DeliveryEventQueued,
+		email.DeliveryEventRetrying,
+		email.DeliveryEventRetrying,
+		email.DeliveryEventSent,
+	}
+
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events but got %v", len(want), events)
+	}
+
+	for index, event := range events {
+		if event.Type != want[index] {
+			t.Errorf("expected event %d to be '%s' but got '%s'", index, want[index], event.Type)
+		}
+	}
+
+	if events[3].Attempt != 3 {
+		t.Errorf("expected delivery on attempt 3 but got %d", events[3].Attempt)
+	}
+
+	if len(service.sent) != 1 {
+		t.Errorf("expected 1 sent mail but got %d", len(service.sent))
+	}
+
+	if pending, _ := store.List(email.QueueStatusPending); len(pending) != 0 {
+		t.Errorf("expected the store to be empty but found %d pending", len(pending))
+	}
+}
+
+func TestQueue_DeadLettersPermanentFailures(t *testing.T) {
+	service := &fakeMailService{
+		failures: []error{&textproto.Error{Code: 550, Msg: "mailbox unavailable"}},
+	}
+
+	store := email.NewMemoryQueueStore()
+	events := runQueue(t, service, store, email.DeliveryEventDeadLettered)
+
+	if len(events) != 2 {
+		t.Fatalf("expected queued and dead-lettered events but got %v", events)
+	}
+
+	dead, _ := store.List(email.QueueStatusDead)
+
+	if len(dead) != 1 {
+		t.Fatalf("expected 1 dead letter but got %d", len(dead))
+	}
+
+	if dead[0].Attempts != 1 || dead[0].LastError == "" {
+		t.Errorf("expected 1 attempt with an error recorded but got %+v", dead[0])
+	}
+}
+
+func TestQueue_RequeuesOnlyDeadLetters(t *testing.T) {
+	store := email.NewMemoryQueueStore()
+	queue := email.NewQueue(email.QueueConfig{Service: &fakeMailService{}, Store: store})
+	now := time.Now().UTC()
+
+	for _, item := range []*email.QueuedMail{
+		{ID: "dead", Attempts: 5, LastError: "mailbox full", Status: email.QueueStatusDead, CreatedAt: now},
+		{ID: "sent", Attempts: 1, Status: email.QueueStatusSent, CreatedAt: now},
+		{ID: "sending", Attempts: 1, Status: email.QueueStatusSending, CreatedAt: now},
+	} {
+		_ = store.Save(item)
+	}
+
+	for _, id := range []string{"sent", "sending"} {
+		if err := queue.Requeue(id); !errors.Is(err, email.ErrQueuedMailNotDead) {
+			t.Errorf("expected ErrQueuedMailNotDead requeueing %s mail but got %v", id, err)
+		}
+
+		if item, _ := store.Get(id); item.Status == email.QueueStatusPending {
+			t.Errorf("expected %s mail to be left alone", id)
+		}
+	}
+
+	if err := queue.Requeue("dead"); err != nil {
+		t.Fatalf("unexpected error requeueing dead mail: %v", err)
+	}
+
+	if item, _ := store.Get("dead"); item.Status != email.QueueStatusPending || item.Attempts != 0 || item.LastError != "" {
+		t.Errorf("expected dead mail to be pending with its attempts reset but got %+v", item)
+	}
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+/*
+QueueStatus describes where a queued mail is in its delivery lifecycle
+*/
+type QueueStatus string
+
+const (
+	// QueueStatusPending mail is waiting for its next delivery attempt
+	QueueStatusPending QueueStatus = "pending"
+
+	// QueueStatusSending mail has been handed to a worker for delivery
+	QueueStatusSending QueueStatus = "sending"
+
+	// QueueStatusSent mail was delivered. Stores that cannot delete records keep them in this state
+	QueueStatusSent QueueStatus = "sent"
+
+	// QueueStatusDead mail failed permanently, or ran out of attempts, and will not be retried
+	QueueStatusDead QueueStatus = "dead"
+)
+
+/*
+QueuedMail is a mail message persisted in a QueueStore, along with
+the state of its delivery
+*/
+type QueuedMail struct {
+	ID          string      `json:"id"`
+	Attempts    int         `json:"attempts"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	LastError   string      `json:"lastError"`
+	Mail        Mail        `json:"mail"`
+	NextAttempt time.Time   `json:"nextAttempt"`
+	Status      QueueStatus `json:"status"`
+	UpdatedAt   time.Time   `json:"updatedAt"`
+}
+
+/*
+newQueuedMailID returns a random, URL and file name safe identifier
+*/
+func newQueuedMailID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"net/textproto"
+	"time"
+)
+
+/*
+ReceivedMail is a message parsed from raw RFC 5322/MIME data. TextBody and
+HTMLBody hold the first text/plain and text/html parts that are not
+attachments. ReplyText is TextBody with quoted replies and signatures
+removed, which is usually what a person actually wrote. Parts holds every leaf part of the message in order,
+including those used for the bodies and attachments. Raw is the
+message exactly as it was received. EnvelopeFrom and EnvelopeTo are only
+set when the message arrived over SMTP, and include Bcc recipients.
+*/
+type ReceivedMail struct {
+	Attachments  []Attachment         `json:"attachments"`
+	Cc           []Person             `json:"cc"`
+	Date         time.Time            `json:"date"`
+	EnvelopeFrom string               `json:"envelopeFrom"`
+	EnvelopeTo   []string             `json:"envelopeTo"`
+	From         Person               `json:"from"`
+	Headers      textproto.MIMEHeader `json:"headers"`
+	HTMLBody     string               `json:"htmlBody"`
+	ID           string               `json:"id"`
+	InReplyTo    string               `json:"inReplyTo"`
+	MessageID    string               `json:"messageID"`
+	Parts        []MessagePart        `json:"parts"`
+	Raw          []byte               `json:"-"`
+	References   []string             `json:"references"`
+	ReplyText    string               `json:"replyText"`
+	ReplyTo      []Person             `json:"replyTo"`
+	Subject      string               `json:"subject"`
+	TextBody     string               `json:"textBody"`
+	To           []Person             `json:"to"`
+}
+
+/*
+MessagePart is a single, decoded leaf part of a MIME message
+*/
+type MessagePart struct {
+	Body        []byte               `json:"-"`
+	ContentType string               `json:"contentType"`
+	Headers     textproto.MIMEHeader `json:"headers"`
+}
+
+/*
+Attachment is a file attached to a message. Inline attachments, such
+as images referenced by an HTML body, have ContentID set.
+*/
+type Attachment struct {
+	ContentID   string `json:"contentID"`
+	ContentType string `json:"contentType"`
+	Data        []byte `json:"-"`
+	FileName    string `json:"fileName"`
+	Inline      bool   `json:"inline"`
+	Size        int    `json:"size"`
+}
+
+/*
+ToMail converts a received message into a Mail, using the HTML body
+when there is one and the text body otherwise
+*/
+func (m *ReceivedMail) ToMail() Mail {
+	body := m.HTMLBody
+
+	if body == "" {
+		body = m.TextBody
+	}
+
+	return Mail{
+		Body:    body,
+		From:    m.From,
+		Subject: m.Subject,
+		To:      m.To,
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	/*
+	 * "On Mon, Jan 2, 2006 at 3:04 PM Adam <adam@example.com> wrote:", which
+	 * some clients wrap over two lines
+	 */
+	replyHeaderPattern = regexp.MustCompile(`(?is)^on\b.{0,300}\bwrote:\s*$`)
+
+	/*
+	 * Outlook and many mobile clients
+	 */
+	originalMessagePattern = regexp.MustCompile(`(?i)^\s*-{2,}\s*(original message|forwarded message)\s*-{2,}\s*$`)
+	outlookFromPattern     = regexp.MustCompile(`(?i)^\s*\*?from:\*?\s`)
+	outlookSentPattern     = regexp.MustCompile(`(?i)^\s*\*?(sent|date):\*?\s`)
+	underscoreRulePattern  = regexp.MustCompile(`^\s*_{20,}\s*$`)
+
+	mobileSignaturePattern = regexp.MustCompile(`(?i)^\s*sent from my \w+`)
+)
+
+/*
+StripQuotedReply returns only the newly written part of a plain text
+reply. Quoted text ("> ..."), reply headers such as "On ... wrote:",
+Outlook style original message blocks, signatures after "-- ", and
+"Sent from my phone" footers are removed.
+*/
+func StripQuotedReply(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	cut := len(lines)
+
+	for index := 0; index < len(lines); index++ {
+		line := lines[index]
+		trimmed := strings.TrimSpace(line)
+
+		if line == "-- " || line == "--" {
+			cut = index
+			break
+		}
+
+		if originalMessagePattern.MatchString(line) || underscoreRulePattern.MatchString(line) || mobileSignaturePattern.MatchString(line) {
+			cut = index
+			break
+		}
+
+		if replyHeaderPattern.MatchString(trimmed) {
+			cut = index
+			break
+		}
+
+		if index+1 < len(lines) && strings.HasPrefix(strings.ToLower(trimmed), "on ") && replyHeaderPattern.MatchString(trimmed+" "+strings.TrimSpace(lines[index+1])) {
+			cut = index
+			break
+		}
+
+		if outlookFromPattern.MatchString(line) && index+1 < len(lines) && outlookSentPattern.MatchString(lines[index+1]) {
+			cut = index
+			break
+		}
+
+		if strings.HasPrefix(trimmed, ">") {
+			cut = index
+
+			/*
+			 * Only treat quoted text as the start of the reply history when
+			 * nothing but more quotes and blank lines follow it. Otherwise
+			 * it is an inline reply, and the quote lines are just dropped
+			 */
+			if quotedUntilEnd(lines[index:]) {
+				break
+			}
+
+			cut = len(lines)
+		}
+	}
+
+	result := []string{}
+
+	for _, line := range lines[:cut] {
+		if strings.HasPrefix(strings.TrimSpace(line), ">") {
+			continue
+		}
+
+		result = append(result, line)
+	}
+
+	return strings.TrimSpace(strings.Join(result, "\n"))
+}
+
+func quotedUntilEnd(lines []string) bool {
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if trimmed != "" && !strings.HasPrefix(trimmed, ">") {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"gopkg.in/gomail.v2"
+)
+
+/*
+SMTPTransportConfig configures a pooled SMTP transport. PoolSize is the
+maximum number of idle connections kept open for reuse. MaxRetries is the
+number of times a failed send is retried on a fresh connection. A send on
+a stale pooled connection is always retried once, whatever MaxRetries is.
+*/
+type SMTPTransportConfig struct {
+	Config     *Config
+	MaxRetries int
+	PoolSize   int
+}
+
+/*
+SMTPTransport delivers mail over SMTP using a pool of reusable connections.
+Connections are dialed on demand. When a send fails the connection is
+discarded and the send is retried on a new connection, so a dropped
+connection or server restart is recovered from transparently. Permanent
+failures, such as a 5xx reply rejecting a recipient, are not retried.
+*/
+type SMTPTransport struct {
+	dialer     dialer
+	maxRetries int
+
+	lock   sync.Mutex
+	closed bool
+	idle   chan gomail.SendCloser
+}
+
+type dialer interface {
+	Dial() (gomail.SendCloser, error)
+}
+
+/*
+NewSMTPTransport creates a new pooled SMTP transport
+*/
+func NewSMTPTransport(config SMTPTransportConfig) *SMTPTransport {
+	d := &gomail.Dialer{
+		Host:     config.Config.Host,
+		Port:     config.Config.Port,
+		Username: config.Config.UserName,
+		Password: config.Config.Password,
+	}
+
+	return newSMTPTransport(d, config)
+}
+
+func newSMTPTransport(d dialer, config SMTPTransportConfig) *SMTPTransport {
+	poolSize := config.PoolSize
+
+	if poolSize < 1 {
+		poolSize = 1
+	}
+
+	return &SMTPTransport{
+		dialer:     d,
+		maxRetries: config.MaxRetries,
+		idle:       make(chan gomail.SendCloser, poolSize),
+	}
+}
+
+/*
+Send delivers a message using a pooled connection. A pooled connection
+may have been dropped by the server while it sat idle, so when one fails
+the send is tried once more on a new connection. That extra try does not
+count against MaxRetries.
+*/
+func (t *SMTPTransport) Send(from string, to []string, msg io.WriterTo) error {
+	var (
+		err    error
+		fresh  bool
+		pooled bool
+		sender gomail.SendCloser
+	)
+
+	for attempt := 0; attempt <= t.maxRetries; {
+		if sender, pooled, err = t.acquire(fresh); err != nil {
+			if IsPermanentDeliveryError(err) {
+				break
+			}
+
+			fresh = true
+			attempt++
+			continue
+		}
+
+		if err = sender.Send(from, to, msg); err != nil {
+			_ = sender.Close()
+
+			if IsPermanentDeliveryError(err) {
+				break
+			}
+
+			if !pooled {
+				attempt++
+			}
+
+			fresh = true
+			continue
+		}
+
+		t.release(sender)
+		return nil
+	}
+
+	return fmt.Errorf("error sending mail over SMTP: %w", err)
+}
+
+/*
+Close closes all idle connections. Connections in use are closed
+when they are returned to the pool.
+*/
+func (t *SMTPTransport) Close() error {
+	var err error
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.closed {
+		return nil
+	}
+
+	t.closed = true
+	close(t.idle)
+
+	for sender := range t.idle {
+		if closeErr := sender.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+/*
+acquire takes an idle connection from the pool or dials a new one, and
+reports whether the connection came from the pool. When fresh is true
+the pool is bypassed so a retry never reuses a connection that may be
+stale.
+*/
+func (t *SMTPTransport) acquire(fresh bool) (gomail.SendCloser, bool, error) {
+	t.lock.Lock()
+	closed := t.closed
+	t.lock.Unlock()
+
+	if closed {
+		return nil, false, ErrTransportClosed
+	}
+
+	if !fresh {
+		select {
+		case sender := <-t.idle:
+			if sender != nil {
+				return sender, true, nil
+			}
+		default:
+		}
+	}
+
+	sender, err := t.dialer.Dial()
+	return sender, false, err
+}
+
+func (t *SMTPTransport) release(sender gomail.SendCloser) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.closed {
+		_ = sender.Close()
+		return
+	}
+
+	select {
+	case t.idle <- sender:
+	default:
+		_ = sender.Close()
+	}
+}
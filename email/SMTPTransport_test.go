@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+type fakeSender struct {
+	closed bool
+	err    error
+	sent   int
+}
+
+func (s *fakeSender) Send(from string, to []string, msg io.WriterTo) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	s.sent++
+	return nil
+}
+
+func (s *fakeSender) Close() error {
+	s.closed = true
+	return nil
+}
+
+type fakeDialer struct {
+	senders []*fakeSender
+	dials   int
+}
+
+func (d *fakeDialer) Dial() (gomail.SendCloser, error) {
+	sender := d.senders[d.dials]
+	d.dials++
+	return sender, nil
+}
+
+func TestSMTPTransport_ReconnectsAfterAFailedSend(t *testing.T) {
+	broken := &fakeSender{err: errors.New("connection reset")}
+	working := &fakeSender{}
+	d := &fakeDialer{senders: []*fakeSender{broken, working}}
+
+	transport := newSMTPTransport(d, SMTPTransportConfig{MaxRetries: 2})
+
+	if err := transport.Send("from@example.com", []string{"to@example.com"}, gomail.NewMessage()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if d.dials != 2 || !broken.closed || working.sent != 1 {
+		t.Errorf("expected the broken connection to be replaced but got %d dials, closed %t, sent %d", d.dials, broken.closed, working.sent)
+	}
+
+	// The working connection went back to the pool and is reused
+	if err := transport.Send("from@example.com", []string{"to@example.com"}, gomail.NewMessage()); err != nil || d.dials != 2 || working.sent != 2 {
+		t.Errorf("expected the pooled connection to be reused but got %d dials, %v", d.dials, err)
+	}
+}
+
+func TestSMTPTransport_DoesNotRetryPermanentFailures(t *testing.T) {
+	rejected := &fakeSender{err: &textproto.Error{Code: 550, Msg: "no such user"}}
+	d := &fakeDialer{senders: []*fakeSender{rejected, {}}}
+
+	transport := newSMTPTransport(d, SMTPTransportConfig{MaxRetries: 3})
+	err := transport.Send("from@example.com", []string{"nobody@example.com"}, gomail.NewMessage())
+
+	var smtpErr *textproto.Error
+
+	if !errors.As(err, &smtpErr) || smtpErr.Code != 550 {
+		t.Errorf("expected the 550 reply but got %v", err)
+	}
+
+	if d.dials != 1 {
+		t.Errorf("expected no retry but got %d dials", d.dials)
+	}
+}
+
+func TestSMTPTransport_RedialsWhenThePooledConnectionWasDropped(t *testing.T) {
+	server := NewCaptureServer(CaptureServerConfig{})
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("unexpected error starting capture server: %s", err)
+	}
+
+	defer server.Close()
+
+	// MaxRetries is left at its default of zero
+	transport := NewSMTPTransport(SMTPTransportConfig{Config: server.Config()})
+	defer transport.Close()
+
+	newMessage := func() *gomail.Message {
+		m := gomail.NewMessage()
+		m.SetHeader("From", "from@example.com")
+		m.SetHeader("To", "to@example.com")
+		m.SetBody("text/plain", "hello")
+		return m
+	}
+
+	if err := transport.Send("from@example.com", []string{"to@example.com"}, newMessage()); err != nil {
+		t.Fatalf("unexpected error on the first send: %s", err)
+	}
+
+	if _, err := server.WaitForMessages(1, 5*time.Second); err != nil {
+		t.Fatalf("unexpected error waiting for the first message: %s", err)
+	}
+
+	// The server drops the idle connection with a reset, as servers and
+	// firewalls do after a timeout. gomail only redials by itself on a
+	// clean EOF.
+	server.connLock.Lock()
+
+	for conn := range server.open {
+		_ = conn.(*net.TCPConn).SetLinger(0)
+		_ = conn.Close()
+	}
+
+	server.connLock.Unlock()
+
+	if err := transport.Send("from@example.com", []string{"to@example.com"}, newMessage()); err != nil {
+		t.Fatalf("expected the send to redial after the dropped connection but got %s", err)
+	}
+
+	if messages, err := server.WaitForMessages(2, 5*time.Second); err != nil || len(messages) != 2 {
+		t.Errorf("expected 2 messages but got %d, %v", len(messages), err)
+	}
+}
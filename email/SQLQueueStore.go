@@ -0,0 +1,226 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/app-nerds/kit/v6/sqldatabase"
+)
+
+/*
+SQLQueueStoreConfig configures a SQL backed queue store. TableName defaults
+to email_queue. Set NumberedPlaceholders for databases, such as Postgres,
+that use $1 style placeholders instead of ?. The table must have the
+following shape:
+
+	CREATE TABLE email_queue (
+		id VARCHAR(64) PRIMARY KEY,
+		status VARCHAR(20) NOT NULL,
+		attempts INT NOT NULL,
+		next_attempt TIMESTAMP NOT NULL,
+		last_error TEXT NOT NULL,
+		mail TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);
+*/
+type SQLQueueStoreConfig struct {
+	DB                   sqldatabase.DB
+	NumberedPlaceholders bool
+	TableName            string
+}
+
+/*
+SQLQueueStore persists queued mail in a SQL database table
+*/
+type SQLQueueStore struct {
+	db                   sqldatabase.DB
+	numberedPlaceholders bool
+	tableName            string
+}
+
+/*
+NewSQLQueueStore creates a new SQL backed queue store
+*/
+func NewSQLQueueStore(config SQLQueueStoreConfig) *SQLQueueStore {
+	tableName := config.TableName
+
+	if tableName == "" {
+		tableName = "email_queue"
+	}
+
+	return &SQLQueueStore{
+		db:                   config.DB,
+		numberedPlaceholders: config.NumberedPlaceholders,
+		tableName:            tableName,
+	}
+}
+
+func (s *SQLQueueStore) Delete(id string) error {
+	var (
+		err          error
+		result       sql.Result
+		rowsAffected int64
+	)
+
+	query := s.query("DELETE FROM %s WHERE id=?")
+
+	if result, err = s.db.Exec(query, id); err != nil {
+		return fmt.Errorf("error deleting queued mail '%s': %w", id, err)
+	}
+
+	if rowsAffected, err = result.RowsAffected(); err != nil {
+		return fmt.Errorf("error deleting queued mail '%s': %w", id, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrQueuedMailNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLQueueStore) Get(id string) (*QueuedMail, error) {
+	query := s.query("SELECT id, status, attempts, next_attempt, last_error, mail, created_at, updated_at FROM %s WHERE id=?")
+	row := s.db.QueryRow(query, id)
+
+	result, err := s.scan(row)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrQueuedMailNotFound
+	}
+
+	return result, err
+}
+
+func (s *SQLQueueStore) List(status QueueStatus) ([]*QueuedMail, error) {
+	var (
+		err  error
+		rows sqldatabase.Rows
+		item *QueuedMail
+	)
+
+	query := s.query("SELECT id, status, attempts, next_attempt, last_error, mail, created_at, updated_at FROM %s WHERE status=? ORDER BY created_at")
+
+	if rows, err = s.db.Query(query, string(status)); err != nil {
+		return nil, fmt.Errorf("error querying queued mail: %w", err)
+	}
+
+	defer rows.Close()
+
+	result := []*QueuedMail{}
+
+	for rows.Next() {
+		if item, err = s.scan(rows); err != nil {
+			return nil, err
+		}
+
+		result = append(result, item)
+	}
+
+	return result, rows.Err()
+}
+
+/*
+Save updates the record for item, inserting it when it does not exist yet.
+Whether the record exists is checked first, since some databases, such as
+MySQL, report no affected rows for an update that changes nothing.
+*/
+func (s *SQLQueueStore) Save(item *QueuedMail) error {
+	var (
+		err    error
+		exists int
+		mail   []byte
+	)
+
+	if mail, err = json.Marshal(item.Mail); err != nil {
+		return fmt.Errorf("error encoding queued mail '%s': %w", item.ID, err)
+	}
+
+	err = s.db.QueryRow(s.query("SELECT 1 FROM %s WHERE id=?"), item.ID).Scan(&exists)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error reading queued mail '%s': %w", item.ID, err)
+	}
+
+	if err == nil {
+		update := s.query("UPDATE %s SET status=?, attempts=?, next_attempt=?, last_error=?, mail=?, updated_at=? WHERE id=?")
+
+		if _, err = s.db.Exec(update, string(item.Status), item.Attempts, item.NextAttempt, item.LastError, string(mail), item.UpdatedAt, item.ID); err != nil {
+			return fmt.Errorf("error updating queued mail '%s': %w", item.ID, err)
+		}
+
+		return nil
+	}
+
+	insert := s.query("INSERT INTO %s (id, status, attempts, next_attempt, last_error, mail, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+
+	if _, err = s.db.Exec(insert, item.ID, string(item.Status), item.Attempts, item.NextAttempt, item.LastError, string(mail), item.CreatedAt, item.UpdatedAt); err != nil {
+		return fmt.Errorf("error inserting queued mail '%s': %w", item.ID, err)
+	}
+
+	return nil
+}
+
+/*
+query fills in the table name and, when configured, converts ? placeholders
+to numbered placeholders
+*/
+func (s *SQLQueueStore) query(format string) string {
+	query := fmt.Sprintf(format, s.tableName)
+
+	if !s.numberedPlaceholders {
+		return query
+	}
+
+	b := &strings.Builder{}
+	index := 0
+
+	for _, r := range query {
+		if r == '?' {
+			index++
+			b.WriteString(fmt.Sprintf("$%d", index))
+			continue
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func (s *SQLQueueStore) scan(scanner sqldatabase.Scanner) (*QueuedMail, error) {
+	var (
+		err    error
+		status string
+		mail   string
+	)
+
+	result := &QueuedMail{}
+
+	if err = scanner.Scan(&result.ID, &status, &result.Attempts, &result.NextAttempt, &result.LastError, &mail, &result.CreatedAt, &result.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("error reading queued mail: %w", err)
+	}
+
+	if err = json.Unmarshal([]byte(mail), &result.Mail); err != nil {
+		return nil, fmt.Errorf("error decoding queued mail '%s': %w", result.ID, err)
+	}
+
+	result.Status = QueueStatus(status)
+	result.NextAttempt = result.NextAttempt.UTC()
+	result.CreatedAt = result.CreatedAt.UTC()
+	result.UpdatedAt = result.UpdatedAt.UTC()
+
+	return result, nil
+}
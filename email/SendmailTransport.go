@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+/*
+SendmailTransport delivers mail by piping each message to a local
+sendmail-compatible binary, such as sendmail, postfix, or msmtp. Path
+defaults to /usr/sbin/sendmail. Args are passed before the standard
+"-i -f <from> -- <recipients>" arguments.
+*/
+type SendmailTransport struct {
+	Args []string
+	Path string
+}
+
+/*
+NewSendmailTransport creates a transport that uses the sendmail binary
+found at path. If path is empty /usr/sbin/sendmail is used.
+*/
+func NewSendmailTransport(path string, args ...string) *SendmailTransport {
+	if path == "" {
+		path = "/usr/sbin/sendmail"
+	}
+
+	return &SendmailTransport{
+		Args: args,
+		Path: path,
+	}
+}
+
+/*
+Send pipes a message to the sendmail binary
+*/
+func (t *SendmailTransport) Send(from string, to []string, msg io.WriterTo) error {
+	var (
+		err    error
+		stdin  io.WriteCloser
+		stderr bytes.Buffer
+	)
+
+	args := append([]string{}, t.Args...)
+	args = append(args, "-i", "-f", from, "--")
+	args = append(args, to...)
+
+	cmd := exec.Command(t.Path, args...)
+	cmd.Stderr = &stderr
+
+	if stdin, err = cmd.StdinPipe(); err != nil {
+		return fmt.Errorf("error opening pipe to sendmail: %w", err)
+	}
+
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("error starting sendmail: %w", err)
+	}
+
+	if _, err = msg.WriteTo(stdin); err != nil {
+		_ = stdin.Close()
+		_ = cmd.Wait()
+		return fmt.Errorf("error writing message to sendmail: %w", err)
+	}
+
+	if err = stdin.Close(); err != nil {
+		_ = cmd.Wait()
+		return fmt.Errorf("error closing pipe to sendmail: %w", err)
+	}
+
+	if err = cmd.Wait(); err != nil {
+		return fmt.Errorf("sendmail failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return nil
+}
+
+/*
+Close does nothing. Each message is delivered by a separate sendmail process.
+*/
+func (t *SendmailTransport) Close() error {
+	return nil
+}
@@ -0,0 +1,20 @@
+/*
+ * Copyright (c) 2023. App Nerds LLC. All rights reserved
+ */
+
+package email
+
+import (
+	"io"
+)
+
+/*
+A Transport delivers fully-formed messages to their recipients. The method
+set matches gomail.SendCloser, so any Transport can be handed to gomail.Send.
+MailService uses a Transport when one is configured, otherwise it falls back
+to dialing the SMTP server described by its Config.
+*/
+type Transport interface {
+	Send(from string, to []string, msg io.WriterTo) error
+	Close() error
+}
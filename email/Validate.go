@@ -7,14 +7,16 @@ package email
 import "net/mail"
 
 /*
-IsValidEmailAddress returns true/false if a provided email address is valid
+IsValidEmailAddress returns true/false if a provided email address is valid.
+The address may include a display name, as in "Adam <adam@example.com>", but
+its domain must be a valid host name, just as AddressValidator requires.
 */
 func IsValidEmailAddress(email string) bool {
-	_, err := mail.ParseAddress(email)
+	parsed, err := mail.ParseAddress(email)
 
 	if err != nil {
 		return false
 	}
 
-	return true
+	return parseAddrSpec(parsed).SyntaxError == nil
 }
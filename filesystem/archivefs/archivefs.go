@@ -0,0 +1,370 @@
+package archivefs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+ErrLimitExceeded is returned when an archive is larger than its
+ArchiveOptions allow, or expands far more than its compressed size
+*/
+var ErrLimitExceeded = errors.New("archive exceeds size limits")
+
+/*
+ErrUnsafePath is returned when an archive holds an entry whose name is
+absolute or climbs out of the archive with ".."
+*/
+var ErrUnsafePath = errors.New("archive entry has an unsafe path")
+
+/*
+ArchiveOptions limits what an archive may contain, to guard against
+decompression bombs. Zero values use the defaults.
+
+MaxEntries is the number of entries allowed, 10,000 by default. In a tar
+archive every header counts, including the links, devices, and PAX or
+GNU long name records that are skipped. MaxFileSize is the largest uncompressed size of one file, 256
+MiB by default. MaxTotalSize is the largest uncompressed size of every
+file together, 1 GiB by default. MaxRatio is how many times larger than
+its compressed size a file may be once expanded, 100 by default. Files
+under 1 MiB are never refused for their ratio.
+*/
+type ArchiveOptions struct {
+	MaxEntries   int
+	MaxFileSize  int64
+	MaxRatio     int64
+	MaxTotalSize int64
+}
+
+/*
+minRatioSize is the uncompressed size below which MaxRatio is not checked
+*/
+const minRatioSize = 1 << 20
+
+func (o ArchiveOptions) withDefaults() ArchiveOptions {
+	if o.MaxEntries <= 0 {
+		o.MaxEntries = 10000
+	}
+
+	if o.MaxFileSize <= 0 {
+		o.MaxFileSize = 256 << 20
+	}
+
+	if o.MaxRatio <= 0 {
+		o.MaxRatio = 100
+	}
+
+	if o.MaxTotalSize <= 0 {
+		o.MaxTotalSize = 1 << 30
+	}
+
+	return o
+}
+
+func (o ArchiveOptions) checkRatio(name string, uncompressed, compressed int64) error {
+	if uncompressed > minRatioSize && uncompressed > compressed*o.MaxRatio {
+		return fmt.Errorf("%s expands more than %d times: %w", name, o.MaxRatio, ErrLimitExceeded)
+	}
+
+	return nil
+}
+
+/*
+ArchiveFS is a read-only view of a zip or tar archive. This implements
+fs.FS, fs.ReadFileFS, fs.ReadDirFS, fs.StatFS, and FileSystem.
+
+Paths follow the same rules as memoryfs. "/" is the top of the archive,
+and relative names are resolved against the directory set with Chdir.
+DirFS gives a strict io/fs view for code that expects one. Directories that the archive does not
+list are made up from the paths of the files inside them. Symbolic links,
+hard links, and device files are left out.
+
+Anything that would change the archive fails with a *fs.PathError
+wrapping fs.ErrPermission.
+*/
+type ArchiveFS struct {
+	lock sync.RWMutex
+	cwd  string
+	root *entry
+}
+
+/*
+entry is a file or directory in the archive. open returns the file's
+uncompressed contents.
+*/
+type entry struct {
+	children map[string]*entry
+	info     filesystem.FileInfo
+	open     func() (io.ReadCloser, error)
+}
+
+func newArchiveFS() *ArchiveFS {
+	return &ArchiveFS{
+		cwd:  "/",
+		root: newDirEntry("/", 0755, time.Time{}),
+	}
+}
+
+func newDirEntry(name string, perm fs.FileMode, modTime time.Time) *entry {
+	return &entry{
+		children: map[string]*entry{},
+		info: filesystem.FileInfo{
+			FileName:     name,
+			FileMode:     fs.ModeDir | perm,
+			ModifiedTime: modTime,
+			IsDirectory:  true,
+		},
+	}
+}
+
+func (a *ArchiveFS) Chdir(dir string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	p := a.abs(dir)
+	e, err := a.find(p)
+
+	if err != nil {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: err}
+	}
+
+	if !e.info.IsDir() {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: syscall.ENOTDIR}
+	}
+
+	a.cwd = p
+	return nil
+}
+
+func (a *ArchiveFS) Create(name string) (filesystem.WritableFile, error) {
+	return nil, denied("open", name)
+}
+
+func (a *ArchiveFS) Mkdir(name string, perm fs.FileMode) error {
+	return denied("mkdir", name)
+}
+
+func (a *ArchiveFS) MkdirAll(path string, perm fs.FileMode) error {
+	return denied("mkdir", path)
+}
+
+func (a *ArchiveFS) Open(name string) (fs.File, error) {
+	return a.OpenFile(name, os.O_RDONLY, 0)
+}
+
+/*
+OpenFile opens a file or directory for reading. Any flag that asks to
+write, create, truncate, or append is refused.
+*/
+func (a *ArchiveFS) OpenFile(name string, flag int, perm os.FileMode) (filesystem.WritableFile, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, denied("open", name)
+	}
+
+	a.lock.RLock()
+	e, err := a.find(a.abs(name))
+	a.lock.RUnlock()
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	f := &archiveFile{info: e.info, name: name}
+
+	if e.info.IsDir() {
+		f.entries = e.dirEntries()
+		return f, nil
+	}
+
+	if f.reader, err = e.open(); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return f, nil
+}
+
+func (a *ArchiveFS) ReadFile(name string) ([]byte, error) {
+	f, err := a.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func (a *ArchiveFS) Stat(name string) (fs.FileInfo, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	e, err := a.find(a.abs(name))
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	return e.info, nil
+}
+
+func (a *ArchiveFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return denied("open", name)
+}
+
+/*
+ReadDir returns the entries of a directory, sorted by name
+*/
+func (a *ArchiveFS) ReadDir(dir string) ([]fs.DirEntry, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	e, err := a.find(a.abs(dir))
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: dir, Err: err}
+	}
+
+	if !e.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: dir, Err: syscall.ENOTDIR}
+	}
+
+	return e.dirEntries(), nil
+}
+
+func (a *ArchiveFS) FileExists(file string) bool {
+	_, err := a.Stat(file)
+	return err == nil
+}
+
+/*
+add puts an entry into the tree at a name already cleaned by cleanName,
+making any missing parent directories. A later entry with the same name
+replaces an earlier one, as it does when a tar archive is extracted.
+*/
+func (a *ArchiveFS) add(name string, e *entry) error {
+	parent := a.root
+	parts := strings.Split(name, "/")
+
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := parent.children[part]
+
+		if !ok {
+			child = newDirEntry(part, 0755, time.Time{})
+			parent.children[part] = child
+		}
+
+		if !child.info.IsDir() {
+			return fmt.Errorf("%s is both a file and a directory in the archive", part)
+		}
+
+		parent = child
+	}
+
+	base := parts[len(parts)-1]
+	existing, ok := parent.children[base]
+
+	if ok && existing.info.IsDir() != e.info.IsDir() {
+		return fmt.Errorf("%s is both a file and a directory in the archive", name)
+	}
+
+	if ok && e.info.IsDir() {
+		existing.info = e.info
+		return nil
+	}
+
+	e.info.FileName = base
+	parent.children[base] = e
+	return nil
+}
+
+func (a *ArchiveFS) abs(name string) string {
+	name = filepath.ToSlash(name)
+
+	if !path.IsAbs(name) {
+		name = path.Join(a.cwd, name)
+	}
+
+	return path.Clean(name)
+}
+
+func (a *ArchiveFS) find(p string) (*entry, error) {
+	e := a.root
+
+	for _, part := range strings.Split(strings.Trim(p, "/"), "/") {
+		if part == "" {
+			continue
+		}
+
+		if !e.info.IsDir() {
+			return nil, syscall.ENOTDIR
+		}
+
+		child, ok := e.children[part]
+
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+
+		e = child
+	}
+
+	return e, nil
+}
+
+func (e *entry) dirEntries() []fs.DirEntry {
+	result := make([]fs.DirEntry, 0, len(e.children))
+
+	for _, child := range e.children {
+		result = append(result, fs.FileInfoToDirEntry(child.info))
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+
+	return result
+}
+
+/*
+cleanName turns the name of an archive entry into a slash separated path
+relative to the top of the archive. Names that are absolute, that name a
+drive, or that use ".." anywhere are refused with ErrUnsafePath. An empty
+result means the entry is the top of the archive itself.
+*/
+func cleanName(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return "", fmt.Errorf("%s: %w", name, ErrUnsafePath)
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("%s: %w", name, ErrUnsafePath)
+		}
+	}
+
+	name = path.Clean(name)
+
+	if name == "." {
+		return "", nil
+	}
+
+	return name, nil
+}
+
+func denied(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+}
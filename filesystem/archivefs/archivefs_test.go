@@ -0,0 +1,172 @@
+package archivefs_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/app-nerds/kit/v6/filesystem/archivefs"
+	"github.com/app-nerds/kit/v6/filesystem/memoryfs"
+)
+
+func newSource(t *testing.T) *memoryfs.MemoryFS {
+	t.Helper()
+
+	mfs := memoryfs.NewMemoryFS()
+	_ = mfs.MkdirAll("/export/docs/empty", 0755)
+	_ = mfs.WriteFile("/export/readme.txt", []byte("read me"), 0644)
+	_ = mfs.WriteFile("/export/docs/guide.md", []byte("# Guide"), 0600)
+	_ = mfs.WriteFile("/other.txt", []byte("not exported"), 0644)
+
+	return mfs
+}
+
+func TestArchiveFS_ZipRoundTrip(t *testing.T) {
+	buffer := &bytes.Buffer{}
+
+	if err := archivefs.WriteZip(buffer, newSource(t), "/export"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	a, err := archivefs.NewZipFS(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()), archivefs.ArchiveOptions{})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err = fstest.TestFS(a.DirFS("/"), "readme.txt", "docs/guide.md", "docs/empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := a.ReadFile("/docs/guide.md"); string(data) != "# Guide" {
+		t.Errorf("expected '# Guide' but got '%s'", data)
+	}
+
+	if err = a.WriteFile("/new.txt", []byte("x"), 0644); err == nil {
+		t.Errorf("expected writes to be refused")
+	}
+}
+
+func TestArchiveFS_TarGzRoundTrip(t *testing.T) {
+	buffer := &bytes.Buffer{}
+
+	if err := archivefs.WriteTarGz(buffer, newSource(t), "/export"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	a, err := archivefs.NewTarFS(buffer, archivefs.ArchiveOptions{})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err = fstest.TestFS(a.DirFS("/"), "readme.txt", "docs/guide.md", "docs/empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	if a.FileExists("/other.txt") {
+		t.Errorf("expected files outside of the root to be left out")
+	}
+}
+
+func TestArchiveFS_RejectsUnsafePaths(t *testing.T) {
+	zipBuffer := &bytes.Buffer{}
+	zw := zip.NewWriter(zipBuffer)
+	w, _ := zw.Create("../../etc/cron.d/evil")
+	_, _ = w.Write([]byte("* * * * * root rm -rf /"))
+	_ = zw.Close()
+
+	if _, err := archivefs.NewZipFS(bytes.NewReader(zipBuffer.Bytes()), int64(zipBuffer.Len()), archivefs.ArchiveOptions{}); !errors.Is(err, archivefs.ErrUnsafePath) {
+		t.Errorf("expected ErrUnsafePath from zip but got %v", err)
+	}
+
+	tarBuffer := &bytes.Buffer{}
+	tw := tar.NewWriter(tarBuffer)
+	_ = tw.WriteHeader(&tar.Header{Name: "/etc/passwd", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+	_, _ = tw.Write([]byte("x"))
+	_ = tw.Close()
+
+	if _, err := archivefs.NewTarFS(tarBuffer, archivefs.ArchiveOptions{}); !errors.Is(err, archivefs.ErrUnsafePath) {
+		t.Errorf("expected ErrUnsafePath from tar but got %v", err)
+	}
+}
+
+func TestArchiveFS_RejectsBombs(t *testing.T) {
+	source := memoryfs.NewMemoryFS()
+	_ = source.Mkdir("/bomb", 0755)
+	_ = source.WriteFile("/bomb/zeros.bin", make([]byte, 4<<20), 0644)
+
+	zipBuffer := &bytes.Buffer{}
+	_ = archivefs.WriteZip(zipBuffer, source, "/bomb")
+
+	if _, err := archivefs.NewZipFS(bytes.NewReader(zipBuffer.Bytes()), int64(zipBuffer.Len()), archivefs.ArchiveOptions{}); !errors.Is(err, archivefs.ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded for a highly compressed zip but got %v", err)
+	}
+
+	tarBuffer := &bytes.Buffer{}
+	_ = archivefs.WriteTarGz(tarBuffer, source, "/bomb")
+
+	if _, err := archivefs.NewTarFS(tarBuffer, archivefs.ArchiveOptions{MaxRatio: 1000, MaxTotalSize: 1 << 20}); !errors.Is(err, archivefs.ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded for a tar over MaxTotalSize but got %v", err)
+	}
+}
+
+func TestArchiveFS_CountsEveryTarHeader(t *testing.T) {
+	longName := strings.Repeat("a", 120)
+
+	tests := []struct {
+		name    string
+		headers []*tar.Header
+	}{
+		{
+			name: "links and devices",
+			headers: []*tar.Header{
+				{Name: "file.txt", Mode: 0644, Typeflag: tar.TypeReg},
+				{Name: "link", Linkname: "file.txt", Typeflag: tar.TypeSymlink},
+				{Name: "hard", Linkname: "file.txt", Typeflag: tar.TypeLink},
+				{Name: "null", Mode: 0644, Typeflag: tar.TypeChar},
+			},
+		},
+		{
+			name: "GNU long names",
+			headers: []*tar.Header{
+				{Name: longName, Mode: 0644, Typeflag: tar.TypeReg, Format: tar.FormatGNU},
+				{Name: "b" + longName, Mode: 0644, Typeflag: tar.TypeReg, Format: tar.FormatGNU},
+			},
+		},
+		{
+			name: "PAX records",
+			headers: []*tar.Header{
+				{Name: longName, Mode: 0644, Typeflag: tar.TypeReg, Format: tar.FormatPAX},
+				{Name: "b" + longName, Mode: 0644, Typeflag: tar.TypeReg, Format: tar.FormatPAX},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			tw := tar.NewWriter(buffer)
+
+			for _, header := range tt.headers {
+				if err := tw.WriteHeader(header); err != nil {
+					t.Fatalf("unexpected error writing %s: %v", header.Name, err)
+				}
+			}
+
+			_ = tw.Close()
+
+			if _, err := archivefs.NewTarFS(bytes.NewReader(buffer.Bytes()), archivefs.ArchiveOptions{MaxEntries: 3}); !errors.Is(err, archivefs.ErrLimitExceeded) {
+				t.Errorf("expected ErrLimitExceeded with 3 entries allowed but got %v", err)
+			}
+
+			if _, err := archivefs.NewTarFS(bytes.NewReader(buffer.Bytes()), archivefs.ArchiveOptions{MaxEntries: 4}); err != nil {
+				t.Errorf("unexpected error with 4 entries allowed: %v", err)
+			}
+		})
+	}
+}
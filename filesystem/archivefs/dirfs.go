@@ -0,0 +1,19 @@
+package archivefs
+
+import (
+	"io/fs"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+DirFS returns a strict io/fs view of dir, much like os.DirFS. Names must
+be valid according to fs.ValidPath, and the working directory is ignored.
+The result passes the testing/fstest.TestFS conformance checks.
+*/
+func (a *ArchiveFS) DirFS(dir string) fs.FS {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	return filesystem.DirFS(a, a.abs(dir))
+}
@@ -0,0 +1,99 @@
+package archivefs
+
+import (
+	"io"
+	"io/fs"
+	"syscall"
+)
+
+/*
+archiveFile is a file or directory opened for reading. Files stream their
+uncompressed contents. Directories hold their entries, read when the
+directory was opened.
+*/
+type archiveFile struct {
+	closed  bool
+	entries []fs.DirEntry
+	info    fs.FileInfo
+	name    string
+	reader  io.ReadCloser
+}
+
+func (f *archiveFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	f.closed = true
+
+	if f.reader != nil {
+		return f.reader.Close()
+	}
+
+	return nil
+}
+
+func (f *archiveFile) Name() string {
+	return f.name
+}
+
+func (f *archiveFile) Read(b []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	if f.info.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+	}
+
+	return f.reader.Read(b)
+}
+
+func (f *archiveFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	if !f.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+	}
+
+	if n <= 0 {
+		result := f.entries
+		f.entries = nil
+		return result, nil
+	}
+
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(f.entries) {
+		n = len(f.entries)
+	}
+
+	result := f.entries[:n]
+	f.entries = f.entries[n:]
+
+	return result, nil
+}
+
+func (f *archiveFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *archiveFile) Sync() error {
+	if f.closed {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	return nil
+}
+
+func (f *archiveFile) Write(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+}
+
+func (f *archiveFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
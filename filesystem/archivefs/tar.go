@@ -0,0 +1,261 @@
+package archivefs
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+NewTarFS creates a read-only view of a tar archive, which may be
+compressed with gzip. Compression is detected from the first bytes of r.
+
+A tar archive can't be read out of order, so the whole archive is read
+into memory up front, and MaxTotalSize bounds how much memory that takes.
+The limits in options are checked as the archive is read, against the
+bytes actually produced, not just the sizes the headers claim.
+*/
+func NewTarFS(r io.Reader, options ArchiveOptions) (*ArchiveFS, error) {
+	options = options.withDefaults()
+
+	compressed := &countingReader{reader: r}
+	buffered := bufio.NewReader(compressed)
+	var source io.Reader = buffered
+	gzipped := false
+
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(buffered)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer zr.Close()
+
+		source = zr
+		gzipped = true
+	}
+
+	a := newArchiveFS()
+	tr := tar.NewReader(source)
+	entries := 0
+	var total int64
+
+	for {
+		header, err := tr.Next()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if entries += headerRecords(header); entries > options.MaxEntries {
+			return nil, fmt.Errorf("archive has more than %d entries: %w", options.MaxEntries, ErrLimitExceeded)
+		}
+
+		name, err := cleanName(header.Name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if name == "" {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err = a.add(name, newDirEntry("", fs.FileMode(header.Mode).Perm(), header.ModTime)); err != nil {
+				return nil, err
+			}
+
+			continue
+
+		case tar.TypeReg:
+
+		default:
+			continue
+		}
+
+		if header.Size > options.MaxFileSize {
+			return nil, fmt.Errorf("%s is larger than %d bytes: %w", name, options.MaxFileSize, ErrLimitExceeded)
+		}
+
+		if total += header.Size; total > options.MaxTotalSize {
+			return nil, fmt.Errorf("archive is larger than %d bytes: %w", options.MaxTotalSize, ErrLimitExceeded)
+		}
+
+		data, err := io.ReadAll(io.LimitReader(tr, header.Size))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if gzipped {
+			if err = options.checkRatio(name, total, compressed.count); err != nil {
+				return nil, err
+			}
+		}
+
+		e := &entry{
+			info: filesystem.FileInfo{
+				FileSize:     int64(len(data)),
+				FileMode:     fs.FileMode(header.Mode).Perm(),
+				ModifiedTime: header.ModTime,
+			},
+			open: func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(data)), nil
+			},
+		}
+
+		if err = a.add(name, e); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+/*
+headerRecords is the number of tar headers behind header. Every header
+counts against MaxEntries, even for entries that are skipped, such as
+links and devices. archive/tar folds PAX and GNU long name records into
+the header that follows them, so those are counted here too.
+*/
+func headerRecords(header *tar.Header) int {
+	records := 1
+
+	if header.Typeflag != tar.TypeXGlobalHeader && len(header.PAXRecords) > 0 {
+		records++
+	}
+
+	if header.Format == tar.FormatGNU {
+		if len(header.Name) > 100 {
+			records++
+		}
+
+		if len(header.Linkname) > 100 {
+			records++
+		}
+	}
+
+	return records
+}
+
+/*
+WriteTar streams the tree below root in fsys to w as a tar archive. Names
+in the archive are relative to root. Symbolic links and other special
+files are left out.
+*/
+func WriteTar(w io.Writer, fsys filesystem.FileSystem, root string) error {
+	tw := tar.NewWriter(w)
+
+	err := walkTree(fsys, root, func(name string, info fs.FileInfo) error {
+		header, err := tar.FileInfoHeader(info, "")
+
+		if err != nil {
+			return err
+		}
+
+		header.Name = name
+
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err = tw.WriteHeader(header); err != nil || info.IsDir() {
+			return err
+		}
+
+		return copyFile(tw, fsys, root, name)
+	})
+
+	if closeErr := tw.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+/*
+WriteTarGz streams the tree below root in fsys to w as a tar archive
+compressed with gzip
+*/
+func WriteTarGz(w io.Writer, fsys filesystem.FileSystem, root string) error {
+	zw := gzip.NewWriter(w)
+	err := WriteTar(zw, fsys, root)
+
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+/*
+walkTree calls fn for every directory and regular file below root, with
+its slash separated name relative to root
+*/
+func walkTree(fsys filesystem.FileSystem, root string, fn func(name string, info fs.FileInfo) error) error {
+	return filesystem.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+
+		if err != nil || rel == "." {
+			return err
+		}
+
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+
+		if err != nil {
+			return err
+		}
+
+		return fn(filepath.ToSlash(rel), info)
+	})
+}
+
+func copyFile(w io.Writer, fsys filesystem.FileSystem, root, name string) error {
+	f, err := fsys.Open(filepath.Join(root, filepath.FromSlash(name)))
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+/*
+countingReader counts the bytes read through it
+*/
+type countingReader struct {
+	count  int64
+	reader io.Reader
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.reader.Read(b)
+	c.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,127 @@
+package archivefs
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+NewZipFS creates a read-only view of a zip archive. Files are read from r
+as they are opened, so r must stay open while the view is in use.
+
+The archive is refused if it breaks the limits in options, judged by the
+sizes its directory declares. The zip reader fails any file that expands
+past its declared size, so those sizes cannot be used to sneak past the
+limits.
+*/
+func NewZipFS(r io.ReaderAt, size int64, options ArchiveOptions) (*ArchiveFS, error) {
+	zr, err := zip.NewReader(r, size)
+
+	if err != nil {
+		return nil, err
+	}
+
+	options = options.withDefaults()
+
+	if len(zr.File) > options.MaxEntries {
+		return nil, fmt.Errorf("archive has more than %d entries: %w", options.MaxEntries, ErrLimitExceeded)
+	}
+
+	a := newArchiveFS()
+	var total int64
+
+	for _, f := range zr.File {
+		name, err := cleanName(f.Name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		mode := f.Mode()
+
+		if name == "" || (!mode.IsDir() && !mode.IsRegular()) {
+			continue
+		}
+
+		if mode.IsDir() {
+			if err = a.add(name, newDirEntry("", mode.Perm(), f.Modified)); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		uncompressed := int64(f.UncompressedSize64)
+
+		if f.UncompressedSize64 > uint64(options.MaxFileSize) {
+			return nil, fmt.Errorf("%s is larger than %d bytes: %w", name, options.MaxFileSize, ErrLimitExceeded)
+		}
+
+		if err = options.checkRatio(name, uncompressed, int64(f.CompressedSize64)); err != nil {
+			return nil, err
+		}
+
+		if total += uncompressed; total > options.MaxTotalSize {
+			return nil, fmt.Errorf("archive is larger than %d bytes: %w", options.MaxTotalSize, ErrLimitExceeded)
+		}
+
+		e := &entry{
+			info: filesystem.FileInfo{
+				FileSize:     uncompressed,
+				FileMode:     mode.Perm(),
+				ModifiedTime: f.Modified,
+			},
+			open: f.Open,
+		}
+
+		if err = a.add(name, e); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+/*
+WriteZip streams the tree below root in fsys to w as a zip archive. Names
+in the archive are relative to root. Symbolic links and other special
+files are left out.
+*/
+func WriteZip(w io.Writer, fsys filesystem.FileSystem, root string) error {
+	zw := zip.NewWriter(w)
+
+	err := walkTree(fsys, root, func(name string, info fs.FileInfo) error {
+		header, err := zip.FileInfoHeader(info)
+
+		if err != nil {
+			return err
+		}
+
+		header.Name = name
+
+		if info.IsDir() {
+			header.Name += "/"
+			_, err = zw.CreateHeader(header)
+			return err
+		}
+
+		header.Method = zip.Deflate
+		fw, err := zw.CreateHeader(header)
+
+		if err != nil {
+			return err
+		}
+
+		return copyFile(fw, fsys, root, name)
+	})
+
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,82 @@
+package filesystem
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+/*
+AtomicWriteFS describes a file system that can replace a file in one
+step, so readers see either the old contents or the new, and never a
+partly written file
+*/
+type AtomicWriteFS interface {
+	WriteFileAtomic(name string, data []byte, perm fs.FileMode) error
+}
+
+/*
+WriteFileAtomic replaces the named file with data, so a crash or a
+concurrent reader never sees a truncated file. File systems that don't
+implement AtomicWriteFS must implement RenameFS. The data is written to
+a temporary file next to the target, synced, and renamed over it.
+*/
+func WriteFileAtomic(fsys FileSystem, name string, data []byte, perm fs.FileMode) error {
+	if writer, ok := fsys.(AtomicWriteFS); ok {
+		return writer.WriteFileAtomic(name, data, perm)
+	}
+
+	if _, ok := fsys.(RenameFS); !ok {
+		return &fs.PathError{Op: "writeatomic", Path: name, Err: ErrNotSupported}
+	}
+
+	tempName, err := TempName(name)
+
+	if err != nil {
+		return err
+	}
+
+	f, err := fsys.OpenFile(tempName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = Rename(fsys, tempName, name)
+	}
+
+	if err != nil {
+		_ = Remove(fsys, tempName)
+		return err
+	}
+
+	return nil
+}
+
+/*
+TempName returns a hidden, random name in the same directory as name,
+suitable for a temporary file that will be renamed over it
+*/
+func TempName(name string) (string, error) {
+	suffix := make([]byte, 8)
+
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+
+	dir, base := filepath.Split(name)
+	return filepath.Join(dir, "."+base+".tmp-"+hex.EncodeToString(suffix)), nil
+}
@@ -0,0 +1,522 @@
+package blobstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+ErrCorrupt is returned when a blob's contents no longer match its hash
+*/
+var ErrCorrupt = errors.New("blob contents do not match their hash")
+
+/*
+ErrInvalidHash is returned when a hash is not 64 lowercase hex characters
+*/
+var ErrInvalidHash = errors.New("invalid blob hash")
+
+/*
+ErrNotFound is returned when a blob is not in the store. It wraps
+fs.ErrNotExist.
+*/
+var ErrNotFound = fmt.Errorf("blob not found: %w", fs.ErrNotExist)
+
+/*
+staleTempAge is how old a temporary file must be before GC removes it
+*/
+const staleTempAge = time.Hour
+
+/*
+BlobStoreConfig configures a BlobStore.
+
+FileSystem is where blobs are kept, and Root is the directory inside it
+that holds the store. ShardLevels is how many directory levels blobs are
+spread across. Each level uses the next two characters of the hash, so the
+default of 2 stores a blob at "blobs/ab/cd/abcd...".
+*/
+type BlobStoreConfig struct {
+	FileSystem  filesystem.FileSystem
+	Root        string
+	ShardLevels int
+}
+
+/*
+BlobStore is a content-addressable store on top of any FileSystem. Blobs
+are named by the SHA-256 hash of their contents, so storing the same data
+twice keeps a single copy.
+
+Every blob has a reference count. Put adds a reference, and Release drops
+one. Blobs with no references left stay in the store until GC removes
+them. Reads check the data against its hash and fail with ErrCorrupt if
+it has changed.
+
+The file system must support renaming. Changes to reference counts are
+guarded by a mutex, and also by a file lock when the file system
+implements LockFS, so processes that share a store don't lose updates.
+*/
+type BlobStore struct {
+	fs          filesystem.FileSystem
+	lock        sync.Mutex
+	root        string
+	shardLevels int
+}
+
+/*
+GCResult reports what a garbage collection removed
+*/
+type GCResult struct {
+	BlobsRemoved int
+	BytesFreed   int64
+}
+
+/*
+NewBlobStore creates a blob store, making its directories if needed
+*/
+func NewBlobStore(config BlobStoreConfig) (*BlobStore, error) {
+	if config.FileSystem == nil {
+		return nil, fmt.Errorf("blob store requires a file system")
+	}
+
+	if config.ShardLevels <= 0 {
+		config.ShardLevels = 2
+	}
+
+	if config.ShardLevels > 8 {
+		return nil, fmt.Errorf("blob store supports at most 8 shard levels")
+	}
+
+	s := &BlobStore{
+		fs:          config.FileSystem,
+		root:        config.Root,
+		shardLevels: config.ShardLevels,
+	}
+
+	for _, dir := range []string{"blobs", "refs", "tmp"} {
+		if err := s.fs.MkdirAll(filepath.Join(s.root, dir), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+/*
+Put stores everything read from r and adds a reference to it, returning
+the blob's hash. The data is streamed to a temporary file while it is
+hashed, so it is never held in memory all at once. If the store already
+has the blob, the new copy is discarded.
+*/
+func (s *BlobStore) Put(r io.Reader) (string, error) {
+	tempName, err := filesystem.TempName(filepath.Join(s.root, "tmp", "blob"))
+
+	if err != nil {
+		return "", err
+	}
+
+	f, err := s.fs.OpenFile(tempName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), r)
+
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = filesystem.Remove(s.fs, tempName)
+		return "", err
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	err = s.locked(func() error {
+		if s.fs.FileExists(s.blobPath(sum)) {
+			_ = filesystem.Remove(s.fs, tempName)
+		} else {
+			if err := s.fs.MkdirAll(filepath.Dir(s.blobPath(sum)), 0755); err != nil {
+				return err
+			}
+
+			if err := filesystem.Rename(s.fs, tempName, s.blobPath(sum)); err != nil {
+				return err
+			}
+		}
+
+		return s.addRefs(sum, 1)
+	})
+
+	if err != nil {
+		_ = filesystem.Remove(s.fs, tempName)
+		return "", err
+	}
+
+	return sum, nil
+}
+
+/*
+PutBytes stores data and adds a reference to it, returning its hash
+*/
+func (s *BlobStore) PutBytes(data []byte) (string, error) {
+	return s.Put(bytes.NewReader(data))
+}
+
+/*
+Open returns a reader for a blob. The data is hashed as it is read, and
+the read that reaches the end fails with ErrCorrupt if it doesn't match.
+Callers that stop early get no such check.
+*/
+func (s *BlobStore) Open(sum string) (io.ReadCloser, error) {
+	if err := validate(sum); err != nil {
+		return nil, err
+	}
+
+	f, err := s.fs.Open(s.blobPath(sum))
+
+	if err != nil {
+		return nil, s.notFound(sum, err)
+	}
+
+	return &verifyingReader{file: f, hash: sha256.New(), sum: sum}, nil
+}
+
+/*
+Get reads a whole blob into memory and verifies it
+*/
+func (s *BlobStore) Get(sum string) ([]byte, error) {
+	r, err := s.Open(sum)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+/*
+Has reports whether the store holds a blob, whether or not it is still
+referenced
+*/
+func (s *BlobStore) Has(sum string) bool {
+	return validate(sum) == nil && s.fs.FileExists(s.blobPath(sum))
+}
+
+/*
+Stat describes the file that holds a blob
+*/
+func (s *BlobStore) Stat(sum string) (fs.FileInfo, error) {
+	if err := validate(sum); err != nil {
+		return nil, err
+	}
+
+	info, err := s.fs.Stat(s.blobPath(sum))
+
+	if err != nil {
+		return nil, s.notFound(sum, err)
+	}
+
+	return info, nil
+}
+
+/*
+Verify reads a blob and checks it against its hash
+*/
+func (s *BlobStore) Verify(sum string) error {
+	r, err := s.Open(sum)
+
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	_, err = io.Copy(io.Discard, r)
+	return err
+}
+
+/*
+AddRef adds a reference to a blob that is already in the store
+*/
+func (s *BlobStore) AddRef(sum string) error {
+	if err := validate(sum); err != nil {
+		return err
+	}
+
+	return s.locked(func() error {
+		if !s.fs.FileExists(s.blobPath(sum)) {
+			return fmt.Errorf("%s: %w", sum, ErrNotFound)
+		}
+
+		return s.addRefs(sum, 1)
+	})
+}
+
+/*
+Release drops a reference to a blob. When the last one is gone the blob
+is left for GC to remove.
+*/
+func (s *BlobStore) Release(sum string) error {
+	if err := validate(sum); err != nil {
+		return err
+	}
+
+	return s.locked(func() error {
+		count, err := s.refCount(sum)
+
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			return fmt.Errorf("%s has no references to release", sum)
+		}
+
+		return s.addRefs(sum, -1)
+	})
+}
+
+/*
+RefCount returns the number of references to a blob
+*/
+func (s *BlobStore) RefCount(sum string) (int, error) {
+	if err := validate(sum); err != nil {
+		return 0, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.refCount(sum)
+}
+
+/*
+GC removes every blob with no references. It also removes temporary
+files more than an hour old, which are left behind by writes that never
+finished.
+*/
+func (s *BlobStore) GC() (GCResult, error) {
+	result := GCResult{}
+
+	err := s.locked(func() error {
+		err := filesystem.WalkDir(s.fs, filepath.Join(s.root, "blobs"), func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+
+			sum := d.Name()
+
+			if validate(sum) != nil {
+				return nil
+			}
+
+			count, err := s.refCount(sum)
+
+			if err != nil || count > 0 {
+				return err
+			}
+
+			info, err := d.Info()
+
+			if err != nil {
+				return err
+			}
+
+			if err = filesystem.Remove(s.fs, p); err != nil {
+				return err
+			}
+
+			result.BlobsRemoved++
+			result.BytesFreed += info.Size()
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return s.removeTemp()
+	})
+
+	return result, err
+}
+
+/*
+removeTemp removes temporary files old enough that the write that made
+them must have been abandoned
+*/
+func (s *BlobStore) removeTemp() error {
+	entries, err := s.fs.ReadDir(filepath.Join(s.root, "tmp"))
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if time.Since(info.ModTime()) < staleTempAge {
+			continue
+		}
+
+		if err = filesystem.Remove(s.fs, filepath.Join(s.root, "tmp", entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+locked runs fn while holding the store's mutex and, when the file system
+supports it, an exclusive lock on the store's lock file
+*/
+func (s *BlobStore) locked(fn func() error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.fs.(filesystem.LockFS); ok {
+		fileLock, err := filesystem.Lock(s.fs, filepath.Join(s.root, "lock"), filesystem.LockOptions{})
+
+		if err != nil {
+			return err
+		}
+
+		defer fileLock.Unlock()
+	}
+
+	return fn()
+}
+
+func (s *BlobStore) refCount(sum string) (int, error) {
+	data, err := s.fs.ReadFile(s.refPath(sum))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func (s *BlobStore) addRefs(sum string, delta int) error {
+	count, err := s.refCount(sum)
+
+	if err != nil {
+		return err
+	}
+
+	count += delta
+
+	if count <= 0 {
+		err = filesystem.Remove(s.fs, s.refPath(sum))
+
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	if err = s.fs.MkdirAll(filepath.Dir(s.refPath(sum)), 0755); err != nil {
+		return err
+	}
+
+	return filesystem.WriteFileAtomic(s.fs, s.refPath(sum), []byte(strconv.Itoa(count)), 0644)
+}
+
+func (s *BlobStore) blobPath(sum string) string {
+	return s.shardedPath("blobs", sum)
+}
+
+func (s *BlobStore) refPath(sum string) string {
+	return s.shardedPath("refs", sum)
+}
+
+func (s *BlobStore) shardedPath(dir, sum string) string {
+	parts := []string{s.root, dir}
+
+	for level := 0; level < s.shardLevels; level++ {
+		parts = append(parts, sum[level*2:level*2+2])
+	}
+
+	return filepath.Join(append(parts, sum)...)
+}
+
+func (s *BlobStore) notFound(sum string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w", sum, ErrNotFound)
+	}
+
+	return err
+}
+
+func validate(sum string) error {
+	if len(sum) != sha256.Size*2 {
+		return fmt.Errorf("%q: %w", sum, ErrInvalidHash)
+	}
+
+	for _, c := range sum {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			return fmt.Errorf("%q: %w", sum, ErrInvalidHash)
+		}
+	}
+
+	return nil
+}
+
+/*
+verifyingReader hashes a blob as it is read and checks the hash at the end
+*/
+type verifyingReader struct {
+	file fs.File
+	hash hash.Hash
+	sum  string
+}
+
+func (r *verifyingReader) Read(b []byte) (int, error) {
+	n, err := r.file.Read(b)
+	r.hash.Write(b[:n])
+
+	if err == io.EOF && hex.EncodeToString(r.hash.Sum(nil)) != r.sum {
+		return n, fmt.Errorf("%s: %w", r.sum, ErrCorrupt)
+	}
+
+	return n, err
+}
+
+func (r *verifyingReader) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,83 @@
+package blobstore_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/filesystem/blobstore"
+	"github.com/app-nerds/kit/v6/filesystem/memoryfs"
+)
+
+func TestBlobStore_DeduplicatesAndCollects(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+	store, err := blobstore.NewBlobStore(blobstore.BlobStoreConfig{FileSystem: mfs, Root: "/cas"})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	first, err := store.Put(strings.NewReader("hello world"))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	second, _ := store.PutBytes([]byte("hello world"))
+	expected := sha256.Sum256([]byte("hello world"))
+
+	if first != hex.EncodeToString(expected[:]) || second != first {
+		t.Errorf("expected both puts to return %x but got %s and %s", expected, first, second)
+	}
+
+	path := "/cas/blobs/" + first[0:2] + "/" + first[2:4] + "/" + first
+
+	if !mfs.FileExists(path) {
+		t.Errorf("expected the blob at %s", path)
+	}
+
+	if count, _ := store.RefCount(first); count != 2 {
+		t.Errorf("expected 2 references but got %d", count)
+	}
+
+	_ = store.Release(first)
+
+	if result, _ := store.GC(); result.BlobsRemoved != 0 {
+		t.Errorf("expected a referenced blob to survive GC but %d were removed", result.BlobsRemoved)
+	}
+
+	_ = store.Release(first)
+	result, err := store.GC()
+
+	if err != nil || result.BlobsRemoved != 1 || result.BytesFreed != 11 {
+		t.Errorf("expected 1 blob and 11 bytes freed but got %+v, %v", result, err)
+	}
+
+	if _, err = store.Get(first); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist but got %v", err)
+	}
+}
+
+func TestBlobStore_DetectsCorruption(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+	store, _ := blobstore.NewBlobStore(blobstore.BlobStoreConfig{FileSystem: mfs, Root: "/cas", ShardLevels: 1})
+
+	sum, _ := store.PutBytes([]byte("original"))
+
+	if data, err := store.Get(sum); err != nil || string(data) != "original" {
+		t.Errorf("expected 'original' but got '%s', %v", data, err)
+	}
+
+	_ = mfs.WriteFile("/cas/blobs/"+sum[0:2]+"/"+sum, []byte("tampered"), 0644)
+
+	if err := store.Verify(sum); !errors.Is(err, blobstore.ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt but got %v", err)
+	}
+
+	if _, err := store.Get("../../etc/passwd"); !errors.Is(err, blobstore.ErrInvalidHash) {
+		t.Errorf("expected ErrInvalidHash but got %v", err)
+	}
+}
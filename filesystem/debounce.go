@@ -0,0 +1,143 @@
+package filesystem
+
+import (
+	"sync"
+	"time"
+)
+
+type debouncedWatcher struct {
+	delay   time.Duration
+	done    chan struct{}
+	events  chan Event
+	fired   chan debounceFire
+	inner   Watcher
+	lock    sync.Mutex
+	pending map[string]*debouncePending
+}
+
+type debouncePending struct {
+	event      Event
+	generation int
+	timer      *time.Timer
+}
+
+type debounceFire struct {
+	generation int
+	name       string
+}
+
+/*
+NewDebouncedWatcher wraps a watcher so that events for the same path are
+held until the path has been quiet for delay. They are then delivered as
+one event, with all of their operations combined. A delay of zero returns
+the watcher unchanged.
+*/
+func NewDebouncedWatcher(inner Watcher, delay time.Duration) Watcher {
+	if delay <= 0 {
+		return inner
+	}
+
+	w := &debouncedWatcher{
+		delay:   delay,
+		done:    make(chan struct{}),
+		events:  make(chan Event, cap(inner.Events())+1),
+		fired:   make(chan debounceFire),
+		inner:   inner,
+		pending: map[string]*debouncePending{},
+	}
+
+	go w.run()
+	return w
+}
+
+func (w *debouncedWatcher) Close() error {
+	return w.inner.Close()
+}
+
+func (w *debouncedWatcher) Errors() <-chan error {
+	return w.inner.Errors()
+}
+
+func (w *debouncedWatcher) Events() <-chan Event {
+	return w.events
+}
+
+func (w *debouncedWatcher) run() {
+	defer func() {
+		close(w.done)
+		close(w.events)
+	}()
+
+	for {
+		select {
+		case event, ok := <-w.inner.Events():
+			if !ok {
+				w.flush()
+				return
+			}
+
+			w.add(event)
+
+		case fire := <-w.fired:
+			w.lock.Lock()
+			item, ok := w.pending[fire.name]
+
+			if !ok || item.generation != fire.generation {
+				w.lock.Unlock()
+				continue
+			}
+
+			delete(w.pending, fire.name)
+			w.lock.Unlock()
+
+			w.events <- item.event
+		}
+	}
+}
+
+func (w *debouncedWatcher) add(event Event) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	item, ok := w.pending[event.Name]
+
+	if !ok {
+		item = &debouncePending{event: event}
+		w.pending[event.Name] = item
+	} else {
+		item.timer.Stop()
+		item.event.Op |= event.Op
+
+		if item.event.OldName == "" {
+			item.event.OldName = event.OldName
+		}
+	}
+
+	item.generation++
+	fire := debounceFire{generation: item.generation, name: event.Name}
+
+	item.timer = time.AfterFunc(w.delay, func() {
+		select {
+		case w.fired <- fire:
+		case <-w.done:
+		}
+	})
+}
+
+/*
+flush delivers everything still pending once the inner watcher closes
+*/
+func (w *debouncedWatcher) flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for name, item := range w.pending {
+		item.timer.Stop()
+		delete(w.pending, name)
+
+		select {
+		case w.events <- item.event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package filesystem
+
+import (
+	"io/fs"
+	"path"
+)
+
+/*
+dirFS is a strict io/fs view of a directory in a FileSystem. Names must
+be valid according to fs.ValidPath, so absolute paths and ".." are
+rejected, and the working directory is ignored.
+*/
+type dirFS struct {
+	fsys FileSystem
+	dir  string
+}
+
+/*
+DirFS returns an fs.FS rooted at dir, much like os.DirFS. dir should be
+absolute, since the file system's working directory is not consulted
+again. The result also implements fs.ReadFileFS, fs.ReadDirFS, and
+fs.StatFS. File systems use it to provide their own DirFS methods.
+*/
+func DirFS(fsys FileSystem, dir string) fs.FS {
+	return &dirFS{
+		fsys: fsys,
+		dir:  dir,
+	}
+}
+
+func (d *dirFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return d.fsys.Open(path.Join(d.dir, name))
+}
+
+func (d *dirFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return d.fsys.ReadFile(path.Join(d.dir, name))
+}
+
+func (d *dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return d.fsys.ReadDir(path.Join(d.dir, name))
+}
+
+func (d *dirFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return d.fsys.Stat(path.Join(d.dir, name))
+}
@@ -0,0 +1,214 @@
+package encryptfs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+/*
+An encrypted file starts with a header, followed by the file's contents
+in chunks.
+
+The header is the magic bytes, a version, and the file's data key wrapped
+by the master key: a random nonce followed by the key sealed with
+AES-256-GCM. Each chunk holds up to chunkSize bytes of the file, sealed
+with the data key under its own random nonce. A chunk's additional data is
+the header, the chunk's index, and whether it is the last chunk, so chunks
+can't be reordered, moved between files, or cut off the end unnoticed.
+Every file has at least one chunk, even when it is empty.
+*/
+const (
+	chunkSize  = 64 * 1024
+	keySize    = 32
+	nonceSize  = 12
+	tagSize    = 16
+	recordSize = nonceSize + chunkSize + tagSize
+	headerSize = len(magic) + 1 + nonceSize + keySize + tagSize
+	version    = 1
+	magic      = "KENC"
+)
+
+/*
+keys holds the keys derived from the master key. Each job gets its own
+key, so none is ever used for two purposes.
+*/
+type keys struct {
+	wrap   cipher.AEAD
+	name   cipher.AEAD
+	nameIV []byte
+}
+
+func deriveKeys(master []byte) (*keys, error) {
+	wrap, err := newGCM(derive(master, "encryptfs key wrap"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := newGCM(derive(master, "encryptfs names"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &keys{
+		wrap:   wrap,
+		name:   name,
+		nameIV: derive(master, "encryptfs name iv"),
+	}, nil
+}
+
+func derive(master []byte, label string) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+/*
+newHeader makes a random data key and returns it with the header that
+holds it wrapped by the master key
+*/
+func (k *keys) newHeader() ([]byte, cipher.AEAD, error) {
+	dataKey := make([]byte, keySize)
+	nonce := make([]byte, nonceSize)
+
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, version)
+	prefix := header[:len(header):len(header)]
+	header = append(header, nonce...)
+	header = k.wrap.Seal(header, nonce, dataKey, prefix)
+	data, err := newGCM(dataKey)
+
+	return header, data, err
+}
+
+/*
+openHeader checks a header and unwraps the data key inside it
+*/
+func (k *keys) openHeader(header []byte) (cipher.AEAD, error) {
+	if len(header) != headerSize || string(header[:len(magic)]) != magic {
+		return nil, ErrCorrupt
+	}
+
+	if header[len(magic)] != version {
+		return nil, fmt.Errorf("unsupported encrypted file version %d: %w", header[len(magic)], ErrCorrupt)
+	}
+
+	prefix := header[:len(magic)+1]
+	nonce := header[len(prefix) : len(prefix)+nonceSize]
+	dataKey, err := k.wrap.Open(nil, nonce, header[len(prefix)+nonceSize:], prefix)
+
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+
+	return newGCM(dataKey)
+}
+
+func sealChunk(data cipher.AEAD, header []byte, index int64, final bool, plain []byte) ([]byte, error) {
+	nonce := make([]byte, nonceSize, nonceSize+len(plain)+tagSize)
+
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return data.Seal(nonce, nonce, plain, chunkAD(header, index, final)), nil
+}
+
+func openChunk(data cipher.AEAD, header []byte, index int64, final bool, record []byte) ([]byte, error) {
+	if len(record) < nonceSize+tagSize {
+		return nil, ErrCorrupt
+	}
+
+	plain, err := data.Open(nil, record[:nonceSize], record[nonceSize:], chunkAD(header, index, final))
+
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+
+	return plain, nil
+}
+
+func chunkAD(header []byte, index int64, final bool) []byte {
+	ad := make([]byte, len(header)+9)
+	copy(ad, header)
+	binary.BigEndian.PutUint64(ad[len(header):], uint64(index))
+
+	if final {
+		ad[len(ad)-1] = 1
+	}
+
+	return ad
+}
+
+/*
+plainSize works out the size of a file's contents from the size of the
+encrypted file holding them
+*/
+func plainSize(encrypted int64) int64 {
+	body := encrypted - int64(headerSize)
+
+	if body < nonceSize+tagSize {
+		return 0
+	}
+
+	chunks := (body + recordSize - 1) / recordSize
+	last := body - (chunks-1)*recordSize
+
+	return (chunks-1)*chunkSize + last - nonceSize - tagSize
+}
+
+/*
+encryptName seals one element of a path. The nonce is derived from the
+name itself, so the same name always encrypts the same way and can be
+looked up.
+*/
+func (k *keys) encryptName(name string) string {
+	mac := hmac.New(sha256.New, k.nameIV)
+	mac.Write([]byte(name))
+	nonce := mac.Sum(nil)[:nonceSize]
+
+	return base64.RawURLEncoding.EncodeToString(k.name.Seal(nonce, nonce, []byte(name), nil))
+}
+
+func (k *keys) decryptName(encrypted string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(encrypted)
+
+	if err != nil || len(sealed) < nonceSize+tagSize {
+		return "", ErrCorrupt
+	}
+
+	plain, err := k.name.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+
+	if err != nil {
+		return "", ErrCorrupt
+	}
+
+	return string(plain), nil
+}
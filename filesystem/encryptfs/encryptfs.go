@@ -0,0 +1,333 @@
+package encryptfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+ErrCorrupt is returned when an encrypted file or name fails to decrypt.
+Either it has been damaged or tampered with, or it was written with a
+different master key.
+*/
+var ErrCorrupt = errors.New("encrypted data is corrupt or was written with a different key")
+
+/*
+ErrInvalidKey is returned when the master key is not 32 bytes long
+*/
+var ErrInvalidKey = errors.New("master key must be 32 bytes")
+
+/*
+EncryptFSConfig configures an EncryptFS.
+
+MasterKey is the 32 byte key that protects every file's data key. Keep it
+outside of the file system it protects. When EncryptNames is set, every
+element of every path is encrypted too. Encrypted names are longer than
+the originals, so names over about 150 bytes may be too long for the
+underlying file system.
+*/
+type EncryptFSConfig struct {
+	EncryptNames bool
+	MasterKey    []byte
+}
+
+/*
+EncryptFS wraps another file system and encrypts everything written to
+it. This implements FileSystem, RemoveFS, and RenameFS.
+
+Each file gets its own random data key, which is stored at the start of
+the file, wrapped by the master key. The contents are split into 64 KiB
+chunks, and each chunk is sealed with AES-256-GCM. Chunks are checked as
+they are read, so damage or tampering is reported as ErrCorrupt rather
+than returned as data. Because each chunk stands alone, files can be
+read with Seek and ReadAt without decrypting what comes before, as long
+as the wrapped file system's files support them.
+
+Files are written whole. Opening a file for writing replaces it, and
+appending to or changing an existing file fails with ErrNotSupported.
+File sizes reported by Stat and ReadDir are the sizes of the decrypted
+contents.
+*/
+type EncryptFS struct {
+	base         filesystem.FileSystem
+	encryptNames bool
+	keys         *keys
+}
+
+/*
+NewEncryptFS creates a file system that encrypts everything it stores in
+base
+*/
+func NewEncryptFS(base filesystem.FileSystem, config EncryptFSConfig) (*EncryptFS, error) {
+	if len(config.MasterKey) != keySize {
+		return nil, ErrInvalidKey
+	}
+
+	k, err := deriveKeys(config.MasterKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptFS{
+		base:         base,
+		encryptNames: config.EncryptNames,
+		keys:         k,
+	}, nil
+}
+
+func (e *EncryptFS) Chdir(dir string) error {
+	return e.rename(e.base.Chdir(e.path(dir)), dir)
+}
+
+func (e *EncryptFS) Create(name string) (filesystem.WritableFile, error) {
+	return e.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (e *EncryptFS) Mkdir(name string, perm fs.FileMode) error {
+	return e.rename(e.base.Mkdir(e.path(name), perm), name)
+}
+
+func (e *EncryptFS) MkdirAll(path string, perm fs.FileMode) error {
+	return e.rename(e.base.MkdirAll(e.path(path), perm), path)
+}
+
+func (e *EncryptFS) Open(name string) (fs.File, error) {
+	return e.OpenFile(name, os.O_RDONLY, 0)
+}
+
+/*
+OpenFile opens a file. Opening for writing always starts the file over,
+as if O_TRUNC were given. O_APPEND, or writing to a file that already
+has contents without O_TRUNC, fails with ErrNotSupported.
+*/
+func (e *EncryptFS) OpenFile(name string, flag int, perm os.FileMode) (filesystem.WritableFile, error) {
+	p := e.path(name)
+
+	if flag&os.O_APPEND != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: filesystem.ErrNotSupported}
+	}
+
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		f, err := e.base.OpenFile(p, flag, perm)
+
+		if err != nil {
+			return nil, e.rename(err, name)
+		}
+
+		return e.newReader(f, name)
+	}
+
+	if flag&os.O_TRUNC == 0 {
+		if info, err := e.base.Stat(p); err == nil && info.Size() > 0 {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: filesystem.ErrNotSupported}
+		}
+	}
+
+	f, err := e.base.OpenFile(p, flag&^os.O_RDWR|os.O_WRONLY|os.O_TRUNC, perm)
+
+	if err != nil {
+		return nil, e.rename(err, name)
+	}
+
+	return e.newWriter(f, name)
+}
+
+func (e *EncryptFS) ReadFile(name string) ([]byte, error) {
+	f, err := e.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func (e *EncryptFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := e.base.Stat(e.path(name))
+
+	if err != nil {
+		return nil, e.rename(err, name)
+	}
+
+	return e.info(info), nil
+}
+
+func (e *EncryptFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	f, err := e.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+/*
+ReadDir returns the entries of a directory, sorted by name. When names
+are encrypted, entries whose names can't be decrypted are left out.
+*/
+func (e *EncryptFS) ReadDir(dir string) ([]fs.DirEntry, error) {
+	entries, err := e.base.ReadDir(e.path(dir))
+
+	if err != nil {
+		return nil, e.rename(err, dir)
+	}
+
+	result := e.dirEntries(entries)
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+
+	return result, nil
+}
+
+func (e *EncryptFS) FileExists(file string) bool {
+	return e.base.FileExists(e.path(file))
+}
+
+func (e *EncryptFS) Remove(name string) error {
+	return e.rename(filesystem.Remove(e.base, e.path(name)), name)
+}
+
+func (e *EncryptFS) RemoveAll(path string) error {
+	return e.rename(filesystem.RemoveAll(e.base, e.path(path)), path)
+}
+
+func (e *EncryptFS) Rename(oldPath, newPath string) error {
+	err := filesystem.Rename(e.base, e.path(oldPath), e.path(newPath))
+	var linkErr *os.LinkError
+
+	if errors.As(err, &linkErr) {
+		return &os.LinkError{Op: linkErr.Op, Old: oldPath, New: newPath, Err: linkErr.Err}
+	}
+
+	return e.rename(err, oldPath)
+}
+
+/*
+path turns a name into the name used in the wrapped file system,
+encrypting each element when names are encrypted
+*/
+func (e *EncryptFS) path(name string) string {
+	if !e.encryptNames {
+		return name
+	}
+
+	parts := strings.Split(filepath.ToSlash(name), "/")
+
+	for i, part := range parts {
+		if part != "" && part != "." && part != ".." {
+			parts[i] = e.keys.encryptName(part)
+		}
+	}
+
+	return strings.Join(parts, "/")
+}
+
+/*
+baseName decrypts a name read from the wrapped file system. Names that
+aren't encrypted, such as the root directory, are returned as they are.
+*/
+func (e *EncryptFS) baseName(name string) (string, error) {
+	if !e.encryptNames || name == "/" || name == "." {
+		return name, nil
+	}
+
+	return e.keys.decryptName(name)
+}
+
+func (e *EncryptFS) info(info fs.FileInfo) fs.FileInfo {
+	name, err := e.baseName(info.Name())
+
+	if err != nil {
+		name = info.Name()
+	}
+
+	return fileInfo{FileInfo: info, name: name}
+}
+
+func (e *EncryptFS) dirEntries(entries []fs.DirEntry) []fs.DirEntry {
+	result := make([]fs.DirEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		name, err := e.baseName(entry.Name())
+
+		if err != nil {
+			continue
+		}
+
+		result = append(result, dirEntry{DirEntry: entry, fs: e, name: name})
+	}
+
+	return result
+}
+
+/*
+rename replaces the path in an error from the wrapped file system with
+the name the caller used, so encrypted names never leak out
+*/
+func (e *EncryptFS) rename(err error, name string) error {
+	var pathErr *fs.PathError
+
+	if errors.As(err, &pathErr) {
+		return &fs.PathError{Op: pathErr.Op, Path: name, Err: pathErr.Err}
+	}
+
+	return err
+}
+
+/*
+fileInfo reports the decrypted name and size of a file
+*/
+type fileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (fi fileInfo) Name() string {
+	return fi.name
+}
+
+func (fi fileInfo) Size() int64 {
+	if !fi.FileInfo.Mode().IsRegular() {
+		return fi.FileInfo.Size()
+	}
+
+	return plainSize(fi.FileInfo.Size())
+}
+
+type dirEntry struct {
+	fs.DirEntry
+	fs   *EncryptFS
+	name string
+}
+
+func (d dirEntry) Name() string {
+	return d.name
+}
+
+func (d dirEntry) Info() (fs.FileInfo, error) {
+	info, err := d.DirEntry.Info()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return fileInfo{FileInfo: info, name: d.name}, nil
+}
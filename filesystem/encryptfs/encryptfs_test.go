@@ -0,0 +1,120 @@
+package encryptfs_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/filesystem/encryptfs"
+	"github.com/app-nerds/kit/v6/filesystem/localfs"
+	"github.com/app-nerds/kit/v6/filesystem/memoryfs"
+)
+
+var masterKey = bytes.Repeat([]byte{7}, 32)
+
+func TestEncryptFS_RoundTripAndSeek(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+	efs, err := encryptfs.NewEncryptFS(mfs, encryptfs.EncryptFSConfig{EncryptNames: true, MasterKey: masterKey})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	data := make([]byte, 200*1024)
+	_, _ = rand.Read(data)
+
+	_ = efs.MkdirAll("/customers/acme", 0755)
+
+	if err = efs.WriteFile("/customers/acme/contract.pdf", data, 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if mfs.FileExists("/customers") {
+		t.Errorf("expected directory names to be encrypted")
+	}
+
+	entries, _ := efs.ReadDir("/customers/acme")
+
+	if len(entries) != 1 || entries[0].Name() != "contract.pdf" {
+		t.Fatalf("expected contract.pdf but got %v", entries)
+	}
+
+	if info, _ := entries[0].Info(); info.Size() != int64(len(data)) {
+		t.Errorf("expected size %d but got %d", len(data), info.Size())
+	}
+
+	read, err := efs.ReadFile("/customers/acme/contract.pdf")
+
+	if err != nil || !bytes.Equal(read, data) {
+		t.Fatalf("expected the original data back but got %d bytes, %v", len(read), err)
+	}
+
+	f, _ := efs.Open("/customers/acme/contract.pdf")
+	defer f.Close()
+
+	buffer := make([]byte, 100)
+	offset := int64(64*1024 - 50)
+
+	if n, err := f.(io.ReaderAt).ReadAt(buffer, offset); n != 100 || err != nil || !bytes.Equal(buffer, data[offset:offset+100]) {
+		t.Errorf("expected a read across the chunk boundary but got %d, %v", n, err)
+	}
+
+	_, _ = f.(io.Seeker).Seek(-10, io.SeekEnd)
+
+	if tail, _ := io.ReadAll(f); !bytes.Equal(tail, data[len(data)-10:]) {
+		t.Errorf("expected the last 10 bytes after seeking but got %v", tail)
+	}
+}
+
+func TestEncryptFS_DetectsTamperingAndWrongKeys(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+	efs, _ := encryptfs.NewEncryptFS(mfs, encryptfs.EncryptFSConfig{MasterKey: masterKey})
+
+	_ = efs.WriteFile("/secret.txt", []byte("the launch codes"), 0644)
+
+	raw, _ := mfs.ReadFile("/secret.txt")
+
+	if bytes.Contains(raw, []byte("launch")) {
+		t.Errorf("expected the contents to be encrypted")
+	}
+
+	other, _ := encryptfs.NewEncryptFS(mfs, encryptfs.EncryptFSConfig{MasterKey: bytes.Repeat([]byte{8}, 32)})
+
+	if _, err := other.ReadFile("/secret.txt"); !errors.Is(err, encryptfs.ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt with the wrong key but got %v", err)
+	}
+
+	raw[len(raw)-1] ^= 1
+	_ = mfs.WriteFile("/secret.txt", raw, 0644)
+
+	if _, err := efs.ReadFile("/secret.txt"); !errors.Is(err, encryptfs.ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt after tampering but got %v", err)
+	}
+
+	_ = mfs.WriteFile("/secret.txt", raw[:len(raw)-5], 0644)
+
+	if _, err := efs.ReadFile("/secret.txt"); !errors.Is(err, encryptfs.ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt after truncation but got %v", err)
+	}
+}
+
+func TestEncryptFS_LocalFS(t *testing.T) {
+	dir := t.TempDir()
+	efs, _ := encryptfs.NewEncryptFS(localfs.NewLocalFS(), encryptfs.EncryptFSConfig{MasterKey: masterKey})
+	name := filepath.Join(dir, "empty.txt")
+
+	if err := efs.WriteFile(name, nil, 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if info, err := efs.Stat(name); err != nil || info.Size() != 0 {
+		t.Errorf("expected an empty file but got %v, %v", info, err)
+	}
+
+	if data, err := efs.ReadFile(name); err != nil || len(data) != 0 {
+		t.Errorf("expected no data but got %v, %v", data, err)
+	}
+}
@@ -0,0 +1,327 @@
+package encryptfs
+
+import (
+	"crypto/cipher"
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+	"syscall"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+EncryptedFile is a file opened for reading. Chunks are decrypted as they
+are reached, and the most recent one is kept so small reads don't
+decrypt it again. When the wrapped file supports ReadAt or Seek, so does
+this one. Otherwise it can only be read from start to end. This
+implements WritableFile, but writes always fail.
+*/
+type EncryptedFile struct {
+	base       fs.File
+	chunk      []byte
+	chunkIndex int64
+	chunks     int64
+	closed     bool
+	data       cipher.AEAD
+	encSize    int64
+	fs         *EncryptFS
+	header     []byte
+	info       fs.FileInfo
+	lock       sync.Mutex
+	name       string
+	next       int64
+	offset     int64
+	size       int64
+}
+
+func (e *EncryptFS) newReader(f fs.File, name string) (filesystem.WritableFile, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		_ = f.Close()
+		return nil, e.rename(err, name)
+	}
+
+	if info.IsDir() {
+		return &encryptedDir{base: f, fs: e, info: e.info(info), name: name}, nil
+	}
+
+	header := make([]byte, headerSize)
+
+	if _, err = io.ReadFull(f, header); err != nil {
+		_ = f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrCorrupt}
+	}
+
+	data, err := e.keys.openHeader(header)
+
+	if err != nil {
+		_ = f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	chunks := (info.Size() - int64(headerSize) + recordSize - 1) / recordSize
+
+	if chunks < 1 {
+		_ = f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrCorrupt}
+	}
+
+	return &EncryptedFile{
+		base:       f,
+		chunkIndex: -1,
+		chunks:     chunks,
+		data:       data,
+		encSize:    info.Size(),
+		fs:         e,
+		header:     header,
+		info:       e.info(info),
+		name:       name,
+		size:       plainSize(info.Size()),
+	}, nil
+}
+
+func (f *EncryptedFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	f.closed = true
+	return f.base.Close()
+}
+
+func (f *EncryptedFile) Name() string {
+	return f.name
+}
+
+func (f *EncryptedFile) Read(b []byte) (int, error) {
+	n, err := f.ReadAt(b, f.offset)
+	f.offset += int64(n)
+
+	if errors.Is(err, io.EOF) && n > 0 {
+		err = nil
+	}
+
+	return n, err
+}
+
+/*
+ReadAt reads from the given offset. Reading anywhere but straight after
+the previous read needs a wrapped file that supports ReadAt or Seek.
+*/
+func (f *EncryptedFile) ReadAt(b []byte, offset int64) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	total := 0
+
+	for total < len(b) {
+		if offset >= f.size {
+			return total, io.EOF
+		}
+
+		chunk, err := f.load(offset / chunkSize)
+
+		if err != nil {
+			return total, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+
+		n := copy(b[total:], chunk[offset%chunkSize:])
+		total += n
+		offset += int64(n)
+	}
+
+	return total, nil
+}
+
+/*
+Seek sets the offset of the next Read. Seeking is always allowed, but a
+read at the new offset needs a wrapped file that supports ReadAt or Seek.
+*/
+func (f *EncryptedFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+
+	case io.SeekEnd:
+		offset += f.size
+	}
+
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *EncryptedFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *EncryptedFile) Sync() error {
+	if f.closed {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	return nil
+}
+
+func (f *EncryptedFile) Write(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+}
+
+func (f *EncryptedFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+/*
+load decrypts a chunk, unless it is the one already held
+*/
+func (f *EncryptedFile) load(index int64) ([]byte, error) {
+	if index == f.chunkIndex {
+		return f.chunk, nil
+	}
+
+	offset := int64(headerSize) + index*recordSize
+	length := f.encSize - offset
+
+	if length > recordSize {
+		length = recordSize
+	}
+
+	record := make([]byte, length)
+
+	if err := f.readRecord(record, index, offset); err != nil {
+		return nil, err
+	}
+
+	chunk, err := openChunk(f.data, f.header, index, index == f.chunks-1, record)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f.chunk = chunk
+	f.chunkIndex = index
+
+	return chunk, nil
+}
+
+func (f *EncryptedFile) readRecord(record []byte, index, offset int64) error {
+	var n int
+	var err error
+
+	switch base := f.base.(type) {
+	case io.ReaderAt:
+		n, err = base.ReadAt(record, offset)
+
+	case io.Seeker:
+		if _, err = base.Seek(offset, io.SeekStart); err == nil {
+			n, err = io.ReadFull(f.base, record)
+		}
+
+	default:
+		if index != f.next {
+			return syscall.ESPIPE
+		}
+
+		n, err = io.ReadFull(f.base, record)
+	}
+
+	if n == len(record) {
+		f.next = index + 1
+		return nil
+	}
+
+	if err == nil || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrCorrupt
+	}
+
+	return err
+}
+
+/*
+encryptedDir is a directory opened for reading. Its entries report
+decrypted names and sizes.
+*/
+type encryptedDir struct {
+	base   fs.File
+	closed bool
+	fs     *EncryptFS
+	info   fs.FileInfo
+	name   string
+}
+
+func (d *encryptedDir) Close() error {
+	if d.closed {
+		return &fs.PathError{Op: "close", Path: d.name, Err: fs.ErrClosed}
+	}
+
+	d.closed = true
+	return d.base.Close()
+}
+
+func (d *encryptedDir) Name() string {
+	return d.name
+}
+
+func (d *encryptedDir) Read(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: syscall.EISDIR}
+}
+
+/*
+ReadDir reads entries from the directory. Entries whose names can't be
+decrypted are skipped, so a call may need more than one read of the
+wrapped directory to return anything.
+*/
+func (d *encryptedDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: fs.ErrClosed}
+	}
+
+	dir, ok := d.base.(fs.ReadDirFile)
+
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: syscall.ENOTDIR}
+	}
+
+	for {
+		entries, err := dir.ReadDir(n)
+		result := d.fs.dirEntries(entries)
+
+		if len(result) > 0 || err != nil || n <= 0 {
+			return result, err
+		}
+	}
+}
+
+func (d *encryptedDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *encryptedDir) Sync() error {
+	return nil
+}
+
+func (d *encryptedDir) Write(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: d.name, Err: syscall.EISDIR}
+}
+
+func (d *encryptedDir) WriteString(s string) (int, error) {
+	return d.Write([]byte(s))
+}
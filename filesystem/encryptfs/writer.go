@@ -0,0 +1,182 @@
+package encryptfs
+
+import (
+	"crypto/cipher"
+	"errors"
+	"io/fs"
+	"time"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+EncryptedWriter is a file opened for writing. Writes are gathered into
+chunks, and each chunk is sealed and written once it is full and more
+data follows. The last chunk is written by Close, so the file is only
+complete once Close succeeds.
+*/
+type EncryptedWriter struct {
+	base    filesystem.WritableFile
+	buffer  []byte
+	closed  bool
+	data    cipher.AEAD
+	err     error
+	header  []byte
+	index   int64
+	modTime time.Time
+	name    string
+	size    int64
+}
+
+func (e *EncryptFS) newWriter(f filesystem.WritableFile, name string) (filesystem.WritableFile, error) {
+	header, data, err := e.keys.newHeader()
+
+	if err == nil {
+		_, err = f.Write(header)
+	}
+
+	if err != nil {
+		_ = f.Close()
+		return nil, e.rename(err, name)
+	}
+
+	return &EncryptedWriter{
+		base:    f,
+		buffer:  make([]byte, 0, chunkSize),
+		data:    data,
+		header:  header,
+		modTime: time.Now(),
+		name:    name,
+	}, nil
+}
+
+/*
+Close seals and writes the last chunk, then closes the wrapped file
+*/
+func (w *EncryptedWriter) Close() error {
+	if w.closed {
+		return &fs.PathError{Op: "close", Path: w.name, Err: fs.ErrClosed}
+	}
+
+	w.closed = true
+	err := w.err
+
+	if err == nil {
+		err = w.flush(true)
+	}
+
+	if closeErr := w.base.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return w.fail("close", err)
+	}
+
+	return nil
+}
+
+func (w *EncryptedWriter) Name() string {
+	return w.name
+}
+
+func (w *EncryptedWriter) Read(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: w.name, Err: filesystem.ErrNotSupported}
+}
+
+/*
+Stat describes the file as it will be once the writer is closed
+*/
+func (w *EncryptedWriter) Stat() (fs.FileInfo, error) {
+	info, err := w.base.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return filesystem.FileInfo{
+		FileName:     w.name,
+		FileSize:     w.size,
+		FileMode:     info.Mode(),
+		ModifiedTime: w.modTime,
+	}, nil
+}
+
+/*
+Sync commits every chunk written so far to stable storage. Data still
+waiting to fill a chunk is not included, and is written by Close.
+*/
+func (w *EncryptedWriter) Sync() error {
+	if w.closed {
+		return &fs.PathError{Op: "sync", Path: w.name, Err: fs.ErrClosed}
+	}
+
+	if w.err != nil {
+		return w.err
+	}
+
+	return w.base.Sync()
+}
+
+func (w *EncryptedWriter) Write(b []byte) (int, error) {
+	if w.closed {
+		return 0, &fs.PathError{Op: "write", Path: w.name, Err: fs.ErrClosed}
+	}
+
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	written := 0
+
+	for len(b) > 0 {
+		if len(w.buffer) == chunkSize {
+			if err := w.flush(false); err != nil {
+				return written, w.fail("write", err)
+			}
+		}
+
+		n := copy(w.buffer[len(w.buffer):chunkSize], b)
+		w.buffer = w.buffer[:len(w.buffer)+n]
+		b = b[n:]
+		written += n
+		w.size += int64(n)
+	}
+
+	return written, nil
+}
+
+func (w *EncryptedWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *EncryptedWriter) flush(final bool) error {
+	record, err := sealChunk(w.data, w.header, w.index, final, w.buffer)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.base.Write(record); err != nil {
+		return err
+	}
+
+	w.buffer = w.buffer[:0]
+	w.index++
+
+	return nil
+}
+
+/*
+fail records the first error, so later writes fail the same way
+*/
+func (w *EncryptedWriter) fail(op string, err error) error {
+	var pathErr *fs.PathError
+
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+
+	w.err = &fs.PathError{Op: op, Path: w.name, Err: err}
+	return w.err
+}
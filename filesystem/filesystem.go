@@ -28,10 +28,55 @@ type FileExistsFS interface {
 	FileExists(file string) bool
 }
 
+/*
+RemoveFS describes a file system that can delete files and directories
+*/
+type RemoveFS interface {
+	Remove(name string) error
+	RemoveAll(path string) error
+}
+
+/*
+RenameFS describes a file system that can move files and directories
+*/
+type RenameFS interface {
+	Rename(oldPath, newPath string) error
+}
+
+/*
+WalkFS describes a file system that can walk a directory tree. WalkDir
+follows the same rules as filepath.WalkDir.
+*/
+type WalkFS interface {
+	WalkDir(root string, fn fs.WalkDirFunc) error
+}
+
+/*
+GlobFS describes a file system that can match file names against a
+pattern. Glob follows the same rules as filepath.Glob.
+*/
+type GlobFS interface {
+	Glob(pattern string) ([]string, error)
+}
+
+/*
+SymlinkFS describes a file system that supports symbolic links
+*/
+type SymlinkFS interface {
+	Lstat(name string) (fs.FileInfo, error)
+	Readlink(name string) (string, error)
+	Symlink(oldName, newName string) error
+}
+
+/*
+WritableFile is an open file that can be written to. Sync commits the
+file's contents to stable storage, so they survive a crash.
+*/
 type WritableFile interface {
 	fs.File
 
 	Name() string
+	Sync() error
 	Write(b []byte) (int, error)
 	WriteString(s string) (int, error)
 }
@@ -0,0 +1,307 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+ErrNotSupported is returned by the package level helpers when a file
+system lacks a capability and there is no way to emulate it
+*/
+var ErrNotSupported = errors.New("operation not supported by file system")
+
+/*
+Remove removes a file or empty directory. The file system must
+implement RemoveFS.
+*/
+func Remove(fsys FileSystem, name string) error {
+	if remover, ok := fsys.(RemoveFS); ok {
+		return remover.Remove(name)
+	}
+
+	return &fs.PathError{Op: "remove", Path: name, Err: ErrNotSupported}
+}
+
+/*
+RemoveAll removes a path and everything it contains. The file system
+must implement RemoveFS.
+*/
+func RemoveAll(fsys FileSystem, path string) error {
+	if remover, ok := fsys.(RemoveFS); ok {
+		return remover.RemoveAll(path)
+	}
+
+	return &fs.PathError{Op: "removeall", Path: path, Err: ErrNotSupported}
+}
+
+/*
+Rename moves a file or directory. When the file system does not
+implement RenameFS, but does implement RemoveFS, the contents are
+copied to the new location and the original is removed.
+*/
+func Rename(fsys FileSystem, oldPath, newPath string) error {
+	if renamer, ok := fsys.(RenameFS); ok {
+		return renamer.Rename(oldPath, newPath)
+	}
+
+	remover, ok := fsys.(RemoveFS)
+
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldPath, Err: ErrNotSupported}
+	}
+
+	if err := copyTree(fsys, oldPath, newPath); err != nil {
+		return err
+	}
+
+	return remover.RemoveAll(oldPath)
+}
+
+/*
+WalkDir walks the tree rooted at root, calling fn for each file and
+directory, following the same rules as filepath.WalkDir. File systems
+that don't implement WalkFS are walked using ReadDir and Stat.
+*/
+func WalkDir(fsys FileSystem, root string, fn fs.WalkDirFunc) error {
+	if walker, ok := fsys.(WalkFS); ok {
+		return walker.WalkDir(root, fn)
+	}
+
+	info, err := Lstat(fsys, root)
+
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDir(fsys, root, fs.FileInfoToDirEntry(info), fn)
+	}
+
+	if err == fs.SkipDir {
+		return nil
+	}
+
+	return err
+}
+
+/*
+Glob returns the names of all files matching pattern, following the
+same rules as filepath.Glob. File systems that don't implement GlobFS
+are searched using ReadDir.
+*/
+func Glob(fsys FileSystem, pattern string) ([]string, error) {
+	if globber, ok := fsys.(GlobFS); ok {
+		return globber.Glob(pattern)
+	}
+
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	return glob(fsys, pattern, 0)
+}
+
+/*
+Symlink creates newName as a symbolic link to oldName. The file
+system must implement SymlinkFS.
+*/
+func Symlink(fsys FileSystem, oldName, newName string) error {
+	if linker, ok := fsys.(SymlinkFS); ok {
+		return linker.Symlink(oldName, newName)
+	}
+
+	return &fs.PathError{Op: "symlink", Path: newName, Err: ErrNotSupported}
+}
+
+/*
+Readlink returns the destination of a symbolic link. The file system
+must implement SymlinkFS.
+*/
+func Readlink(fsys FileSystem, name string) (string, error) {
+	if linker, ok := fsys.(SymlinkFS); ok {
+		return linker.Readlink(name)
+	}
+
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: ErrNotSupported}
+}
+
+/*
+Lstat describes a file without following symbolic links. File systems
+that don't implement SymlinkFS have no links, so Stat is used.
+*/
+func Lstat(fsys FileSystem, name string) (fs.FileInfo, error) {
+	if linker, ok := fsys.(SymlinkFS); ok {
+		return linker.Lstat(name)
+	}
+
+	return fsys.Stat(name)
+}
+
+func isNotExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+func walkDir(fsys FileSystem, path string, entry fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, entry, nil); err != nil || !entry.IsDir() {
+		if err == fs.SkipDir && entry.IsDir() {
+			err = nil
+		}
+
+		return err
+	}
+
+	entries, err := fsys.ReadDir(path)
+
+	if err != nil {
+		if err = fn(path, entry, err); err != nil {
+			if err == fs.SkipDir {
+				err = nil
+			}
+
+			return err
+		}
+	}
+
+	for _, child := range entries {
+		if err = walkDir(fsys, filepath.Join(path, child.Name()), child, fn); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func glob(fsys FileSystem, pattern string, depth int) ([]string, error) {
+	if depth > 10000 {
+		return nil, filepath.ErrBadPattern
+	}
+
+	if !hasMeta(pattern) {
+		if _, err := Lstat(fsys, pattern); err != nil {
+			return nil, nil
+		}
+
+		return []string{pattern}, nil
+	}
+
+	dir, file := filepath.Split(pattern)
+	dir = cleanGlobPath(dir)
+
+	if !hasMeta(dir) {
+		return globInDir(fsys, dir, file, nil)
+	}
+
+	if dir == pattern {
+		return nil, filepath.ErrBadPattern
+	}
+
+	dirs, err := glob(fsys, dir, depth+1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+
+	for _, d := range dirs {
+		if result, err = globInDir(fsys, d, file, result); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+func globInDir(fsys FileSystem, dir, pattern string, matches []string) ([]string, error) {
+	info, err := fsys.Stat(dir)
+
+	if err != nil || !info.IsDir() {
+		return matches, nil
+	}
+
+	entries, err := fsys.ReadDir(dir)
+
+	if err != nil {
+		return matches, nil
+	}
+
+	names := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		matched, err := filepath.Match(pattern, name)
+
+		if err != nil {
+			return matches, err
+		}
+
+		if matched {
+			matches = append(matches, filepath.Join(dir, name))
+		}
+	}
+
+	return matches, nil
+}
+
+func cleanGlobPath(path string) string {
+	switch path {
+	case "":
+		return "."
+
+	case string(filepath.Separator):
+		return path
+	}
+
+	return path[:len(path)-1]
+}
+
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[\`)
+}
+
+func copyTree(fsys FileSystem, oldPath, newPath string) error {
+	info, err := fsys.Stat(oldPath)
+
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		data, err := fsys.ReadFile(oldPath)
+
+		if err != nil {
+			return err
+		}
+
+		return fsys.WriteFile(newPath, data, info.Mode().Perm())
+	}
+
+	if err = fsys.MkdirAll(newPath, info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	entries, err := fsys.ReadDir(oldPath)
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err = copyTree(fsys, filepath.Join(oldPath, entry.Name()), filepath.Join(newPath, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
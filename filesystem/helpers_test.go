@@ -0,0 +1,92 @@
+package filesystem_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+	"github.com/app-nerds/kit/v6/filesystem/memoryfs"
+)
+
+/*
+basicFS only exposes the FileSystem methods, hiding every optional
+capability of the file system it wraps
+*/
+type basicFS struct {
+	filesystem.FileSystem
+}
+
+func TestHelpers_FallBackWithoutCapabilities(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+	fsys := basicFS{mfs}
+
+	_ = mfs.MkdirAll("/a/b", 0755)
+	_ = mfs.WriteFile("/a/b/file.txt", []byte("hello"), 0644)
+
+	count := 0
+
+	err := filesystem.WalkDir(fsys, "/a", func(path string, d fs.DirEntry, err error) error {
+		count++
+		return err
+	})
+
+	if err != nil || count != 3 {
+		t.Errorf("expected to walk 3 entries but got %d (%v)", count, err)
+	}
+
+	matches, err := filesystem.Glob(fsys, "/a/*/*.txt")
+
+	if err != nil || len(matches) != 1 || matches[0] != "/a/b/file.txt" {
+		t.Errorf("expected [/a/b/file.txt] but got %v (%v)", matches, err)
+	}
+
+	if err = filesystem.Remove(fsys, "/a/b/file.txt"); !errors.Is(err, filesystem.ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported but got %v", err)
+	}
+
+	if err = filesystem.Rename(fsys, "/a", "/z"); !errors.Is(err, filesystem.ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported but got %v", err)
+	}
+}
+
+func TestHelpers_RenameCopiesWhenOnlyRemoveIsSupported(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+	fsys := struct {
+		filesystem.FileSystem
+		filesystem.RemoveFS
+	}{mfs, mfs}
+
+	_ = mfs.MkdirAll("/a/b", 0755)
+	_ = mfs.WriteFile("/a/b/file.txt", []byte("hello"), 0644)
+
+	if err := filesystem.Rename(fsys, "/a", "/z"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if data, err := mfs.ReadFile("/z/b/file.txt"); err != nil || string(data) != "hello" {
+		t.Errorf("expected copied file to contain 'hello' but got %q (%v)", data, err)
+	}
+
+	if mfs.FileExists("/a") {
+		t.Errorf("expected the original directory to be removed")
+	}
+}
+
+func TestDirFS(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+	_ = mfs.MkdirAll("/site/css", 0755)
+	_ = mfs.WriteFile("/site/index.html", []byte("<html>"), 0644)
+	_ = mfs.WriteFile("/site/css/main.css", []byte("body {}"), 0644)
+
+	dir := filesystem.DirFS(basicFS{mfs}, "/site")
+
+	if err := fstest.TestFS(dir, "index.html", "css/main.css"); err != nil {
+		t.Fatalf("expected DirFS to pass fstest.TestFS but got %s", err)
+	}
+
+	if _, err := fs.ReadFile(dir, "../site/index.html"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("expected fs.ErrInvalid for a name with .. but got %v", err)
+	}
+}
@@ -41,9 +41,14 @@ func (lf LocalFile) WriteString(s string) (int, error) {
 	return lf.f.WriteString(s)
 }
 
+func (lf LocalFile) Sync() error {
+	return lf.f.Sync()
+}
+
 /*
 LocalFS is wrapper around the OS file system used to read and write files. This implements
-fs.FS, fs.ReadFileFS, OpenFileFS, WriteFileFS.
+fs.FS, fs.ReadFileFS, OpenFileFS, WriteFileFS, RemoveFS, RenameFS, WalkFS, GlobFS,
+SymlinkFS, WatchFS, AtomicWriteFS, and LockFS.
 */
 type LocalFS struct {
 }
@@ -88,6 +93,56 @@ func (lfs *LocalFS) WriteFile(name string, data []byte, perm fs.FileMode) error
 	return os.WriteFile(name, data, perm)
 }
 
+/*
+WriteFileAtomic writes data to a temporary file in the same directory,
+syncs it, and renames it over name. The directory is synced too, so the
+rename survives a crash.
+*/
+func (lfs *LocalFS) WriteFileAtomic(name string, data []byte, perm fs.FileMode) error {
+	dir, base := filepath.Split(name)
+
+	if dir == "" {
+		dir = "."
+	}
+
+	f, err := os.CreateTemp(dir, "."+base+".tmp-*")
+
+	if err != nil {
+		return err
+	}
+
+	tempName := f.Name()
+	_, err = f.Write(data)
+
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tempName, name)
+	}
+
+	if err != nil {
+		_ = os.Remove(tempName)
+		return err
+	}
+
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+
+	return nil
+}
+
 func (lfs *LocalFS) ReadDir(dir string) ([]fs.DirEntry, error) {
 	return os.ReadDir(dir)
 }
@@ -96,3 +151,35 @@ func (lfs *LocalFS) FileExists(file string) bool {
 	_, err := os.Stat(file)
 	return !os.IsNotExist(err)
 }
+
+func (lfs *LocalFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (lfs *LocalFS) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (lfs *LocalFS) Rename(oldPath, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
+func (lfs *LocalFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return filepath.WalkDir(root, fn)
+}
+
+func (lfs *LocalFS) Glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+func (lfs *LocalFS) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (lfs *LocalFS) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (lfs *LocalFS) Symlink(oldName, newName string) error {
+	return os.Symlink(oldName, newName)
+}
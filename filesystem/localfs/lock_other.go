@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package localfs
+
+import (
+	"io/fs"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+Lock is not available on this platform
+*/
+func (lfs *LocalFS) Lock(name string, options filesystem.LockOptions) (filesystem.FileLock, error) {
+	return nil, &fs.PathError{Op: "lock", Path: name, Err: filesystem.ErrNotSupported}
+}
@@ -0,0 +1,43 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package localfs_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+	"github.com/app-nerds/kit/v6/filesystem/localfs"
+)
+
+func TestLocalFS_LockAndAtomicWrite(t *testing.T) {
+	dir := t.TempDir()
+	lfs := localfs.NewLocalFS().(*localfs.LocalFS)
+	name := filepath.Join(dir, "data.json")
+
+	lock, err := lfs.Lock(name+".lock", filesystem.LockOptions{})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err = lfs.Lock(name+".lock", filesystem.LockOptions{Timeout: -1}); !errors.Is(err, filesystem.ErrLockTimeout) {
+		t.Errorf("expected ErrLockTimeout but got %v", err)
+	}
+
+	if err = lfs.WriteFileAtomic(name, []byte("{}"), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_ = lock.Unlock()
+
+	if data, _ := os.ReadFile(name); string(data) != "{}" {
+		t.Errorf("expected '{}' but got '%s'", data)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("expected no temporary files to be left behind but got %d entries", len(entries))
+	}
+}
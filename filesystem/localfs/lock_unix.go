@@ -0,0 +1,67 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package localfs
+
+import (
+	"io/fs"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+type localLock struct {
+	file *os.File
+	once sync.Once
+}
+
+/*
+Lock takes an advisory lock on the named file with flock. The file is
+created if it does not exist. flock never blocks here. It is retried
+until the lock is free or the timeout in options runs out.
+*/
+func (lfs *LocalFS) Lock(name string, options filesystem.LockOptions) (filesystem.FileLock, error) {
+	f, err := os.OpenFile(name, os.O_RDONLY|os.O_CREATE, 0644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	how := unix.LOCK_EX
+
+	if options.Shared {
+		how = unix.LOCK_SH
+	}
+
+	err = filesystem.RetryLock(name, options, unix.EWOULDBLOCK, func() error {
+		return unix.Flock(int(f.Fd()), how|unix.LOCK_NB)
+	})
+
+	if err != nil {
+		f.Close()
+
+		if _, ok := err.(*fs.PathError); !ok {
+			err = &fs.PathError{Op: "lock", Path: name, Err: err}
+		}
+
+		return nil, err
+	}
+
+	return &localLock{file: f}, nil
+}
+
+func (l *localLock) Unlock() error {
+	err := fs.ErrClosed
+
+	l.once.Do(func() {
+		err = unix.Flock(int(l.file.Fd()), unix.LOCK_UN)
+
+		if closeErr := l.file.Close(); err == nil {
+			err = closeErr
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,23 @@
+package localfs
+
+import (
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+Watch reports changes to a file or directory. On Linux this uses inotify.
+Elsewhere, or when inotify can't be started, the path is polled instead.
+*/
+func (lfs *LocalFS) Watch(name string, options filesystem.WatchOptions) (filesystem.Watcher, error) {
+	if _, err := lfs.Stat(name); err != nil {
+		return nil, err
+	}
+
+	w, err := newNativeWatcher(name, options)
+
+	if err != nil {
+		return filesystem.NewPollingWatcher(lfs, name, options)
+	}
+
+	return filesystem.NewDebouncedWatcher(w, options.Debounce), nil
+}
@@ -0,0 +1,313 @@
+//go:build linux
+
+package localfs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_MODIFY | unix.IN_DELETE | unix.IN_DELETE_SELF |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_MOVE_SELF
+
+/*
+inotifyWatcher watches paths with Linux inotify. For recursive watches
+every directory gets its own inotify watch, and new directories are
+added as they are created.
+*/
+type inotifyWatcher struct {
+	closeOnce sync.Once
+	done      chan struct{}
+	errors    chan error
+	events    chan filesystem.Event
+	file      *os.File
+	fd        int
+	lock      sync.Mutex
+	name      string
+	recursive bool
+	paths     map[int]string
+}
+
+func newNativeWatcher(name string, options filesystem.WatchOptions) (filesystem.Watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bufferSize := options.BufferSize
+
+	if bufferSize <= 0 {
+		bufferSize = filesystem.DefaultWatchBufferSize
+	}
+
+	w := &inotifyWatcher{
+		done:      make(chan struct{}),
+		errors:    make(chan error, 1),
+		events:    make(chan filesystem.Event, bufferSize),
+		file:      os.NewFile(uintptr(fd), "inotify"),
+		fd:        fd,
+		name:      filepath.Clean(name),
+		recursive: options.Recursive,
+		paths:     map[int]string{},
+	}
+
+	if err = w.add(w.name, false); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+
+	go w.run()
+	return w, nil
+}
+
+func (w *inotifyWatcher) Close() error {
+	var err error
+
+	w.closeOnce.Do(func() {
+		close(w.done)
+		err = w.file.Close()
+	})
+
+	return err
+}
+
+func (w *inotifyWatcher) Errors() <-chan error {
+	return w.errors
+}
+
+func (w *inotifyWatcher) Events() <-chan filesystem.Event {
+	return w.events
+}
+
+/*
+add watches a path, and for recursive watches every directory below it.
+When announce is set, files found in new directories are reported as
+created, since they may have appeared before the watch was in place.
+*/
+func (w *inotifyWatcher) add(name string, announce bool) error {
+	wd, err := unix.InotifyAddWatch(w.fd, name, inotifyMask)
+
+	if err != nil {
+		return err
+	}
+
+	w.lock.Lock()
+	w.paths[wd] = name
+	w.lock.Unlock()
+
+	if !w.recursive {
+		return nil
+	}
+
+	entries, err := os.ReadDir(name)
+
+	if err != nil {
+		return nil
+	}
+
+	for _, entry := range entries {
+		child := filepath.Join(name, entry.Name())
+
+		if announce {
+			w.send(filesystem.Event{Name: child, Op: filesystem.EventCreate})
+		}
+
+		if entry.IsDir() {
+			_ = w.add(child, announce)
+		}
+	}
+
+	return nil
+}
+
+func (w *inotifyWatcher) run() {
+	defer func() {
+		close(w.events)
+		close(w.errors)
+	}()
+
+	buffer := make([]byte, (unix.SizeofInotifyEvent+unix.NAME_MAX+1)*64)
+
+	for {
+		n, err := w.file.Read(buffer)
+
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				select {
+				case w.errors <- err:
+				default:
+				}
+			}
+
+			return
+		}
+
+		w.handle(buffer[:n])
+	}
+}
+
+/*
+remove drops the watches on name and every directory below it, after it
+is moved out of the tree. Their events would otherwise still be reported
+under paths that no longer exist.
+*/
+func (w *inotifyWatcher) remove(name string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for wd, path := range w.paths {
+		if _, ok := relativeTo(name, path); ok {
+			_, _ = unix.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.paths, wd)
+		}
+	}
+}
+
+/*
+rename rewrites the stored paths of the watches on oldName and every
+directory below it, after it is renamed within the tree. The watches
+follow the directories, so only their names change.
+*/
+func (w *inotifyWatcher) rename(oldName, newName string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for wd, path := range w.paths {
+		if rel, ok := relativeTo(oldName, path); ok {
+			w.paths[wd] = filepath.Join(newName, rel)
+		}
+	}
+}
+
+/*
+relativeTo returns path relative to dir, and whether path is dir or
+somewhere below it
+*/
+func relativeTo(dir, path string) (string, bool) {
+	if path == dir {
+		return "", true
+	}
+
+	if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return path[len(dir)+1:], true
+	}
+
+	return "", false
+}
+
+/*
+handle turns a batch of raw inotify events into Events. A move within
+the watched tree arrives as a MOVED_FROM and MOVED_TO pair sharing a
+cookie, and becomes one rename. Halves without a partner moved in or
+out of the tree, and become a create or remove. For recursive watches
+the watches below a renamed directory are renamed with it, and those
+below a directory moved out of the tree are dropped.
+*/
+func (w *inotifyWatcher) handle(data []byte) {
+	movedFrom := map[uint32]string{}
+	pending := []filesystem.Event{}
+
+	for offset := 0; offset+unix.SizeofInotifyEvent <= len(data); {
+		raw := (*unix.InotifyEvent)(unsafe.Pointer(&data[offset]))
+		nameBytes := data[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(raw.Len)]
+		offset += unix.SizeofInotifyEvent + int(raw.Len)
+
+		w.lock.Lock()
+		dir, ok := w.paths[int(raw.Wd)]
+
+		if raw.Mask&unix.IN_IGNORED != 0 {
+			delete(w.paths, int(raw.Wd))
+		}
+
+		w.lock.Unlock()
+
+		if !ok {
+			continue
+		}
+
+		name := dir
+
+		if len(nameBytes) > 0 {
+			name = filepath.Join(dir, string(bytes.TrimRight(nameBytes, "\x00")))
+		}
+
+		isDir := raw.Mask&unix.IN_ISDIR != 0
+
+		switch {
+		case raw.Mask&unix.IN_CREATE != 0:
+			pending = append(pending, filesystem.Event{Name: name, Op: filesystem.EventCreate})
+
+			if isDir && w.recursive {
+				w.flush(pending)
+				pending = pending[:0]
+				_ = w.add(name, true)
+			}
+
+		case raw.Mask&unix.IN_MODIFY != 0:
+			pending = append(pending, filesystem.Event{Name: name, Op: filesystem.EventModify})
+
+		case raw.Mask&unix.IN_MOVED_FROM != 0:
+			movedFrom[raw.Cookie] = name
+
+		case raw.Mask&unix.IN_MOVED_TO != 0:
+			oldName, paired := movedFrom[raw.Cookie]
+
+			if paired {
+				delete(movedFrom, raw.Cookie)
+				pending = append(pending, filesystem.Event{Name: name, OldName: oldName, Op: filesystem.EventRename})
+			} else {
+				pending = append(pending, filesystem.Event{Name: name, Op: filesystem.EventCreate})
+			}
+
+			if isDir && w.recursive {
+				w.flush(pending)
+				pending = pending[:0]
+
+				if paired {
+					w.rename(oldName, name)
+				} else {
+					_ = w.add(name, false)
+				}
+			}
+
+		case raw.Mask&unix.IN_DELETE != 0:
+			pending = append(pending, filesystem.Event{Name: name, Op: filesystem.EventRemove})
+
+		case raw.Mask&(unix.IN_DELETE_SELF|unix.IN_MOVE_SELF) != 0 && name == w.name:
+			pending = append(pending, filesystem.Event{Name: name, Op: filesystem.EventRemove})
+		}
+	}
+
+	for _, oldName := range movedFrom {
+		pending = append(pending, filesystem.Event{Name: oldName, Op: filesystem.EventRemove})
+
+		if w.recursive {
+			w.remove(oldName)
+		}
+	}
+
+	w.flush(pending)
+}
+
+func (w *inotifyWatcher) flush(events []filesystem.Event) {
+	for _, event := range events {
+		w.send(event)
+	}
+}
+
+func (w *inotifyWatcher) send(event filesystem.Event) {
+	select {
+	case w.events <- event:
+	case <-w.done:
+	}
+}
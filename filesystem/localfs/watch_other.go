@@ -0,0 +1,15 @@
+//go:build !linux
+
+package localfs
+
+import (
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+newNativeWatcher is not available on this platform, so Watch falls back
+to polling
+*/
+func newNativeWatcher(name string, options filesystem.WatchOptions) (filesystem.Watcher, error) {
+	return nil, filesystem.ErrNotSupported
+}
@@ -0,0 +1,112 @@
+package localfs_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+	"github.com/app-nerds/kit/v6/filesystem/localfs"
+)
+
+func waitFor(t *testing.T, w filesystem.Watcher, name string, op filesystem.EventOp) filesystem.Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+
+	for {
+		select {
+		case event := <-w.Events():
+			if event.Name == name && event.Op.Has(op) {
+				return event
+			}
+
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s on %s", op, name)
+		}
+	}
+}
+
+func TestLocalFS_Watch(t *testing.T) {
+	dir := t.TempDir()
+	lfs := localfs.NewLocalFS().(*localfs.LocalFS)
+
+	w, err := lfs.Watch(dir, filesystem.WatchOptions{Recursive: true, PollInterval: 10 * time.Millisecond})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	defer w.Close()
+
+	nested := filepath.Join(dir, "nested")
+	_ = os.Mkdir(nested, 0755)
+	waitFor(t, w, nested, filesystem.EventCreate)
+
+	file := filepath.Join(nested, "drop.csv")
+	_ = os.WriteFile(file, []byte("a,b"), 0644)
+	waitFor(t, w, file, filesystem.EventCreate)
+
+	renamed := filepath.Join(nested, "done.csv")
+	_ = os.Rename(file, renamed)
+
+	if event := waitFor(t, w, renamed, filesystem.EventRename); event.OldName != file {
+		t.Errorf("expected the old name %s but got %s", file, event.OldName)
+	}
+
+	_ = os.Remove(renamed)
+	waitFor(t, w, renamed, filesystem.EventRemove)
+}
+
+func TestLocalFS_WatchFollowsRenamedDirectories(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	lfs := localfs.NewLocalFS().(*localfs.LocalFS)
+
+	nested := filepath.Join(dir, "nested")
+	_ = os.MkdirAll(filepath.Join(nested, "deeper"), 0755)
+
+	w, err := lfs.Watch(dir, filesystem.WatchOptions{Recursive: true, PollInterval: 10 * time.Millisecond})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	defer w.Close()
+
+	renamed := filepath.Join(dir, "renamed")
+	_ = os.Rename(nested, renamed)
+	waitFor(t, w, renamed, filesystem.EventRename)
+
+	file := filepath.Join(renamed, "deeper", "drop.csv")
+	_ = os.WriteFile(file, []byte("a,b"), 0644)
+	waitFor(t, w, file, filesystem.EventCreate)
+
+	// Once moved out of the tree, nothing below the directory is reported
+	moved := filepath.Join(outside, "moved")
+	_ = os.Rename(renamed, moved)
+	waitFor(t, w, renamed, filesystem.EventRemove)
+
+	_ = os.WriteFile(filepath.Join(moved, "deeper", "late.csv"), []byte("a,b"), 0644)
+
+	marker := filepath.Join(dir, "marker")
+	_ = os.WriteFile(marker, []byte("x"), 0644)
+	timeout := time.After(5 * time.Second)
+
+	for {
+		select {
+		case event := <-w.Events():
+			if strings.HasPrefix(event.Name, renamed+string(filepath.Separator)) {
+				t.Errorf("expected no events from the moved out directory but got %s on %s", event.Op, event.Name)
+			}
+
+			if event.Name == marker {
+				return
+			}
+
+		case <-timeout:
+			t.Fatalf("timed out waiting for the marker")
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"time"
+)
+
+/*
+ErrLockTimeout is returned when a file lock could not be acquired before
+the timeout ran out
+*/
+var ErrLockTimeout = errors.New("timed out waiting for file lock")
+
+/*
+LockOptions configures a file lock.
+
+Shared asks for a shared lock, which any number of holders may have at
+once. Otherwise the lock is exclusive. Timeout is how long to wait for
+the lock. Zero waits forever, and a negative timeout gives up at once
+if the lock is held.
+*/
+type LockOptions struct {
+	Shared  bool
+	Timeout time.Duration
+}
+
+/*
+FileLock is a held lock. Unlock releases it.
+*/
+type FileLock interface {
+	Unlock() error
+}
+
+/*
+LockFS describes a file system with advisory file locks. Locks only keep
+out others who also ask for them. They do not stop anyone from reading
+or writing the file. Locking a file that does not exist creates it.
+*/
+type LockFS interface {
+	Lock(name string, options LockOptions) (FileLock, error)
+}
+
+/*
+Lock takes an advisory lock on the named file. The file system must
+implement LockFS.
+*/
+func Lock(fsys FileSystem, name string, options LockOptions) (FileLock, error) {
+	if locker, ok := fsys.(LockFS); ok {
+		return locker.Lock(name, options)
+	}
+
+	return nil, &fs.PathError{Op: "lock", Path: name, Err: ErrNotSupported}
+}
+
+/*
+RetryLock calls try until it succeeds, fails with an error other than
+errBusy, or the timeout in options runs out. It backs off between tries.
+File systems use it to add timeouts to non-blocking locks.
+*/
+func RetryLock(name string, options LockOptions, errBusy error, try func() error) error {
+	wait := time.Millisecond
+	var deadline time.Time
+
+	if options.Timeout > 0 {
+		deadline = time.Now().Add(options.Timeout)
+	}
+
+	for {
+		err := try()
+
+		if err == nil || !errors.Is(err, errBusy) {
+			return err
+		}
+
+		if options.Timeout < 0 || (!deadline.IsZero() && time.Now().After(deadline)) {
+			return &fs.PathError{Op: "lock", Path: name, Err: ErrLockTimeout}
+		}
+
+		if !deadline.IsZero() {
+			if remaining := time.Until(deadline); wait > remaining {
+				wait = remaining
+			}
+		}
+
+		time.Sleep(wait)
+
+		if wait *= 2; wait > 50*time.Millisecond {
+			wait = 50 * time.Millisecond
+		}
+	}
+}
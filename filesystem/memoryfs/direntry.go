@@ -0,0 +1,41 @@
+package memoryfs
+
+import (
+	"io/fs"
+	"time"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+DirEntry is an entry read from a directory. This implements fs.DirEntry
+*/
+type DirEntry struct {
+	name    string
+	dirType fs.FileMode
+	info    fs.FileInfo
+}
+
+func (d *DirEntry) Name() string      { return d.name }
+func (d *DirEntry) IsDir() bool       { return d.dirType.IsDir() }
+func (d *DirEntry) Type() fs.FileMode { return d.dirType }
+
+func (d *DirEntry) Info() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+/*
+NewDirEntry creates a DirEntry describing a directory
+*/
+func NewDirEntry(name string) fs.DirEntry {
+	return &DirEntry{
+		name:    name,
+		dirType: fs.ModeDir,
+		info: filesystem.FileInfo{
+			FileName:     name,
+			FileMode:     fs.ModeDir | 0755,
+			ModifiedTime: time.Now().UTC(),
+			IsDirectory:  true,
+		},
+	}
+}
@@ -0,0 +1,19 @@
+package memoryfs
+
+import (
+	"io/fs"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+DirFS returns a strict io/fs view of dir, much like os.DirFS. Names must
+be valid according to fs.ValidPath, and the working directory is ignored.
+The result passes the testing/fstest.TestFS conformance checks.
+*/
+func (mfs *MemoryFS) DirFS(dir string) fs.FS {
+	mfs.lock.RLock()
+	defer mfs.lock.RUnlock()
+
+	return filesystem.DirFS(mfs, mfs.abs(dir))
+}
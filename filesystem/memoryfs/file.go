@@ -0,0 +1,315 @@
+package memoryfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"syscall"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+MemoryFile is an open file or directory in a MemoryFS. It implements fs.File,
+fs.ReadDirFile, io.Seeker, io.ReaderAt, io.WriterAt, and WritableFile.
+*/
+type MemoryFile struct {
+	fs       *MemoryFS
+	node     *node
+	fileName string
+	path     string
+	flag     int
+	offset   int64
+	closed   bool
+
+	dirEntries []fs.DirEntry
+	dirOffset  int
+	dirRead    bool
+}
+
+func (mf *MemoryFile) Close() error {
+	mf.fs.lock.Lock()
+	defer mf.fs.lock.Unlock()
+
+	if mf.closed {
+		return &fs.PathError{Op: "close", Path: mf.fileName, Err: fs.ErrClosed}
+	}
+
+	mf.closed = true
+	return nil
+}
+
+func (mf *MemoryFile) Name() string {
+	return mf.fileName
+}
+
+func (mf *MemoryFile) Read(b []byte) (int, error) {
+	mf.fs.lock.Lock()
+	defer mf.fs.lock.Unlock()
+
+	if err := mf.checkRead("read"); err != nil {
+		return 0, err
+	}
+
+	n, err := mf.readAt(b, mf.offset)
+	mf.offset += int64(n)
+
+	return n, err
+}
+
+func (mf *MemoryFile) ReadAt(b []byte, offset int64) (int, error) {
+	mf.fs.lock.RLock()
+	defer mf.fs.lock.RUnlock()
+
+	if err := mf.checkRead("read"); err != nil {
+		return 0, err
+	}
+
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "readat", Path: mf.fileName, Err: fs.ErrInvalid}
+	}
+
+	n, err := mf.readAt(b, offset)
+
+	if err == nil && n < len(b) {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+/*
+ReadDir reads the contents of a directory. When n > 0 at most n entries
+are returned, and io.EOF is returned once there are none left. When
+n <= 0 all remaining entries are returned.
+*/
+func (mf *MemoryFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	mf.fs.lock.Lock()
+	defer mf.fs.lock.Unlock()
+
+	if mf.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: mf.fileName, Err: fs.ErrClosed}
+	}
+
+	if !mf.node.isDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: mf.fileName, Err: syscall.ENOTDIR}
+	}
+
+	if !mf.dirRead {
+		mf.dirEntries = mf.node.entries()
+		mf.dirRead = true
+	}
+
+	remaining := mf.dirEntries[mf.dirOffset:]
+
+	if n <= 0 {
+		mf.dirOffset = len(mf.dirEntries)
+		return remaining, nil
+	}
+
+	if len(remaining) == 0 {
+		return []fs.DirEntry{}, io.EOF
+	}
+
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+
+	mf.dirOffset += n
+	return remaining[:n], nil
+}
+
+/*
+Seek sets the offset for the next Read or Write
+*/
+func (mf *MemoryFile) Seek(offset int64, whence int) (int64, error) {
+	mf.fs.lock.Lock()
+	defer mf.fs.lock.Unlock()
+
+	if mf.closed {
+		return 0, &fs.PathError{Op: "seek", Path: mf.fileName, Err: fs.ErrClosed}
+	}
+
+	var position int64
+
+	switch whence {
+	case io.SeekStart:
+		position = offset
+
+	case io.SeekCurrent:
+		position = mf.offset + offset
+
+	case io.SeekEnd:
+		position = int64(len(mf.node.data)) + offset
+
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: mf.fileName, Err: fs.ErrInvalid}
+	}
+
+	if position < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: mf.fileName, Err: fs.ErrInvalid}
+	}
+
+	if mf.node.isDir() {
+		/*
+		 * Seeking a directory to the start rewinds ReadDir
+		 */
+		mf.dirRead = false
+		mf.dirOffset = 0
+	}
+
+	mf.offset = position
+	return position, nil
+}
+
+func (mf *MemoryFile) Stat() (fs.FileInfo, error) {
+	mf.fs.lock.RLock()
+	defer mf.fs.lock.RUnlock()
+
+	if mf.closed {
+		return nil, &fs.PathError{Op: "stat", Path: mf.fileName, Err: fs.ErrClosed}
+	}
+
+	return mf.node.info(), nil
+}
+
+/*
+Sync does nothing. Memory file contents are always up to date.
+*/
+func (mf *MemoryFile) Sync() error {
+	mf.fs.lock.RLock()
+	defer mf.fs.lock.RUnlock()
+
+	if mf.closed {
+		return &fs.PathError{Op: "sync", Path: mf.fileName, Err: fs.ErrClosed}
+	}
+
+	return nil
+}
+
+/*
+Truncate changes the size of the file without moving the offset
+*/
+func (mf *MemoryFile) Truncate(size int64) error {
+	defer mf.fs.flush()
+
+	mf.fs.lock.Lock()
+	defer mf.fs.lock.Unlock()
+
+	if err := mf.checkWrite("truncate"); err != nil {
+		return err
+	}
+
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: mf.fileName, Err: fs.ErrInvalid}
+	}
+
+	mf.node.data = resize(mf.node.data, size)
+	mf.node.modTime = mf.fs.now()
+	mf.fs.notify(filesystem.EventModify, mf.path, "")
+
+	return nil
+}
+
+/*
+Write writes b at the current offset, or at the end of the file if it
+was opened with O_APPEND
+*/
+func (mf *MemoryFile) Write(b []byte) (int, error) {
+	defer mf.fs.flush()
+
+	mf.fs.lock.Lock()
+	defer mf.fs.lock.Unlock()
+
+	if err := mf.checkWrite("write"); err != nil {
+		return 0, err
+	}
+
+	if mf.flag&os.O_APPEND != 0 {
+		mf.offset = int64(len(mf.node.data))
+	}
+
+	n := mf.writeAt(b, mf.offset)
+	mf.offset += int64(n)
+
+	return n, nil
+}
+
+func (mf *MemoryFile) WriteAt(b []byte, offset int64) (int, error) {
+	defer mf.fs.flush()
+
+	mf.fs.lock.Lock()
+	defer mf.fs.lock.Unlock()
+
+	if err := mf.checkWrite("writeat"); err != nil {
+		return 0, err
+	}
+
+	if mf.flag&os.O_APPEND != 0 {
+		return 0, &fs.PathError{Op: "writeat", Path: mf.fileName, Err: fs.ErrInvalid}
+	}
+
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "writeat", Path: mf.fileName, Err: fs.ErrInvalid}
+	}
+
+	return mf.writeAt(b, offset), nil
+}
+
+func (mf *MemoryFile) WriteString(s string) (int, error) {
+	return mf.Write([]byte(s))
+}
+
+func (mf *MemoryFile) checkRead(op string) error {
+	if mf.closed {
+		return &fs.PathError{Op: op, Path: mf.fileName, Err: fs.ErrClosed}
+	}
+
+	if mf.node.isDir() {
+		return &fs.PathError{Op: op, Path: mf.fileName, Err: syscall.EISDIR}
+	}
+
+	if mf.flag&os.O_WRONLY != 0 {
+		return &fs.PathError{Op: op, Path: mf.fileName, Err: syscall.EBADF}
+	}
+
+	return nil
+}
+
+func (mf *MemoryFile) checkWrite(op string) error {
+	if mf.closed {
+		return &fs.PathError{Op: op, Path: mf.fileName, Err: fs.ErrClosed}
+	}
+
+	if mf.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return &fs.PathError{Op: op, Path: mf.fileName, Err: syscall.EBADF}
+	}
+
+	return nil
+}
+
+func (mf *MemoryFile) readAt(b []byte, offset int64) (int, error) {
+	if offset >= int64(len(mf.node.data)) {
+		if len(b) == 0 {
+			return 0, nil
+		}
+
+		return 0, io.EOF
+	}
+
+	return copy(b, mf.node.data[offset:]), nil
+}
+
+func (mf *MemoryFile) writeAt(b []byte, offset int64) int {
+	end := offset + int64(len(b))
+
+	if end > int64(len(mf.node.data)) {
+		mf.node.data = resize(mf.node.data, end)
+	}
+
+	copy(mf.node.data[offset:], b)
+	mf.node.modTime = mf.fs.now()
+	mf.fs.notify(filesystem.EventModify, mf.path, "")
+
+	return len(b)
+}
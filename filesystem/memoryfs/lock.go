@@ -0,0 +1,100 @@
+package memoryfs
+
+import (
+	"io/fs"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+fileLock is the state of the advisory lock on one path
+*/
+type fileLock struct {
+	exclusive bool
+	shared    int
+}
+
+type memoryLock struct {
+	fs     *MemoryFS
+	once   sync.Once
+	path   string
+	shared bool
+}
+
+/*
+Lock takes an advisory lock on the named file, creating it if it does
+not exist. Locks behave like flock. Any number of shared locks may be
+held at once, but an exclusive lock keeps out everyone else, including
+other locks taken by the same program.
+*/
+func (mfs *MemoryFS) Lock(name string, options filesystem.LockOptions) (filesystem.FileLock, error) {
+	f, err := mfs.OpenFile(name, os.O_RDONLY|os.O_CREATE, 0644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_ = f.Close()
+
+	mfs.lock.RLock()
+	p := mfs.abs(name)
+	mfs.lock.RUnlock()
+
+	err = filesystem.RetryLock(name, options, syscall.EWOULDBLOCK, func() error {
+		mfs.fileLockMutex.Lock()
+		defer mfs.fileLockMutex.Unlock()
+
+		state := mfs.fileLocks[p]
+
+		if state == nil {
+			state = &fileLock{}
+			mfs.fileLocks[p] = state
+		}
+
+		if state.exclusive || (!options.Shared && state.shared > 0) {
+			return syscall.EWOULDBLOCK
+		}
+
+		if options.Shared {
+			state.shared++
+		} else {
+			state.exclusive = true
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &memoryLock{fs: mfs, path: p, shared: options.Shared}, nil
+}
+
+func (l *memoryLock) Unlock() error {
+	err := fs.ErrClosed
+
+	l.once.Do(func() {
+		l.fs.fileLockMutex.Lock()
+		defer l.fs.fileLockMutex.Unlock()
+
+		state := l.fs.fileLocks[l.path]
+
+		if l.shared {
+			state.shared--
+		} else {
+			state.exclusive = false
+		}
+
+		if state.shared == 0 && !state.exclusive {
+			delete(l.fs.fileLocks, l.path)
+		}
+
+		err = nil
+	})
+
+	return err
+}
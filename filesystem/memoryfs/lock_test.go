@@ -0,0 +1,74 @@
+package memoryfs_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+	"github.com/app-nerds/kit/v6/filesystem/memoryfs"
+)
+
+func TestMemoryFS_Lock(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+
+	first, err := mfs.Lock("/app.lock", filesystem.LockOptions{Shared: true})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	second, err := mfs.Lock("/app.lock", filesystem.LockOptions{Shared: true, Timeout: -1})
+
+	if err != nil {
+		t.Fatalf("expected a second shared lock but got %s", err)
+	}
+
+	if _, err = mfs.Lock("/app.lock", filesystem.LockOptions{Timeout: 10 * time.Millisecond}); !errors.Is(err, filesystem.ErrLockTimeout) {
+		t.Errorf("expected ErrLockTimeout but got %v", err)
+	}
+
+	_ = first.Unlock()
+	_ = second.Unlock()
+
+	if err = second.Unlock(); err == nil {
+		t.Errorf("expected an error unlocking twice")
+	}
+
+	exclusive, err := mfs.Lock("/app.lock", filesystem.LockOptions{Timeout: -1})
+
+	if err != nil {
+		t.Fatalf("expected the exclusive lock once the shared locks were released but got %s", err)
+	}
+
+	_ = exclusive.Unlock()
+
+	if !mfs.FileExists("/app.lock") {
+		t.Errorf("expected the lock file to be created")
+	}
+}
+
+func TestMemoryFS_WriteFileAtomic(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+	_ = mfs.WriteFile("/config.json", []byte("old"), 0644)
+
+	f, _ := mfs.Open("/config.json")
+	defer f.Close()
+
+	if err := filesystem.WriteFileAtomic(mfs, "/config.json", []byte("new"), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if data, _ := mfs.ReadFile("/config.json"); string(data) != "new" {
+		t.Errorf("expected 'new' but got '%s'", data)
+	}
+
+	if data, _ := io.ReadAll(f); string(data) != "old" {
+		t.Errorf("expected the open handle to keep 'old' but got '%s'", data)
+	}
+
+	if info, _ := mfs.Stat("/config.json"); info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600 but got %s", info.Mode())
+	}
+}
@@ -1,266 +1,825 @@
 package memoryfs
 
 import (
-	"bytes"
-	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/app-nerds/kit/v6/filesystem"
 )
 
-type DirEntry struct {
-	name    string
-	dirType fs.FileMode
-	info    fs.FileInfo
+/*
+maxSymlinks is the number of symbolic links followed while resolving a
+path before giving up with ELOOP
+*/
+const maxSymlinks = 40
+
+/*
+MemoryFS is an in-memory file system used to read and write files. This implements
+fs.FS, fs.ReadFileFS, fs.ReadDirFS, fs.StatFS, OpenFileFS, WriteFileFS, RemoveFS,
+RenameFS, WalkFS, GlobFS, SymlinkFS, WatchFS, AtomicWriteFS, LockFS, and FileSystem.
+
+Paths follow the same rules as the OS file system. Absolute paths start at the
+root, "/", and relative paths are resolved against the working directory set
+with Chdir. Use DirFS for a strict io/fs view of a directory.
+*/
+type MemoryFS struct {
+	lock sync.RWMutex
+	root *node
+	cwd  string
+	now  func() time.Time
+
+	deliverLock sync.Mutex
+	pending     []filesystem.Event
+	watchLock   sync.Mutex
+	watchers    []*memoryWatcher
+
+	fileLockMutex sync.Mutex
+	fileLocks     map[string]*fileLock
 }
 
-func (d *DirEntry) Name() string      { return d.name }
-func (d *DirEntry) IsDir() bool       { return true }
-func (d *DirEntry) Type() fs.FileMode { return d.dirType }
+func NewMemoryFS() *MemoryFS {
+	now := func() time.Time { return time.Now().UTC() }
 
-func (d *DirEntry) Info() (fs.FileInfo, error) {
-	if d.info != nil {
-		return d.info, nil
+	return &MemoryFS{
+		root:      newDirNode("/", 0755, now()),
+		cwd:       "/",
+		now:       now,
+		fileLocks: map[string]*fileLock{},
 	}
-	return d.info, nil
 }
 
-func NewDirEntry(name string) fs.DirEntry {
-	return &DirEntry{
-		name: name,
+/*
+Chdir changes the working directory used to resolve relative paths
+*/
+func (mfs *MemoryFS) Chdir(dir string) error {
+	mfs.lock.Lock()
+	defer mfs.lock.Unlock()
+
+	p := mfs.abs(dir)
+	n, err := mfs.walk(p)
+
+	if err != nil {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: err}
 	}
+
+	if !n.isDir() {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: syscall.ENOTDIR}
+	}
+
+	mfs.cwd = p
+	return nil
 }
 
 /*
-MemoryFile is an in-memory file struct that implements fs.File, WritableFile
+Getwd returns the current working directory
 */
-type MemoryFile struct {
-	data     []byte
-	fileName string
-	path     string
-	flag     int
+func (mfs *MemoryFS) Getwd() (string, error) {
+	mfs.lock.RLock()
+	defer mfs.lock.RUnlock()
+
+	return mfs.cwd, nil
 }
 
-func (mf *MemoryFile) Close() error {
+/*
+Chmod changes the permission bits of a file or directory
+*/
+func (mfs *MemoryFS) Chmod(name string, mode fs.FileMode) error {
+	mfs.lock.Lock()
+	defer mfs.lock.Unlock()
+
+	n, err := mfs.walk(mfs.abs(name))
+
+	if err != nil {
+		return &fs.PathError{Op: "chmod", Path: name, Err: err}
+	}
+
+	n.mode = n.mode.Type() | (mode & fs.ModePerm)
+	return nil
+}
+
+/*
+Chtimes changes the modification time of a file or directory. Access
+times are not tracked.
+*/
+func (mfs *MemoryFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	mfs.lock.Lock()
+	defer mfs.lock.Unlock()
+
+	n, err := mfs.walk(mfs.abs(name))
+
+	if err != nil {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: err}
+	}
+
+	n.modTime = mtime
 	return nil
 }
 
-func (mf *MemoryFile) Name() string {
-	return filepath.Join(mf.path, mf.fileName)
+func (mfs *MemoryFS) Create(name string) (filesystem.WritableFile, error) {
+	return mfs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (mfs *MemoryFS) Mkdir(name string, perm fs.FileMode) error {
+	defer mfs.flush()
+
+	mfs.lock.Lock()
+	defer mfs.lock.Unlock()
+
+	return mfs.mkdir(name, mfs.abs(name), perm)
 }
 
-func (mf *MemoryFile) Read(b []byte) (int, error) {
-	buffer := bytes.NewBuffer(b)
-	return buffer.Write(mf.data)
+func (mfs *MemoryFS) MkdirAll(dir string, perm fs.FileMode) error {
+	defer mfs.flush()
+
+	mfs.lock.Lock()
+	defer mfs.lock.Unlock()
+
+	p := mfs.abs(dir)
+
+	if n, err := mfs.walk(p); err == nil {
+		if n.isDir() {
+			return nil
+		}
+
+		return &fs.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+	}
+
+	current := "/"
+
+	for _, part := range splitPath(p) {
+		current = path.Join(current, part)
+		n, err := mfs.walk(current)
+
+		if err == nil {
+			if !n.isDir() {
+				return &fs.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+			}
+
+			continue
+		}
+
+		if err = mfs.mkdir(dir, current, perm); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (mf *MemoryFile) Stat() (fs.FileInfo, error) {
-	return filesystem.FileInfo{
-		FileName:     mf.fileName,
-		FileSize:     int64(len(mf.data)),
-		FileMode:     0777,
-		ModifiedTime: time.Now().UTC(),
-		IsDirectory:  false,
-		System:       nil,
+func (mfs *MemoryFS) Open(name string) (fs.File, error) {
+	return mfs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (mfs *MemoryFS) OpenFile(name string, flag int, perm os.FileMode) (filesystem.WritableFile, error) {
+	defer mfs.flush()
+
+	mfs.lock.Lock()
+	defer mfs.lock.Unlock()
+
+	p := mfs.abs(name)
+	writing := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	reading := flag&os.O_WRONLY == 0
+	created := false
+
+	n, err := mfs.walk(p)
+
+	if err == fs.ErrNotExist && flag&os.O_CREATE != 0 {
+		parent, base, parentErr := mfs.createParent(p)
+
+		if parentErr != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: parentErr}
+		}
+
+		if !parent.canWrite() {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+		}
+
+		n = newFileNode(base, perm, mfs.now())
+		parent.children[base] = n
+		parent.modTime = n.modTime
+		created = true
+		err = nil
+
+		mfs.notify(filesystem.EventCreate, p, "")
+	}
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	if !created && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	}
+
+	if n.isDir() && writing {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+
+	if !created && ((reading && !n.canRead()) || (writing && !n.canWrite())) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+
+	if writing && flag&os.O_TRUNC != 0 && len(n.data) > 0 {
+		n.data = []byte{}
+		n.modTime = mfs.now()
+		mfs.notify(filesystem.EventModify, p, "")
+	}
+
+	return &MemoryFile{
+		fs:       mfs,
+		node:     n,
+		fileName: name,
+		flag:     flag,
+		path:     p,
 	}, nil
 }
 
-func (mf *MemoryFile) Write(b []byte) (int, error) {
-	if mf.flag&os.O_APPEND > 0 {
-		newBuffer := bytes.NewBuffer(mf.data)
-		_, _ = newBuffer.Write(b)
+func (mfs *MemoryFS) ReadFile(name string) ([]byte, error) {
+	mfs.lock.RLock()
+	defer mfs.lock.RUnlock()
 
-		mf.data = newBuffer.Bytes()
-		return len(b), nil
+	n, err := mfs.walk(mfs.abs(name))
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
 	}
 
-	mf.data = b
-	return len(b), nil
+	if n.isDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: syscall.EISDIR}
+	}
+
+	if !n.canRead() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+
+	result := make([]byte, len(n.data))
+	copy(result, n.data)
+
+	return result, nil
 }
 
-func (mf *MemoryFile) WriteString(s string) (int, error) {
-	if mf.flag&os.O_APPEND > 0 {
-		newBuffer := bytes.NewBuffer(mf.data)
-		_, _ = newBuffer.WriteString(s)
+func (mfs *MemoryFS) Stat(name string) (fs.FileInfo, error) {
+	mfs.lock.RLock()
+	defer mfs.lock.RUnlock()
+
+	n, err := mfs.walk(mfs.abs(name))
 
-		mf.data = newBuffer.Bytes()
-		return len(s), nil
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
 	}
 
-	mf.data = []byte(s)
-	return len(s), nil
+	return n.info(), nil
 }
 
 /*
-MemoryFS is an in-memory file system used to read and write files. This implements
-fs.FS, fs.ReadFileFS, OpenFileFS, WriteFileFS.
+WriteFile writes data to the named file, creating it with perm if
+necessary, and truncating it otherwise
 */
-type MemoryFS struct {
-	dirs  []*DirEntry
-	files []*MemoryFile
-}
+func (mfs *MemoryFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	f, err := mfs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
 
-func NewMemoryFS() *MemoryFS {
-	return &MemoryFS{
-		dirs:  []*DirEntry{},
-		files: []*MemoryFile{},
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
 	}
+
+	return err
 }
 
-func (mfs *MemoryFS) Chdir(dir string) error {
+/*
+WriteFileAtomic replaces the named file with a new one holding data, in
+a single step. Like a rename over the old file, handles that are already
+open keep seeing the old contents.
+*/
+func (mfs *MemoryFS) WriteFileAtomic(name string, data []byte, perm fs.FileMode) error {
+	defer mfs.flush()
+
+	mfs.lock.Lock()
+	defer mfs.lock.Unlock()
+
+	p := mfs.abs(name)
+	parent, base, err := mfs.createParent(p)
+
+	if err != nil {
+		return &fs.PathError{Op: "writeatomic", Path: name, Err: err}
+	}
+
+	existing, exists := parent.children[base]
+
+	if exists && existing.isDir() {
+		return &fs.PathError{Op: "writeatomic", Path: name, Err: syscall.EISDIR}
+	}
+
+	if !parent.canWrite() {
+		return &fs.PathError{Op: "writeatomic", Path: name, Err: fs.ErrPermission}
+	}
+
+	n := newFileNode(base, perm, mfs.now())
+	n.data = append(n.data, data...)
+	parent.children[base] = n
+	parent.modTime = n.modTime
+
+	if exists {
+		mfs.notify(filesystem.EventModify, p, "")
+	} else {
+		mfs.notify(filesystem.EventCreate, p, "")
+	}
+
 	return nil
 }
 
-func (mfs *MemoryFS) Create(name string) (filesystem.WritableFile, error) {
-	return mfs.OpenFile(name, os.O_APPEND|os.O_CREATE, 0777)
+/*
+ReadDir returns the entries of a directory, sorted by name
+*/
+func (mfs *MemoryFS) ReadDir(dir string) ([]fs.DirEntry, error) {
+	mfs.lock.RLock()
+	defer mfs.lock.RUnlock()
+
+	n, err := mfs.walk(mfs.abs(dir))
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: dir, Err: err}
+	}
+
+	if !n.isDir() {
+		return nil, &fs.PathError{Op: "readdirent", Path: dir, Err: syscall.ENOTDIR}
+	}
+
+	if !n.canRead() {
+		return nil, &fs.PathError{Op: "open", Path: dir, Err: fs.ErrPermission}
+	}
+
+	return n.entries(), nil
 }
 
-func (mfs *MemoryFS) Mkdir(name string, perm fs.FileMode) error {
-	mfs.dirs = append(mfs.dirs, &DirEntry{
-		name:    name,
-		dirType: perm,
-	})
+func (mfs *MemoryFS) FileExists(file string) bool {
+	_, err := mfs.Stat(file)
+	return err == nil
+}
+
+/*
+Remove removes a file or empty directory
+*/
+func (mfs *MemoryFS) Remove(name string) error {
+	defer mfs.flush()
+
+	mfs.lock.Lock()
+	defer mfs.lock.Unlock()
+
+	p := mfs.abs(name)
+
+	if p == "/" {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+
+	n, err := mfs.lstat(p)
+
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+
+	if n.isDir() && len(n.children) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+
+	parent, base, _ := mfs.parent(p)
+
+	if !parent.canWrite() {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+	}
+
+	delete(parent.children, base)
+	parent.modTime = mfs.now()
+	mfs.notify(filesystem.EventRemove, p, "")
 
 	return nil
 }
 
-func (mfs *MemoryFS) MkdirAll(path string, perm fs.FileMode) error {
-	return mfs.Mkdir(path, perm)
-}
+/*
+RemoveAll removes a path and everything it contains. It returns nil
+if the path does not exist.
+*/
+func (mfs *MemoryFS) RemoveAll(name string) error {
+	defer mfs.flush()
 
-func (mfs *MemoryFS) Open(name string) (fs.File, error) {
-	for _, f := range mfs.files {
-		if filepath.Join(f.path, f.fileName) == name {
-			return f, nil
+	mfs.lock.Lock()
+	defer mfs.lock.Unlock()
+
+	p := mfs.abs(name)
+
+	if p == "/" {
+		return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if _, err := mfs.lstat(p); err != nil {
+		if err == fs.ErrNotExist {
+			return nil
 		}
+
+		return &fs.PathError{Op: "removeall", Path: name, Err: err}
 	}
 
-	return nil, os.ErrNotExist
+	parent, base, _ := mfs.parent(p)
+
+	if !parent.canWrite() {
+		return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrPermission}
+	}
+
+	delete(parent.children, base)
+	parent.modTime = mfs.now()
+	mfs.notify(filesystem.EventRemove, p, "")
+
+	return nil
 }
 
-func (mfs *MemoryFS) OpenFile(name string, flag int, perm os.FileMode) (filesystem.WritableFile, error) {
-	var f *MemoryFile
-	found := false
+/*
+Rename moves oldName to newName. An existing file at newName is replaced.
+A directory may only replace an empty directory.
+*/
+func (mfs *MemoryFS) Rename(oldName, newName string) error {
+	defer mfs.flush()
 
-	for _, f = range mfs.files {
-		if f.path == name {
-			found = true
-			break
-		}
+	mfs.lock.Lock()
+	defer mfs.lock.Unlock()
+
+	oldPath := mfs.abs(oldName)
+	newPath := mfs.abs(newName)
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: err}
 	}
 
-	if !found && flag&os.O_CREATE == 0 && flag&os.O_APPEND == 0 {
-		return f, os.ErrNotExist
+	if oldPath == "/" || newPath == "/" {
+		return linkErr(fs.ErrInvalid)
 	}
 
-	if (!found && flag&os.O_APPEND > 0) || (!found && flag&os.O_CREATE > 0) {
-		newFile := &MemoryFile{
-			data:     []byte{},
-			fileName: filepath.Base(name),
-			path:     filepath.Dir(name),
-			flag:     flag,
+	n, err := mfs.lstat(oldPath)
+
+	if err != nil {
+		return linkErr(err)
+	}
+
+	if oldPath == newPath {
+		return nil
+	}
+
+	if n.isDir() && strings.HasPrefix(newPath, oldPath+"/") {
+		return linkErr(fs.ErrInvalid)
+	}
+
+	newParent, newBase, err := mfs.parent(newPath)
+
+	if err != nil {
+		return linkErr(err)
+	}
+
+	if existing, ok := newParent.children[newBase]; ok {
+		switch {
+		case existing.isDir() && !n.isDir():
+			return linkErr(syscall.EISDIR)
+
+		case !existing.isDir() && n.isDir():
+			return linkErr(syscall.ENOTDIR)
+
+		case existing.isDir() && len(existing.children) > 0:
+			return linkErr(syscall.ENOTEMPTY)
 		}
+	}
 
-		mfs.files = append(mfs.files, newFile)
-		return newFile, nil
+	oldParent, oldBase, _ := mfs.parent(oldPath)
+
+	if !oldParent.canWrite() || !newParent.canWrite() {
+		return linkErr(fs.ErrPermission)
 	}
 
-	return f, nil
+	now := mfs.now()
+
+	delete(oldParent.children, oldBase)
+	oldParent.modTime = now
+
+	n.name = newBase
+	newParent.children[newBase] = n
+	newParent.modTime = now
+	mfs.notify(filesystem.EventRename, newPath, oldPath)
+
+	return nil
 }
 
-func (mfs *MemoryFS) ReadFile(name string) ([]byte, error) {
-	var (
-		err error
-		f   fs.File
-	)
+/*
+Symlink creates newName as a symbolic link to oldName. The target is
+stored as given and resolved when the link is followed, so it does not
+need to exist.
+*/
+func (mfs *MemoryFS) Symlink(oldName, newName string) error {
+	defer mfs.flush()
 
-	if f, err = mfs.Open(name); err != nil {
-		return []byte{}, err
+	mfs.lock.Lock()
+	defer mfs.lock.Unlock()
+
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "symlink", Old: oldName, New: newName, Err: err}
 	}
 
-	result := f.(*MemoryFile)
-	return result.data, nil
+	p := mfs.abs(newName)
+
+	if p == "/" {
+		return linkErr(fs.ErrExist)
+	}
+
+	parent, base, err := mfs.parent(p)
+
+	if err != nil {
+		return linkErr(err)
+	}
+
+	if _, ok := parent.children[base]; ok {
+		return linkErr(fs.ErrExist)
+	}
+
+	if !parent.canWrite() {
+		return linkErr(fs.ErrPermission)
+	}
+
+	n := newLinkNode(base, filepath.ToSlash(oldName), mfs.now())
+	parent.children[base] = n
+	parent.modTime = n.modTime
+	mfs.notify(filesystem.EventCreate, p, "")
+
+	return nil
 }
 
-func (mfs *MemoryFS) Stat(name string) (fs.FileInfo, error) {
-	f, err := mfs.Open(name)
+/*
+Readlink returns the target of a symbolic link
+*/
+func (mfs *MemoryFS) Readlink(name string) (string, error) {
+	mfs.lock.RLock()
+	defer mfs.lock.RUnlock()
+
+	n, err := mfs.lstat(mfs.abs(name))
 
 	if err != nil {
-		return filesystem.FileInfo{}, err
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
 	}
 
-	file := f.(*MemoryFile)
+	if !n.isLink() {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
 
-	return filesystem.FileInfo{
-		FileName:     name,
-		FileSize:     int64(len(file.data)),
-		FileMode:     0,
-		ModifiedTime: time.Now(),
-		IsDirectory:  false,
-		System:       nil,
-	}, nil
+	return string(n.data), nil
 }
 
-func (mfs *MemoryFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
-	newFile := &MemoryFile{
-		data:     data,
-		fileName: filepath.Base(name),
-		path:     filepath.Dir(name),
-		flag:     os.O_CREATE,
+/*
+Lstat describes a file. If the file is a symbolic link, the link itself
+is described rather than its target.
+*/
+func (mfs *MemoryFS) Lstat(name string) (fs.FileInfo, error) {
+	mfs.lock.RLock()
+	defer mfs.lock.RUnlock()
+
+	n, err := mfs.lstat(mfs.abs(name))
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: err}
 	}
 
-	mfs.files = append(mfs.files, newFile)
-	return nil
+	return n.info(), nil
 }
 
-func (mfs *MemoryFS) ReadDir(dir string) ([]fs.DirEntry, error) {
-	var (
-		err      error
-		result   []fs.DirEntry
-		foundDir *DirEntry
-	)
-
-	for _, d := range mfs.dirs {
-		if d.name == dir {
-			foundDir = d
-			break
-		}
+/*
+WalkDir walks the tree rooted at root, following the same rules as
+filepath.WalkDir. Symbolic links are not followed.
+*/
+func (mfs *MemoryFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return filesystem.WalkDir(mfs.fallback(), root, fn)
+}
+
+/*
+Glob returns the names of all files matching pattern, following the
+same rules as filepath.Glob
+*/
+func (mfs *MemoryFS) Glob(pattern string) ([]string, error) {
+	return filesystem.Glob(mfs.fallback(), pattern)
+}
+
+/*
+Truncate changes the size of a file. Growing a file pads it with zeros.
+*/
+func (mfs *MemoryFS) Truncate(name string, size int64) error {
+	defer mfs.flush()
+
+	mfs.lock.Lock()
+	defer mfs.lock.Unlock()
+
+	n, err := mfs.walk(mfs.abs(name))
+
+	if err != nil {
+		return &fs.PathError{Op: "truncate", Path: name, Err: err}
+	}
+
+	if n.isDir() {
+		return &fs.PathError{Op: "truncate", Path: name, Err: syscall.EISDIR}
 	}
 
-	if foundDir == nil {
-		return result, fmt.Errorf("directory not found")
+	if !n.canWrite() {
+		return &fs.PathError{Op: "truncate", Path: name, Err: fs.ErrPermission}
 	}
 
-	for _, f := range mfs.files {
-		fi := filesystem.FileInfo{
-			FileName:     f.Name(),
-			FileSize:     0,
-			FileMode:     0777,
-			ModifiedTime: time.Now().UTC(),
-			IsDirectory:  false,
-			System:       nil,
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: name, Err: fs.ErrInvalid}
+	}
+
+	n.data = resize(n.data, size)
+	n.modTime = mfs.now()
+	mfs.notify(filesystem.EventModify, mfs.abs(name), "")
+
+	return nil
+}
+
+/*
+abs converts a name to a clean, absolute, slash separated path. Relative
+names are resolved against the working directory.
+*/
+func (mfs *MemoryFS) abs(name string) string {
+	name = filepath.ToSlash(name)
+
+	if !path.IsAbs(name) {
+		name = path.Join(mfs.cwd, name)
+	}
+
+	return path.Clean(name)
+}
+
+/*
+walk finds the node at an absolute path, following symbolic links
+*/
+func (mfs *MemoryFS) walk(p string) (*node, error) {
+	return mfs.resolve(p, true)
+}
+
+/*
+lstat finds the node at an absolute path. Symbolic links in the
+directory part of the path are followed, but a link at the end is not.
+*/
+func (mfs *MemoryFS) lstat(p string) (*node, error) {
+	return mfs.resolve(p, false)
+}
+
+func (mfs *MemoryFS) resolve(p string, followLast bool) (*node, error) {
+	parts := splitPath(p)
+	current := mfs.root
+	currentPath := "/"
+	links := 0
+
+	for i := 0; i < len(parts); i++ {
+		if !current.isDir() {
+			return nil, syscall.ENOTDIR
+		}
+
+		next, ok := current.children[parts[i]]
+
+		if !ok {
+			return nil, fs.ErrNotExist
 		}
 
-		de := &DirEntry{
-			name: f.Name(),
-			info: fi,
+		if next.isLink() && (followLast || i < len(parts)-1) {
+			if links++; links > maxSymlinks {
+				return nil, syscall.ELOOP
+			}
+
+			target := string(next.data)
+
+			if !path.IsAbs(target) {
+				target = path.Join(currentPath, target)
+			}
+
+			parts = append(splitPath(path.Clean(target)), parts[i+1:]...)
+			current = mfs.root
+			currentPath = "/"
+			i = -1
+			continue
 		}
 
-		result = append(result, de)
+		current = next
+		currentPath = path.Join(currentPath, parts[i])
 	}
 
-	return result, nil
+	return current, nil
 }
 
-func (mfs *MemoryFS) FileExists(file string) bool {
-	for _, f := range mfs.files {
-		if f.Name() == file {
-			return true
+/*
+createParent works like parent, but when the path names a dangling
+symbolic link it returns the location of the link's target instead,
+so creating the file creates the target
+*/
+func (mfs *MemoryFS) createParent(p string) (*node, string, error) {
+	for links := 0; ; links++ {
+		parent, base, err := mfs.parent(p)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		link, ok := parent.children[base]
+
+		if !ok || !link.isLink() {
+			return parent, base, nil
+		}
+
+		if links >= maxSymlinks {
+			return nil, "", syscall.ELOOP
 		}
+
+		target := string(link.data)
+
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(p), target)
+		}
+
+		p = path.Clean(target)
+	}
+}
+
+/*
+fallback hides the optional capabilities of the file system, so the
+generic helpers in the filesystem package don't call back into MemoryFS
+*/
+func (mfs *MemoryFS) fallback() filesystem.FileSystem {
+	return struct {
+		filesystem.FileSystem
+		filesystem.SymlinkFS
+	}{mfs, mfs}
+}
+
+/*
+parent finds the directory that contains an absolute path, and
+returns it along with the base name
+*/
+func (mfs *MemoryFS) parent(p string) (*node, string, error) {
+	dir, base := path.Split(p)
+	n, err := mfs.walk(path.Clean(dir))
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !n.isDir() {
+		return nil, "", syscall.ENOTDIR
+	}
+
+	return n, base, nil
+}
+
+func (mfs *MemoryFS) mkdir(name, p string, perm fs.FileMode) error {
+	if p == "/" {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+
+	parent, base, err := mfs.parent(p)
+
+	if err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+
+	if _, ok := parent.children[base]; ok {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+
+	if !parent.canWrite() {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrPermission}
+	}
+
+	n := newDirNode(base, perm, mfs.now())
+	parent.children[base] = n
+	parent.modTime = n.modTime
+	mfs.notify(filesystem.EventCreate, p, "")
+
+	return nil
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+
+	if p == "" {
+		return []string{}
+	}
+
+	return strings.Split(p, "/")
+}
+
+func resize(data []byte, size int64) []byte {
+	if int64(len(data)) >= size {
+		return data[:size]
 	}
 
-	return false
+	return append(data, make([]byte, size-int64(len(data)))...)
 }
@@ -0,0 +1,219 @@
+package memoryfs_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/fstest"
+
+	"github.com/app-nerds/kit/v6/filesystem/memoryfs"
+)
+
+func TestMemoryFS_PassesFSTest(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+
+	if err := mfs.MkdirAll("/data/sub/deeper", 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_ = mfs.WriteFile("/data/a.txt", []byte("hello"), 0644)
+	_ = mfs.WriteFile("/data/sub/b.txt", []byte("world"), 0644)
+	_ = mfs.WriteFile("/data/sub/deeper/c.txt", []byte(""), 0600)
+
+	if err := fstest.TestFS(mfs.DirFS("/data"), "a.txt", "sub/b.txt", "sub/deeper/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryFS_ReadSeekAndEOF(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+	_ = mfs.WriteFile("file.txt", []byte("0123456789"), 0644)
+
+	f, err := mfs.Open("file.txt")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+
+	if err != nil || string(data) != "0123456789" {
+		t.Fatalf("expected full contents but got '%s', %v", data, err)
+	}
+
+	if n, err := f.Read(make([]byte, 4)); n != 0 || err != io.EOF {
+		t.Errorf("expected EOF after reading everything but got %d, %v", n, err)
+	}
+
+	_, _ = f.(io.Seeker).Seek(-3, io.SeekEnd)
+	data, _ = io.ReadAll(f)
+
+	if string(data) != "789" {
+		t.Errorf("expected '789' after seeking but got '%s'", data)
+	}
+}
+
+func TestMemoryFS_OpenFileFlags(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+	_ = mfs.MkdirAll("/logs", 0755)
+
+	f, _ := mfs.OpenFile("/logs/app.log", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	_, _ = f.WriteString("one\n")
+	_ = f.Close()
+
+	f, _ = mfs.OpenFile("/logs/app.log", os.O_WRONLY|os.O_APPEND, 0644)
+	_, _ = f.WriteString("two\n")
+	_ = f.Close()
+
+	if data, _ := mfs.ReadFile("/logs/app.log"); string(data) != "one\ntwo\n" {
+		t.Errorf("expected appended contents but got '%s'", data)
+	}
+
+	if _, err := mfs.OpenFile("/logs/app.log", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected ErrExist with O_EXCL but got %v", err)
+	}
+
+	if _, err := mfs.OpenFile("/missing/app.log", os.O_WRONLY|os.O_CREATE, 0644); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected ErrNotExist when the parent is missing but got %v", err)
+	}
+
+	f, _ = mfs.OpenFile("/logs/app.log", os.O_RDONLY, 0)
+
+	if _, err := f.Write([]byte("nope")); err == nil {
+		t.Errorf("expected an error writing to a read-only handle")
+	}
+
+	_ = mfs.Chmod("/logs/app.log", 0444)
+
+	if _, err := mfs.OpenFile("/logs/app.log", os.O_WRONLY, 0); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected ErrPermission writing a read-only file but got %v", err)
+	}
+}
+
+func TestMemoryFS_DirectoriesAndRelativePaths(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+
+	if err := mfs.MkdirAll("/a/b/c", 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mfs.Chdir("/a/b"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_ = mfs.WriteFile("c/file.txt", []byte("x"), 0644)
+	_ = mfs.WriteFile("../other.txt", []byte("y"), 0644)
+
+	if !mfs.FileExists("/a/b/c/file.txt") || !mfs.FileExists("/a/other.txt") {
+		t.Errorf("expected relative paths to resolve against the working directory")
+	}
+
+	entries, _ := mfs.ReadDir("/a")
+
+	if len(entries) != 2 || entries[0].Name() != "b" || !entries[0].IsDir() || entries[1].Name() != "other.txt" {
+		t.Errorf("expected only the entries of /a but got %v", entries)
+	}
+
+	if err := mfs.Remove("/a/b"); err == nil {
+		t.Errorf("expected an error removing a non-empty directory")
+	}
+
+	if err := mfs.Rename("/a/other.txt", "/a/b/c/moved.txt"); err != nil {
+		t.Fatalf("unexpected error renaming: %v", err)
+	}
+
+	if mfs.FileExists("/a/other.txt") || !mfs.FileExists("/a/b/c/moved.txt") {
+		t.Errorf("expected the file to move")
+	}
+
+	if err := mfs.RemoveAll("/a"); err != nil || mfs.FileExists("/a") {
+		t.Errorf("expected /a to be removed but got %v", err)
+	}
+}
+
+func TestMemoryFS_Symlinks(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+
+	_ = mfs.MkdirAll("/data/real", 0755)
+	_ = mfs.WriteFile("/data/real/file.txt", []byte("hello"), 0644)
+
+	if err := mfs.Symlink("real", "/data/link"); err != nil {
+		t.Fatalf("unexpected error creating symlink: %s", err)
+	}
+
+	if data, err := mfs.ReadFile("/data/link/file.txt"); err != nil || string(data) != "hello" {
+		t.Errorf("expected to read through the link but got %q, %v", data, err)
+	}
+
+	if target, _ := mfs.Readlink("/data/link"); target != "real" {
+		t.Errorf("expected link target 'real' but got %q", target)
+	}
+
+	info, _ := mfs.Lstat("/data/link")
+
+	if info.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("expected Lstat to describe the link but got mode %s", info.Mode())
+	}
+
+	if info, _ = mfs.Stat("/data/link"); !info.IsDir() {
+		t.Errorf("expected Stat to follow the link to a directory")
+	}
+
+	_ = mfs.Symlink("/data/missing.txt", "/data/dangling")
+
+	if err := mfs.WriteFile("/data/dangling", []byte("created"), 0644); err != nil {
+		t.Fatalf("unexpected error writing through dangling link: %s", err)
+	}
+
+	if !mfs.FileExists("/data/missing.txt") {
+		t.Errorf("expected writing through a dangling link to create its target")
+	}
+
+	_ = mfs.Symlink("/loop/b", "/loop")
+
+	if _, err := mfs.Stat("/loop"); !errors.Is(err, syscall.ELOOP) {
+		t.Errorf("expected ELOOP but got %v", err)
+	}
+
+	if err := mfs.Remove("/data/link"); err != nil {
+		t.Fatalf("unexpected error removing link: %s", err)
+	}
+
+	if !mfs.FileExists("/data/real/file.txt") {
+		t.Errorf("expected removing a link to leave its target alone")
+	}
+}
+
+func TestMemoryFS_WalkDirAndGlob(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+
+	_ = mfs.MkdirAll("/a/b", 0755)
+	_ = mfs.WriteFile("/a/one.txt", nil, 0644)
+	_ = mfs.WriteFile("/a/b/two.txt", nil, 0644)
+	_ = mfs.WriteFile("/a/b/three.md", nil, 0644)
+
+	var visited []string
+
+	err := mfs.WalkDir("/a", func(path string, d fs.DirEntry, err error) error {
+		visited = append(visited, path)
+		return err
+	})
+
+	expected := "/a,/a/b,/a/b/three.md,/a/b/two.txt,/a/one.txt"
+
+	if err != nil || strings.Join(visited, ",") != expected {
+		t.Errorf("expected %s but got %s (%v)", expected, strings.Join(visited, ","), err)
+	}
+
+	matches, err := mfs.Glob("/a/*/*.txt")
+
+	if err != nil || len(matches) != 1 || matches[0] != "/a/b/two.txt" {
+		t.Errorf("expected [/a/b/two.txt] but got %v (%v)", matches, err)
+	}
+}
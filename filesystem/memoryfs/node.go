@@ -0,0 +1,99 @@
+package memoryfs
+
+import (
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+node is a single file or directory in the tree. Directories keep their
+children by name. Files keep their contents in data, and symbolic links keep their
+target there. Open file handles
+point at the node, so a file that is removed or renamed while open keeps
+working, just like on a POSIX file system.
+*/
+type node struct {
+	children map[string]*node
+	data     []byte
+	mode     fs.FileMode
+	modTime  time.Time
+	name     string
+}
+
+func newDirNode(name string, perm fs.FileMode, modTime time.Time) *node {
+	return &node{
+		children: map[string]*node{},
+		mode:     fs.ModeDir | (perm & fs.ModePerm),
+		modTime:  modTime,
+		name:     name,
+	}
+}
+
+func newFileNode(name string, perm fs.FileMode, modTime time.Time) *node {
+	return &node{
+		data:    []byte{},
+		mode:    perm & fs.ModePerm,
+		modTime: modTime,
+		name:    name,
+	}
+}
+
+func newLinkNode(name, target string, modTime time.Time) *node {
+	return &node{
+		data:    []byte(target),
+		mode:    fs.ModeSymlink | fs.ModePerm,
+		modTime: modTime,
+		name:    name,
+	}
+}
+
+func (n *node) isLink() bool {
+	return n.mode&fs.ModeSymlink != 0
+}
+
+func (n *node) isDir() bool {
+	return n.mode.IsDir()
+}
+
+func (n *node) info() fs.FileInfo {
+	return filesystem.FileInfo{
+		FileName:     n.name,
+		FileSize:     int64(len(n.data)),
+		FileMode:     n.mode,
+		ModifiedTime: n.modTime,
+		IsDirectory:  n.isDir(),
+		System:       nil,
+	}
+}
+
+/*
+entries returns the directory's children as sorted DirEntry values
+*/
+func (n *node) entries() []fs.DirEntry {
+	result := make([]fs.DirEntry, 0, len(n.children))
+
+	for _, child := range n.children {
+		result = append(result, &DirEntry{
+			name:    child.name,
+			dirType: child.mode.Type(),
+			info:    child.info(),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+
+	return result
+}
+
+func (n *node) canRead() bool {
+	return n.mode&0400 != 0
+}
+
+func (n *node) canWrite() bool {
+	return n.mode&0200 != 0
+}
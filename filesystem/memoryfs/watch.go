@@ -0,0 +1,157 @@
+package memoryfs
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+memoryWatcher receives the events of one Watch call
+*/
+type memoryWatcher struct {
+	closeOnce sync.Once
+	done      chan struct{}
+	errors    chan error
+	events    chan filesystem.Event
+	fs        *MemoryFS
+	path      string
+	recursive bool
+}
+
+/*
+Watch reports changes to a file or directory. Events are delivered
+synchronously. By the time the call that made a change returns, its
+events are in the channel, which makes tests deterministic. If the
+channel is full, that call waits for room, so keep it drained.
+
+Creating a file and writing to it are separate events, as they are on
+a real file system. Use WatchOptions.Debounce to combine them.
+*/
+func (mfs *MemoryFS) Watch(name string, options filesystem.WatchOptions) (filesystem.Watcher, error) {
+	mfs.lock.RLock()
+	p := mfs.abs(name)
+	_, err := mfs.walk(p)
+	mfs.lock.RUnlock()
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "watch", Path: name, Err: err}
+	}
+
+	bufferSize := options.BufferSize
+
+	if bufferSize <= 0 {
+		bufferSize = filesystem.DefaultWatchBufferSize
+	}
+
+	w := &memoryWatcher{
+		done:      make(chan struct{}),
+		errors:    make(chan error),
+		events:    make(chan filesystem.Event, bufferSize),
+		fs:        mfs,
+		path:      p,
+		recursive: options.Recursive,
+	}
+
+	mfs.watchLock.Lock()
+	mfs.watchers = append(mfs.watchers, w)
+	mfs.watchLock.Unlock()
+
+	return filesystem.NewDebouncedWatcher(w, options.Debounce), nil
+}
+
+func (w *memoryWatcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+
+		w.fs.deliverLock.Lock()
+		defer w.fs.deliverLock.Unlock()
+
+		w.fs.watchLock.Lock()
+
+		for index, other := range w.fs.watchers {
+			if other == w {
+				w.fs.watchers = append(w.fs.watchers[:index], w.fs.watchers[index+1:]...)
+				break
+			}
+		}
+
+		w.fs.watchLock.Unlock()
+
+		close(w.events)
+		close(w.errors)
+	})
+
+	return nil
+}
+
+func (w *memoryWatcher) Errors() <-chan error {
+	return w.errors
+}
+
+func (w *memoryWatcher) Events() <-chan filesystem.Event {
+	return w.events
+}
+
+func (w *memoryWatcher) matches(event filesystem.Event) bool {
+	return w.covers(event.Name) || (event.OldName != "" && w.covers(event.OldName))
+}
+
+func (w *memoryWatcher) covers(name string) bool {
+	switch {
+	case name == w.path:
+		return true
+
+	case w.recursive:
+		return w.path == "/" || strings.HasPrefix(name, w.path+"/")
+	}
+
+	return path.Dir(name) == w.path
+}
+
+/*
+notify queues an event. It is called while the file system is locked,
+and the event is delivered by flush once the lock is released.
+*/
+func (mfs *MemoryFS) notify(op filesystem.EventOp, name, oldName string) {
+	mfs.watchLock.Lock()
+	defer mfs.watchLock.Unlock()
+
+	if len(mfs.watchers) == 0 {
+		return
+	}
+
+	mfs.pending = append(mfs.pending, filesystem.Event{Name: name, OldName: oldName, Op: op})
+}
+
+/*
+flush delivers queued events to the watchers that are interested in
+them. Every method that changes the file system defers it before taking
+the lock, so it runs after the lock is released.
+*/
+func (mfs *MemoryFS) flush() {
+	mfs.deliverLock.Lock()
+	defer mfs.deliverLock.Unlock()
+
+	mfs.watchLock.Lock()
+	events := mfs.pending
+	watchers := append([]*memoryWatcher{}, mfs.watchers...)
+	mfs.pending = nil
+	mfs.watchLock.Unlock()
+
+	for _, event := range events {
+		for _, w := range watchers {
+			if !w.matches(event) {
+				continue
+			}
+
+			select {
+			case w.events <- event:
+			case <-w.done:
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package memoryfs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+	"github.com/app-nerds/kit/v6/filesystem/memoryfs"
+)
+
+func drain(w filesystem.Watcher) []filesystem.Event {
+	result := []filesystem.Event{}
+
+	for {
+		select {
+		case event := <-w.Events():
+			result = append(result, event)
+
+		default:
+			return result
+		}
+	}
+}
+
+func TestMemoryFS_WatchIsSynchronous(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+	_ = mfs.MkdirAll("/drop/nested", 0755)
+
+	shallow, _ := mfs.Watch("/drop", filesystem.WatchOptions{})
+	deep, _ := mfs.Watch("/drop", filesystem.WatchOptions{Recursive: true})
+
+	defer shallow.Close()
+	defer deep.Close()
+
+	_ = mfs.WriteFile("/drop/a.txt", []byte("a"), 0644)
+	_ = mfs.WriteFile("/drop/nested/b.txt", []byte("b"), 0644)
+	_ = mfs.Rename("/drop/a.txt", "/drop/c.txt")
+	_ = mfs.Remove("/drop/c.txt")
+
+	expected := []filesystem.Event{
+		{Name: "/drop/a.txt", Op: filesystem.EventCreate},
+		{Name: "/drop/a.txt", Op: filesystem.EventModify},
+		{Name: "/drop/c.txt", OldName: "/drop/a.txt", Op: filesystem.EventRename},
+		{Name: "/drop/c.txt", Op: filesystem.EventRemove},
+	}
+
+	if got := drain(shallow); !equalEvents(got, expected) {
+		t.Errorf("expected %v but got %v", expected, got)
+	}
+
+	if got := drain(deep); len(got) != 6 || got[2].Name != "/drop/nested/b.txt" {
+		t.Errorf("expected the recursive watch to see nested files but got %v", got)
+	}
+}
+
+func TestMemoryFS_WatchDebounce(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+	w, _ := mfs.Watch("/", filesystem.WatchOptions{Debounce: 20 * time.Millisecond})
+
+	defer w.Close()
+
+	f, _ := mfs.Create("/upload.bin")
+
+	for i := 0; i < 5; i++ {
+		_, _ = f.Write([]byte("chunk"))
+	}
+
+	_ = f.Close()
+
+	select {
+	case event := <-w.Events():
+		if event.Name != "/upload.bin" || event.Op != filesystem.EventCreate|filesystem.EventModify {
+			t.Errorf("expected one combined CREATE|MODIFY event but got %v", event)
+		}
+
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for the debounced event")
+	}
+
+	if extra := drain(w); len(extra) != 0 {
+		t.Errorf("expected no more events but got %v", extra)
+	}
+}
+
+func equalEvents(a, b []filesystem.Event) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,76 @@
+package overlayfs
+
+import (
+	"io"
+	"io/fs"
+	"syscall"
+)
+
+/*
+dirFile is a directory opened for reading. It holds the merged entries
+of every layer, read when the directory was opened.
+*/
+type dirFile struct {
+	closed  bool
+	entries []fs.DirEntry
+	info    fs.FileInfo
+	name    string
+}
+
+func (d *dirFile) Close() error {
+	if d.closed {
+		return &fs.PathError{Op: "close", Path: d.name, Err: fs.ErrClosed}
+	}
+
+	d.closed = true
+	return nil
+}
+
+func (d *dirFile) Name() string {
+	return d.name
+}
+
+func (d *dirFile) Read(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: syscall.EISDIR}
+}
+
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: fs.ErrClosed}
+	}
+
+	if n <= 0 {
+		result := d.entries
+		d.entries = nil
+		return result, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+
+	result := d.entries[:n]
+	d.entries = d.entries[n:]
+
+	return result, nil
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dirFile) Sync() error {
+	return nil
+}
+
+func (d *dirFile) Write(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: d.name, Err: syscall.EISDIR}
+}
+
+func (d *dirFile) WriteString(s string) (int, error) {
+	return d.Write([]byte(s))
+}
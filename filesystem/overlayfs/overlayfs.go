@@ -0,0 +1,769 @@
+package overlayfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+OverlayFS stacks file systems on top of each other. This implements FileSystem,
+RemoveFS, and RenameFS.
+
+Reads fall through the layers, from the top down, and the first layer that has
+a file wins. Directories that exist in several layers are merged by ReadDir.
+Only the top layer is ever written to. Changing a file that lives in a lower
+layer first copies it up to the top layer, along with its parent directories.
+
+Removing something that exists in a lower layer records a whiteout, which hides
+that path, and everything below it, in every lower layer. Whiteouts are kept in
+memory. Commit writes the top layer and its whiteouts down to the base layer,
+then empties the top layer.
+
+All layers share the same paths. Absolute names are passed to them unchanged,
+and relative names are resolved against the overlay's own working directory.
+*/
+type OverlayFS struct {
+	lock      sync.RWMutex
+	cwd       string
+	layers    []filesystem.FileSystem
+	top       filesystem.FileSystem
+	whiteouts map[string]bool
+}
+
+/*
+NewOverlayFS creates an overlay with top as the writable layer. The lower
+layers are listed from the top down, so the last one is the base layer.
+They are only read from, until Commit is called.
+*/
+func NewOverlayFS(top filesystem.FileSystem, lower ...filesystem.FileSystem) *OverlayFS {
+	return &OverlayFS{
+		cwd:       "/",
+		layers:    lower,
+		top:       top,
+		whiteouts: map[string]bool{},
+	}
+}
+
+/*
+Chdir changes the overlay working directory. The working directories of
+the layers are left alone.
+*/
+func (o *OverlayFS) Chdir(dir string) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	p := o.abs(dir)
+	info, _, err := o.lookup(p)
+
+	if err != nil {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: err}
+	}
+
+	if !info.IsDir() {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: syscall.ENOTDIR}
+	}
+
+	o.cwd = p
+	return nil
+}
+
+func (o *OverlayFS) Create(name string) (filesystem.WritableFile, error) {
+	return o.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (o *OverlayFS) Mkdir(name string, perm fs.FileMode) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	p := o.abs(name)
+
+	if _, _, err := o.lookup(p); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+
+	if err := o.copyUpParents(p); err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+
+	return o.top.Mkdir(p, perm)
+}
+
+func (o *OverlayFS) MkdirAll(dir string, perm fs.FileMode) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if err := o.mkdirAll(o.abs(dir), perm); err != nil {
+		return &fs.PathError{Op: "mkdir", Path: dir, Err: err}
+	}
+
+	return nil
+}
+
+func (o *OverlayFS) Open(name string) (fs.File, error) {
+	return o.OpenFile(name, os.O_RDONLY, 0)
+}
+
+/*
+OpenFile opens a file in the top most layer that has it. Opening a file
+from a lower layer for writing copies it up first, unless it is being
+truncated anyway. Directories opened for reading list their merged
+entries.
+*/
+func (o *OverlayFS) OpenFile(name string, flag int, perm os.FileMode) (filesystem.WritableFile, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	p := o.abs(name)
+	info, layer, err := o.lookup(p)
+	writing := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0
+
+	if !writing {
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+
+		if info.IsDir() {
+			entries, err := o.readDir(p)
+
+			if err != nil {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+			}
+
+			return &dirFile{name: name, info: info, entries: entries}, nil
+		}
+
+		return layer.OpenFile(p, flag, perm)
+	}
+
+	switch {
+	case err == nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+
+	case err == nil && layer != o.top:
+		if info.IsDir() {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+		}
+
+		if err = o.copyUpParents(p); err == nil && flag&os.O_TRUNC == 0 {
+			err = o.copyUpFile(p, info, layer)
+		}
+
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+
+		flag |= os.O_CREATE
+		perm = info.Mode().Perm()
+
+	case err != nil && (flag&os.O_CREATE == 0 || !isMissing(err)):
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+
+	case err != nil:
+		if err = o.copyUpParents(p); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+
+	return o.top.OpenFile(p, flag, perm)
+}
+
+func (o *OverlayFS) ReadFile(name string) ([]byte, error) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	p := o.abs(name)
+	_, layer, err := o.lookup(p)
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return layer.ReadFile(p)
+}
+
+func (o *OverlayFS) Stat(name string) (fs.FileInfo, error) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	info, _, err := o.lookup(o.abs(name))
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	return info, nil
+}
+
+func (o *OverlayFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	f, err := o.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+/*
+ReadDir merges the entries of a directory from every layer, sorted by
+name. When a name exists in several layers, the top most one wins.
+*/
+func (o *OverlayFS) ReadDir(dir string) ([]fs.DirEntry, error) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	entries, err := o.readDir(o.abs(dir))
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: dir, Err: err}
+	}
+
+	return entries, nil
+}
+
+func (o *OverlayFS) FileExists(file string) bool {
+	_, err := o.Stat(file)
+	return err == nil
+}
+
+/*
+Remove removes a file or empty directory from the top layer, and records
+a whiteout if a lower layer has it too
+*/
+func (o *OverlayFS) Remove(name string) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	p := o.abs(name)
+
+	if p == "/" {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+
+	info, _, err := o.lookup(p)
+
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+
+	if info.IsDir() {
+		if entries, err := o.readDir(p); err != nil || len(entries) > 0 {
+			if err == nil {
+				err = syscall.ENOTEMPTY
+			}
+
+			return &fs.PathError{Op: "remove", Path: name, Err: err}
+		}
+	}
+
+	if err = o.removeAll(p); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+
+	return nil
+}
+
+/*
+RemoveAll removes a path and everything it contains from the top layer,
+and records a whiteout if a lower layer has it too
+*/
+func (o *OverlayFS) RemoveAll(name string) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	p := o.abs(name)
+
+	if p == "/" {
+		return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if err := o.removeAll(p); err != nil {
+		return &fs.PathError{Op: "removeall", Path: name, Err: err}
+	}
+
+	return nil
+}
+
+/*
+Rename moves a file or directory. Anything that lives in a lower layer
+is copied up to its new name in the top layer, and its old name is
+whited out.
+*/
+func (o *OverlayFS) Rename(oldName, newName string) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	oldPath := o.abs(oldName)
+	newPath := o.abs(newName)
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: err}
+	}
+
+	if oldPath == "/" || newPath == "/" {
+		return linkErr(fs.ErrInvalid)
+	}
+
+	oldInfo, _, err := o.lookup(oldPath)
+
+	if err != nil {
+		return linkErr(err)
+	}
+
+	if oldPath == newPath {
+		return nil
+	}
+
+	if oldInfo.IsDir() && strings.HasPrefix(newPath, oldPath+"/") {
+		return linkErr(fs.ErrInvalid)
+	}
+
+	if newInfo, _, err := o.lookup(newPath); err == nil {
+		switch {
+		case newInfo.IsDir() && !oldInfo.IsDir():
+			return linkErr(syscall.EISDIR)
+
+		case !newInfo.IsDir() && oldInfo.IsDir():
+			return linkErr(syscall.ENOTDIR)
+
+		case newInfo.IsDir():
+			if entries, err := o.readDir(newPath); err != nil || len(entries) > 0 {
+				return linkErr(syscall.ENOTEMPTY)
+			}
+		}
+	}
+
+	if err = o.copyUpParents(newPath); err != nil {
+		return linkErr(err)
+	}
+
+	if !o.inLower(oldPath) && !o.inLower(newPath) {
+		if err = filesystem.Rename(o.top, oldPath, newPath); err != nil {
+			return linkErr(unwrap(err))
+		}
+
+		return nil
+	}
+
+	if err = o.removeAll(newPath); err != nil {
+		return linkErr(err)
+	}
+
+	if err = o.copyTree(oldPath, newPath); err != nil {
+		return linkErr(err)
+	}
+
+	if err = o.removeAll(oldPath); err != nil {
+		return linkErr(err)
+	}
+
+	return nil
+}
+
+/*
+Commit writes the top layer down to the base layer, which is the last of
+the lower layers. Whiteouts are applied first, by removing those paths
+from every lower layer that has them, then every directory and file in
+the top layer is copied down to the base. Anything in a middle layer that
+would hide a committed file is removed too. Finally the top layer is
+emptied and the whiteouts are forgotten. The overlay looks the same before
+and after.
+
+The top layer is walked from "/", so it should only hold the changes, as a
+fresh memoryfs does. Lower layers must implement RemoveFS if they hold
+paths that need removing.
+*/
+func (o *OverlayFS) Commit() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if len(o.layers) == 0 {
+		return nil
+	}
+
+	base := o.layers[len(o.layers)-1]
+	middle := o.layers[:len(o.layers)-1]
+	whiteouts := make([]string, 0, len(o.whiteouts))
+
+	for p := range o.whiteouts {
+		whiteouts = append(whiteouts, p)
+	}
+
+	sort.Strings(whiteouts)
+
+	for _, p := range whiteouts {
+		for _, layer := range o.layers {
+			if _, err := layer.Stat(p); isMissing(err) {
+				continue
+			}
+
+			if err := filesystem.RemoveAll(layer, p); err != nil {
+				return err
+			}
+		}
+
+		delete(o.whiteouts, p)
+	}
+
+	err := filesystem.WalkDir(o.top, "/", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == "/" {
+			return err
+		}
+
+		p = filepath.ToSlash(p)
+		info, err := d.Info()
+
+		if err != nil {
+			return err
+		}
+
+		for _, layer := range middle {
+			if existing, statErr := layer.Stat(p); statErr == nil && !(d.IsDir() && existing.IsDir()) {
+				if err = filesystem.RemoveAll(layer, p); err != nil {
+					return err
+				}
+			}
+		}
+
+		if d.IsDir() {
+			return base.MkdirAll(p, info.Mode().Perm())
+		}
+
+		data, err := o.top.ReadFile(p)
+
+		if err != nil {
+			return err
+		}
+
+		return base.WriteFile(p, data, info.Mode().Perm())
+	})
+
+	if err != nil {
+		return err
+	}
+
+	entries, err := o.top.ReadDir("/")
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err = filesystem.RemoveAll(o.top, path.Join("/", entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+Whiteouts returns the sorted paths that have been removed from the lower
+layers since the last Commit
+*/
+func (o *OverlayFS) Whiteouts() []string {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	result := make([]string, 0, len(o.whiteouts))
+
+	for p := range o.whiteouts {
+		result = append(result, p)
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+/*
+abs converts a name to a clean, absolute, slash separated path
+*/
+func (o *OverlayFS) abs(name string) string {
+	name = filepath.ToSlash(name)
+
+	if !path.IsAbs(name) {
+		name = path.Join(o.cwd, name)
+	}
+
+	return path.Clean(name)
+}
+
+/*
+lookup finds the top most layer that has a path, skipping the lower
+layers when the path has been whited out
+*/
+func (o *OverlayFS) lookup(p string) (fs.FileInfo, filesystem.FileSystem, error) {
+	info, err := o.top.Stat(p)
+
+	if err == nil {
+		return info, o.top, nil
+	}
+
+	if !isMissing(err) {
+		return nil, nil, unwrap(err)
+	}
+
+	if o.hidden(p) {
+		return nil, nil, fs.ErrNotExist
+	}
+
+	for _, layer := range o.layers {
+		info, err = layer.Stat(p)
+
+		if err == nil {
+			return info, layer, nil
+		}
+
+		if !isMissing(err) {
+			return nil, nil, unwrap(err)
+		}
+	}
+
+	return nil, nil, fs.ErrNotExist
+}
+
+/*
+hidden reports whether a path, or one of its parents, has been whited out
+*/
+func (o *OverlayFS) hidden(p string) bool {
+	for {
+		if o.whiteouts[p] {
+			return true
+		}
+
+		if p == "/" {
+			return false
+		}
+
+		p = path.Dir(p)
+	}
+}
+
+/*
+inLower reports whether a lower layer has a path that is not whited out
+*/
+func (o *OverlayFS) inLower(p string) bool {
+	if o.hidden(p) {
+		return false
+	}
+
+	for _, layer := range o.layers {
+		if _, err := layer.Stat(p); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (o *OverlayFS) readDir(p string) ([]fs.DirEntry, error) {
+	info, _, err := o.lookup(p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, syscall.ENOTDIR
+	}
+
+	result := []fs.DirEntry{}
+	seen := map[string]bool{}
+	layers := []filesystem.FileSystem{o.top}
+
+	if !o.hidden(p) {
+		layers = append(layers, o.layers...)
+	}
+
+	for index, layer := range layers {
+		info, err := layer.Stat(p)
+
+		if err != nil {
+			continue
+		}
+
+		if !info.IsDir() {
+			break
+		}
+
+		entries, err := layer.ReadDir(p)
+
+		if err != nil {
+			return nil, unwrap(err)
+		}
+
+		for _, entry := range entries {
+			if seen[entry.Name()] || (index > 0 && o.whiteouts[path.Join(p, entry.Name())]) {
+				continue
+			}
+
+			seen[entry.Name()] = true
+			result = append(result, entry)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+
+	return result, nil
+}
+
+func (o *OverlayFS) mkdirAll(p string, perm fs.FileMode) error {
+	info, _, err := o.lookup(p)
+
+	if err == nil {
+		if !info.IsDir() {
+			return syscall.ENOTDIR
+		}
+
+		return nil
+	}
+
+	if err = o.mkdirAll(path.Dir(p), perm); err != nil {
+		return err
+	}
+
+	if err = o.copyUpParents(p); err != nil {
+		return err
+	}
+
+	return o.top.Mkdir(p, perm)
+}
+
+/*
+copyUpParents makes sure the directories above a path exist in the top
+layer, copying their permissions from the lower layers
+*/
+func (o *OverlayFS) copyUpParents(p string) error {
+	dir := path.Dir(p)
+
+	if dir == p {
+		return nil
+	}
+
+	if info, err := o.top.Stat(dir); err == nil {
+		if !info.IsDir() {
+			return syscall.ENOTDIR
+		}
+
+		return nil
+	}
+
+	info, _, err := o.lookup(dir)
+
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return syscall.ENOTDIR
+	}
+
+	if err = o.copyUpParents(dir); err != nil {
+		return err
+	}
+
+	return o.top.Mkdir(dir, info.Mode().Perm())
+}
+
+func (o *OverlayFS) copyUpFile(p string, info fs.FileInfo, layer filesystem.FileSystem) error {
+	data, err := layer.ReadFile(p)
+
+	if err != nil {
+		return err
+	}
+
+	return o.top.WriteFile(p, data, info.Mode().Perm())
+}
+
+/*
+copyTree copies a file or directory, as the overlay sees it, to a new
+path in the top layer
+*/
+func (o *OverlayFS) copyTree(oldPath, newPath string) error {
+	info, layer, err := o.lookup(oldPath)
+
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		data, err := layer.ReadFile(oldPath)
+
+		if err != nil {
+			return err
+		}
+
+		return o.top.WriteFile(newPath, data, info.Mode().Perm())
+	}
+
+	if err = o.top.MkdirAll(newPath, info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	entries, err := o.readDir(oldPath)
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err = o.copyTree(path.Join(oldPath, entry.Name()), path.Join(newPath, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+removeAll removes a path from the top layer, and whites it out when a
+lower layer has it
+*/
+func (o *OverlayFS) removeAll(p string) error {
+	if _, err := o.top.Stat(p); err == nil {
+		if err = filesystem.RemoveAll(o.top, p); err != nil {
+			return unwrap(err)
+		}
+	}
+
+	if o.inLower(p) {
+		o.whiteouts[p] = true
+	}
+
+	return nil
+}
+
+func isMissing(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR)
+}
+
+func unwrap(err error) error {
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+
+	switch {
+	case errors.As(err, &pathErr):
+		return pathErr.Err
+
+	case errors.As(err, &linkErr):
+		return linkErr.Err
+	}
+
+	return err
+}
@@ -0,0 +1,143 @@
+package overlayfs_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/filesystem/localfs"
+	"github.com/app-nerds/kit/v6/filesystem/memoryfs"
+	"github.com/app-nerds/kit/v6/filesystem/overlayfs"
+	"github.com/app-nerds/kit/v6/filesystem/readonlyfs"
+)
+
+func names(t *testing.T, o *overlayfs.OverlayFS, dir string) string {
+	t.Helper()
+
+	entries, err := o.ReadDir(dir)
+
+	if err != nil {
+		t.Fatalf("unexpected error reading %s: %s", dir, err)
+	}
+
+	result := []string{}
+
+	for _, entry := range entries {
+		result = append(result, entry.Name())
+	}
+
+	return strings.Join(result, ",")
+}
+
+func TestOverlayFS_CopyOnWriteOverReadOnlyBase(t *testing.T) {
+	dir := t.TempDir()
+
+	_ = os.MkdirAll(filepath.Join(dir, "site", "css"), 0755)
+	_ = os.WriteFile(filepath.Join(dir, "site", "index.html"), []byte("original"), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "site", "about.html"), []byte("about"), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "site", "css", "app.css"), []byte("css"), 0644)
+
+	site := filepath.Join(dir, "site")
+	o := overlayfs.NewOverlayFS(memoryfs.NewMemoryFS(), readonlyfs.NewReadOnlyFS(localfs.NewLocalFS()))
+
+	if err := o.WriteFile(filepath.Join(site, "index.html"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_ = o.WriteFile(filepath.Join(site, "new.html"), []byte("new"), 0644)
+	_ = o.Remove(filepath.Join(site, "about.html"))
+
+	if data, _ := o.ReadFile(filepath.Join(site, "index.html")); string(data) != "changed" {
+		t.Errorf("expected 'changed' from the top layer but got '%s'", data)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(site, "index.html")); string(data) != "original" {
+		t.Errorf("expected the base layer to be untouched but got '%s'", data)
+	}
+
+	if got := names(t, o, site); got != "css,index.html,new.html" {
+		t.Errorf("expected css,index.html,new.html but got %s", got)
+	}
+
+	if o.FileExists(filepath.Join(site, "about.html")) {
+		t.Errorf("expected the whiteout to hide about.html")
+	}
+
+	if err := o.Rename(filepath.Join(site, "css"), filepath.Join(site, "styles")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if data, _ := o.ReadFile(filepath.Join(site, "styles", "app.css")); string(data) != "css" {
+		t.Errorf("expected the renamed directory to be copied up but got '%s'", data)
+	}
+
+	if got := names(t, o, site); got != "index.html,new.html,styles" {
+		t.Errorf("expected index.html,new.html,styles but got %s", got)
+	}
+}
+
+func TestOverlayFS_Commit(t *testing.T) {
+	base := memoryfs.NewMemoryFS()
+	_ = base.MkdirAll("/data/old", 0755)
+	_ = base.WriteFile("/data/old/file.txt", []byte("old"), 0644)
+	_ = base.WriteFile("/data/keep.txt", []byte("keep"), 0644)
+
+	top := memoryfs.NewMemoryFS()
+	o := overlayfs.NewOverlayFS(top, base)
+
+	_ = o.RemoveAll("/data/old")
+	_ = o.MkdirAll("/data/old", 0755)
+	_ = o.WriteFile("/data/old/other.txt", []byte("other"), 0644)
+
+	if got := names(t, o, "/data/old"); got != "other.txt" {
+		t.Errorf("expected the recreated directory to hide the old contents but got %s", got)
+	}
+
+	if err := o.Commit(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if base.FileExists("/data/old/file.txt") || !base.FileExists("/data/old/other.txt") || !base.FileExists("/data/keep.txt") {
+		t.Errorf("expected the base layer to match the overlay after commit")
+	}
+
+	if entries, _ := top.ReadDir("/"); len(entries) != 0 || len(o.Whiteouts()) != 0 {
+		t.Errorf("expected the top layer and whiteouts to be empty after commit")
+	}
+
+	if got := names(t, o, "/data/old"); got != "other.txt" {
+		t.Errorf("expected the overlay to look the same after commit but got %s", got)
+	}
+}
+
+func TestOverlayFS_CommitWritesToTheBaseLayer(t *testing.T) {
+	base := memoryfs.NewMemoryFS()
+	_ = base.WriteFile("/removed.txt", []byte("base"), 0644)
+
+	middle := memoryfs.NewMemoryFS()
+	_ = middle.WriteFile("/config.txt", []byte("middle"), 0644)
+	_ = middle.WriteFile("/removed.txt", []byte("middle"), 0644)
+
+	top := memoryfs.NewMemoryFS()
+	o := overlayfs.NewOverlayFS(top, middle, base)
+
+	_ = o.WriteFile("/config.txt", []byte("top"), 0644)
+	_ = o.Remove("/removed.txt")
+
+	if err := o.Commit(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if data, _ := base.ReadFile("/config.txt"); string(data) != "top" {
+		t.Errorf("expected the change to be committed to the base layer but got '%s'", data)
+	}
+
+	if data, _ := o.ReadFile("/config.txt"); string(data) != "top" {
+		t.Errorf("expected the overlay to look the same after commit but got '%s'", data)
+	}
+
+	if o.FileExists("/removed.txt") || base.FileExists("/removed.txt") || middle.FileExists("/removed.txt") {
+		t.Errorf("expected the whiteout to be applied to every lower layer")
+	}
+}
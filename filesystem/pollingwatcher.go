@@ -0,0 +1,234 @@
+package filesystem
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+type pollingWatcher struct {
+	closeOnce sync.Mutex
+	closed    bool
+	done      chan struct{}
+	errors    chan error
+	events    chan Event
+	fsys      FileSystem
+	name      string
+	recursive bool
+	snapshot  map[string]fs.FileInfo
+	stopped   chan struct{}
+}
+
+/*
+NewPollingWatcher watches a file or directory by listing it over and over,
+and comparing what it finds. It works with any FileSystem. Renames are
+detected when a file disappears and another with the same size and
+modification time appears at the same time. Otherwise they are reported
+as a remove and a create.
+*/
+func NewPollingWatcher(fsys FileSystem, name string, options WatchOptions) (Watcher, error) {
+	if _, err := fsys.Stat(name); err != nil {
+		return nil, err
+	}
+
+	interval := options.PollInterval
+
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	w := &pollingWatcher{
+		done:      make(chan struct{}),
+		errors:    make(chan error, 1),
+		events:    make(chan Event, options.bufferSize()),
+		fsys:      fsys,
+		name:      name,
+		recursive: options.Recursive,
+		stopped:   make(chan struct{}),
+	}
+
+	w.snapshot, _ = w.scan()
+
+	go w.run(interval)
+
+	return NewDebouncedWatcher(w, options.Debounce), nil
+}
+
+func (w *pollingWatcher) Close() error {
+	w.closeOnce.Lock()
+	defer w.closeOnce.Unlock()
+
+	if !w.closed {
+		w.closed = true
+		close(w.done)
+		<-w.stopped
+	}
+
+	return nil
+}
+
+func (w *pollingWatcher) Errors() <-chan error {
+	return w.errors
+}
+
+func (w *pollingWatcher) Events() <-chan Event {
+	return w.events
+}
+
+func (w *pollingWatcher) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	defer func() {
+		ticker.Stop()
+		close(w.events)
+		close(w.errors)
+		close(w.stopped)
+	}()
+
+	for {
+		select {
+		case <-w.done:
+			return
+
+		case <-ticker.C:
+			snapshot, err := w.scan()
+
+			if err != nil {
+				select {
+				case w.errors <- err:
+				default:
+				}
+
+				continue
+			}
+
+			for _, event := range diffSnapshots(w.snapshot, snapshot) {
+				select {
+				case w.events <- event:
+				case <-w.done:
+					return
+				}
+			}
+
+			w.snapshot = snapshot
+		}
+	}
+}
+
+/*
+scan describes the watched path and, for directories, its contents. A
+watched path that no longer exists gives an empty snapshot.
+*/
+func (w *pollingWatcher) scan() (map[string]fs.FileInfo, error) {
+	result := map[string]fs.FileInfo{}
+	info, err := w.fsys.Stat(w.name)
+
+	if err != nil {
+		if isNotExist(err) {
+			return result, nil
+		}
+
+		return nil, err
+	}
+
+	result[w.name] = info
+
+	if !info.IsDir() {
+		return result, nil
+	}
+
+	return result, w.scanDir(w.name, result)
+}
+
+func (w *pollingWatcher) scanDir(dir string, result map[string]fs.FileInfo) error {
+	entries, err := w.fsys.ReadDir(dir)
+
+	if err != nil {
+		if isNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, entry := range entries {
+		name := filepath.Join(dir, entry.Name())
+		info, err := entry.Info()
+
+		if err != nil {
+			continue
+		}
+
+		result[name] = info
+
+		if w.recursive && entry.IsDir() {
+			if err = w.scanDir(name, result); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+diffSnapshots compares two scans and returns the events that explain the
+difference, sorted by name
+*/
+func diffSnapshots(before, after map[string]fs.FileInfo) []Event {
+	created := []string{}
+	removed := []string{}
+	result := []Event{}
+
+	for name, info := range after {
+		old, ok := before[name]
+
+		switch {
+		case !ok:
+			created = append(created, name)
+
+		case !info.IsDir() && (info.Size() != old.Size() || !info.ModTime().Equal(old.ModTime())):
+			result = append(result, Event{Name: name, Op: EventModify})
+		}
+	}
+
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	sort.Strings(created)
+	sort.Strings(removed)
+
+	for _, name := range created {
+		info := after[name]
+		op := EventCreate
+		oldName := ""
+
+		for index, candidate := range removed {
+			old := before[candidate]
+
+			if !info.IsDir() && !old.IsDir() && old.Size() == info.Size() && old.ModTime().Equal(info.ModTime()) {
+				op = EventRename
+				oldName = candidate
+				removed = append(removed[:index], removed[index+1:]...)
+				break
+			}
+		}
+
+		result = append(result, Event{Name: name, OldName: oldName, Op: op})
+	}
+
+	for _, name := range removed {
+		result = append(result, Event{Name: name, Op: EventRemove})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
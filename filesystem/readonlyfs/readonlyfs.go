@@ -0,0 +1,115 @@
+package readonlyfs
+
+import (
+	"io/fs"
+	"os"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+ReadOnlyFS wraps another file system and refuses every change to it. This
+implements FileSystem, RemoveFS, RenameFS, WalkFS, GlobFS, and SymlinkFS.
+
+Reads are passed straight through. Anything that would create, change, or
+remove a file fails with a *fs.PathError wrapping fs.ErrPermission, without
+reaching the wrapped file system.
+*/
+type ReadOnlyFS struct {
+	base filesystem.FileSystem
+}
+
+/*
+NewReadOnlyFS creates a read-only view of base
+*/
+func NewReadOnlyFS(base filesystem.FileSystem) *ReadOnlyFS {
+	return &ReadOnlyFS{base: base}
+}
+
+func (r *ReadOnlyFS) Chdir(dir string) error {
+	return r.base.Chdir(dir)
+}
+
+func (r *ReadOnlyFS) Create(name string) (filesystem.WritableFile, error) {
+	return nil, denied("open", name)
+}
+
+func (r *ReadOnlyFS) Mkdir(name string, perm fs.FileMode) error {
+	return denied("mkdir", name)
+}
+
+func (r *ReadOnlyFS) MkdirAll(path string, perm fs.FileMode) error {
+	return denied("mkdir", path)
+}
+
+func (r *ReadOnlyFS) Open(name string) (fs.File, error) {
+	return r.base.Open(name)
+}
+
+/*
+OpenFile opens a file for reading. Any flag that asks to write, create,
+truncate, or append is refused.
+*/
+func (r *ReadOnlyFS) OpenFile(name string, flag int, perm os.FileMode) (filesystem.WritableFile, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, denied("open", name)
+	}
+
+	return r.base.OpenFile(name, flag, perm)
+}
+
+func (r *ReadOnlyFS) ReadFile(name string) ([]byte, error) {
+	return r.base.ReadFile(name)
+}
+
+func (r *ReadOnlyFS) Stat(name string) (fs.FileInfo, error) {
+	return r.base.Stat(name)
+}
+
+func (r *ReadOnlyFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return denied("open", name)
+}
+
+func (r *ReadOnlyFS) ReadDir(dir string) ([]fs.DirEntry, error) {
+	return r.base.ReadDir(dir)
+}
+
+func (r *ReadOnlyFS) FileExists(file string) bool {
+	return r.base.FileExists(file)
+}
+
+func (r *ReadOnlyFS) Remove(name string) error {
+	return denied("remove", name)
+}
+
+func (r *ReadOnlyFS) RemoveAll(path string) error {
+	return denied("removeall", path)
+}
+
+func (r *ReadOnlyFS) Rename(oldPath, newPath string) error {
+	return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrPermission}
+}
+
+func (r *ReadOnlyFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return filesystem.WalkDir(r.base, root, fn)
+}
+
+func (r *ReadOnlyFS) Glob(pattern string) ([]string, error) {
+	return filesystem.Glob(r.base, pattern)
+}
+
+func (r *ReadOnlyFS) Lstat(name string) (fs.FileInfo, error) {
+	return filesystem.Lstat(r.base, name)
+}
+
+func (r *ReadOnlyFS) Readlink(name string) (string, error) {
+	return filesystem.Readlink(r.base, name)
+}
+
+func (r *ReadOnlyFS) Symlink(oldName, newName string) error {
+	return &os.LinkError{Op: "symlink", Old: oldName, New: newName, Err: fs.ErrPermission}
+}
+
+func denied(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+}
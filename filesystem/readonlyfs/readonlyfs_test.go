@@ -0,0 +1,45 @@
+package readonlyfs_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+	"github.com/app-nerds/kit/v6/filesystem/memoryfs"
+	"github.com/app-nerds/kit/v6/filesystem/readonlyfs"
+	"github.com/app-nerds/kit/v6/filesystem/sandboxfs"
+)
+
+func TestReadOnlyFS_RefusesWrites(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+	_ = mfs.MkdirAll("/site/assets", 0755)
+	_ = mfs.WriteFile("/site/assets/app.js", []byte("app"), 0644)
+
+	sandbox, _ := sandboxfs.NewSandboxFS(mfs, "/site")
+	readOnly := readonlyfs.NewReadOnlyFS(sandbox)
+
+	if data, err := readOnly.ReadFile("/assets/app.js"); err != nil || string(data) != "app" {
+		t.Errorf("expected 'app' but got '%s', %v", data, err)
+	}
+
+	writes := map[string]error{
+		"WriteFile": readOnly.WriteFile("/assets/app.js", []byte("changed"), 0644),
+		"Mkdir":     readOnly.Mkdir("/new", 0755),
+		"Remove":    filesystem.Remove(readOnly, "/assets/app.js"),
+		"Rename":    filesystem.Rename(readOnly, "/assets", "/moved"),
+	}
+
+	_, writes["OpenFile"] = readOnly.OpenFile("/assets/app.js", os.O_RDWR, 0)
+
+	for name, err := range writes {
+		if !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("expected %s to fail with fs.ErrPermission but got %v", name, err)
+		}
+	}
+
+	if data, _ := mfs.ReadFile("/site/assets/app.js"); string(data) != "app" {
+		t.Errorf("expected the file to be unchanged but got '%s'", data)
+	}
+}
@@ -0,0 +1,99 @@
+package s3fs
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+)
+
+/*
+ErrPartSizeTooSmall is returned by NewS3FS when PartSize is below MinPartSize
+*/
+var ErrPartSizeTooSmall = errors.New("part size must be at least 5 MiB")
+
+/*
+ResponseError is returned when the object store answers with an error.
+It matches fs.ErrNotExist and fs.ErrPermission with errors.Is, so the
+usual checks work on the errors returned by S3FS.
+*/
+type ResponseError struct {
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+	RequestID  string `xml:"RequestId"`
+	StatusCode int    `xml:"-"`
+}
+
+func (e *ResponseError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("object store returned status %d", e.StatusCode)
+	}
+
+	return fmt.Sprintf("object store returned status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (e *ResponseError) Is(target error) bool {
+	switch target {
+	case fs.ErrNotExist:
+		return e.StatusCode == http.StatusNotFound
+
+	case fs.ErrPermission:
+		return e.StatusCode == http.StatusForbidden
+	}
+
+	return false
+}
+
+func newResponseError(resp *http.Response) error {
+	result := &ResponseError{StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	_ = xml.Unmarshal(body, result)
+	return result
+}
+
+/*
+checkErrorBody looks for an error document in the body of a successful
+response. S3 does this for copies and completed multipart uploads,
+which can fail after the status has been sent.
+*/
+func checkErrorBody(resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Contains(body, []byte("<Error>")) {
+		return nil
+	}
+
+	result := &ResponseError{StatusCode: http.StatusInternalServerError}
+
+	if err = xml.Unmarshal(body, result); err != nil || result.Code == "" {
+		return nil
+	}
+
+	return result
+}
+
+func isNotExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+/*
+unwrapPathError returns the error inside a *fs.PathError, so it can be
+wrapped again with a different operation
+*/
+func unwrapPathError(err error) error {
+	var pathErr *fs.PathError
+
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+
+	return err
+}
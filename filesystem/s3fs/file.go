@@ -0,0 +1,246 @@
+package s3fs
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"syscall"
+)
+
+/*
+S3File is an object opened for reading. Data is fetched with ranged GET
+requests. A sequential read keeps one response open and streams from it.
+Seeking drops the response, and the next read starts a new one at the
+new offset. This implements WritableFile, but writes always fail.
+*/
+type S3File struct {
+	fs         *S3FS
+	body       io.ReadCloser
+	bodyOffset int64
+	closed     bool
+	dirEntries []fs.DirEntry
+	dirRead    bool
+	info       fs.FileInfo
+	key        string
+	name       string
+	offset     int64
+}
+
+func (f *S3File) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	f.closed = true
+	f.closeBody()
+
+	return nil
+}
+
+func (f *S3File) Name() string {
+	return f.name
+}
+
+func (f *S3File) Read(b []byte) (int, error) {
+	if err := f.check("read"); err != nil {
+		return 0, err
+	}
+
+	if f.offset >= f.info.Size() {
+		return 0, io.EOF
+	}
+
+	if f.body != nil && f.bodyOffset != f.offset {
+		f.closeBody()
+	}
+
+	if f.body == nil {
+		resp, err := f.get(f.offset, -1)
+
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+
+		f.body = resp.Body
+		f.bodyOffset = f.offset
+	}
+
+	n, err := f.body.Read(b)
+	f.offset += int64(n)
+	f.bodyOffset += int64(n)
+
+	if err == io.EOF {
+		f.closeBody()
+
+		if n > 0 {
+			err = nil
+		}
+	}
+
+	return n, err
+}
+
+/*
+ReadAt reads len(b) bytes starting at offset with a single ranged GET
+*/
+func (f *S3File) ReadAt(b []byte, offset int64) (int, error) {
+	if err := f.check("read"); err != nil {
+		return 0, err
+	}
+
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "readat", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	if offset >= f.info.Size() || len(b) == 0 {
+		if len(b) == 0 {
+			return 0, nil
+		}
+
+		return 0, io.EOF
+	}
+
+	resp, err := f.get(offset, offset+int64(len(b))-1)
+
+	if err != nil {
+		return 0, &fs.PathError{Op: "readat", Path: f.name, Err: err}
+	}
+
+	defer resp.Body.Close()
+
+	n, err := io.ReadFull(resp.Body, b)
+
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+/*
+ReadDir lists a directory opened with Open
+*/
+func (f *S3File) ReadDir(n int) ([]fs.DirEntry, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	if !f.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+	}
+
+	if !f.dirRead {
+		entries, err := f.fs.ReadDir(f.name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		f.dirEntries = entries
+		f.dirRead = true
+	}
+
+	if n <= 0 {
+		result := f.dirEntries
+		f.dirEntries = nil
+		return result, nil
+	}
+
+	if len(f.dirEntries) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(f.dirEntries) {
+		n = len(f.dirEntries)
+	}
+
+	result := f.dirEntries[:n]
+	f.dirEntries = f.dirEntries[n:]
+
+	return result, nil
+}
+
+func (f *S3File) Seek(offset int64, whence int) (int64, error) {
+	if err := f.check("seek"); err != nil {
+		return 0, err
+	}
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+
+	case io.SeekEnd:
+		offset += f.info.Size()
+
+	case io.SeekStart:
+
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *S3File) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+/*
+Sync does nothing, as there is never anything to write
+*/
+func (f *S3File) Sync() error {
+	if f.closed {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	return nil
+}
+
+func (f *S3File) Write(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+}
+
+func (f *S3File) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *S3File) check(op string) error {
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+
+	if f.info.IsDir() {
+		return &fs.PathError{Op: op, Path: f.name, Err: syscall.EISDIR}
+	}
+
+	return nil
+}
+
+/*
+get requests the bytes from start to end, inclusive. An end below zero
+means the rest of the object.
+*/
+func (f *S3File) get(start, end int64) (*http.Response, error) {
+	header := http.Header{}
+
+	if end < 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+	} else {
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	}
+
+	return f.fs.do(http.MethodGet, f.key, nil, header, nil)
+}
+
+func (f *S3File) closeBody() {
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+}
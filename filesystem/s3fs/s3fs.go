@@ -0,0 +1,754 @@
+package s3fs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+	"github.com/app-nerds/kit/v6/restclient"
+)
+
+/*
+DefaultPartSize is the size of each part of a multipart upload when
+S3FSConfig.PartSize is not set
+*/
+const DefaultPartSize = 8 * 1024 * 1024
+
+/*
+MinPartSize is the smallest PartSize allowed. S3 requires every part of
+a multipart upload except the last to be at least 5 MiB.
+*/
+const MinPartSize = 5 * 1024 * 1024
+
+/*
+S3FSConfig configures an S3FS.
+
+Endpoint is the base URL of the object store, such as
+"https://s3.us-east-1.amazonaws.com" or "http://localhost:9000". It
+defaults to the AWS endpoint for Region. Set PathStyle to address the
+bucket in the path instead of the host name, which most self hosted
+S3-compatible servers require. Prefix, when set, is prepended to every
+key, so the file system only sees part of the bucket.
+*/
+type S3FSConfig struct {
+	AccessKeyID     string
+	Bucket          string
+	Endpoint        string
+	HTTPClient      restclient.HTTPClientInterface
+	PartSize        int64
+	PathStyle       bool
+	Prefix          string
+	Region          string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+/*
+S3FS is a file system backed by an S3-compatible object store. This implements
+fs.FS, fs.ReadFileFS, fs.ReadDirFS, fs.StatFS, OpenFileFS, WriteFileFS, RemoveFS,
+RenameFS, AtomicWriteFS, and FileSystem.
+
+Paths follow the same rules as memoryfs. Each file is an object whose key is the
+cleaned path without its leading slash. Object stores have no real directories,
+so a directory exists whenever some key starts with its name followed by a
+slash. Mkdir stores an empty "name/" marker object so empty directories can
+exist too.
+
+Files are read with ranged GET requests, so seeking and ReadAt only download
+what is asked for. Files opened for writing are buffered and sent with a
+multipart upload once they grow past the part size. Writing always replaces
+the whole object, and appending is not supported.
+*/
+type S3FS struct {
+	lock      sync.RWMutex
+	bucket    string
+	client    restclient.HTTPClientInterface
+	cwd       string
+	endpoint  *url.URL
+	now       func() time.Time
+	partSize  int64
+	pathStyle bool
+	prefix    string
+	signer    *Signer
+}
+
+/*
+NewS3FS creates a file system over a bucket. ErrPartSizeTooSmall is
+returned when PartSize is below MinPartSize.
+*/
+func NewS3FS(config S3FSConfig) (*S3FS, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("a bucket name is required")
+	}
+
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+
+	endpoint, err := url.Parse(strings.TrimRight(config.Endpoint, "/"))
+
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint '%s'", config.Endpoint)
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 5 * time.Minute}
+	}
+
+	if config.PartSize <= 0 {
+		config.PartSize = DefaultPartSize
+	}
+
+	if config.PartSize < MinPartSize {
+		return nil, ErrPartSizeTooSmall
+	}
+
+	return &S3FS{
+		bucket:    config.Bucket,
+		client:    config.HTTPClient,
+		cwd:       "/",
+		endpoint:  endpoint,
+		now:       time.Now,
+		partSize:  config.PartSize,
+		pathStyle: config.PathStyle,
+		prefix:    strings.Trim(config.Prefix, "/"),
+		signer:    NewSigner(config.AccessKeyID, config.SecretAccessKey, config.SessionToken, config.Region),
+	}, nil
+}
+
+/*
+Chdir changes the working directory used to resolve relative paths
+*/
+func (s *S3FS) Chdir(dir string) error {
+	info, err := s.Stat(dir)
+
+	if err != nil {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: unwrapPathError(err)}
+	}
+
+	if !info.IsDir() {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: syscall.ENOTDIR}
+	}
+
+	p := s.abs(dir)
+
+	s.lock.Lock()
+	s.cwd = p
+	s.lock.Unlock()
+
+	return nil
+}
+
+func (s *S3FS) Create(name string) (filesystem.WritableFile, error) {
+	return s.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+/*
+Mkdir creates an empty directory marker object
+*/
+func (s *S3FS) Mkdir(name string, perm fs.FileMode) error {
+	if _, err := s.Stat(name); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+
+	return s.putDirMarker("mkdir", name)
+}
+
+/*
+MkdirAll creates a directory marker object. Parent directories need no
+markers of their own, since the new key already implies them.
+*/
+func (s *S3FS) MkdirAll(dir string, perm fs.FileMode) error {
+	info, err := s.Stat(dir)
+
+	if err == nil {
+		if !info.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+		}
+
+		return nil
+	}
+
+	return s.putDirMarker("mkdir", dir)
+}
+
+func (s *S3FS) Open(name string) (fs.File, error) {
+	return s.OpenFile(name, os.O_RDONLY, 0)
+}
+
+/*
+OpenFile opens a file for reading or writing. Opening for writing always
+starts an empty object that replaces the old one on Close, so O_APPEND
+is not supported.
+*/
+func (s *S3FS) OpenFile(name string, flag int, perm os.FileMode) (filesystem.WritableFile, error) {
+	writing := flag&(os.O_WRONLY|os.O_RDWR) != 0
+
+	if !writing {
+		info, err := s.Stat(name)
+
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: unwrapPathError(err)}
+		}
+
+		return &S3File{fs: s, name: name, key: s.key(name), info: info}, nil
+	}
+
+	if flag&os.O_APPEND != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: filesystem.ErrNotSupported}
+	}
+
+	info, err := s.Stat(name)
+
+	switch {
+	case err == nil && info.IsDir():
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+
+	case err == nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+
+	case err != nil && (flag&os.O_CREATE == 0 || !isNotExist(err)):
+		return nil, &fs.PathError{Op: "open", Path: name, Err: unwrapPathError(err)}
+	}
+
+	return &S3Writer{fs: s, name: name, key: s.key(name), modTime: s.now()}, nil
+}
+
+func (s *S3FS) ReadFile(name string) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, s.key(name), nil, nil, nil)
+
+	if err != nil {
+		if isNotExist(err) {
+			if info, statErr := s.Stat(name); statErr == nil && info.IsDir() {
+				err = syscall.EISDIR
+			}
+		}
+
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+/*
+Stat describes a file. When there is no object with the name, but there
+are objects below it, the name is reported as a directory.
+*/
+func (s *S3FS) Stat(name string) (fs.FileInfo, error) {
+	key := s.key(name)
+	base := path.Base(s.abs(name))
+
+	if key == s.prefix {
+		return dirInfo(base, time.Time{}), nil
+	}
+
+	resp, err := s.do(http.MethodHead, key, nil, nil, nil)
+
+	if err == nil {
+		resp.Body.Close()
+		return objectInfo(base, resp.Header), nil
+	}
+
+	if !isNotExist(err) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	list, err := s.list(key+"/", "", "", 1)
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	if len(list.Contents) == 0 && len(list.CommonPrefixes) == 0 {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	var modTime time.Time
+
+	if len(list.Contents) > 0 && list.Contents[0].Key == key+"/" {
+		modTime = list.Contents[0].LastModified
+	}
+
+	return dirInfo(base, modTime), nil
+}
+
+/*
+WriteFile uploads data as the named object, replacing it if it exists
+*/
+func (s *S3FS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	f, err := s.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+/*
+WriteFileAtomic writes a file. A PUT to an object store already replaces
+the object in a single step, so this is the same as WriteFile.
+*/
+func (s *S3FS) WriteFileAtomic(name string, data []byte, perm fs.FileMode) error {
+	return s.WriteFile(name, data, perm)
+}
+
+/*
+ReadDir lists the objects and common prefixes directly below a
+directory, sorted by name
+*/
+func (s *S3FS) ReadDir(dir string) ([]fs.DirEntry, error) {
+	prefix := s.dirKey(dir)
+	result := []fs.DirEntry{}
+	token := ""
+
+	for {
+		list, err := s.list(prefix, "/", token, 1000)
+
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: dir, Err: err}
+		}
+
+		for _, object := range list.Contents {
+			if object.Key == prefix {
+				continue
+			}
+
+			info := filesystem.FileInfo{
+				FileName:     strings.TrimPrefix(object.Key, prefix),
+				FileSize:     object.Size,
+				FileMode:     0644,
+				ModifiedTime: object.LastModified,
+			}
+
+			result = append(result, fs.FileInfoToDirEntry(info))
+		}
+
+		for _, common := range list.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(common.Prefix, prefix), "/")
+			result = append(result, fs.FileInfoToDirEntry(dirInfo(name, time.Time{})))
+		}
+
+		if !list.IsTruncated || list.NextContinuationToken == "" {
+			break
+		}
+
+		token = list.NextContinuationToken
+	}
+
+	if len(result) == 0 {
+		if info, err := s.Stat(dir); err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: dir, Err: unwrapPathError(err)}
+		} else if !info.IsDir() {
+			return nil, &fs.PathError{Op: "readdir", Path: dir, Err: syscall.ENOTDIR}
+		}
+	}
+
+	sortEntries(result)
+	return result, nil
+}
+
+func (s *S3FS) FileExists(file string) bool {
+	_, err := s.Stat(file)
+	return err == nil
+}
+
+/*
+Remove deletes an object, or the marker of an empty directory
+*/
+func (s *S3FS) Remove(name string) error {
+	info, err := s.Stat(name)
+
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: unwrapPathError(err)}
+	}
+
+	key := s.key(name)
+
+	if info.IsDir() {
+		if key == s.prefix {
+			return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+		}
+
+		list, err := s.list(key+"/", "", "", 2)
+
+		if err != nil {
+			return &fs.PathError{Op: "remove", Path: name, Err: err}
+		}
+
+		for _, object := range list.Contents {
+			if object.Key != key+"/" {
+				return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+			}
+		}
+
+		key += "/"
+	}
+
+	if err = s.deleteObject(key); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+
+	return nil
+}
+
+/*
+RemoveAll deletes an object and every object below it. It returns nil
+if nothing exists at the path.
+*/
+func (s *S3FS) RemoveAll(name string) error {
+	key := s.key(name)
+
+	if key == s.prefix {
+		return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrInvalid}
+	}
+
+	keys, err := s.listAll(key + "/")
+
+	if err != nil {
+		return &fs.PathError{Op: "removeall", Path: name, Err: err}
+	}
+
+	for _, k := range append(keys, key) {
+		if err = s.deleteObject(k); err != nil {
+			return &fs.PathError{Op: "removeall", Path: name, Err: err}
+		}
+	}
+
+	return nil
+}
+
+/*
+Rename copies objects to their new keys on the server, then deletes the
+originals. Renaming a directory moves every object below it. Each
+object must be 5 GiB or smaller, the limit of a server side copy.
+*/
+func (s *S3FS) Rename(oldName, newName string) error {
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: err}
+	}
+
+	info, err := s.Stat(oldName)
+
+	if err != nil {
+		return linkErr(unwrapPathError(err))
+	}
+
+	oldKey := s.key(oldName)
+	newKey := s.key(newName)
+
+	if oldKey == newKey {
+		return nil
+	}
+
+	if oldKey == s.prefix || newKey == s.prefix {
+		return linkErr(fs.ErrInvalid)
+	}
+
+	if !info.IsDir() {
+		if err = s.copyObject(oldKey, newKey); err != nil {
+			return linkErr(err)
+		}
+
+		if err = s.deleteObject(oldKey); err != nil {
+			return linkErr(err)
+		}
+
+		return nil
+	}
+
+	if strings.HasPrefix(newKey, oldKey+"/") {
+		return linkErr(fs.ErrInvalid)
+	}
+
+	keys, err := s.listAll(oldKey + "/")
+
+	if err != nil {
+		return linkErr(err)
+	}
+
+	for _, key := range keys {
+		if err = s.copyObject(key, newKey+strings.TrimPrefix(key, oldKey)); err != nil {
+			return linkErr(err)
+		}
+	}
+
+	for _, key := range keys {
+		if err = s.deleteObject(key); err != nil {
+			return linkErr(err)
+		}
+	}
+
+	return nil
+}
+
+/*
+abs converts a name to a clean, absolute, slash separated path
+*/
+func (s *S3FS) abs(name string) string {
+	name = filepath.ToSlash(name)
+
+	if !path.IsAbs(name) {
+		s.lock.RLock()
+		name = path.Join(s.cwd, name)
+		s.lock.RUnlock()
+	}
+
+	return path.Clean(name)
+}
+
+/*
+key converts a name to an object key
+*/
+func (s *S3FS) key(name string) string {
+	return strings.TrimPrefix(path.Join(s.prefix, s.abs(name)), "/")
+}
+
+/*
+dirKey converts a directory name to the prefix of the keys inside it
+*/
+func (s *S3FS) dirKey(name string) string {
+	if key := s.key(name); key != "" {
+		return key + "/"
+	}
+
+	return ""
+}
+
+func (s *S3FS) putDirMarker(op, name string) error {
+	key := s.key(name)
+
+	if key == s.prefix {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrExist}
+	}
+
+	resp, err := s.do(http.MethodPut, key+"/", nil, nil, []byte{})
+
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3FS) putObject(key string, data []byte) error {
+	sum := md5.Sum(data)
+	header := http.Header{}
+	header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+
+	resp, err := s.do(http.MethodPut, key, nil, header, data)
+
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3FS) deleteObject(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, nil, nil)
+
+	if err != nil {
+		if isNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3FS) copyObject(oldKey, newKey string) error {
+	header := http.Header{}
+	header.Set("X-Amz-Copy-Source", uriEncode("/"+s.bucket+"/"+oldKey, false))
+
+	resp, err := s.do(http.MethodPut, newKey, nil, header, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	// A copy can fail after the 200 status has been sent, in which case the
+	// body holds an error document
+	return checkErrorBody(resp)
+}
+
+type listBucketResult struct {
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	Contents []struct {
+		ETag         string    `xml:"ETag"`
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3FS) list(prefix, delimiter, token string, maxKeys int) (*listBucketResult, error) {
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("prefix", prefix)
+	query.Set("max-keys", strconv.Itoa(maxKeys))
+
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+
+	if token != "" {
+		query.Set("continuation-token", token)
+	}
+
+	resp, err := s.do(http.MethodGet, "", query, nil, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	result := &listBucketResult{}
+
+	if err = xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, fmt.Errorf("error decoding bucket listing: %w", err)
+	}
+
+	return result, nil
+}
+
+/*
+listAll returns every key that starts with prefix
+*/
+func (s *S3FS) listAll(prefix string) ([]string, error) {
+	keys := []string{}
+	token := ""
+
+	for {
+		list, err := s.list(prefix, "", token, 1000)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range list.Contents {
+			keys = append(keys, object.Key)
+		}
+
+		if !list.IsTruncated || list.NextContinuationToken == "" {
+			return keys, nil
+		}
+
+		token = list.NextContinuationToken
+	}
+}
+
+/*
+do sends a signed request for an object key, or for the bucket itself
+when key is empty. Responses with an error status are turned into a
+*ResponseError, and the body is closed.
+*/
+func (s *S3FS) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	objectPath := "/" + key
+
+	if s.pathStyle {
+		objectPath = path.Join("/"+s.bucket, key)
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+
+	u.Path = strings.TrimRight(u.Path, "/") + objectPath
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = ""
+
+	if query != nil {
+		u.RawQuery = query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	s.signer.Sign(req, hashHex(body), s.now())
+
+	resp, err := s.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, newResponseError(resp)
+	}
+
+	return resp, nil
+}
+
+func objectInfo(name string, header http.Header) fs.FileInfo {
+	size, _ := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	modTime, _ := http.ParseTime(header.Get("Last-Modified"))
+
+	return filesystem.FileInfo{
+		FileName:     name,
+		FileSize:     size,
+		FileMode:     0644,
+		ModifiedTime: modTime,
+	}
+}
+
+func dirInfo(name string, modTime time.Time) fs.FileInfo {
+	return filesystem.FileInfo{
+		FileName:     name,
+		FileMode:     fs.ModeDir | 0755,
+		ModifiedTime: modTime,
+		IsDirectory:  true,
+	}
+}
+
+func sortEntries(entries []fs.DirEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+}
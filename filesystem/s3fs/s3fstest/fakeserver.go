@@ -0,0 +1,447 @@
+package s3fstest
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/app-nerds/kit/v6/filesystem/s3fs"
+)
+
+/*
+FakeServerConfig configures a FakeServer. When AccessKeyID is set, every
+request must carry a valid signature for these credentials.
+*/
+type FakeServerConfig struct {
+	AccessKeyID     string
+	Region          string
+	SecretAccessKey string
+}
+
+/*
+FakeServer is an in-memory stand-in for an S3-compatible server, for use
+in tests. It understands path style requests for getting, putting,
+copying and deleting objects, ranged reads, ListObjectsV2 and multipart
+uploads. Buckets are created on first use.
+*/
+type FakeServer struct {
+	*httptest.Server
+
+	config   FakeServerConfig
+	lock     sync.Mutex
+	objects  map[string]fakeObject
+	uploadID int
+	uploads  map[string]map[int][]byte
+}
+
+type fakeObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+/*
+NewFakeServer starts a fake S3 server. Call Close when done.
+*/
+func NewFakeServer(config FakeServerConfig) *FakeServer {
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	f := &FakeServer{
+		config:  config,
+		objects: map[string]fakeObject{},
+		uploads: map[string]map[int][]byte{},
+	}
+
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	return f
+}
+
+/*
+Config returns an S3FSConfig that talks to this server
+*/
+func (f *FakeServer) Config(bucket string) s3fs.S3FSConfig {
+	return s3fs.S3FSConfig{
+		AccessKeyID:     f.config.AccessKeyID,
+		Bucket:          bucket,
+		Endpoint:        f.URL,
+		HTTPClient:      f.Client(),
+		PathStyle:       true,
+		Region:          f.config.Region,
+		SecretAccessKey: f.config.SecretAccessKey,
+	}
+}
+
+/*
+Object returns the contents of an object, and whether it exists
+*/
+func (f *FakeServer) Object(bucket, key string) ([]byte, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	object, ok := f.objects[bucket+"/"+key]
+	return object.data, ok
+}
+
+/*
+Keys returns the sorted keys of every object in a bucket
+*/
+func (f *FakeServer) Keys(bucket string) []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.keys(bucket + "/")
+}
+
+func (f *FakeServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	if err := f.verify(r, body); err != "" {
+		writeFakeError(w, http.StatusForbidden, "SignatureDoesNotMatch", err)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	if bucket == "" {
+		writeFakeError(w, http.StatusBadRequest, "InvalidBucketName", "a bucket is required")
+		return
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	id := bucket + "/" + key
+	query := r.URL.Query()
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, bucket, query)
+
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.uploadID++
+		uploadID := strconv.Itoa(f.uploadID)
+		f.uploads[uploadID] = map[int][]byte{}
+		writeFakeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			UploadID string   `xml:"UploadId"`
+		}{UploadID: uploadID})
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		f.completeUpload(w, id, query.Get("uploadId"), body)
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+
+		if !ok {
+			writeFakeError(w, http.StatusNotFound, "NoSuchUpload", "upload not found")
+			return
+		}
+
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[number] = body
+		w.Header().Set("ETag", fakeETag(body))
+
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		source, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		object, ok := f.objects[strings.TrimPrefix(source, "/")]
+
+		if !ok {
+			writeFakeError(w, http.StatusNotFound, "NoSuchKey", "copy source not found")
+			return
+		}
+
+		f.objects[id] = fakeObject{data: object.data, modTime: time.Now().UTC()}
+		writeFakeXML(w, struct {
+			XMLName xml.Name `xml:"CopyObjectResult"`
+			ETag    string   `xml:"ETag"`
+		}{ETag: fakeETag(object.data)})
+
+	case r.Method == http.MethodPut:
+		f.objects[id] = fakeObject{data: body, modTime: time.Now().UTC()}
+		w.Header().Set("ETag", fakeETag(body))
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodDelete:
+		delete(f.objects, id)
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		f.get(w, r, id)
+
+	default:
+		writeFakeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "unsupported request")
+	}
+}
+
+func (f *FakeServer) get(w http.ResponseWriter, r *http.Request, id string) {
+	object, ok := f.objects[id]
+
+	if !ok {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		writeFakeError(w, http.StatusNotFound, "NoSuchKey", "the specified key does not exist")
+		return
+	}
+
+	size := int64(len(object.data))
+	start, end := int64(0), size-1
+	status := http.StatusOK
+
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		first, last, _ := strings.Cut(strings.TrimPrefix(rangeHeader, "bytes="), "-")
+		start, _ = strconv.ParseInt(first, 10, 64)
+
+		if last != "" {
+			end, _ = strconv.ParseInt(last, 10, 64)
+		}
+
+		if start >= size {
+			writeFakeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "the requested range is not satisfiable")
+			return
+		}
+
+		if end >= size {
+			end = size - 1
+		}
+
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.Header().Set("ETag", fakeETag(object.data))
+	w.Header().Set("Last-Modified", object.modTime.Format(http.TimeFormat))
+	w.WriteHeader(status)
+
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(object.data[start : end+1])
+	}
+}
+
+func (f *FakeServer) list(w http.ResponseWriter, bucket string, query url.Values) {
+	type content struct {
+		ETag         string    `xml:"ETag"`
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         int64     `xml:"Size"`
+	}
+
+	type commonPrefix struct {
+		Prefix string `xml:"Prefix"`
+	}
+
+	result := struct {
+		XMLName               xml.Name       `xml:"ListBucketResult"`
+		CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+		Contents              []content      `xml:"Contents"`
+		IsTruncated           bool           `xml:"IsTruncated"`
+		KeyCount              int            `xml:"KeyCount"`
+		Name                  string         `xml:"Name"`
+		NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+		Prefix                string         `xml:"Prefix"`
+	}{Name: bucket, Prefix: query.Get("prefix")}
+
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	after := query.Get("continuation-token")
+	maxKeys, err := strconv.Atoi(query.Get("max-keys"))
+
+	if err != nil || maxKeys <= 0 {
+		maxKeys = 1000
+	}
+
+	seen := map[string]bool{}
+
+	for _, key := range f.keys(bucket + "/" + prefix) {
+		key = strings.TrimPrefix(key, bucket+"/")
+
+		if key <= after {
+			continue
+		}
+
+		if delimiter != "" {
+			if index := strings.Index(key[len(prefix):], delimiter); index >= 0 {
+				common := key[:len(prefix)+index+len(delimiter)]
+
+				if !seen[common] {
+					if result.KeyCount == maxKeys {
+						result.IsTruncated = true
+						break
+					}
+
+					seen[common] = true
+					result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: common})
+					result.KeyCount++
+					result.NextContinuationToken = common + "\xff"
+				}
+
+				continue
+			}
+		}
+
+		if result.KeyCount == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+
+		object := f.objects[bucket+"/"+key]
+		result.Contents = append(result.Contents, content{
+			ETag:         fakeETag(object.data),
+			Key:          key,
+			LastModified: object.modTime,
+			Size:         int64(len(object.data)),
+		})
+		result.KeyCount++
+		result.NextContinuationToken = key
+	}
+
+	if !result.IsTruncated {
+		result.NextContinuationToken = ""
+	}
+
+	writeFakeXML(w, result)
+}
+
+func (f *FakeServer) completeUpload(w http.ResponseWriter, id, uploadID string, body []byte) {
+	parts, ok := f.uploads[uploadID]
+
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "NoSuchUpload", "upload not found")
+		return
+	}
+
+	request := struct {
+		Parts []struct {
+			ETag       string `xml:"ETag"`
+			PartNumber int    `xml:"PartNumber"`
+		} `xml:"Part"`
+	}{}
+
+	if err := xml.Unmarshal(body, &request); err != nil {
+		writeFakeError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+
+	data := []byte{}
+
+	for index, part := range request.Parts {
+		partData, ok := parts[part.PartNumber]
+
+		if !ok || part.PartNumber != index+1 || part.ETag != fakeETag(partData) {
+			writeFakeError(w, http.StatusBadRequest, "InvalidPart", "a part is missing or out of order")
+			return
+		}
+
+		if index < len(request.Parts)-1 && len(partData) < s3fs.MinPartSize {
+			writeFakeError(w, http.StatusBadRequest, "EntityTooSmall", "every part but the last must be at least 5 MiB")
+			return
+		}
+
+		data = append(data, partData...)
+	}
+
+	delete(f.uploads, uploadID)
+	f.objects[id] = fakeObject{data: data, modTime: time.Now().UTC()}
+
+	writeFakeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		ETag    string   `xml:"ETag"`
+	}{ETag: fakeETag(data)})
+}
+
+/*
+verify checks the request signature, returning a message describing the
+problem, or an empty string when it is valid. The request is signed again
+with the server's credentials and the two signatures are compared.
+*/
+func (f *FakeServer) verify(r *http.Request, body []byte) string {
+	if f.config.AccessKeyID == "" {
+		return ""
+	}
+
+	authorization := r.Header.Get("Authorization")
+
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential="+f.config.AccessKeyID+"/") {
+		return "missing or unknown credentials"
+	}
+
+	t, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+
+	if err != nil {
+		return "invalid X-Amz-Date"
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	bodyHash := sha256.Sum256(body)
+
+	if payloadHash != s3fs.UnsignedPayload && payloadHash != hex.EncodeToString(bodyHash[:]) {
+		return "payload hash does not match the body"
+	}
+
+	expected := r.Clone(r.Context())
+	expected.Header.Del("Authorization")
+
+	s3fs.NewSigner(f.config.AccessKeyID, f.config.SecretAccessKey, r.Header.Get("X-Amz-Security-Token"), f.config.Region).Sign(expected, payloadHash, t)
+
+	if expected.Header.Get("Authorization") != authorization {
+		return "the request signature does not match"
+	}
+
+	return ""
+}
+
+/*
+keys returns the sorted ids of every object starting with prefix. The
+lock must be held.
+*/
+func (f *FakeServer) keys(prefix string) []string {
+	result := []string{}
+
+	for id := range f.objects {
+		if strings.HasPrefix(id, prefix) {
+			result = append(result, id)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+func writeFakeXML(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(value)
+}
+
+func writeFakeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: message})
+}
+
+func fakeETag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
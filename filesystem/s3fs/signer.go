@@ -0,0 +1,204 @@
+package s3fs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+	shortDateFormat  = "20060102"
+
+	/*
+	   UnsignedPayload can be passed to Sign in place of a payload hash when
+	   the body should not be covered by the signature
+	*/
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+/*
+Signer signs HTTP requests using AWS Signature Version 4, which is
+understood by S3 and every S3-compatible object store
+*/
+type Signer struct {
+	AccessKeyID     string
+	Region          string
+	SecretAccessKey string
+	Service         string
+	SessionToken    string
+}
+
+/*
+NewSigner creates a Signer for the S3 service. sessionToken may be
+empty when using long lived credentials.
+*/
+func NewSigner(accessKeyID, secretAccessKey, sessionToken, region string) *Signer {
+	return &Signer{
+		AccessKeyID:     accessKeyID,
+		Region:          region,
+		SecretAccessKey: secretAccessKey,
+		Service:         "s3",
+		SessionToken:    sessionToken,
+	}
+}
+
+/*
+Sign adds the X-Amz-Date, X-Amz-Content-Sha256 and Authorization headers
+to a request. payloadHash is the hex encoded SHA-256 of the body, or
+UnsignedPayload. The host header, the Content-Type, Content-MD5 and
+Range headers, and all X-Amz-* headers are signed.
+*/
+func (s *Signer) Sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+
+	req.Header.Set("X-Amz-Date", t.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	signedHeaders := []string{"host"}
+
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "content-md5" || lower == "range" {
+			signedHeaders = append(signedHeaders, lower)
+		}
+	}
+
+	sort.Strings(signedHeaders)
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signingAlgorithm,
+		s.AccessKeyID,
+		s.scope(t),
+		strings.Join(signedHeaders, ";"),
+		s.signature(req, payloadHash, signedHeaders, t),
+	))
+}
+
+func (s *Signer) scope(t time.Time) string {
+	return strings.Join([]string{t.Format(shortDateFormat), s.Region, s.Service, "aws4_request"}, "/")
+}
+
+func (s *Signer) signature(req *http.Request, payloadHash string, signedHeaders []string, t time.Time) string {
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req),
+		canonicalHeaders(req, signedHeaders),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		signingAlgorithm,
+		t.Format(amzDateFormat),
+		s.scope(t),
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), t.Format(shortDateFormat))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, s.Service)
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func canonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+
+	for key := range query {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	pairs := []string{}
+
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+func canonicalHeaders(req *http.Request, signedHeaders []string) string {
+	b := strings.Builder{}
+
+	for _, name := range signedHeaders {
+		var value string
+
+		if name == "host" {
+			value = req.Host
+
+			if value == "" {
+				value = req.URL.Host
+			}
+		} else {
+			raw := req.Header.Values(name)
+			values := make([]string, len(raw))
+
+			for index, v := range raw {
+				values[index] = strings.Join(strings.Fields(v), " ")
+			}
+
+			value = strings.Join(values, ",")
+		}
+
+		b.WriteString(name + ":" + value + "\n")
+	}
+
+	return b.String()
+}
+
+/*
+uriEncode escapes a string the way SigV4 expects. Only the unreserved
+characters are left alone. Slashes are kept when encoding a path.
+*/
+func uriEncode(s string, encodeSlash bool) string {
+	b := strings.Builder{}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9'),
+			c == '-', c == '.', c == '_', c == '~',
+			c == '/' && !encodeSlash:
+			b.WriteByte(c)
+
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,226 @@
+package s3fs
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+S3Writer is an object opened for writing. Writes are buffered in memory.
+Small files are sent with a single PUT when the writer is closed. Once
+the buffer reaches the part size a multipart upload is started, and
+each full part is uploaded as it fills. The object only becomes visible
+when Close succeeds. If anything fails, the upload is aborted.
+*/
+type S3Writer struct {
+	fs       *S3FS
+	buffer   bytes.Buffer
+	closed   bool
+	err      error
+	key      string
+	modTime  time.Time
+	name     string
+	parts    []completedPart
+	size     int64
+	uploadID string
+}
+
+type completedPart struct {
+	ETag       string `xml:"ETag"`
+	PartNumber int    `xml:"PartNumber"`
+}
+
+func (w *S3Writer) Close() error {
+	if w.closed {
+		return &fs.PathError{Op: "close", Path: w.name, Err: fs.ErrClosed}
+	}
+
+	w.closed = true
+
+	if w.err != nil {
+		return w.err
+	}
+
+	if w.uploadID == "" {
+		if err := w.fs.putObject(w.key, w.buffer.Bytes()); err != nil {
+			return &fs.PathError{Op: "close", Path: w.name, Err: err}
+		}
+
+		return nil
+	}
+
+	if w.buffer.Len() > 0 || len(w.parts) == 0 {
+		if err := w.uploadPart(); err != nil {
+			return w.fail(err)
+		}
+	}
+
+	if err := w.complete(); err != nil {
+		return w.fail(err)
+	}
+
+	return nil
+}
+
+/*
+Sync cannot make anything durable before the object is complete, so it
+only reports an earlier failure. The object is stored when Close succeeds.
+*/
+func (w *S3Writer) Sync() error {
+	if w.closed {
+		return &fs.PathError{Op: "sync", Path: w.name, Err: fs.ErrClosed}
+	}
+
+	return w.err
+}
+
+func (w *S3Writer) Name() string {
+	return w.name
+}
+
+func (w *S3Writer) Read(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: w.name, Err: filesystem.ErrNotSupported}
+}
+
+/*
+Stat describes the object as it will be once the writer is closed
+*/
+func (w *S3Writer) Stat() (fs.FileInfo, error) {
+	return filesystem.FileInfo{
+		FileName:     w.name,
+		FileSize:     w.size,
+		FileMode:     0644,
+		ModifiedTime: w.modTime,
+	}, nil
+}
+
+func (w *S3Writer) Write(b []byte) (int, error) {
+	if w.closed {
+		return 0, &fs.PathError{Op: "write", Path: w.name, Err: fs.ErrClosed}
+	}
+
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	w.buffer.Write(b)
+	w.size += int64(len(b))
+
+	for int64(w.buffer.Len()) >= w.fs.partSize {
+		if w.uploadID == "" {
+			if err := w.start(); err != nil {
+				return 0, w.fail(err)
+			}
+		}
+
+		if err := w.uploadPart(); err != nil {
+			return 0, w.fail(err)
+		}
+	}
+
+	return len(b), nil
+}
+
+func (w *S3Writer) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *S3Writer) start() error {
+	query := url.Values{}
+	query.Set("uploads", "")
+
+	resp, err := w.fs.do(http.MethodPost, w.key, query, nil, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	result := struct {
+		UploadID string `xml:"UploadId"`
+	}{}
+
+	if err = xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("error decoding multipart upload: %w", err)
+	}
+
+	w.uploadID = result.UploadID
+	return nil
+}
+
+/*
+uploadPart sends up to one part size of the buffer
+*/
+func (w *S3Writer) uploadPart() error {
+	data := w.buffer.Next(int(w.fs.partSize))
+	number := len(w.parts) + 1
+
+	query := url.Values{}
+	query.Set("partNumber", strconv.Itoa(number))
+	query.Set("uploadId", w.uploadID)
+
+	resp, err := w.fs.do(http.MethodPut, w.key, query, nil, data)
+
+	if err != nil {
+		return err
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	w.parts = append(w.parts, completedPart{ETag: resp.Header.Get("ETag"), PartNumber: number})
+	return nil
+}
+
+func (w *S3Writer) complete() error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: w.parts})
+
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("uploadId", w.uploadID)
+
+	resp, err := w.fs.do(http.MethodPost, w.key, query, nil, body)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	return checkErrorBody(resp)
+}
+
+/*
+fail aborts the multipart upload, if one was started, and remembers the
+error so later writes fail too
+*/
+func (w *S3Writer) fail(err error) error {
+	if w.uploadID != "" {
+		query := url.Values{}
+		query.Set("uploadId", w.uploadID)
+
+		if resp, abortErr := w.fs.do(http.MethodDelete, w.key, query, nil, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+
+		w.uploadID = ""
+	}
+
+	w.err = &fs.PathError{Op: "write", Path: w.name, Err: err}
+	return w.err
+}
@@ -0,0 +1,548 @@
+package sandboxfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+ErrEscapesRoot is returned when a path, or a symbolic link along it,
+points outside of the sandbox root. It matches fs.ErrPermission.
+*/
+var ErrEscapesRoot = fmt.Errorf("path escapes the sandbox root: %w", fs.ErrPermission)
+
+/*
+maxSymlinks is the number of symbolic links followed while resolving a
+path before giving up with ELOOP
+*/
+const maxSymlinks = 40
+
+/*
+SandboxFS confines another file system to a root directory, much like chroot.
+This implements FileSystem, RemoveFS, RenameFS, SymlinkFS, AtomicWriteFS,
+and LockFS.
+
+Names are resolved inside the sandbox. "/" is the root directory, and relative
+names are resolved against the sandbox working directory set with Chdir. A name
+that uses ".." to climb above the root is rejected with ErrEscapesRoot, rather
+than quietly clamped to the root.
+
+When the wrapped file system supports symbolic links, SandboxFS follows them
+itself, one path element at a time, and hands the wrapped file system a path
+with no links left in it. Links that point outside of the root are rejected
+with ErrEscapesRoot. Absolute link targets are only understood when root is
+an absolute path.
+
+Errors report the name as it was given, so the location of the root is never
+revealed. Opened files are returned as is, and their Name method reports the
+path in the wrapped file system.
+*/
+type SandboxFS struct {
+	lock sync.RWMutex
+	base filesystem.FileSystem
+	cwd  string
+	root string
+}
+
+/*
+NewSandboxFS creates a file system confined to root, which must be an
+existing directory in base
+*/
+func NewSandboxFS(base filesystem.FileSystem, root string) (*SandboxFS, error) {
+	root = filepath.Clean(root)
+	info, err := base.Stat(root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "sandbox", Path: root, Err: syscall.ENOTDIR}
+	}
+
+	return &SandboxFS{
+		base: base,
+		cwd:  "/",
+		root: root,
+	}, nil
+}
+
+/*
+Chdir changes the sandbox working directory. The wrapped file system's
+working directory is left alone.
+*/
+func (s *SandboxFS) Chdir(dir string) error {
+	virtual, err := s.virtual(dir)
+
+	if err != nil {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: err}
+	}
+
+	info, err := s.Stat(dir)
+
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: syscall.ENOTDIR}
+	}
+
+	s.lock.Lock()
+	s.cwd = virtual
+	s.lock.Unlock()
+
+	return nil
+}
+
+func (s *SandboxFS) Create(name string) (filesystem.WritableFile, error) {
+	real, err := s.resolve("open", name, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := s.base.Create(real)
+	return f, rename(err, name)
+}
+
+func (s *SandboxFS) Mkdir(name string, perm fs.FileMode) error {
+	real, err := s.resolve("mkdir", name, false)
+
+	if err != nil {
+		return err
+	}
+
+	return rename(s.base.Mkdir(real, perm), name)
+}
+
+func (s *SandboxFS) MkdirAll(dir string, perm fs.FileMode) error {
+	real, err := s.resolve("mkdir", dir, true)
+
+	if err != nil {
+		return err
+	}
+
+	return rename(s.base.MkdirAll(real, perm), dir)
+}
+
+func (s *SandboxFS) Open(name string) (fs.File, error) {
+	real, err := s.resolve("open", name, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := s.base.Open(real)
+	return f, rename(err, name)
+}
+
+func (s *SandboxFS) OpenFile(name string, flag int, perm os.FileMode) (filesystem.WritableFile, error) {
+	real, err := s.resolve("open", name, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := s.base.OpenFile(real, flag, perm)
+	return f, rename(err, name)
+}
+
+func (s *SandboxFS) ReadFile(name string) ([]byte, error) {
+	real, err := s.resolve("open", name, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.base.ReadFile(real)
+	return data, rename(err, name)
+}
+
+func (s *SandboxFS) Stat(name string) (fs.FileInfo, error) {
+	real, err := s.resolve("stat", name, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := s.base.Stat(real)
+	return info, rename(err, name)
+}
+
+func (s *SandboxFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	real, err := s.resolve("open", name, true)
+
+	if err != nil {
+		return err
+	}
+
+	return rename(s.base.WriteFile(real, data, perm), name)
+}
+
+func (s *SandboxFS) WriteFileAtomic(name string, data []byte, perm fs.FileMode) error {
+	real, err := s.resolve("open", name, true)
+
+	if err != nil {
+		return err
+	}
+
+	return rename(filesystem.WriteFileAtomic(s.base, real, data, perm), name)
+}
+
+func (s *SandboxFS) Lock(name string, options filesystem.LockOptions) (filesystem.FileLock, error) {
+	real, err := s.resolve("lock", name, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := filesystem.Lock(s.base, real, options)
+	return l, rename(err, name)
+}
+
+func (s *SandboxFS) ReadDir(dir string) ([]fs.DirEntry, error) {
+	real, err := s.resolve("open", dir, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.base.ReadDir(real)
+	return entries, rename(err, dir)
+}
+
+func (s *SandboxFS) FileExists(file string) bool {
+	_, err := s.Stat(file)
+	return err == nil
+}
+
+func (s *SandboxFS) Remove(name string) error {
+	real, err := s.resolveForChange("remove", name)
+
+	if err != nil {
+		return err
+	}
+
+	return rename(filesystem.Remove(s.base, real), name)
+}
+
+func (s *SandboxFS) RemoveAll(name string) error {
+	real, err := s.resolveForChange("removeall", name)
+
+	if err != nil {
+		return err
+	}
+
+	return rename(filesystem.RemoveAll(s.base, real), name)
+}
+
+func (s *SandboxFS) Rename(oldName, newName string) error {
+	oldReal, err := s.resolveForChange("rename", oldName)
+
+	if err != nil {
+		return err
+	}
+
+	newReal, err := s.resolveForChange("rename", newName)
+
+	if err != nil {
+		return err
+	}
+
+	if err = filesystem.Rename(s.base, oldReal, newReal); err != nil {
+		var linkErr *os.LinkError
+
+		if errors.As(err, &linkErr) {
+			return &os.LinkError{Op: linkErr.Op, Old: oldName, New: newName, Err: linkErr.Err}
+		}
+
+		return rename(err, oldName)
+	}
+
+	return nil
+}
+
+func (s *SandboxFS) Lstat(name string) (fs.FileInfo, error) {
+	real, err := s.resolve("lstat", name, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := filesystem.Lstat(s.base, real)
+	return info, rename(err, name)
+}
+
+/*
+Readlink returns the target of a symbolic link. Absolute targets are
+reported relative to the sandbox root.
+*/
+func (s *SandboxFS) Readlink(name string) (string, error) {
+	real, err := s.resolve("readlink", name, false)
+
+	if err != nil {
+		return "", err
+	}
+
+	target, err := filesystem.Readlink(s.base, real)
+
+	if err != nil {
+		return "", rename(err, name)
+	}
+
+	if filepath.IsAbs(target) {
+		virtual, ok := s.inside(target)
+
+		if !ok {
+			return "", &fs.PathError{Op: "readlink", Path: name, Err: ErrEscapesRoot}
+		}
+
+		return virtual, nil
+	}
+
+	return target, nil
+}
+
+/*
+Symlink creates newName as a link to oldName. The target must stay
+inside the sandbox. Absolute targets are relative to the sandbox root.
+*/
+func (s *SandboxFS) Symlink(oldName, newName string) error {
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "symlink", Old: oldName, New: newName, Err: err}
+	}
+
+	virtualLink, err := s.virtual(newName)
+
+	if err != nil {
+		return linkErr(err)
+	}
+
+	target := filepath.ToSlash(oldName)
+
+	if escapes(path.Dir(virtualLink), target) {
+		return linkErr(ErrEscapesRoot)
+	}
+
+	real, err := s.resolve("symlink", newName, false)
+
+	if err != nil {
+		return linkErr(unwrap(err))
+	}
+
+	stored := oldName
+
+	if path.IsAbs(target) {
+		stored = s.real(target)
+	}
+
+	if err = filesystem.Symlink(s.base, stored, real); err != nil {
+		return linkErr(unwrap(err))
+	}
+
+	return nil
+}
+
+/*
+resolveForChange resolves a name that is about to be removed or
+renamed. The final element is not followed, and the root itself is off
+limits.
+*/
+func (s *SandboxFS) resolveForChange(op, name string) (string, error) {
+	virtual, err := s.virtual(name)
+
+	if err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	if virtual == "/" {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	return s.resolve(op, name, false)
+}
+
+/*
+resolve turns a name into a path in the wrapped file system, following
+symbolic links along the way. When followLast is false, a link at the
+end of the path is left alone.
+*/
+func (s *SandboxFS) resolve(op, name string, followLast bool) (string, error) {
+	virtual, err := s.virtual(name)
+
+	if err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	if _, ok := s.base.(filesystem.SymlinkFS); !ok {
+		return s.real(virtual), nil
+	}
+
+	parts := splitPath(virtual)
+	current := "/"
+	links := 0
+
+	for i := 0; i < len(parts); i++ {
+		candidate := path.Join(current, parts[i])
+		info, err := filesystem.Lstat(s.base, s.real(candidate))
+
+		if err != nil || info.Mode()&fs.ModeSymlink == 0 || (!followLast && i == len(parts)-1) {
+			current = candidate
+			continue
+		}
+
+		if links++; links > maxSymlinks {
+			return "", &fs.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+		}
+
+		target, err := filesystem.Readlink(s.base, s.real(candidate))
+
+		if err != nil {
+			return "", rename(err, name)
+		}
+
+		if filepath.IsAbs(target) {
+			inside, ok := s.inside(target)
+
+			if !ok {
+				return "", &fs.PathError{Op: op, Path: name, Err: ErrEscapesRoot}
+			}
+
+			target = inside
+		} else if escapes(current, filepath.ToSlash(target)) {
+			return "", &fs.PathError{Op: op, Path: name, Err: ErrEscapesRoot}
+		} else {
+			target = path.Join(current, filepath.ToSlash(target))
+		}
+
+		parts = append(splitPath(target), parts[i+1:]...)
+		current = "/"
+		i = -1
+	}
+
+	return s.real(current), nil
+}
+
+/*
+virtual converts a name to a clean, absolute path inside the sandbox,
+failing with ErrEscapesRoot if ".." climbs above the root
+*/
+func (s *SandboxFS) virtual(name string) (string, error) {
+	name = filepath.ToSlash(name)
+
+	if path.IsAbs(name) {
+		if escapes("/", name) {
+			return "", ErrEscapesRoot
+		}
+
+		return path.Clean(name), nil
+	}
+
+	s.lock.RLock()
+	cwd := s.cwd
+	s.lock.RUnlock()
+
+	if escapes(cwd, name) {
+		return "", ErrEscapesRoot
+	}
+
+	return path.Join(cwd, name), nil
+}
+
+/*
+real converts an absolute sandbox path to a path in the wrapped file
+system
+*/
+func (s *SandboxFS) real(virtual string) string {
+	return filepath.Join(s.root, filepath.FromSlash(virtual))
+}
+
+/*
+inside converts an absolute path in the wrapped file system to a
+sandbox path, reporting false when it lies outside of the root
+*/
+func (s *SandboxFS) inside(real string) (string, bool) {
+	if !filepath.IsAbs(s.root) {
+		return "", false
+	}
+
+	rel, err := filepath.Rel(s.root, filepath.Clean(real))
+
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return path.Join("/", filepath.ToSlash(rel)), true
+}
+
+/*
+escapes reports whether name, resolved against the absolute directory
+dir, climbs above "/"
+*/
+func escapes(dir, name string) bool {
+	depth := len(splitPath(dir))
+
+	if path.IsAbs(name) {
+		depth = 0
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		switch part {
+		case "", ".":
+
+		case "..":
+			if depth--; depth < 0 {
+				return true
+			}
+
+		default:
+			depth++
+		}
+	}
+
+	return false
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(path.Clean(p), "/")
+
+	if p == "" {
+		return []string{}
+	}
+
+	return strings.Split(p, "/")
+}
+
+/*
+rename replaces the path in an error from the wrapped file system with
+the name the caller used
+*/
+func rename(err error, name string) error {
+	var pathErr *fs.PathError
+
+	if errors.As(err, &pathErr) {
+		return &fs.PathError{Op: pathErr.Op, Path: name, Err: pathErr.Err}
+	}
+
+	return err
+}
+
+func unwrap(err error) error {
+	var pathErr *fs.PathError
+
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+
+	return err
+}
@@ -0,0 +1,114 @@
+package sandboxfs_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+	"github.com/app-nerds/kit/v6/filesystem/localfs"
+	"github.com/app-nerds/kit/v6/filesystem/memoryfs"
+	"github.com/app-nerds/kit/v6/filesystem/sandboxfs"
+)
+
+func TestSandboxFS_ConfinesMemoryFS(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+
+	_ = mfs.MkdirAll("/srv/uploads/images", 0755)
+	_ = mfs.WriteFile("/srv/secret.txt", []byte("secret"), 0644)
+	_ = mfs.WriteFile("/srv/uploads/images/cat.png", []byte("cat"), 0644)
+
+	sandbox, err := sandboxfs.NewSandboxFS(mfs, "/srv/uploads")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if data, err := sandbox.ReadFile("/images/cat.png"); err != nil || string(data) != "cat" {
+		t.Errorf("expected 'cat' but got '%s', %v", data, err)
+	}
+
+	_ = sandbox.Chdir("images")
+
+	if data, err := sandbox.ReadFile("../images/./cat.png"); err != nil || string(data) != "cat" {
+		t.Errorf("expected '..' inside the sandbox to work but got '%s', %v", data, err)
+	}
+
+	for _, name := range []string{"../../secret.txt", "/../secret.txt", "../../../srv/secret.txt"} {
+		if _, err = sandbox.ReadFile(name); !errors.Is(err, sandboxfs.ErrEscapesRoot) || !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("expected ErrEscapesRoot for %s but got %v", name, err)
+		}
+	}
+
+	_ = mfs.Symlink("/srv/secret.txt", "/srv/uploads/absolute")
+	_ = mfs.Symlink("../secret.txt", "/srv/uploads/relative")
+	_ = mfs.Symlink("/srv/uploads/images", "/srv/uploads/pictures")
+
+	for _, name := range []string{"/absolute", "/relative"} {
+		if _, err = sandbox.ReadFile(name); !errors.Is(err, sandboxfs.ErrEscapesRoot) {
+			t.Errorf("expected ErrEscapesRoot following %s but got %v", name, err)
+		}
+
+		if err = sandbox.WriteFile(name, []byte("overwrite"), 0644); !errors.Is(err, sandboxfs.ErrEscapesRoot) {
+			t.Errorf("expected ErrEscapesRoot writing through %s but got %v", name, err)
+		}
+	}
+
+	if data, _ := mfs.ReadFile("/srv/secret.txt"); string(data) != "secret" {
+		t.Errorf("expected the file outside the sandbox to be untouched but got '%s'", data)
+	}
+
+	if data, err := sandbox.ReadFile("/pictures/cat.png"); err != nil || string(data) != "cat" {
+		t.Errorf("expected a link inside the sandbox to work but got '%s', %v", data, err)
+	}
+
+	if target, _ := sandbox.Readlink("/pictures"); target != "/images" {
+		t.Errorf("expected link target '/images' but got '%s'", target)
+	}
+
+	if err = sandbox.Symlink("../../secret.txt", "/images/escape"); !errors.Is(err, sandboxfs.ErrEscapesRoot) {
+		t.Errorf("expected ErrEscapesRoot creating an escaping link but got %v", err)
+	}
+
+	if err = sandbox.Remove("/absolute"); err != nil || !mfs.FileExists("/srv/secret.txt") {
+		t.Errorf("expected removing a link to leave its target alone but got %v", err)
+	}
+}
+
+func TestSandboxFS_ConfinesLocalFS(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+
+	_ = os.Mkdir(root, 0755)
+	_ = os.WriteFile(filepath.Join(dir, "outside.txt"), []byte("outside"), 0644)
+
+	if err := os.Symlink(filepath.Join(dir, "outside.txt"), filepath.Join(root, "link")); err != nil {
+		t.Skipf("symbolic links are not available: %s", err)
+	}
+
+	sandbox, err := sandboxfs.NewSandboxFS(localfs.NewLocalFS(), root)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err = sandbox.ReadFile("/link"); !errors.Is(err, sandboxfs.ErrEscapesRoot) {
+		t.Errorf("expected ErrEscapesRoot but got %v", err)
+	}
+
+	if err = sandbox.WriteFile("/inside.txt", []byte("inside"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(root, "inside.txt")); string(data) != "inside" {
+		t.Errorf("expected the file to be written inside the root but got '%s'", data)
+	}
+
+	matches, _ := filesystem.Glob(sandbox, "/*.txt")
+
+	if len(matches) != 1 || matches[0] != "/inside.txt" {
+		t.Errorf("expected [/inside.txt] but got %v", matches)
+	}
+}
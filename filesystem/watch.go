@@ -0,0 +1,117 @@
+package filesystem
+
+import (
+	"strings"
+	"time"
+)
+
+/*
+DefaultWatchBufferSize is the size of a watcher's events channel when
+WatchOptions.BufferSize is not set
+*/
+const DefaultWatchBufferSize = 100
+
+/*
+EventOp describes what happened to a file. Debounced events may carry
+several operations at once.
+*/
+type EventOp uint32
+
+const (
+	EventCreate EventOp = 1 << iota
+	EventModify
+	EventRemove
+	EventRename
+)
+
+/*
+Has reports whether op includes all of the operations in other
+*/
+func (op EventOp) Has(other EventOp) bool {
+	return op&other == other
+}
+
+func (op EventOp) String() string {
+	names := []string{}
+
+	for _, item := range []struct {
+		op   EventOp
+		name string
+	}{
+		{op: EventCreate, name: "CREATE"},
+		{op: EventModify, name: "MODIFY"},
+		{op: EventRemove, name: "REMOVE"},
+		{op: EventRename, name: "RENAME"},
+	} {
+		if op.Has(item.op) {
+			names = append(names, item.name)
+		}
+	}
+
+	return strings.Join(names, "|")
+}
+
+/*
+Event is a change to a file or directory. For renames, Name is the new
+path and OldName is the old one.
+*/
+type Event struct {
+	Name    string
+	OldName string
+	Op      EventOp
+}
+
+/*
+WatchOptions configures a watch.
+
+When Debounce is set, events for the same path are held until the path
+has been quiet for that long, then delivered as one event with all of
+their operations combined. Recursive watches a directory and everything
+below it, rather than just its direct children. BufferSize is the size
+of the events channel, and defaults to DefaultWatchBufferSize. PollInterval is how often a
+polling watcher looks for changes, and defaults to one second.
+*/
+type WatchOptions struct {
+	BufferSize   int
+	Debounce     time.Duration
+	PollInterval time.Duration
+	Recursive    bool
+}
+
+/*
+Watcher delivers change events until it is closed. Events and Errors
+are closed when the watcher is.
+*/
+type Watcher interface {
+	Close() error
+	Errors() <-chan error
+	Events() <-chan Event
+}
+
+/*
+WatchFS describes a file system that can report changes to files and
+directories
+*/
+type WatchFS interface {
+	Watch(name string, options WatchOptions) (Watcher, error)
+}
+
+/*
+Watch watches a file or directory for changes. File systems that don't
+implement WatchFS are polled.
+*/
+func Watch(fsys FileSystem, name string, options WatchOptions) (Watcher, error) {
+	if watcher, ok := fsys.(WatchFS); ok {
+		return watcher.Watch(name, options)
+	}
+
+	return NewPollingWatcher(fsys, name, options)
+}
+
+func (options WatchOptions) bufferSize() int {
+	if options.BufferSize <= 0 {
+		return DefaultWatchBufferSize
+	}
+
+	return options.BufferSize
+}
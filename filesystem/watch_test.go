@@ -0,0 +1,34 @@
+package filesystem_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+	"github.com/app-nerds/kit/v6/filesystem/memoryfs"
+)
+
+func TestWatch_PollsWithoutCapability(t *testing.T) {
+	mfs := memoryfs.NewMemoryFS()
+	_ = mfs.MkdirAll("/drop", 0755)
+
+	w, err := filesystem.Watch(basicFS{mfs}, "/drop", filesystem.WatchOptions{PollInterval: 5 * time.Millisecond})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	defer w.Close()
+
+	_ = mfs.WriteFile("/drop/new.txt", []byte("new"), 0644)
+
+	select {
+	case event := <-w.Events():
+		if event.Name != "/drop/new.txt" || event.Op != filesystem.EventCreate {
+			t.Errorf("expected CREATE /drop/new.txt but got %s %s", event.Op, event.Name)
+		}
+
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for an event")
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+)
+
+/*
+composeFrames draws every frame of an animated GIF in full. A GIF frame
+may only cover part of the canvas, and relies on the frames before it
+for the rest, so this plays the animation through, honoring each frame's
+disposal method.
+*/
+func composeFrames(animation *gif.GIF) []image.Image {
+	bounds := image.Rect(0, 0, animation.Config.Width, animation.Config.Height)
+
+	if bounds.Empty() {
+		bounds = animation.Image[0].Bounds()
+	}
+
+	canvas := image.NewRGBA(bounds)
+	result := make([]image.Image, 0, len(animation.Image))
+
+	for i, frame := range animation.Image {
+		var previous *image.RGBA
+		disposal := byte(gif.DisposalNone)
+
+		if i < len(animation.Disposal) {
+			disposal = animation.Disposal[i]
+		}
+
+		if disposal == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		result = append(result, cloneRGBA(canvas))
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return result
+}
+
+/*
+encodeFrames turns transformed frames back into a GIF with the timing
+and looping of the original. Every frame is a full image, so none needs
+disposing. Frames are reduced to the original's palette.
+*/
+func encodeFrames(animation *gif.GIF, frames []image.Image) *gif.GIF {
+	palette := animationPalette(animation)
+	bounds := frames[0].Bounds()
+
+	result := &gif.GIF{
+		Config: image.Config{
+			ColorModel: palette,
+			Height:     bounds.Dy(),
+			Width:      bounds.Dx(),
+		},
+		Delay:     animation.Delay,
+		Image:     make([]*image.Paletted, len(frames)),
+		LoopCount: animation.LoopCount,
+	}
+
+	for i, frame := range frames {
+		paletted := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), palette)
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), frame, frame.Bounds().Min)
+		result.Image[i] = paletted
+	}
+
+	return result
+}
+
+/*
+animationPalette returns the global palette of an animation, or the
+first frame's palette when there isn't one. A transparent entry is added
+when there is room, so transparent areas stay transparent.
+*/
+func animationPalette(animation *gif.GIF) color.Palette {
+	palette, ok := animation.Config.ColorModel.(color.Palette)
+
+	if !ok || len(palette) == 0 {
+		palette = animation.Image[0].Palette
+	}
+
+	palette = append(color.Palette{}, palette...)
+
+	for _, c := range palette {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return palette
+		}
+	}
+
+	if len(palette) < 256 {
+		palette = append(palette, color.RGBA{})
+	}
+
+	return palette
+}
+
+func cloneRGBA(source *image.RGBA) *image.RGBA {
+	result := image.NewRGBA(source.Bounds())
+	copy(result.Pix, source.Pix)
+	return result
+}
@@ -0,0 +1,264 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"github.com/nfnt/resize"
+)
+
+const base83Characters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+/*
+placeholderSourceSize is the size images are shrunk to before a
+placeholder is made from them. Placeholders only keep the broadest
+shapes, so nothing is lost, and it keeps the work small for any image.
+*/
+const placeholderSourceSize = 64
+
+/*
+EncodeBlurHash returns a BlurHash of img, a short string that a front end
+turns into a blurred placeholder while the real image loads. xComponents
+and yComponents, from 1 to 9, are how much detail is kept across and
+down. 4 and 3 suit most landscape images.
+*/
+func EncodeBlurHash(img image.Image, xComponents, yComponents int) (string, error) {
+	if xComponents < 1 || xComponents > 9 || yComponents < 1 || yComponents > 9 {
+		return "", fmt.Errorf("%w: components must be from 1 to 9", ErrInvalidBlurHash)
+	}
+
+	small := toNRGBA(shrink(img, placeholderSourceSize))
+	width, height := small.Bounds().Dx(), small.Bounds().Dy()
+	factors := make([][3]float64, 0, xComponents*yComponents)
+
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			var factor [3]float64
+
+			normalization := 2.0
+
+			if i == 0 && j == 0 {
+				normalization = 1
+			}
+
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := normalization *
+						math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+
+					p := small.PixOffset(x, y)
+
+					for c := 0; c < 3; c++ {
+						factor[c] += basis * srgbToLinear(small.Pix[p+c])
+					}
+				}
+			}
+
+			for c := 0; c < 3; c++ {
+				factor[c] /= float64(width * height)
+			}
+
+			factors = append(factors, factor)
+		}
+	}
+
+	var result strings.Builder
+
+	result.WriteString(encode83((xComponents-1)+(yComponents-1)*9, 1))
+
+	maximum := 1.0
+
+	if len(factors) > 1 {
+		actualMaximum := 0.0
+
+		for _, factor := range factors[1:] {
+			for c := 0; c < 3; c++ {
+				actualMaximum = math.Max(actualMaximum, math.Abs(factor[c]))
+			}
+		}
+
+		quantised := int(math.Max(0, math.Min(82, math.Floor(actualMaximum*166-0.5))))
+		maximum = float64(quantised+1) / 166
+		result.WriteString(encode83(quantised, 1))
+	} else {
+		result.WriteString(encode83(0, 1))
+	}
+
+	dc := factors[0]
+	result.WriteString(encode83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+
+	for _, factor := range factors[1:] {
+		value := 0
+
+		for c := 0; c < 3; c++ {
+			quantised := int(math.Max(0, math.Min(18, math.Floor(signPow(factor[c]/maximum, 0.5)*9+9.5))))
+			value = value*19 + quantised
+		}
+
+		result.WriteString(encode83(value, 2))
+	}
+
+	return result.String(), nil
+}
+
+/*
+DecodeBlurHash draws a BlurHash as a width by height image. punch makes
+the colors stronger or weaker. 1 is normal.
+*/
+func DecodeBlurHash(hash string, width, height int, punch float64) (image.Image, error) {
+	if len(hash) < 6 || width <= 0 || height <= 0 {
+		return nil, ErrInvalidBlurHash
+	}
+
+	sizeFlag, err := decode83(hash[:1])
+
+	if err != nil {
+		return nil, err
+	}
+
+	xComponents, yComponents := sizeFlag%9+1, sizeFlag/9+1
+
+	if len(hash) != 4+2*xComponents*yComponents {
+		return nil, fmt.Errorf("%w: expected %d characters but got %d", ErrInvalidBlurHash, 4+2*xComponents*yComponents, len(hash))
+	}
+
+	quantisedMaximum, err := decode83(hash[1:2])
+
+	if err != nil {
+		return nil, err
+	}
+
+	if punch <= 0 {
+		punch = 1
+	}
+
+	maximum := float64(quantisedMaximum+1) / 166
+	colors := make([][3]float64, xComponents*yComponents)
+
+	dc, err := decode83(hash[2:6])
+
+	if err != nil {
+		return nil, err
+	}
+
+	colors[0] = [3]float64{srgbToLinear(uint8(dc >> 16)), srgbToLinear(uint8(dc >> 8)), srgbToLinear(uint8(dc))}
+
+	for i := 1; i < len(colors); i++ {
+		value, err := decode83(hash[4+i*2 : 6+i*2])
+
+		if err != nil {
+			return nil, err
+		}
+
+		colors[i] = [3]float64{
+			signPow(float64(value/(19*19)-9)/9, 2) * maximum * punch,
+			signPow(float64(value/19%19-9)/9, 2) * maximum * punch,
+			signPow(float64(value%19-9)/9, 2) * maximum * punch,
+		}
+	}
+
+	result := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var pixel [3]float64
+
+			for j := 0; j < yComponents; j++ {
+				for i := 0; i < xComponents; i++ {
+					basis := math.Cos(math.Pi*float64(x)*float64(i)/float64(width)) *
+						math.Cos(math.Pi*float64(y)*float64(j)/float64(height))
+
+					for c := 0; c < 3; c++ {
+						pixel[c] += colors[i+j*xComponents][c] * basis
+					}
+				}
+			}
+
+			p := result.PixOffset(x, y)
+
+			for c := 0; c < 3; c++ {
+				result.Pix[p+c] = uint8(linearToSRGB(pixel[c]))
+			}
+
+			result.Pix[p+3] = 255
+		}
+	}
+
+	return result, nil
+}
+
+func encode83(value, length int) string {
+	result := make([]byte, length)
+
+	for i := length - 1; i >= 0; i-- {
+		result[i] = base83Characters[value%83]
+		value /= 83
+	}
+
+	return string(result)
+}
+
+func decode83(s string) (int, error) {
+	value := 0
+
+	for _, c := range s {
+		digit := strings.IndexRune(base83Characters, c)
+
+		if digit < 0 {
+			return 0, fmt.Errorf("%w: bad character %q", ErrInvalidBlurHash, c)
+		}
+
+		value = value*83 + digit
+	}
+
+	return value, nil
+}
+
+func srgbToLinear(value uint8) float64 {
+	v := float64(value) / 255
+
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exponent float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exponent), value)
+}
+
+/*
+shrink scales img down to fit inside size by size. Smaller images are
+returned as they are.
+*/
+func shrink(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+
+	if bounds.Dx() <= size && bounds.Dy() <= size {
+		return img
+	}
+
+	if bounds.Dx() >= bounds.Dy() {
+		return resize.Resize(uint(size), 0, img, resize.Bilinear)
+	}
+
+	return resize.Resize(0, uint(size), img, resize.Bilinear)
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+/*
+PaletteColor is one of the main colors of an image. Share is the part of
+the image, from 0 to 1, closest to this color.
+*/
+type PaletteColor struct {
+	Color color.RGBA
+	Share float64
+}
+
+/*
+Hex returns the color as "#rrggbb", for CSS
+*/
+func (c PaletteColor) Hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.Color.R, c.Color.G, c.Color.B)
+}
+
+/*
+ExtractPalette finds up to count main colors of an image using k-means
+clustering, with the most common first. Transparent pixels are ignored.
+The result is the same every time for the same image. Fewer colors are
+returned when the image has fewer distinct colors.
+*/
+func ExtractPalette(img image.Image, count int) []PaletteColor {
+	const maxIterations = 20
+
+	if count < 1 {
+		return nil
+	}
+
+	small := toNRGBA(shrink(img, placeholderSourceSize))
+	points := make([][3]float64, 0, len(small.Pix)/4)
+
+	for i := 0; i < len(small.Pix); i += 4 {
+		if small.Pix[i+3] >= 128 {
+			points = append(points, [3]float64{float64(small.Pix[i]), float64(small.Pix[i+1]), float64(small.Pix[i+2])})
+		}
+	}
+
+	if len(points) == 0 {
+		return nil
+	}
+
+	centers := initialCenters(points, count)
+	assignments := make([]int, len(points))
+
+	for iteration := 0; iteration < maxIterations; iteration++ {
+		changed := false
+
+		for i, point := range points {
+			nearest := nearestCenter(centers, point)
+
+			if nearest != assignments[i] || iteration == 0 {
+				assignments[i] = nearest
+				changed = true
+			}
+		}
+
+		if !changed {
+			break
+		}
+
+		sums := make([][3]float64, len(centers))
+		sizes := make([]int, len(centers))
+
+		for i, point := range points {
+			for c := 0; c < 3; c++ {
+				sums[assignments[i]][c] += point[c]
+			}
+
+			sizes[assignments[i]]++
+		}
+
+		for i := range centers {
+			if sizes[i] > 0 {
+				centers[i] = [3]float64{sums[i][0] / float64(sizes[i]), sums[i][1] / float64(sizes[i]), sums[i][2] / float64(sizes[i])}
+			}
+		}
+	}
+
+	sizes := make([]int, len(centers))
+
+	for _, assignment := range assignments {
+		sizes[assignment]++
+	}
+
+	result := make([]PaletteColor, 0, len(centers))
+
+	for i, center := range centers {
+		if sizes[i] == 0 {
+			continue
+		}
+
+		result = append(result, PaletteColor{
+			Color: color.RGBA{R: clampByte(center[0]), G: clampByte(center[1]), B: clampByte(center[2]), A: 255},
+			Share: float64(sizes[i]) / float64(len(points)),
+		})
+	}
+
+	sort.SliceStable(result, func(a, b int) bool {
+		return result[a].Share > result[b].Share
+	})
+
+	return result
+}
+
+/*
+DominantColor returns the most common color of an image, which makes a
+good background while the image loads. A fully transparent image returns
+transparent.
+*/
+func DominantColor(img image.Image) color.RGBA {
+	palette := ExtractPalette(img, 5)
+
+	if len(palette) == 0 {
+		return color.RGBA{}
+	}
+
+	return palette[0].Color
+}
+
+/*
+initialCenters picks starting colors that are spread out. The first is
+the point nearest the average, and each after it is the point farthest
+from those already picked. Unlike random starts, this always gives the
+same palette.
+*/
+func initialCenters(points [][3]float64, count int) [][3]float64 {
+	var mean [3]float64
+
+	for _, point := range points {
+		for c := 0; c < 3; c++ {
+			mean[c] += point[c] / float64(len(points))
+		}
+	}
+
+	centers := [][3]float64{points[nearestCenter(points, mean)]}
+	distances := make([]float64, len(points))
+
+	for i, point := range points {
+		distances[i] = colorDistance(point, centers[0])
+	}
+
+	for len(centers) < count {
+		farthest := 0
+
+		for i := range points {
+			if distances[i] > distances[farthest] {
+				farthest = i
+			}
+		}
+
+		if distances[farthest] == 0 {
+			break
+		}
+
+		centers = append(centers, points[farthest])
+
+		for i, point := range points {
+			distances[i] = math.Min(distances[i], colorDistance(point, points[farthest]))
+		}
+	}
+
+	return centers
+}
+
+func nearestCenter(centers [][3]float64, point [3]float64) int {
+	nearest, best := 0, math.Inf(1)
+
+	for i, center := range centers {
+		if distance := colorDistance(center, point); distance < best {
+			nearest, best = i, distance
+		}
+	}
+
+	return nearest
+}
+
+func colorDistance(a, b [3]float64) float64 {
+	dr, dg, db := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dr*dr + dg*dg + db*db
+}
@@ -13,11 +13,14 @@ CropOptions describes how an image is cropped. Width/Height defines how big to m
 the image. AnchorMode describes how to apply the crop anchor point. Valid options are
 top-left, centered. Anchor describes the X/Y offset from top left if the anchor mode
 is top-left. UseRatio, when true, makes width/height a ratio-based instead of pixels.
+Output describes how the cropped image is encoded. Left empty, it keeps the original
+format.
 */
 type CropOptions struct {
 	Anchor     image.Point
 	AnchorMode CropAnchorMode
 	Height     int
+	Output     EncodeOptions
 	UseRatio   bool
 	Width      int
 }
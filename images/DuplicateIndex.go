@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"sort"
+	"sync"
+)
+
+/*
+DuplicateMatch is an image found in a DuplicateIndex
+*/
+type DuplicateMatch struct {
+	Distance   int
+	ID         string
+	Similarity float64
+}
+
+/*
+DuplicateIndex keeps image hashes in memory and finds near duplicates of
+a new image. Use one kind of hash for everything in an index. It is safe
+to use from many goroutines.
+
+	index := images.NewDuplicateIndex(0.9)
+	hash := images.PerceptualHash(img)
+
+	if matches := index.Find(hash); len(matches) > 0 {
+		fmt.Printf("looks like %s\n", matches[0].ID)
+	}
+
+	index.Add(uploadID, hash)
+*/
+type DuplicateIndex struct {
+	hashes      map[string]ImageHash
+	maxDistance int
+	mutex       sync.RWMutex
+}
+
+/*
+NewDuplicateIndex creates an empty index. Images match when their
+Similarity is at least threshold, from 0 to 1. A threshold around 0.85
+to 0.9 finds resized and recompressed copies without many false matches.
+*/
+func NewDuplicateIndex(threshold float64) *DuplicateIndex {
+	return &DuplicateIndex{
+		hashes:      map[string]ImageHash{},
+		maxDistance: int((1 - threshold) * 64),
+	}
+}
+
+/*
+Add puts a hash in the index, replacing any hash already stored for id
+*/
+func (i *DuplicateIndex) Add(id string, hash ImageHash) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.hashes[id] = hash
+}
+
+/*
+Find returns every image in the index similar enough to hash, closest
+first
+*/
+func (i *DuplicateIndex) Find(hash ImageHash) []DuplicateMatch {
+	var result []DuplicateMatch
+
+	i.mutex.RLock()
+
+	for id, stored := range i.hashes {
+		if distance := hash.Distance(stored); distance <= i.maxDistance {
+			result = append(result, DuplicateMatch{Distance: distance, ID: id, Similarity: hash.Similarity(stored)})
+		}
+	}
+
+	i.mutex.RUnlock()
+
+	sort.Slice(result, func(a, b int) bool {
+		if result[a].Distance != result[b].Distance {
+			return result[a].Distance < result[b].Distance
+		}
+
+		return result[a].ID < result[b].ID
+	})
+
+	return result
+}
+
+/*
+Len returns how many images are in the index
+*/
+func (i *DuplicateIndex) Len() int {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	return len(i.hashes)
+}
+
+/*
+Remove takes an image out of the index
+*/
+func (i *DuplicateIndex) Remove(id string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	delete(i.hashes, id)
+}
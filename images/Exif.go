@@ -0,0 +1,336 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// ErrNoExif is an error when an image has no EXIF data
+var ErrNoExif = errors.New("Image has no EXIF data")
+
+// ErrInvalidExif is an error when an image's EXIF data can't be read
+var ErrInvalidExif = errors.New("Invalid EXIF data")
+
+const (
+	exifTagMake               = 0x010F
+	exifTagModel              = 0x0110
+	exifTagOrientation        = 0x0112
+	exifTagSoftware           = 0x0131
+	exifTagDateTime           = 0x0132
+	exifTagExposureTime       = 0x829A
+	exifTagFNumber            = 0x829D
+	exifTagExifIFD            = 0x8769
+	exifTagISO                = 0x8827
+	exifTagGPSIFD             = 0x8825
+	exifTagDateTimeOriginal   = 0x9003
+	exifTagOffsetTimeOriginal = 0x9011
+	exifTagFocalLength        = 0x920A
+	exifTagLensModel          = 0xA434
+	exifTagGPSLatitudeRef     = 0x0001
+	exifTagGPSLatitude        = 0x0002
+	exifTagGPSLongitudeRef    = 0x0003
+	exifTagGPSLongitude       = 0x0004
+	exifTagGPSAltitudeRef     = 0x0005
+	exifTagGPSAltitude        = 0x0006
+
+	maxIFDEntries = 1000
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+/*
+exifData is EXIF data, which is laid out like a TIFF file: a byte order
+mark, then directories of tagged values that point into the rest of it
+*/
+type exifData struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+/*
+exifEntry is one tagged value. offset is where the value's bytes start
+within the EXIF data.
+*/
+type exifEntry struct {
+	count  uint32
+	offset uint32
+	kind   uint16
+}
+
+var exifTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+func parseExif(data []byte) (*exifData, error) {
+	if len(data) < 8 {
+		return nil, ErrInvalidExif
+	}
+
+	result := &exifData{data: data}
+
+	switch string(data[:4]) {
+	case "II*\x00":
+		result.order = binary.LittleEndian
+
+	case "MM\x00*":
+		result.order = binary.BigEndian
+
+	default:
+		return nil, ErrInvalidExif
+	}
+
+	return result, nil
+}
+
+/*
+ifd reads a directory. offset zero means the first directory in the data.
+*/
+func (e *exifData) ifd(offset uint32) (map[uint16]exifEntry, error) {
+	if offset == 0 {
+		offset = e.order.Uint32(e.data[4:8])
+	}
+
+	if uint64(offset)+2 > uint64(len(e.data)) {
+		return nil, ErrInvalidExif
+	}
+
+	count := uint32(e.order.Uint16(e.data[offset:]))
+
+	if count > maxIFDEntries || uint64(offset)+2+uint64(count)*12 > uint64(len(e.data)) {
+		return nil, ErrInvalidExif
+	}
+
+	result := make(map[uint16]exifEntry, count)
+
+	for i := uint32(0); i < count; i++ {
+		start := offset + 2 + i*12
+		entry := exifEntry{
+			kind:   e.order.Uint16(e.data[start+2:]),
+			count:  e.order.Uint32(e.data[start+4:]),
+			offset: start + 8,
+		}
+
+		size, ok := exifTypeSizes[entry.kind]
+
+		if !ok {
+			continue
+		}
+
+		total := uint64(size) * uint64(entry.count)
+
+		if total > 4 {
+			entry.offset = e.order.Uint32(e.data[start+8:])
+		}
+
+		if uint64(entry.offset)+total > uint64(len(e.data)) {
+			continue
+		}
+
+		result[e.order.Uint16(e.data[start:])] = entry
+	}
+
+	return result, nil
+}
+
+func (e *exifData) string(entry exifEntry) string {
+	if entry.kind != 2 {
+		return ""
+	}
+
+	value := e.data[entry.offset : entry.offset+entry.count]
+
+	if i := bytes.IndexByte(value, 0); i >= 0 {
+		value = value[:i]
+	}
+
+	return strings.TrimSpace(string(value))
+}
+
+func (e *exifData) uint(entry exifEntry) (uint32, bool) {
+	if entry.count < 1 {
+		return 0, false
+	}
+
+	switch entry.kind {
+	case 1, 7:
+		return uint32(e.data[entry.offset]), true
+
+	case 3:
+		return uint32(e.order.Uint16(e.data[entry.offset:])), true
+
+	case 4:
+		return e.order.Uint32(e.data[entry.offset:]), true
+	}
+
+	return 0, false
+}
+
+func (e *exifData) rational(entry exifEntry, index uint32) (float64, bool) {
+	if index >= entry.count || (entry.kind != 5 && entry.kind != 10) {
+		return 0, false
+	}
+
+	start := entry.offset + index*8
+	numerator := e.order.Uint32(e.data[start:])
+	denominator := e.order.Uint32(e.data[start+4:])
+
+	if denominator == 0 {
+		return 0, false
+	}
+
+	if entry.kind == 10 {
+		return float64(int32(numerator)) / float64(int32(denominator)), true
+	}
+
+	return float64(numerator) / float64(denominator), true
+}
+
+/*
+findExif returns the EXIF data in a JPEG, PNG, WebP, or TIFF file
+*/
+func findExif(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		for _, segment := range jpegSegments(data) {
+			if segment.marker == 0xE1 && bytes.HasPrefix(segment.payload, exifHeader) {
+				return segment.payload[len(exifHeader):]
+			}
+		}
+
+	case bytes.HasPrefix(data, pngSignature):
+		for _, chunk := range pngChunks(data) {
+			if chunk.kind == "eXIf" {
+				return chunk.data
+			}
+		}
+
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		for _, chunk := range riffChunks(data) {
+			if chunk.kind == "EXIF" {
+				return bytes.TrimPrefix(chunk.data, exifHeader)
+			}
+		}
+
+	case bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")):
+		return data
+	}
+
+	return nil
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+type jpegSegment struct {
+	start   int
+	end     int
+	marker  byte
+	payload []byte
+}
+
+/*
+jpegSegments lists the marker segments of a JPEG up to the start of the
+image data
+*/
+func jpegSegments(data []byte) []jpegSegment {
+	result := []jpegSegment{}
+	offset := 2
+
+	for offset+4 <= len(data) {
+		if data[offset] != 0xFF {
+			break
+		}
+
+		marker := data[offset+1]
+
+		if marker == 0xFF {
+			offset++
+			continue
+		}
+
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+
+		if length < 2 || offset+2+length > len(data) {
+			break
+		}
+
+		result = append(result, jpegSegment{
+			start:   offset,
+			end:     offset + 2 + length,
+			marker:  marker,
+			payload: data[offset+4 : offset+2+length],
+		})
+
+		offset += 2 + length
+	}
+
+	return result
+}
+
+type fileChunk struct {
+	start int
+	end   int
+	kind  string
+	data  []byte
+}
+
+func pngChunks(data []byte) []fileChunk {
+	result := []fileChunk{}
+	offset := len(pngSignature)
+
+	for offset+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+
+		if length < 0 || length > len(data)-offset-12 {
+			break
+		}
+
+		result = append(result, fileChunk{
+			start: offset,
+			end:   offset + 12 + length,
+			kind:  string(data[offset+4 : offset+8]),
+			data:  data[offset+8 : offset+8+length],
+		})
+
+		offset += 12 + length
+	}
+
+	return result
+}
+
+func riffChunks(data []byte) []fileChunk {
+	result := []fileChunk{}
+	offset := 12
+
+	for offset+8 <= len(data) {
+		length := int(binary.LittleEndian.Uint32(data[offset+4:]))
+
+		if length < 0 || length > len(data)-offset-8 {
+			break
+		}
+
+		end := offset + 8 + length + length%2
+
+		if end > len(data) {
+			end = len(data)
+		}
+
+		result = append(result, fileChunk{
+			start: offset,
+			end:   end,
+			kind:  string(data[offset : offset+4]),
+			data:  data[offset+8 : offset+8+length],
+		})
+
+		offset = end
+	}
+
+	return result
+}
@@ -0,0 +1,272 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+/*
+rotate turns img clockwise by degrees. Quarter turns move pixels exactly.
+Any other angle samples the source with bilinear filtering onto a canvas
+big enough for the turned corners, which is transparent where the source
+does not reach.
+*/
+func rotate(img image.Image, degrees float64) image.Image {
+	degrees = math.Mod(degrees, 360)
+
+	if degrees < 0 {
+		degrees += 360
+	}
+
+	switch degrees {
+	case 0:
+		return img
+	case 90:
+		return rotate90(img)
+	case 180:
+		return rotate180(img)
+	case 270:
+		return rotate270(img)
+	}
+
+	src := toRGBA(img)
+	width, height := float64(src.Bounds().Dx()), float64(src.Bounds().Dy())
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+
+	newWidth := int(math.Ceil(math.Abs(width*cos) + math.Abs(height*sin)))
+	newHeight := int(math.Ceil(math.Abs(width*sin) + math.Abs(height*cos)))
+	result := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+
+	for y := 0; y < newHeight; y++ {
+		for x := 0; x < newWidth; x++ {
+			// Turn the center of the destination pixel back onto the source
+			dx := float64(x) + 0.5 - float64(newWidth)/2
+			dy := float64(y) + 0.5 - float64(newHeight)/2
+			sx := dx*cos + dy*sin + width/2 - 0.5
+			sy := -dx*sin + dy*cos + height/2 - 0.5
+
+			i := result.PixOffset(x, y)
+			r, g, b, a := bilinear(src, sx, sy)
+			result.Pix[i], result.Pix[i+1], result.Pix[i+2], result.Pix[i+3] = r, g, b, a
+		}
+	}
+
+	return result
+}
+
+/*
+bilinear samples an RGBA image between pixels. Anything outside the image
+counts as transparent, so the edges of a rotated image are smooth.
+*/
+func bilinear(img *image.RGBA, x, y float64) (uint8, uint8, uint8, uint8) {
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	var sum [4]float64
+
+	for _, corner := range [4]struct {
+		x, y   int
+		weight float64
+	}{
+		{x0, y0, (1 - fx) * (1 - fy)},
+		{x0 + 1, y0, fx * (1 - fy)},
+		{x0, y0 + 1, (1 - fx) * fy},
+		{x0 + 1, y0 + 1, fx * fy},
+	} {
+		if corner.x < 0 || corner.y < 0 || corner.x >= width || corner.y >= height {
+			continue
+		}
+
+		i := img.PixOffset(corner.x, corner.y)
+
+		for c := 0; c < 4; c++ {
+			sum[c] += float64(img.Pix[i+c]) * corner.weight
+		}
+	}
+
+	return clampByte(sum[0]), clampByte(sum[1]), clampByte(sum[2]), clampByte(sum[3])
+}
+
+/*
+blur applies a Gaussian blur with the given sigma, in pixels. The blur
+runs across then down, on premultiplied colors, so transparent pixels do
+not bleed black into their neighbours.
+*/
+func blur(img image.Image, sigma float64) image.Image {
+	if sigma <= 0 {
+		return img
+	}
+
+	src := toRGBA(img)
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	kernel := gaussianKernel(sigma)
+	radius := len(kernel) / 2
+
+	across := make([]float64, len(src.Pix))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum [4]float64
+
+			for k, weight := range kernel {
+				i := src.PixOffset(clampInt(x+k-radius, 0, width-1), y)
+
+				for c := 0; c < 4; c++ {
+					sum[c] += float64(src.Pix[i+c]) * weight
+				}
+			}
+
+			copy(across[src.PixOffset(x, y):], sum[:])
+		}
+	}
+
+	result := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum [4]float64
+
+			for k, weight := range kernel {
+				i := src.PixOffset(x, clampInt(y+k-radius, 0, height-1))
+
+				for c := 0; c < 4; c++ {
+					sum[c] += across[i+c] * weight
+				}
+			}
+
+			i := result.PixOffset(x, y)
+
+			for c := 0; c < 4; c++ {
+				result.Pix[i+c] = clampByte(sum[c])
+			}
+		}
+	}
+
+	return result
+}
+
+/*
+gaussianKernel returns normalized weights reaching three sigmas either
+side of the center
+*/
+func gaussianKernel(sigma float64) []float64 {
+	radius := int(math.Ceil(sigma * 3))
+	kernel := make([]float64, radius*2+1)
+	total := 0.0
+
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-(d * d) / (2 * sigma * sigma))
+		total += kernel[i]
+	}
+
+	for i := range kernel {
+		kernel[i] /= total
+	}
+
+	return kernel
+}
+
+/*
+sharpen applies an unsharp mask. The difference between the image and a
+blurred copy is the detail. Adding amount times the detail back makes
+edges stand out. Transparency is left alone.
+*/
+func sharpen(img image.Image, sigma, amount float64) image.Image {
+	if sigma <= 0 || amount <= 0 {
+		return img
+	}
+
+	src := toRGBA(img)
+	blurred := blur(src, sigma).(*image.RGBA)
+	result := image.NewRGBA(src.Bounds())
+
+	for i := 0; i < len(src.Pix); i += 4 {
+		alpha := src.Pix[i+3]
+
+		for c := 0; c < 3; c++ {
+			value := float64(src.Pix[i+c])
+			value += amount * (value - float64(blurred.Pix[i+c]))
+			result.Pix[i+c] = minByte(clampByte(value), alpha)
+		}
+
+		result.Pix[i+3] = alpha
+	}
+
+	return result
+}
+
+/*
+grayscale converts img to shades of gray using the Rec. 601 weights,
+keeping its transparency
+*/
+func grayscale(img image.Image) image.Image {
+	src := toNRGBA(img)
+	result := image.NewNRGBA(src.Bounds())
+
+	for i := 0; i < len(src.Pix); i += 4 {
+		luma := clampByte(0.299*float64(src.Pix[i]) + 0.587*float64(src.Pix[i+1]) + 0.114*float64(src.Pix[i+2]))
+		result.Pix[i], result.Pix[i+1], result.Pix[i+2], result.Pix[i+3] = luma, luma, luma, src.Pix[i+3]
+	}
+
+	return result
+}
+
+/*
+background draws img over a solid color, leaving no transparency
+*/
+func background(img image.Image, c color.Color) image.Image {
+	bounds := img.Bounds()
+	result := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+
+	r, g, b, _ := c.RGBA()
+	opaque := color.RGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: 255}
+
+	draw.Draw(result, result.Bounds(), image.NewUniform(opaque), image.Point{}, draw.Src)
+	draw.Draw(result, result.Bounds(), img, bounds.Min, draw.Over)
+
+	return result
+}
+
+/*
+toRGBA returns img as an *image.RGBA, with premultiplied colors, whose
+bounds start at 0, 0
+*/
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+
+	bounds := img.Bounds()
+	result := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(result, result.Bounds(), img, bounds.Min, draw.Src)
+
+	return result
+}
+
+func clampByte(value float64) uint8 {
+	if value <= 0 {
+		return 0
+	}
+
+	if value >= 255 {
+		return 255
+	}
+
+	return uint8(value + 0.5)
+}
+
+func minByte(a, b uint8) uint8 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"image"
+	"math"
+
+	"github.com/nfnt/resize"
+)
+
+/*
+FitMode describes how an image is made to fit a width and height
+*/
+type FitMode string
+
+const (
+	// FitContain scales the image to fit inside the box, keeping its aspect ratio
+	FitContain FitMode = "contain"
+
+	// FitFill stretches the image to exactly the box
+	FitFill FitMode = "fill"
+
+	// FitCover scales the image to cover the box, keeping its aspect ratio, and crops what is left over
+	FitCover FitMode = "cover"
+)
+
+/*
+FocalPoint is the spot in an image to keep when it is cropped. X and Y run
+from 0 to 1 across the width and height of the image, so 0.5, 0.5 is the
+center.
+*/
+type FocalPoint struct {
+	X float64
+	Y float64
+}
+
+/*
+ResizeOptions describes a resize. Width and Height are the box the image
+is fitted to. When only one of them is given, the image is scaled to
+match it and keeps its aspect ratio, whatever the mode. Mode defaults to
+FitContain.
+
+With FitCover, the part of the image that is kept is centered on
+FocalPoint. Set SmartCrop instead to keep the busiest part of the image,
+the part with the most detail, which is usually the subject.
+*/
+type ResizeOptions struct {
+	FocalPoint *FocalPoint
+	Height     int
+	Mode       FitMode
+	SmartCrop  bool
+	Width      int
+}
+
+func resizeImage(img image.Image, options ResizeOptions) (image.Image, error) {
+	bounds := img.Bounds()
+	sourceWidth, sourceHeight := bounds.Dx(), bounds.Dy()
+	width, height := options.Width, options.Height
+
+	if width <= 0 && height <= 0 {
+		return img, nil
+	}
+
+	if width <= 0 || height <= 0 {
+		return resize.Resize(uint(maxInt(width, 0)), uint(maxInt(height, 0)), img, resize.Lanczos3), nil
+	}
+
+	switch options.Mode {
+	case FitFill:
+		return resize.Resize(uint(width), uint(height), img, resize.Lanczos3), nil
+
+	case FitCover:
+		scale := math.Max(float64(width)/float64(sourceWidth), float64(height)/float64(sourceHeight))
+		cropWidth := minInt(sourceWidth, int(math.Round(float64(width)/scale)))
+		cropHeight := minInt(sourceHeight, int(math.Round(float64(height)/scale)))
+
+		var area image.Rectangle
+
+		if options.SmartCrop {
+			area = smartCrop(img, cropWidth, cropHeight)
+		} else {
+			area = focalCrop(bounds, cropWidth, cropHeight, options.FocalPoint)
+		}
+
+		cropped := toNRGBA(img).SubImage(area.Sub(bounds.Min))
+		return resize.Resize(uint(width), uint(height), cropped, resize.Lanczos3), nil
+	}
+
+	scale := math.Min(float64(width)/float64(sourceWidth), float64(height)/float64(sourceHeight))
+	newWidth := maxInt(1, int(math.Round(float64(sourceWidth)*scale)))
+	newHeight := maxInt(1, int(math.Round(float64(sourceHeight)*scale)))
+
+	return resize.Resize(uint(newWidth), uint(newHeight), img, resize.Lanczos3), nil
+}
+
+/*
+focalCrop places a width by height rectangle inside bounds, centered on
+the focal point as far as the edges allow
+*/
+func focalCrop(bounds image.Rectangle, width, height int, focus *FocalPoint) image.Rectangle {
+	x, y := 0.5, 0.5
+
+	if focus != nil {
+		x, y = focus.X, focus.Y
+	}
+
+	left := int(math.Round(x*float64(bounds.Dx()) - float64(width)/2))
+	top := int(math.Round(y*float64(bounds.Dy()) - float64(height)/2))
+
+	left = clampInt(left, 0, bounds.Dx()-width)
+	top = clampInt(top, 0, bounds.Dy()-height)
+
+	return image.Rect(left, top, left+width, top+height).Add(bounds.Min)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+func clampInt(value, low, high int) int {
+	if value < low {
+		return low
+	}
+
+	if value > high {
+		return high
+	}
+
+	return value
+}
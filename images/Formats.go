@@ -0,0 +1,341 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+/*
+ImageFormat names an image encoding. Every format here can be read. All
+but WebP can also be written out of the box. WebP is decode-only, since
+there is no pure Go encoder, so asking for WebP output returns
+ErrUnsupportedFormat unless an encoder is registered with
+RegisterEncoder. AVIF can be neither read nor written.
+*/
+type ImageFormat string
+
+const (
+	FormatBMP  ImageFormat = "bmp"
+	FormatGIF  ImageFormat = "gif"
+	FormatJPEG ImageFormat = "jpeg"
+	FormatPNG  ImageFormat = "png"
+	FormatTIFF ImageFormat = "tiff"
+	FormatWebP ImageFormat = "webp"
+)
+
+func (f ImageFormat) String() string {
+	return string(f)
+}
+
+/*
+ContentType returns the MIME type for the format
+*/
+func (f ImageFormat) ContentType() string {
+	return "image/" + string(f)
+}
+
+/*
+EncodeOptions describes how an image is written out. Format is the
+encoding to use. When it is empty, images are written in the format they
+were read in, or as PNG when there is no encoder for that format. Quality
+runs from 1 to 100 and is used by lossy formats such as JPEG. Zero uses
+the encoder's default.
+
+Metadata such as the camera, time, and GPS position is stripped by
+default, for privacy. Set KeepMetadata to copy the source image's EXIF
+data into JPEG and PNG output. Its orientation is reset to upright, since
+the pixels have already been turned.
+
+Watermark, when set, is drawn over the image, and every frame of an
+animation, just before it is encoded. Because the Resizer, ImageCropper,
+and Pipeline all finish by encoding, this adds a watermark to any of
+their output.
+*/
+type EncodeOptions struct {
+	Format       ImageFormat
+	KeepMetadata bool
+	Quality      int
+	Watermark    *WatermarkOptions
+}
+
+/*
+EncoderFunc writes an image in one format
+*/
+type EncoderFunc func(w io.Writer, img image.Image, options EncodeOptions) error
+
+var (
+	encoderLock sync.RWMutex
+	encoders    = map[ImageFormat]EncoderFunc{
+		FormatBMP: func(w io.Writer, img image.Image, options EncodeOptions) error {
+			return bmp.Encode(w, img)
+		},
+		FormatGIF: func(w io.Writer, img image.Image, options EncodeOptions) error {
+			return gif.Encode(w, img, nil)
+		},
+		FormatJPEG: func(w io.Writer, img image.Image, options EncodeOptions) error {
+			var jpegOptions *jpeg.Options
+
+			if options.Quality > 0 {
+				jpegOptions = &jpeg.Options{Quality: options.Quality}
+			}
+
+			return jpeg.Encode(w, img, jpegOptions)
+		},
+		FormatPNG: func(w io.Writer, img image.Image, options EncodeOptions) error {
+			return png.Encode(w, img)
+		},
+		FormatTIFF: func(w io.Writer, img image.Image, options EncodeOptions) error {
+			return tiff.Encode(w, img, &tiff.Options{Compression: tiff.Deflate})
+		},
+	}
+)
+
+/*
+RegisterEncoder adds or replaces the encoder for a format. WebP has no
+pure Go encoder, so this is how an application that links one in makes
+WebP available as output. Registering an encoder only adds output.
+Reading a new format also needs a decoder, registered with
+image.RegisterFormat.
+*/
+func RegisterEncoder(format ImageFormat, encoder EncoderFunc) {
+	encoderLock.Lock()
+	defer encoderLock.Unlock()
+
+	encoders[format] = encoder
+}
+
+/*
+CanEncode reports whether there is an encoder for a format
+*/
+func CanEncode(format ImageFormat) bool {
+	encoderLock.RLock()
+	defer encoderLock.RUnlock()
+
+	_, ok := encoders[format]
+	return ok
+}
+
+var contentTypes = map[string]ImageFormat{
+	"image/bmp":      FormatBMP,
+	"image/gif":      FormatGIF,
+	"image/jpeg":     FormatJPEG,
+	"image/jpg":      FormatJPEG,
+	"image/pjpeg":    FormatJPEG,
+	"image/png":      FormatPNG,
+	"image/tiff":     FormatTIFF,
+	"image/webp":     FormatWebP,
+	"image/x-ms-bmp": FormatBMP,
+	"image/x-png":    FormatPNG,
+}
+
+/*
+FormatFromContentType returns the format for a MIME type, such as
+"image/jpeg". Parameters are ignored. Anything that isn't a supported
+image type returns ErrInvalidFileType.
+*/
+func FormatFromContentType(contentType string) (ImageFormat, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidFileType, contentType)
+	}
+
+	format, ok := contentTypes[strings.ToLower(mediaType)]
+
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrInvalidFileType, contentType)
+	}
+
+	return format, nil
+}
+
+/*
+Encode writes img to w as described by options. Images are written as
+PNG when no format is given.
+*/
+func Encode(w io.Writer, img image.Image, options EncodeOptions) error {
+	var err error
+
+	if options.Format == "" {
+		options.Format = FormatPNG
+	}
+
+	if options.Watermark != nil {
+		if img, err = watermark(img, *options.Watermark); err != nil {
+			return err
+		}
+	}
+
+	encoderLock.RLock()
+	encoder, ok := encoders[options.Format]
+	encoderLock.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w: no encoder for %s", ErrUnsupportedFormat, options.Format)
+	}
+
+	return encoder(w, img, options)
+}
+
+/*
+Decode reads an image the same way Resizer does. Its format is worked
+out from its contents, and it is turned the right way up using its EXIF
+orientation. Animations return their first frame. Images over
+DefaultImageLimits are refused. Use it to get an image for functions such
+as EncodeBlurHash, ExtractPalette, and PerceptualHash.
+*/
+func Decode(source io.Reader) (image.Image, ImageFormat, error) {
+	data, err := io.ReadAll(io.LimitReader(source, DefaultImageLimits.MaxFileSize+1))
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	decoded, err := decode(data, ImageLimits{})
+
+	if err != nil {
+		return nil, "", fmt.Errorf("Error decoding image in Decode: %w", err)
+	}
+
+	return decoded.image, decoded.format, nil
+}
+
+/*
+decodedImage is an image as it was read. Animated GIFs keep every frame,
+each drawn out in full, so frames can be transformed on their own.
+*/
+type decodedImage struct {
+	animation *gif.GIF
+	exif      []byte
+	format    ImageFormat
+	frames    []image.Image
+	image     image.Image
+}
+
+/*
+decode reads an image, working out its format from its contents. Images
+are turned the right way up using their EXIF orientation. The image is
+checked against limits before any pixels are decoded.
+*/
+func decode(data []byte, limits ImageLimits) (*decodedImage, error) {
+	if _, err := ValidateImage(data, "", limits); err != nil {
+		return nil, err
+	}
+
+	img, formatName, err := image.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &decodedImage{
+		exif:   findExif(data),
+		format: ImageFormat(formatName),
+		image:  img,
+	}
+
+	if result.format != FormatGIF {
+		result.image = Orient(img, exifOrientation(data))
+		return result, nil
+	}
+
+	animation, err := gif.DecodeAll(bytes.NewReader(data))
+
+	if err != nil || len(animation.Image) < 2 {
+		return result, nil
+	}
+
+	result.animation = animation
+	result.frames = composeFrames(animation)
+	result.image = result.frames[0]
+
+	return result, nil
+}
+
+/*
+transform applies fn to the image, and to every frame of an animation
+*/
+func (d *decodedImage) transform(fn func(image.Image) (image.Image, error)) error {
+	var err error
+
+	for i, frame := range d.frames {
+		if d.frames[i], err = fn(frame); err != nil {
+			return err
+		}
+	}
+
+	if len(d.frames) > 0 {
+		d.image = d.frames[0]
+		return nil
+	}
+
+	d.image, err = fn(d.image)
+	return err
+}
+
+/*
+clone returns a copy that can be transformed without changing d. Frames
+are never changed in place, so only the list of them is copied.
+*/
+func (d *decodedImage) clone() *decodedImage {
+	result := *d
+	result.frames = append([]image.Image(nil), d.frames...)
+
+	return &result
+}
+
+/*
+encode writes the image. Animations written as GIF keep every frame and
+their timing. Any other format gets the first frame.
+*/
+func (d *decodedImage) encode(options EncodeOptions) (*bytes.Buffer, error) {
+	result := new(bytes.Buffer)
+
+	if options.Format == "" {
+		options.Format = d.format
+
+		if !CanEncode(options.Format) {
+			options.Format = FormatPNG
+		}
+	}
+
+	if options.Watermark != nil {
+		if err := d.transform(func(img image.Image) (image.Image, error) {
+			return watermark(img, *options.Watermark)
+		}); err != nil {
+			return result, err
+		}
+
+		options.Watermark = nil
+	}
+
+	if options.Format == FormatGIF && d.animation != nil {
+		return result, gif.EncodeAll(result, encodeFrames(d.animation, d.frames))
+	}
+
+	if err := Encode(result, d.image, options); err != nil {
+		return result, err
+	}
+
+	if options.KeepMetadata && d.exif != nil {
+		return bytes.NewBuffer(insertExif(result.Bytes(), uprightExif(d.exif))), nil
+	}
+
+	return result, nil
+}
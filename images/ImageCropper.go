@@ -8,18 +8,16 @@ import (
 	"bytes"
 	"fmt"
 	"image"
-	"image/gif"
 	_ "image/gif"
-	"image/jpeg"
 	_ "image/jpeg"
-	"image/png"
 	_ "image/png"
-	"strings"
 
 	"github.com/oliamb/cutter"
 )
 
-// ErrImageFormatNotFound is used when the provided image format is unsupported
+// ErrImageFormatNotFound is used when the provided image format is unsupported.
+//
+// Deprecated: Crop now reports ErrUnsupportedFormat instead.
 var ErrImageFormatNotFound = fmt.Errorf("Image format not found")
 
 /*
@@ -30,29 +28,46 @@ type IImageCropper interface {
 }
 
 /*
-ImageCropper crops images
+ImageCropper crops images. Images over Limits are refused before they
+are decoded.
 */
-type ImageCropper struct{}
+type ImageCropper struct {
+	Limits ImageLimits
+}
 
 /*
 Crop takes an image reader and performs a crop based on the options
-provided. It returns the newly cropped image in the form of a
-PNG
+provided. The cropped image is encoded as described by
+cropOptions.Output, which by default keeps the original format. Every
+frame of an animated GIF is cropped the same way.
 */
 func (ic ImageCropper) Crop(imageBytes []byte, cropOptions CropOptions) (*bytes.Buffer, error) {
 	var (
 		err           error
-		originalImage image.Image
-		formatName    string
-		croppedImage  image.Image
+		originalImage *decodedImage
+		result        *bytes.Buffer
 	)
 
-	result := new(bytes.Buffer)
+	if originalImage, err = decode(imageBytes, ic.Limits); err != nil {
+		return new(bytes.Buffer), fmt.Errorf("Error decoding image in Crop: %w", err)
+	}
+
+	err = originalImage.transform(func(img image.Image) (image.Image, error) {
+		return cropImage(img, cropOptions)
+	})
 
-	if originalImage, formatName, err = ic.decodeImage(imageBytes); err != nil {
-		return result, fmt.Errorf("Error decoding image in Crop: %w", err)
+	if err != nil {
+		return new(bytes.Buffer), fmt.Errorf("Error cropping image: %w", err)
 	}
 
+	if result, err = originalImage.encode(cropOptions.Output); err != nil {
+		return result, fmt.Errorf("Unable to encode cropped image: %w", err)
+	}
+
+	return result, nil
+}
+
+func cropImage(img image.Image, cropOptions CropOptions) (image.Image, error) {
 	config := cutter.Config{
 		Width:  cropOptions.Width,
 		Height: cropOptions.Height,
@@ -69,54 +84,5 @@ func (ic ImageCropper) Crop(imageBytes []byte, cropOptions CropOptions) (*bytes.
 		config.Options = cutter.Ratio
 	}
 
-	if croppedImage, err = cutter.Crop(
-		originalImage,
-		config,
-	); err != nil {
-		return result, fmt.Errorf("Error cropping image: %w", err)
-	}
-
-	if strings.Contains(formatName, "jpg") || strings.Contains(formatName, "jpeg") {
-		if err = jpeg.Encode(result, croppedImage, nil); err != nil {
-			return result, fmt.Errorf("Unable to encode cropped image back to JPG: %w", err)
-		}
-
-		return result, nil
-	}
-
-	if strings.Contains(formatName, "png") {
-		if err = png.Encode(result, croppedImage); err != nil {
-			return result, fmt.Errorf("Unable to encode cropped image back to PNG: %w", err)
-		}
-
-		return result, nil
-	}
-
-	if strings.Contains(formatName, "gif") {
-		if err = gif.Encode(result, croppedImage, nil); err != nil {
-			return result, fmt.Errorf("Unable to encode cropped image back to GIF: %w", err)
-		}
-
-		return result, nil
-	}
-
-	return result, ErrImageFormatNotFound
-}
-
-func (ic ImageCropper) decodeImage(imageBytes []byte) (image.Image, string, error) {
-	var (
-		err        error
-		formatName string
-		result     image.Image
-	)
-
-	if result, formatName, err = image.Decode(bytes.NewReader(imageBytes)); err != nil {
-		return result, "", fmt.Errorf("Error decoding image before cropping: %w", err)
-	}
-
-	if _, formatName, err = image.DecodeConfig(bytes.NewReader(imageBytes)); err != nil {
-		return result, "", fmt.Errorf("Error determining image configuration when decoding image for cropping: %w", err)
-	}
-
-	return result, formatName, nil
+	return cutter.Crop(img, config)
 }
@@ -9,4 +9,28 @@ import (
 )
 
 // ErrInvalidFileType is an error when the user uploads a bad file type
-var ErrInvalidFileType = errors.New("Invalid image type. Supported image formats are JPG and PNG")
+var ErrInvalidFileType = errors.New("Invalid image type. Supported image formats are JPG, PNG, GIF, WebP, BMP, and TIFF")
+
+// ErrUnsupportedFormat is an error when an image can't be written in the requested format
+var ErrUnsupportedFormat = errors.New("Unsupported output image format")
+
+// ErrInvalidPipeline is an error when a pipeline query string has a bad value
+var ErrInvalidPipeline = errors.New("Invalid image pipeline")
+
+// ErrMissingWatermark is an error when a watermark has no image or text to draw
+var ErrMissingWatermark = errors.New("Watermark needs an image or text")
+
+// ErrInvalidBlurHash is an error when a BlurHash string can't be read
+var ErrInvalidBlurHash = errors.New("Invalid BlurHash")
+
+// ErrInvalidThumbHash is an error when a ThumbHash string can't be read
+var ErrInvalidThumbHash = errors.New("Invalid ThumbHash")
+
+// ErrFileTooLarge is an error when an image file is bigger than allowed
+var ErrFileTooLarge = errors.New("Image file is too large")
+
+// ErrImageTooLarge is an error when an image has more pixels, or more frames, than allowed
+var ErrImageTooLarge = errors.New("Image dimensions are too large")
+
+// ErrContentTypeMismatch is an error when an image's contents don't match its declared content type
+var ErrContentTypeMismatch = errors.New("Image contents don't match the content type")
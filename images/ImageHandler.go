@@ -0,0 +1,332 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+)
+
+/*
+ImageHandlerConfig configures an image handler.
+
+  - Originals is where the source images are read from. Required
+  - SigningKey is the secret URLs are signed with, using SignImageURL. Requests without a valid signature get a 403. Required
+  - Cache, when provided, is where transformed images are kept, so each one is only made once
+  - CacheControl is sent with every image. Defaults to "public, max-age=31536000, immutable". Errors are sent with "no-store"
+  - MaxConcurrent limits how many images are decoded at once, which bounds memory use. Defaults to the number of CPUs
+  - Prefix is removed from the request path to get the name of the original
+  - Limits is the largest original that will be decoded. Defaults to DefaultImageLimits
+  - Watermark, when provided, is drawn on every image served. It is part of the cache key and ETag, so changing it makes new images
+*/
+type ImageHandlerConfig struct {
+	Cache         filesystem.FileSystem
+	CacheControl  string
+	Limits        ImageLimits
+	MaxConcurrent int
+	Originals     filesystem.FileSystem
+	Prefix        string
+	SigningKey    []byte
+	Watermark     *WatermarkOptions
+}
+
+/*
+ImageHandler is an http.Handler that serves transformed images. The
+request path names an original, and the query string is a pipeline, as
+read by ParsePipeline, plus a signature in "s". Signing stops anyone
+from asking for endless sizes of every image.
+
+	handler := images.NewImageHandler(images.ImageHandlerConfig{
+		Cache:      cacheFS,
+		Originals:  uploadsFS,
+		Prefix:     "/images/",
+		SigningKey: key,
+	})
+
+	http.Handle("/images/", handler)
+
+	// In a template
+	src := "/images/" + images.SignImageURL(key, "photos/cat.jpg", url.Values{"w": {"400"}})
+
+Responses carry an ETag made from the original's name, size, and
+modification time, the pipeline, and the watermark, so conditional
+requests are answered with a 304 without decoding anything.
+*/
+type ImageHandler struct {
+	cache        filesystem.FileSystem
+	cacheControl string
+	limits       ImageLimits
+	originals    filesystem.FileSystem
+	prefix       string
+	semaphore    chan struct{}
+	signingKey   []byte
+	watermark    *WatermarkOptions
+	watermarkKey string
+}
+
+/*
+NewImageHandler creates a new image handler
+*/
+func NewImageHandler(config ImageHandlerConfig) *ImageHandler {
+	result := &ImageHandler{
+		cache:        config.Cache,
+		cacheControl: config.CacheControl,
+		limits:       config.Limits.withDefaults(),
+		originals:    config.Originals,
+		prefix:       config.Prefix,
+		signingKey:   config.SigningKey,
+	}
+
+	if result.cacheControl == "" {
+		result.cacheControl = "public, max-age=31536000, immutable"
+	}
+
+	if config.Watermark != nil {
+		watermark := *config.Watermark
+		result.watermark = &watermark
+		result.watermarkKey = watermark.fingerprint()
+	}
+
+	if config.MaxConcurrent <= 0 {
+		config.MaxConcurrent = runtime.NumCPU()
+	}
+
+	result.semaphore = make(chan struct{}, config.MaxConcurrent)
+	return result
+}
+
+/*
+SignImageURL returns the path and query string for an image served by
+ImageHandler, with the signature added. The name is relative to the
+handler's Prefix.
+*/
+func SignImageURL(key []byte, name string, query url.Values) string {
+	signed := url.Values{}
+
+	for k, v := range query {
+		if k != "s" {
+			signed[k] = v
+		}
+	}
+
+	signed.Set("s", imageSignature(key, cleanImageName(name), signed))
+	return cleanImageName(name) + "?" + signed.Encode()
+}
+
+func (h *ImageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		err      error
+		info     fs.FileInfo
+		output   []byte
+		pipeline *Pipeline
+	)
+
+	// Only successful responses may be cached. The real Cache-Control
+	// replaces this once the image is ready.
+	w.Header().Set("Cache-Control", "no-store")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := cleanImageName(strings.TrimPrefix(r.URL.Path, h.prefix))
+	query := r.URL.Query()
+	signature := query.Get("s")
+	query.Del("s")
+
+	if len(h.signingKey) == 0 || !hmac.Equal([]byte(signature), []byte(imageSignature(h.signingKey, name, query))) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	if pipeline, err = ParsePipeline(query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if info, err = h.originals.Stat(name); err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	if info.Size() > h.limits.MaxFileSize {
+		h.writeError(w, newValidationError(ErrFileTooLarge, "Image file is %d bytes. The most allowed is %d", info.Size(), h.limits.MaxFileSize))
+		return
+	}
+
+	key := h.cacheKey(name, query, info)
+	etag := `"` + key[:32] + `"`
+
+	if matchesETag(r.Header.Get("If-None-Match"), etag) {
+		h.writeCacheHeaders(w, etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	cacheName := path.Join(key[:2], key[2:4], key)
+
+	if output, err = h.readCache(cacheName); err != nil {
+		if output, err = h.transform(r, name, pipeline); err != nil {
+			h.writeError(w, err)
+			return
+		}
+
+		h.writeCache(cacheName, output)
+	}
+
+	if format, err := formatOf(output); err == nil {
+		w.Header().Set("Content-Type", format.ContentType())
+	}
+
+	h.writeCacheHeaders(w, etag)
+	http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(output))
+}
+
+/*
+transform reads the original and runs it through the pipeline, waiting
+for a free decode slot first
+*/
+func (h *ImageHandler) transform(r *http.Request, name string, pipeline *Pipeline) ([]byte, error) {
+	select {
+	case h.semaphore <- struct{}{}:
+		defer func() { <-h.semaphore }()
+
+	case <-r.Context().Done():
+		return nil, r.Context().Err()
+	}
+
+	original, err := h.originals.ReadFile(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline.output.Watermark = h.watermark
+	output, err := pipeline.Limits(h.limits).Process(bytes.NewReader(original))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Bytes(), nil
+}
+
+func (h *ImageHandler) readCache(name string) ([]byte, error) {
+	if h.cache == nil {
+		return nil, fs.ErrNotExist
+	}
+
+	return h.cache.ReadFile(name)
+}
+
+/*
+writeCache stores a transformed image. Failing to cache is not an error
+for the request, since the image can be made again.
+*/
+func (h *ImageHandler) writeCache(name string, data []byte) {
+	if h.cache == nil {
+		return
+	}
+
+	if err := h.cache.MkdirAll(path.Dir(name), 0755); err != nil {
+		return
+	}
+
+	_ = filesystem.WriteFileAtomic(h.cache, name, data, 0644)
+}
+
+/*
+cacheKey identifies one transformation, with one watermark, of one version
+of an original
+*/
+func (h *ImageHandler) cacheKey(name string, query url.Values, info fs.FileInfo) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n%d\n%d\n%s", name, query.Encode(), info.Size(), info.ModTime().UnixNano(), h.watermarkKey)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (h *ImageHandler) writeCacheHeaders(w http.ResponseWriter, etag string) {
+	w.Header().Set("Cache-Control", h.cacheControl)
+	w.Header().Set("ETag", etag)
+}
+
+/*
+writeError responds with the status that best describes err. Errors are
+never cached, since the next request may well succeed.
+*/
+func (h *ImageHandler) writeError(w http.ResponseWriter, err error) {
+	var validationErr *ValidationError
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Del("ETag")
+
+	switch {
+	case errors.As(err, &validationErr):
+		http.Error(w, validationErr.Error(), validationErr.StatusCode())
+
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, "not found", http.StatusNotFound)
+
+	case errors.Is(err, image.ErrFormat), errors.Is(err, ErrInvalidFileType):
+		http.Error(w, "unsupported image", http.StatusUnsupportedMediaType)
+
+	case errors.Is(err, ErrUnsupportedFormat):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "too busy", http.StatusServiceUnavailable)
+
+	default:
+		http.Error(w, "error transforming image", http.StatusInternalServerError)
+	}
+}
+
+func imageSignature(key []byte, name string, query url.Values) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name + "?" + query.Encode()))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+/*
+cleanImageName makes a request path into a name in the originals file
+system, which can't climb out of it
+*/
+func cleanImageName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+/*
+matchesETag reports whether an If-None-Match header lists etag
+*/
+func matchesETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+
+	return false
+}
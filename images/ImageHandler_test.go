@@ -0,0 +1,146 @@
+package images_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/filesystem"
+	"github.com/app-nerds/kit/v6/filesystem/memoryfs"
+	"github.com/app-nerds/kit/v6/images"
+)
+
+func TestImageHandler(t *testing.T) {
+	key := []byte("secret")
+	originals := memoryfs.NewMemoryFS()
+	cache := memoryfs.NewMemoryFS()
+
+	source := &bytes.Buffer{}
+	_ = png.Encode(source, newTestImage(40, 20, color.RGBA{B: 255, A: 255}))
+	_ = originals.Mkdir("photos", 0755)
+	_ = originals.WriteFile("photos/sky.png", source.Bytes(), 0644)
+
+	handler := images.NewImageHandler(images.ImageHandlerConfig{
+		Cache:      cache,
+		Originals:  originals,
+		Prefix:     "/images/",
+		SigningKey: key,
+	})
+
+	target := "/images/" + images.SignImageURL(key, "photos/sky.png", url.Values{"w": {"10"}})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200 but got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "image/png" {
+		t.Errorf("expected image/png but got %s", contentType)
+	}
+
+	config, _, err := image.DecodeConfig(recorder.Body)
+
+	if err != nil || config.Width != 10 || config.Height != 5 {
+		t.Errorf("expected a 10x5 image but got %dx%d, %v", config.Width, config.Height, err)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, target, nil)
+	request.Header.Set("If-None-Match", recorder.Header().Get("ETag"))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusNotModified {
+		t.Errorf("expected 304 but got %d", recorder.Code)
+	}
+
+	cached := 0
+
+	_ = filesystem.WalkDir(cache, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			cached++
+		}
+
+		return nil
+	})
+
+	if cached != 1 {
+		t.Errorf("expected 1 cached image but got %d", cached)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/images/photos/sky.png?w=10", nil))
+
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for an unsigned URL but got %d", recorder.Code)
+	}
+}
+
+func TestImageHandler_ErrorsAreNotCached(t *testing.T) {
+	key := []byte("secret")
+	originals := memoryfs.NewMemoryFS()
+	_ = originals.WriteFile("broken.png", []byte("not an image"), 0644)
+
+	handler := images.NewImageHandler(images.ImageHandlerConfig{
+		Originals:  originals,
+		SigningKey: key,
+	})
+
+	target := "/" + images.SignImageURL(key, "broken.png", url.Values{"w": {"10"}})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+
+	if recorder.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415 but got %d", recorder.Code)
+	}
+
+	if cacheControl := recorder.Header().Get("Cache-Control"); cacheControl != "no-store" {
+		t.Errorf("expected errors to be sent with no-store but got '%s'", cacheControl)
+	}
+
+	if etag := recorder.Header().Get("ETag"); etag != "" {
+		t.Errorf("expected no ETag on an error but got %s", etag)
+	}
+}
+
+func TestImageHandler_WatermarkIsPartOfTheETag(t *testing.T) {
+	key := []byte("secret")
+	originals := memoryfs.NewMemoryFS()
+	cache := memoryfs.NewMemoryFS()
+
+	source := &bytes.Buffer{}
+	_ = png.Encode(source, newTestImage(40, 20, color.RGBA{B: 255, A: 255}))
+	_ = originals.WriteFile("sky.png", source.Bytes(), 0644)
+
+	target := "/" + images.SignImageURL(key, "sky.png", url.Values{"w": {"10"}})
+	etags := map[string]bool{}
+
+	for _, text := range []string{"", "draft", "final"} {
+		config := images.ImageHandlerConfig{Cache: cache, Originals: originals, SigningKey: key}
+
+		if text != "" {
+			config.Watermark = &images.WatermarkOptions{Text: text}
+		}
+
+		recorder := httptest.NewRecorder()
+		images.NewImageHandler(config).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected 200 but got %d: %s", recorder.Code, recorder.Body.String())
+		}
+
+		etags[recorder.Header().Get("ETag")] = true
+	}
+
+	if len(etags) != 3 {
+		t.Errorf("expected a different ETag for each watermark but got %v", etags)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+
+	"github.com/nfnt/resize"
+)
+
+/*
+ImageHash is a 64 bit perceptual hash. Unlike a cryptographic hash,
+images that look alike get hashes that differ in only a few bits, even
+after they are resized, recompressed, or slightly edited. Only compare
+hashes made by the same function.
+*/
+type ImageHash uint64
+
+/*
+AverageHash (aHash) shrinks the image to 8x8 gray pixels and sets a bit
+for each pixel brighter than the average. It is the fastest, but the
+easiest to fool with changes in brightness or contrast.
+*/
+func AverageHash(img image.Image) ImageHash {
+	pixels := grayPixels(img, 8, 8)
+	mean := 0.0
+
+	for _, value := range pixels {
+		mean += value
+	}
+
+	mean /= float64(len(pixels))
+	return hashBits(len(pixels), func(i int) bool { return pixels[i] > mean })
+}
+
+/*
+DifferenceHash (dHash) shrinks the image to 9x8 gray pixels and sets a
+bit for each pixel brighter than the one to its right. It follows the
+gradients in the image, so it copes well with brightness changes.
+*/
+func DifferenceHash(img image.Image) ImageHash {
+	pixels := grayPixels(img, 9, 8)
+
+	return hashBits(64, func(i int) bool {
+		row, column := i/8, i%8
+		return pixels[row*9+column] > pixels[row*9+column+1]
+	})
+}
+
+/*
+PerceptualHash (pHash) takes the discrete cosine transform of the image
+shrunk to 32x32 gray pixels, and sets a bit for each of the 64 lowest
+frequencies above their median. It is the slowest, but the hardest to
+fool.
+*/
+func PerceptualHash(img image.Image) ImageHash {
+	const size = 32
+
+	pixels := grayPixels(img, size, size)
+	coefficients := make([]float64, 0, 64)
+
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			sum := 0.0
+
+			for y := 0; y < size; y++ {
+				for x := 0; x < size; x++ {
+					sum += pixels[y*size+x] *
+						math.Cos(float64(2*x+1)*float64(u)*math.Pi/(2*size)) *
+						math.Cos(float64(2*y+1)*float64(v)*math.Pi/(2*size))
+				}
+			}
+
+			coefficients = append(coefficients, sum)
+		}
+	}
+
+	// The first coefficient is the average brightness, which would swamp the median
+	sorted := append([]float64(nil), coefficients[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	return hashBits(64, func(i int) bool { return coefficients[i] > median })
+}
+
+/*
+ParseImageHash reads a hash written by String
+*/
+func ParseImageHash(s string) (ImageHash, error) {
+	value, err := strconv.ParseUint(s, 16, 64)
+
+	if err != nil {
+		return 0, fmt.Errorf("Invalid image hash %q: %w", s, err)
+	}
+
+	return ImageHash(value), nil
+}
+
+/*
+Distance returns the Hamming distance to another hash, which is the
+number of bits that differ. Zero means the images look the same. Up to
+about 10 usually means one is an edited copy of the other.
+*/
+func (h ImageHash) Distance(other ImageHash) int {
+	return bits.OnesCount64(uint64(h ^ other))
+}
+
+/*
+Similarity returns how alike two hashes are, from 0 to 1, where 1 is
+identical
+*/
+func (h ImageHash) Similarity(other ImageHash) float64 {
+	return 1 - float64(h.Distance(other))/64
+}
+
+/*
+String returns the hash as 16 hex digits, for storing in a database
+*/
+func (h ImageHash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+/*
+grayPixels shrinks img to width by height and returns the brightness of
+each pixel, row by row. Transparent areas count as white.
+*/
+func grayPixels(img image.Image, width, height int) []float64 {
+	small := toNRGBA(resize.Resize(uint(width), uint(height), img, resize.Bilinear))
+	result := make([]float64, width*height)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := small.PixOffset(x, y)
+			alpha := float64(small.Pix[i+3]) / 255
+			luma := 0.299*float64(small.Pix[i]) + 0.587*float64(small.Pix[i+1]) + 0.114*float64(small.Pix[i+2])
+			result[y*width+x] = luma*alpha + 255*(1-alpha)
+		}
+	}
+
+	return result
+}
+
+/*
+hashBits builds a hash from the first count bits, most significant first
+*/
+func hashBits(count int, set func(i int) bool) ImageHash {
+	var result ImageHash
+
+	for i := 0; i < count; i++ {
+		result <<= 1
+
+		if set(i) {
+			result |= 1
+		}
+	}
+
+	return result
+}
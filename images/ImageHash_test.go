@@ -0,0 +1,76 @@
+package images_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/images"
+	"github.com/nfnt/resize"
+)
+
+func newPatternImage(width, height int, invert bool) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			value := uint8((x*255/width + y*y*255/(height*height)) / 2)
+
+			if (x/(width/4)+y/(height/4))%2 == 0 {
+				value = 255 - value
+			}
+
+			if invert {
+				value = 255 - value
+			}
+
+			img.SetGray(x, y, color.Gray{Y: value})
+		}
+	}
+
+	return img
+}
+
+func TestImageHash_FindsResizedCopies(t *testing.T) {
+	original := newPatternImage(256, 192, false)
+	copied := resize.Resize(100, 75, original, resize.Lanczos3)
+	different := newPatternImage(256, 192, true)
+
+	for name, hash := range map[string]func(image.Image) images.ImageHash{
+		"aHash": images.AverageHash,
+		"dHash": images.DifferenceHash,
+		"pHash": images.PerceptualHash,
+	} {
+		if distance := hash(original).Distance(hash(copied)); distance > 6 {
+			t.Errorf("expected %s of a resized copy to be close but got a distance of %d", name, distance)
+		}
+
+		if distance := hash(original).Distance(hash(different)); distance < 20 {
+			t.Errorf("expected %s of a different image to be far but got a distance of %d", name, distance)
+		}
+	}
+
+	hash := images.PerceptualHash(original)
+
+	if parsed, err := images.ParseImageHash(hash.String()); err != nil || parsed != hash {
+		t.Errorf("expected %s but got %s, %v", hash, parsed, err)
+	}
+}
+
+func TestDuplicateIndex_Find(t *testing.T) {
+	index := images.NewDuplicateIndex(0.9)
+	index.Add("original", images.PerceptualHash(newPatternImage(256, 192, false)))
+	index.Add("different", images.PerceptualHash(newPatternImage(256, 192, true)))
+
+	matches := index.Find(images.PerceptualHash(resize.Resize(128, 96, newPatternImage(256, 192, false), resize.Bilinear)))
+
+	if len(matches) != 1 || matches[0].ID != "original" {
+		t.Fatalf("expected to match only the original but got %+v", matches)
+	}
+
+	index.Remove("original")
+
+	if index.Len() != 1 {
+		t.Errorf("expected 1 image in the index but got %d", index.Len())
+	}
+}
@@ -0,0 +1,390 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"io"
+	"time"
+)
+
+/*
+Metadata describes an image and the camera that took it. Width and
+Height are the size of the image as it should be shown, after the EXIF
+orientation is applied. Camera details are only filled in when the image
+has EXIF data. Taken is the time the photo was taken, in the time zone
+the camera recorded, or UTC when it recorded none.
+*/
+type Metadata struct {
+	ExposureTime float64
+	FNumber      float64
+	FocalLength  float64
+	Format       ImageFormat
+	GPS          *GPSPosition
+	Height       int
+	ISO          int
+	LensModel    string
+	Make         string
+	Model        string
+	Orientation  int
+	Software     string
+	Taken        time.Time
+	Width        int
+}
+
+/*
+GPSPosition is where a photo was taken. Latitude and Longitude are in
+degrees, negative to the south and west. Altitude is in meters, negative
+below sea level.
+*/
+type GPSPosition struct {
+	Altitude  float64
+	Latitude  float64
+	Longitude float64
+}
+
+/*
+ReadMetadata reads the size, format, and EXIF details of an image without
+decoding its pixels. No more than DefaultImageLimits.MaxFileSize bytes are
+read. A larger image returns a *ValidationError wrapping ErrFileTooLarge.
+*/
+func ReadMetadata(source io.Reader) (*Metadata, error) {
+	maxFileSize := DefaultImageLimits.MaxFileSize
+	data, err := io.ReadAll(io.LimitReader(source, maxFileSize+1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > maxFileSize {
+		return nil, newValidationError(ErrFileTooLarge, "Image file is larger than the most allowed, %d bytes", maxFileSize)
+	}
+
+	config, formatName, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Metadata{
+		Format:      ImageFormat(formatName),
+		Height:      config.Height,
+		Orientation: 1,
+		Width:       config.Width,
+	}
+
+	if exif := findExif(data); exif != nil {
+		result.readExif(exif)
+	}
+
+	if result.Orientation >= 5 {
+		result.Width, result.Height = result.Height, result.Width
+	}
+
+	return result, nil
+}
+
+/*
+readExif fills in the details found in EXIF data. Values that are missing
+or can't be read are left empty.
+*/
+func (m *Metadata) readExif(data []byte) {
+	exif, err := parseExif(data)
+
+	if err != nil {
+		return
+	}
+
+	ifd0, err := exif.ifd(0)
+
+	if err != nil {
+		return
+	}
+
+	m.Make = exif.string(ifd0[exifTagMake])
+	m.Model = exif.string(ifd0[exifTagModel])
+	m.Software = exif.string(ifd0[exifTagSoftware])
+	m.Taken = parseExifTime(exif.string(ifd0[exifTagDateTime]), "")
+
+	if orientation, ok := exif.uint(ifd0[exifTagOrientation]); ok && orientation >= 1 && orientation <= 8 {
+		m.Orientation = int(orientation)
+	}
+
+	if offset, ok := exif.uint(ifd0[exifTagExifIFD]); ok && offset != 0 {
+		if sub, err := exif.ifd(offset); err == nil {
+			if taken := parseExifTime(exif.string(sub[exifTagDateTimeOriginal]), exif.string(sub[exifTagOffsetTimeOriginal])); !taken.IsZero() {
+				m.Taken = taken
+			}
+
+			m.ExposureTime, _ = exif.rational(sub[exifTagExposureTime], 0)
+			m.FNumber, _ = exif.rational(sub[exifTagFNumber], 0)
+			m.FocalLength, _ = exif.rational(sub[exifTagFocalLength], 0)
+			m.LensModel = exif.string(sub[exifTagLensModel])
+
+			if iso, ok := exif.uint(sub[exifTagISO]); ok {
+				m.ISO = int(iso)
+			}
+		}
+	}
+
+	if offset, ok := exif.uint(ifd0[exifTagGPSIFD]); ok && offset != 0 {
+		if gps, err := exif.ifd(offset); err == nil {
+			m.GPS = readGPS(exif, gps)
+		}
+	}
+}
+
+func readGPS(exif *exifData, gps map[uint16]exifEntry) *GPSPosition {
+	latitude, ok := degrees(exif, gps[exifTagGPSLatitude])
+
+	if !ok {
+		return nil
+	}
+
+	longitude, ok := degrees(exif, gps[exifTagGPSLongitude])
+
+	if !ok {
+		return nil
+	}
+
+	result := &GPSPosition{Latitude: latitude, Longitude: longitude}
+
+	if exif.string(gps[exifTagGPSLatitudeRef]) == "S" {
+		result.Latitude = -result.Latitude
+	}
+
+	if exif.string(gps[exifTagGPSLongitudeRef]) == "W" {
+		result.Longitude = -result.Longitude
+	}
+
+	result.Altitude, _ = exif.rational(gps[exifTagGPSAltitude], 0)
+
+	if below, ok := exif.uint(gps[exifTagGPSAltitudeRef]); ok && below == 1 {
+		result.Altitude = -result.Altitude
+	}
+
+	return result
+}
+
+/*
+degrees reads a GPS coordinate stored as degrees, minutes, and seconds
+*/
+func degrees(exif *exifData, entry exifEntry) (float64, bool) {
+	d, ok := exif.rational(entry, 0)
+
+	if !ok {
+		return 0, false
+	}
+
+	m, _ := exif.rational(entry, 1)
+	s, _ := exif.rational(entry, 2)
+
+	return d + m/60 + s/3600, true
+}
+
+func parseExifTime(value, offset string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	if offset != "" {
+		if result, err := time.Parse("2006:01:02 15:04:05-07:00", value+offset); err == nil {
+			return result
+		}
+	}
+
+	result, _ := time.Parse("2006:01:02 15:04:05", value)
+	return result
+}
+
+/*
+exifOrientation returns the EXIF orientation of an image, from 1 to 8. 1
+is upright, and is also returned when there is no orientation.
+*/
+func exifOrientation(data []byte) int {
+	exif, err := parseExif(findExif(data))
+
+	if err != nil {
+		return 1
+	}
+
+	ifd0, err := exif.ifd(0)
+
+	if err != nil {
+		return 1
+	}
+
+	if orientation, ok := exif.uint(ifd0[exifTagOrientation]); ok && orientation >= 1 && orientation <= 8 {
+		return int(orientation)
+	}
+
+	return 1
+}
+
+/*
+StripMetadata removes EXIF, XMP, IPTC, comments, and other text metadata
+from a JPEG or PNG without re-encoding it, so there is no loss of quality.
+Only the orientation is kept, so the image still displays the right way
+up. Other formats return ErrUnsupportedFormat. Images written by the
+Resizer, the ImageCropper, and Encode never carry metadata, as only the
+pixels are encoded.
+*/
+func StripMetadata(data []byte) ([]byte, error) {
+	orientation := exifOrientation(data)
+
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		return stripJPEG(data, orientation), nil
+
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPNG(data, orientation), nil
+	}
+
+	return nil, fmt.Errorf("%w: metadata can only be stripped from JPEG and PNG", ErrUnsupportedFormat)
+}
+
+func stripJPEG(data []byte, orientation int) []byte {
+	result := bytes.NewBuffer(make([]byte, 0, len(data)))
+	result.Write(data[:2])
+
+	if orientation != 1 {
+		exif := append(append([]byte{}, exifHeader...), orientationExif(orientation)...)
+		result.Write([]byte{0xFF, 0xE1})
+		_ = binary.Write(result, binary.BigEndian, uint16(len(exif)+2))
+		result.Write(exif)
+	}
+
+	offset := 2
+
+	for _, segment := range jpegSegments(data) {
+		result.Write(data[offset:segment.start])
+		offset = segment.end
+
+		// APP1 holds EXIF and XMP, APP13 holds IPTC, and COM holds comments.
+		// Other segments, including the color profile in APP2, are needed to
+		// draw the image correctly.
+		if segment.marker == 0xE1 || segment.marker == 0xED || segment.marker == 0xFE {
+			continue
+		}
+
+		result.Write(data[segment.start:segment.end])
+	}
+
+	result.Write(data[offset:])
+	return result.Bytes()
+}
+
+func stripPNG(data []byte, orientation int) []byte {
+	result := bytes.NewBuffer(make([]byte, 0, len(data)))
+	result.Write(pngSignature)
+
+	for _, chunk := range pngChunks(data) {
+		switch chunk.kind {
+		case "eXIf", "tEXt", "iTXt", "zTXt", "tIME":
+			continue
+
+		case "IDAT":
+			if orientation != 1 {
+				writePNGChunk(result, "eXIf", orientationExif(orientation))
+				orientation = 1
+			}
+		}
+
+		result.Write(data[chunk.start:chunk.end])
+	}
+
+	return result.Bytes()
+}
+
+func writePNGChunk(w *bytes.Buffer, kind string, data []byte) {
+	_ = binary.Write(w, binary.BigEndian, uint32(len(data)))
+	w.WriteString(kind)
+	w.Write(data)
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(data)
+	_ = binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+/*
+orientationExif builds EXIF data holding nothing but an orientation
+*/
+func orientationExif(orientation int) []byte {
+	result := []byte("MM\x00*\x00\x00\x00\x08\x00\x01")
+	result = append(result, 0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01)
+	result = append(result, 0x00, byte(orientation), 0x00, 0x00)
+	return append(result, 0x00, 0x00, 0x00, 0x00)
+}
+
+/*
+uprightExif returns a copy of EXIF data with its orientation set to 1
+*/
+func uprightExif(data []byte) []byte {
+	result := append([]byte{}, data...)
+	exif, err := parseExif(result)
+
+	if err != nil {
+		return result
+	}
+
+	ifd0, err := exif.ifd(0)
+
+	if err != nil {
+		return result
+	}
+
+	if entry, ok := ifd0[exifTagOrientation]; ok && entry.kind == 3 {
+		exif.order.PutUint16(result[entry.offset:], 1)
+	}
+
+	return result
+}
+
+/*
+insertExif adds EXIF data to an encoded JPEG or PNG that has none. Other
+formats, and EXIF data too large for a JPEG segment, are left out.
+*/
+func insertExif(data, exif []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		payload := append(append([]byte{}, exifHeader...), exif...)
+
+		if len(payload)+2 > 0xFFFF {
+			return data
+		}
+
+		result := bytes.NewBuffer(make([]byte, 0, len(data)+len(payload)+4))
+		result.Write(data[:2])
+		result.Write([]byte{0xFF, 0xE1})
+		_ = binary.Write(result, binary.BigEndian, uint16(len(payload)+2))
+		result.Write(payload)
+		result.Write(data[2:])
+
+		return result.Bytes()
+
+	case bytes.HasPrefix(data, pngSignature):
+		result := bytes.NewBuffer(make([]byte, 0, len(data)+len(exif)+12))
+		result.Write(pngSignature)
+		inserted := false
+
+		for _, chunk := range pngChunks(data) {
+			if chunk.kind == "IDAT" && !inserted {
+				writePNGChunk(result, "eXIf", exif)
+				inserted = true
+			}
+
+			result.Write(data[chunk.start:chunk.end])
+		}
+
+		return result.Bytes()
+	}
+
+	return data
+}
@@ -0,0 +1,177 @@
+package images_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/images"
+)
+
+/*
+newPhoneJPEG returns a 40x20 JPEG, red on the left and blue on the right,
+with EXIF data saying it must be turned a quarter turn clockwise, and
+that it was taken by an Apple camera at 40.5N 73.25W
+*/
+func newPhoneJPEG(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			if x < 20 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+
+	encoded := &bytes.Buffer{}
+	_ = jpeg.Encode(encoded, img, &jpeg.Options{Quality: 100})
+
+	exif := &bytes.Buffer{}
+	write := func(values ...interface{}) {
+		for _, value := range values {
+			_ = binary.Write(exif, binary.BigEndian, value)
+		}
+	}
+
+	exif.WriteString("MM\x00*")
+	write(uint32(8))
+	write(uint16(3))
+	write(uint16(0x010F), uint16(2), uint32(6), uint32(50))
+	write(uint16(0x0112), uint16(3), uint32(1), uint16(6), uint16(0))
+	write(uint16(0x8825), uint16(4), uint32(1), uint32(56))
+	write(uint32(0))
+	exif.WriteString("Apple\x00")
+	write(uint16(4))
+	write(uint16(1), uint16(2), uint32(2), []byte("N\x00\x00\x00"))
+	write(uint16(2), uint16(5), uint32(3), uint32(110))
+	write(uint16(3), uint16(2), uint32(2), []byte("W\x00\x00\x00"))
+	write(uint16(4), uint16(5), uint32(3), uint32(134))
+	write(uint32(0))
+	write(uint32(40), uint32(1), uint32(30), uint32(1), uint32(0), uint32(1))
+	write(uint32(73), uint32(1), uint32(15), uint32(1), uint32(0), uint32(1))
+
+	result := &bytes.Buffer{}
+	result.Write(encoded.Bytes()[:2])
+	write = func(values ...interface{}) {
+		for _, value := range values {
+			_ = binary.Write(result, binary.BigEndian, value)
+		}
+	}
+
+	write(uint16(0xFFE1), uint16(exif.Len()+8))
+	result.WriteString("Exif\x00\x00")
+	result.Write(exif.Bytes())
+	result.Write(encoded.Bytes()[2:])
+
+	return result.Bytes()
+}
+
+func TestReadMetadata(t *testing.T) {
+	metadata, err := images.ReadMetadata(bytes.NewReader(newPhoneJPEG(t)))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if metadata.Width != 20 || metadata.Height != 40 || metadata.Orientation != 6 {
+		t.Errorf("expected a 20x40 image with orientation 6 but got %dx%d with %d", metadata.Width, metadata.Height, metadata.Orientation)
+	}
+
+	if metadata.Make != "Apple" || metadata.Format != images.FormatJPEG {
+		t.Errorf("expected an Apple JPEG but got %s %s", metadata.Make, metadata.Format)
+	}
+
+	if metadata.GPS == nil || metadata.GPS.Latitude != 40.5 || metadata.GPS.Longitude != -73.25 {
+		t.Errorf("expected 40.5, -73.25 but got %+v", metadata.GPS)
+	}
+}
+
+func TestResizer_AutoOrientsAndStripsMetadata(t *testing.T) {
+	resized, err := images.Resizer{}.ResizeImagePixelsAs(bytes.NewReader(newPhoneJPEG(t)), 10, 20, images.EncodeOptions{Format: images.FormatPNG})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	img, _ := png.Decode(bytes.NewReader(resized.Bytes()))
+
+	if r, _, b, _ := img.At(5, 2).RGBA(); r>>8 < 200 || b>>8 > 50 {
+		t.Errorf("expected the top to be red after turning but got r=%d b=%d", r>>8, b>>8)
+	}
+
+	if r, _, b, _ := img.At(5, 17).RGBA(); b>>8 < 200 || r>>8 > 50 {
+		t.Errorf("expected the bottom to be blue after turning but got r=%d b=%d", r>>8, b>>8)
+	}
+
+	if metadata, _ := images.ReadMetadata(bytes.NewReader(resized.Bytes())); metadata.GPS != nil || metadata.Orientation != 1 {
+		t.Errorf("expected no metadata in the resized image but got %+v", metadata)
+	}
+}
+
+func TestReadMetadata_RefusesLargeFiles(t *testing.T) {
+	oversized := io.MultiReader(
+		bytes.NewReader(newPhoneJPEG(t)),
+		io.LimitReader(zeroReader{}, images.DefaultImageLimits.MaxFileSize),
+	)
+
+	if _, err := images.ReadMetadata(oversized); !errors.Is(err, images.ErrFileTooLarge) {
+		t.Errorf("expected ErrFileTooLarge but got %v", err)
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	for index := range b {
+		b[index] = 0
+	}
+
+	return len(b), nil
+}
+
+func TestStripMetadata(t *testing.T) {
+	stripped, err := images.StripMetadata(newPhoneJPEG(t))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	metadata, err := images.ReadMetadata(bytes.NewReader(stripped))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if metadata.GPS != nil || metadata.Make != "" {
+		t.Errorf("expected the GPS position and camera to be gone but got %+v", metadata)
+	}
+
+	if metadata.Orientation != 6 {
+		t.Errorf("expected the orientation to be kept but got %d", metadata.Orientation)
+	}
+}
+
+func TestResizer_KeepMetadata(t *testing.T) {
+	resized, err := images.Resizer{}.ResizeImagePixelsAs(bytes.NewReader(newPhoneJPEG(t)), 10, 20, images.EncodeOptions{KeepMetadata: true})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	metadata, _ := images.ReadMetadata(bytes.NewReader(resized.Bytes()))
+
+	if metadata.Make != "Apple" || metadata.GPS == nil || metadata.Orientation != 1 {
+		t.Errorf("expected the metadata to be kept with an upright orientation but got %+v", metadata)
+	}
+}
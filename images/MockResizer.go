@@ -10,8 +10,10 @@ import (
 )
 
 type MockResizer struct {
-	ResizeImageFunc       func(source io.ReadSeeker, contentType string, imageSize ImageSize) (*bytes.Buffer, error)
-	ResizeImagePixelsFunc func(source io.ReadSeeker, contentType string, width, height int) (*bytes.Buffer, error)
+	ResizeImageFunc         func(source io.ReadSeeker, contentType string, imageSize ImageSize) (*bytes.Buffer, error)
+	ResizeImageAsFunc       func(source io.ReadSeeker, imageSize ImageSize, options EncodeOptions) (*bytes.Buffer, error)
+	ResizeImagePixelsFunc   func(source io.ReadSeeker, contentType string, width, height int) (*bytes.Buffer, error)
+	ResizeImagePixelsAsFunc func(source io.ReadSeeker, width, height int, options EncodeOptions) (*bytes.Buffer, error)
 }
 
 func (m MockResizer) ResizeImage(source io.ReadSeeker, contentType string, imageSize ImageSize) (*bytes.Buffer, error) {
@@ -21,3 +23,11 @@ func (m MockResizer) ResizeImage(source io.ReadSeeker, contentType string, image
 func (m MockResizer) ResizeImagePixels(source io.ReadSeeker, contentType string, width, height int) (*bytes.Buffer, error) {
 	return m.ResizeImagePixelsFunc(source, contentType, width, height)
 }
+
+func (m MockResizer) ResizeImageAs(source io.ReadSeeker, imageSize ImageSize, options EncodeOptions) (*bytes.Buffer, error) {
+	return m.ResizeImageAsFunc(source, imageSize, options)
+}
+
+func (m MockResizer) ResizeImagePixelsAs(source io.ReadSeeker, width, height int, options EncodeOptions) (*bytes.Buffer, error) {
+	return m.ResizeImagePixelsAsFunc(source, width, height, options)
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"image"
+	"image/draw"
+)
+
+/*
+Orient turns an image the right way up, given its EXIF orientation from 1
+to 8. Phone cameras store photos as the sensor saw them, and record how
+the phone was held in the orientation tag. Images are oriented when they
+are read, so the Resizer and ImageCropper never need this, but it is
+useful for images decoded elsewhere.
+*/
+func Orient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return flipHorizontal(img)
+
+	case 3:
+		return rotate180(img)
+
+	case 4:
+		return flipVertical(img)
+
+	case 5:
+		return transpose(img)
+
+	case 6:
+		return rotate90(img)
+
+	case 7:
+		return transverse(img)
+
+	case 8:
+		return rotate270(img)
+	}
+
+	return img
+}
+
+func flipHorizontal(img image.Image) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return remap(img, w, h, func(x, y int) (int, int) { return w - 1 - x, y })
+}
+
+func flipVertical(img image.Image) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return remap(img, w, h, func(x, y int) (int, int) { return x, h - 1 - y })
+}
+
+func rotate180(img image.Image) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return remap(img, w, h, func(x, y int) (int, int) { return w - 1 - x, h - 1 - y })
+}
+
+/*
+rotate90 turns an image a quarter turn clockwise
+*/
+func rotate90(img image.Image) *image.NRGBA {
+	h := img.Bounds().Dy()
+	return remap(img, h, img.Bounds().Dx(), func(x, y int) (int, int) { return y, h - 1 - x })
+}
+
+/*
+rotate270 turns an image a quarter turn counterclockwise
+*/
+func rotate270(img image.Image) *image.NRGBA {
+	w := img.Bounds().Dx()
+	return remap(img, img.Bounds().Dy(), w, func(x, y int) (int, int) { return w - 1 - y, x })
+}
+
+/*
+transpose mirrors an image across the diagonal from its top left corner
+*/
+func transpose(img image.Image) *image.NRGBA {
+	return remap(img, img.Bounds().Dy(), img.Bounds().Dx(), func(x, y int) (int, int) { return y, x })
+}
+
+/*
+transverse mirrors an image across the diagonal from its top right corner
+*/
+func transverse(img image.Image) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return remap(img, h, w, func(x, y int) (int, int) { return w - 1 - y, h - 1 - x })
+}
+
+/*
+remap builds a width by height image, where the pixel at x, y is copied
+from the source pixel that source returns
+*/
+func remap(img image.Image, width, height int, source func(x, y int) (int, int)) *image.NRGBA {
+	src := toNRGBA(img)
+	result := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sx, sy := source(x, y)
+			from := src.PixOffset(sx, sy)
+			to := result.PixOffset(x, y)
+			copy(result.Pix[to:to+4], src.Pix[from:from+4])
+		}
+	}
+
+	return result
+}
+
+/*
+toNRGBA returns img as an *image.NRGBA whose bounds start at 0, 0,
+converting it when it is anything else
+*/
+func toNRGBA(img image.Image) *image.NRGBA {
+	if nrgba, ok := img.(*image.NRGBA); ok && nrgba.Bounds().Min == (image.Point{}) {
+		return nrgba
+	}
+
+	bounds := img.Bounds()
+	result := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(result, result.Bounds(), img, bounds.Min, draw.Src)
+
+	return result
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+/*
+Operation is one step in a Pipeline. Apply returns the transformed image,
+and must not change the image it is given.
+*/
+type Operation interface {
+	Apply(img image.Image) (image.Image, error)
+}
+
+/*
+OperationFunc adapts a function into an Operation
+*/
+type OperationFunc func(img image.Image) (image.Image, error)
+
+func (f OperationFunc) Apply(img image.Image) (image.Image, error) {
+	return f(img)
+}
+
+/*
+Pipeline is a list of operations applied to an image in order. Unlike
+calling the Resizer and ImageCropper one after the other, a pipeline
+decodes the image once, runs every operation on the decoded pixels, and
+encodes once, so quality is only lost a single time. Every frame of an
+animated GIF goes through the whole pipeline.
+
+Methods that add an operation return the pipeline, so they can be
+chained.
+
+	output, err := images.NewPipeline().
+		Resize(images.ResizeOptions{Width: 400, Height: 400, Mode: images.FitCover, SmartCrop: true}).
+		Sharpen(1, 0.5).
+		Output(images.EncodeOptions{Format: images.FormatJPEG, Quality: 85}).
+		Process(file)
+*/
+type Pipeline struct {
+	limits     ImageLimits
+	operations []Operation
+	output     EncodeOptions
+}
+
+/*
+NewPipeline creates an empty pipeline
+*/
+func NewPipeline() *Pipeline {
+	return &Pipeline{}
+}
+
+/*
+Then adds any operation to the pipeline
+*/
+func (p *Pipeline) Then(operation Operation) *Pipeline {
+	p.operations = append(p.operations, operation)
+	return p
+}
+
+/*
+Resize scales the image as described by options
+*/
+func (p *Pipeline) Resize(options ResizeOptions) *Pipeline {
+	return p.Then(OperationFunc(func(img image.Image) (image.Image, error) {
+		return resizeImage(img, options)
+	}))
+}
+
+/*
+Crop cuts out part of the image, just like ImageCropper. The Output in
+options is ignored. Use Output on the pipeline instead.
+*/
+func (p *Pipeline) Crop(options CropOptions) *Pipeline {
+	return p.Then(OperationFunc(func(img image.Image) (image.Image, error) {
+		return cropImage(img, options)
+	}))
+}
+
+/*
+Rotate turns the image clockwise by the given number of degrees. Quarter
+turns are exact. Other angles make the image larger to fit the turned
+corners, and fill the space around them with transparency.
+*/
+func (p *Pipeline) Rotate(degrees float64) *Pipeline {
+	return p.Then(OperationFunc(func(img image.Image) (image.Image, error) {
+		return rotate(img, degrees), nil
+	}))
+}
+
+/*
+FlipHorizontal mirrors the image left to right
+*/
+func (p *Pipeline) FlipHorizontal() *Pipeline {
+	return p.Then(OperationFunc(func(img image.Image) (image.Image, error) {
+		return flipHorizontal(img), nil
+	}))
+}
+
+/*
+FlipVertical mirrors the image top to bottom
+*/
+func (p *Pipeline) FlipVertical() *Pipeline {
+	return p.Then(OperationFunc(func(img image.Image) (image.Image, error) {
+		return flipVertical(img), nil
+	}))
+}
+
+/*
+Blur applies a Gaussian blur. Sigma is the blur radius in pixels.
+*/
+func (p *Pipeline) Blur(sigma float64) *Pipeline {
+	return p.Then(OperationFunc(func(img image.Image) (image.Image, error) {
+		return blur(img, sigma), nil
+	}))
+}
+
+/*
+Sharpen applies an unsharp mask. Sigma is the radius of the detail to
+bring out, in pixels, and amount is how strongly, where 1 doubles the
+contrast of edges.
+*/
+func (p *Pipeline) Sharpen(sigma, amount float64) *Pipeline {
+	return p.Then(OperationFunc(func(img image.Image) (image.Image, error) {
+		return sharpen(img, sigma, amount), nil
+	}))
+}
+
+/*
+Grayscale removes the color from the image, keeping its transparency
+*/
+func (p *Pipeline) Grayscale() *Pipeline {
+	return p.Then(OperationFunc(func(img image.Image) (image.Image, error) {
+		return grayscale(img), nil
+	}))
+}
+
+/*
+Background fills transparent areas with a color, leaving an opaque image.
+Use it before writing an image with transparency as JPEG, which would
+otherwise turn transparent areas black.
+*/
+func (p *Pipeline) Background(c color.Color) *Pipeline {
+	return p.Then(OperationFunc(func(img image.Image) (image.Image, error) {
+		return background(img, c), nil
+	}))
+}
+
+/*
+Watermark draws a logo or text over the image, as described by options
+*/
+func (p *Pipeline) Watermark(options WatermarkOptions) *Pipeline {
+	return p.Then(OperationFunc(func(img image.Image) (image.Image, error) {
+		return watermark(img, options)
+	}))
+}
+
+/*
+Limits sets the largest image Process will decode. DefaultImageLimits
+are used otherwise.
+*/
+func (p *Pipeline) Limits(limits ImageLimits) *Pipeline {
+	p.limits = limits
+	return p
+}
+
+/*
+Output sets how Process encodes the result
+*/
+func (p *Pipeline) Output(options EncodeOptions) *Pipeline {
+	p.output = options
+	return p
+}
+
+/*
+Apply runs every operation on an image that is already decoded
+*/
+func (p *Pipeline) Apply(img image.Image) (image.Image, error) {
+	var err error
+
+	for _, operation := range p.operations {
+		if img, err = operation.Apply(img); err != nil {
+			return nil, err
+		}
+	}
+
+	return img, nil
+}
+
+/*
+Process reads an image, runs it through the pipeline, and encodes the
+result
+*/
+func (p *Pipeline) Process(source io.Reader) (*bytes.Buffer, error) {
+	data, err := io.ReadAll(io.LimitReader(source, p.limits.withDefaults().MaxFileSize+1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := decode(data, p.limits)
+
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding image in pipeline: %w", err)
+	}
+
+	if err = decoded.transform(p.Apply); err != nil {
+		return nil, err
+	}
+
+	return decoded.encode(p.output)
+}
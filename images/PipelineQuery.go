@@ -0,0 +1,248 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"encoding/hex"
+	"fmt"
+	"image/color"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxPipelineDimension is the largest width or height ParsePipeline accepts
+	MaxPipelineDimension = 8192
+
+	// MaxPipelineSigma is the largest blur or sharpen radius ParsePipeline accepts
+	MaxPipelineSigma = 100
+)
+
+/*
+ParsePipeline builds a pipeline from a URL query string, so image
+transformations can be described in a link. These parameters are read.
+All are optional.
+
+	w, h       width and height to resize to, up to MaxPipelineDimension
+	fit        contain (the default), fill, or cover
+	focus      with fit=cover, the point to keep as "x,y" from 0 to 1, or "smart"
+	rotate     degrees to turn clockwise
+	flip       h, v, or hv
+	blur       Gaussian blur radius in pixels
+	sharpen    unsharp mask as "sigma" or "sigma,amount". Amount defaults to 1
+	grayscale  true to remove color
+	bg         background color for transparent areas as hex, such as "fff" or "ffffff"
+	format     output format, such as jpeg or png
+	quality    output quality from 1 to 100
+
+However the parameters are ordered, operations run in this order:
+rotate, flip, resize, blur, sharpen, grayscale, then background. Any bad
+value returns an error wrapping ErrInvalidPipeline.
+
+	pipeline, err := images.ParsePipeline(r.URL.Query())
+*/
+func ParsePipeline(query url.Values) (*Pipeline, error) {
+	var (
+		err     error
+		resize  ResizeOptions
+		degrees float64
+		sigma   float64
+	)
+
+	p := NewPipeline()
+
+	if degrees, err = parseFloatParam(query, "rotate", -360, 360); err != nil {
+		return nil, err
+	}
+
+	if degrees != 0 {
+		p.Rotate(degrees)
+	}
+
+	switch flip := query.Get("flip"); flip {
+	case "":
+	case "h":
+		p.FlipHorizontal()
+	case "v":
+		p.FlipVertical()
+	case "hv", "vh":
+		p.FlipHorizontal().FlipVertical()
+	default:
+		return nil, fmt.Errorf("%w: flip must be h, v, or hv, not %q", ErrInvalidPipeline, flip)
+	}
+
+	if resize.Width, err = parseIntParam(query, "w", 0, MaxPipelineDimension); err != nil {
+		return nil, err
+	}
+
+	if resize.Height, err = parseIntParam(query, "h", 0, MaxPipelineDimension); err != nil {
+		return nil, err
+	}
+
+	switch fit := FitMode(query.Get("fit")); fit {
+	case "", FitContain, FitFill, FitCover:
+		resize.Mode = fit
+	default:
+		return nil, fmt.Errorf("%w: fit must be contain, fill, or cover, not %q", ErrInvalidPipeline, fit)
+	}
+
+	if focus := query.Get("focus"); focus == "smart" {
+		resize.SmartCrop = true
+	} else if focus != "" {
+		if resize.FocalPoint, err = parseFocalPoint(focus); err != nil {
+			return nil, err
+		}
+	}
+
+	if resize.Width > 0 || resize.Height > 0 {
+		p.Resize(resize)
+	}
+
+	if sigma, err = parseFloatParam(query, "blur", 0, MaxPipelineSigma); err != nil {
+		return nil, err
+	}
+
+	if sigma > 0 {
+		p.Blur(sigma)
+	}
+
+	if value := query.Get("sharpen"); value != "" {
+		sigma, amount, err := parseSharpen(value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		p.Sharpen(sigma, amount)
+	}
+
+	if value := query.Get("grayscale"); value != "" {
+		grayscale, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: grayscale must be true or false, not %q", ErrInvalidPipeline, value)
+		}
+
+		if grayscale {
+			p.Grayscale()
+		}
+	}
+
+	if value := query.Get("bg"); value != "" {
+		c, err := parseHexColor(value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		p.Background(c)
+	}
+
+	if value := query.Get("format"); value != "" {
+		format := ImageFormat(strings.ToLower(value))
+
+		if format == "jpg" {
+			format = FormatJPEG
+		}
+
+		if !CanEncode(format) {
+			return nil, fmt.Errorf("%w: there is no encoder for format %q", ErrInvalidPipeline, value)
+		}
+
+		p.output.Format = format
+	}
+
+	if p.output.Quality, err = parseIntParam(query, "quality", 1, 100); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func parseIntParam(query url.Values, name string, min, max int) (int, error) {
+	value := query.Get(name)
+
+	if value == "" {
+		return 0, nil
+	}
+
+	result, err := strconv.Atoi(value)
+
+	if err != nil || result < min || result > max {
+		return 0, fmt.Errorf("%w: %s must be a whole number from %d to %d, not %q", ErrInvalidPipeline, name, min, max, value)
+	}
+
+	return result, nil
+}
+
+func parseFloatParam(query url.Values, name string, min, max float64) (float64, error) {
+	value := query.Get(name)
+
+	if value == "" {
+		return 0, nil
+	}
+
+	result, err := strconv.ParseFloat(value, 64)
+
+	if err != nil || math.IsNaN(result) || result < min || result > max {
+		return 0, fmt.Errorf("%w: %s must be a number from %g to %g, not %q", ErrInvalidPipeline, name, min, max, value)
+	}
+
+	return result, nil
+}
+
+func parseFocalPoint(value string) (*FocalPoint, error) {
+	parts := strings.Split(value, ",")
+
+	if len(parts) == 2 {
+		x, xErr := strconv.ParseFloat(parts[0], 64)
+		y, yErr := strconv.ParseFloat(parts[1], 64)
+
+		if xErr == nil && yErr == nil && x >= 0 && x <= 1 && y >= 0 && y <= 1 {
+			return &FocalPoint{X: x, Y: y}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: focus must be \"x,y\" from 0 to 1, or \"smart\", not %q", ErrInvalidPipeline, value)
+}
+
+func parseSharpen(value string) (float64, float64, error) {
+	parts := strings.Split(value, ",")
+	amount := 1.0
+
+	sigma, err := strconv.ParseFloat(parts[0], 64)
+
+	if err == nil && len(parts) == 2 {
+		amount, err = strconv.ParseFloat(parts[1], 64)
+	}
+
+	if err != nil || len(parts) > 2 || !(sigma > 0 && sigma <= MaxPipelineSigma) || !(amount > 0 && amount <= 10) {
+		return 0, 0, fmt.Errorf("%w: sharpen must be \"sigma\" or \"sigma,amount\", not %q", ErrInvalidPipeline, value)
+	}
+
+	return sigma, amount, nil
+}
+
+/*
+parseHexColor reads a color written as 3 or 6 hex digits, with or without
+a leading #
+*/
+func parseHexColor(value string) (color.Color, error) {
+	digits := strings.TrimPrefix(value, "#")
+
+	if len(digits) == 3 {
+		digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+	}
+
+	rgb, err := hex.DecodeString(digits)
+
+	if err != nil || len(rgb) != 3 {
+		return nil, fmt.Errorf("%w: bg must be a hex color, not %q", ErrInvalidPipeline, value)
+	}
+
+	return color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 255}, nil
+}
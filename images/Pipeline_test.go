@@ -0,0 +1,112 @@
+package images_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/url"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/images"
+)
+
+func TestPipeline_CoverWithSmartCropKeepsTheDetail(t *testing.T) {
+	// A plain white image with a black and white checkerboard in the right third
+	img := newTestImage(300, 100, color.White)
+
+	for y := 0; y < 100; y++ {
+		for x := 200; x < 300; x++ {
+			if (x/5+y/5)%2 == 0 {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	result, err := images.NewPipeline().
+		Resize(images.ResizeOptions{Width: 50, Height: 50, Mode: images.FitCover, SmartCrop: true}).
+		Apply(img)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if result.Bounds().Dx() != 50 || result.Bounds().Dy() != 50 {
+		t.Errorf("expected 50x50 but got %v", result.Bounds())
+	}
+
+	var dark int
+
+	for y := 0; y < 50; y++ {
+		for x := 0; x < 50; x++ {
+			if r, _, _, _ := result.At(x, y).RGBA(); r < 0x8000 {
+				dark++
+			}
+		}
+	}
+
+	if dark < 500 {
+		t.Errorf("expected the crop to contain the checkerboard but got %d dark pixels", dark)
+	}
+}
+
+func TestPipeline_Process(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	source := &bytes.Buffer{}
+	_ = png.Encode(source, img)
+
+	query, _ := url.ParseQuery("w=10&rotate=90&bg=f00&format=png")
+	pipeline, err := images.ParsePipeline(query)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	output, err := pipeline.Process(source)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err := png.Decode(output)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Rotated first, so 20x40 scaled to 10x20
+	if result.Bounds().Dx() != 10 || result.Bounds().Dy() != 20 {
+		t.Errorf("expected 10x20 but got %v", result.Bounds())
+	}
+
+	if r, g, _, a := result.At(5, 10).RGBA(); r != 0xffff || g != 0 || a != 0xffff {
+		t.Errorf("expected an opaque red background but got %d, %d, %d", r, g, a)
+	}
+}
+
+func TestParsePipeline_RejectsBadValues(t *testing.T) {
+	for _, raw := range []string{"w=-1", "w=100000", "fit=squash", "focus=2,0", "flip=x", "quality=101", "bg=zzz", "format=avif", "sharpen=1,2,3"} {
+		query, _ := url.ParseQuery(raw)
+
+		if _, err := images.ParsePipeline(query); !errors.Is(err, images.ErrInvalidPipeline) {
+			t.Errorf("expected ErrInvalidPipeline for %s but got %v", raw, err)
+		}
+	}
+}
+
+func TestPipeline_RotateArbitraryAngle(t *testing.T) {
+	result, err := images.NewPipeline().Rotate(45).Apply(newTestImage(10, 10, color.White))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if result.Bounds().Dx() != 15 || result.Bounds().Dy() != 15 {
+		t.Errorf("expected 15x15 but got %v", result.Bounds())
+	}
+
+	if _, _, _, a := result.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("expected a transparent corner but got alpha %d", a)
+	}
+}
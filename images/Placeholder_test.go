@@ -0,0 +1,101 @@
+package images_test
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/images"
+)
+
+func newHalvesImage(width, height int, left, right color.Color) *image.RGBA {
+	img := newTestImage(width, height, left)
+
+	for y := 0; y < height; y++ {
+		for x := width / 2; x < width; x++ {
+			img.Set(x, y, right)
+		}
+	}
+
+	return img
+}
+
+func TestBlurHash_RoundTrip(t *testing.T) {
+	img := newHalvesImage(80, 60, color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255})
+	hash, err := images.EncodeBlurHash(img, 4, 3)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(hash) != 28 {
+		t.Errorf("expected a 28 character hash but got %q", hash)
+	}
+
+	decoded, err := images.DecodeBlurHash(hash, 32, 24, 1)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if r, _, b, _ := decoded.At(2, 12).RGBA(); r <= b {
+		t.Errorf("expected the left to be red but got r=%d b=%d", r, b)
+	}
+
+	if r, _, b, _ := decoded.At(29, 12).RGBA(); b <= r {
+		t.Errorf("expected the right to be blue but got r=%d b=%d", r, b)
+	}
+
+	if _, err = images.DecodeBlurHash("LKO2?U%2Tw=w", 32, 32, 1); !errors.Is(err, images.ErrInvalidBlurHash) {
+		t.Errorf("expected ErrInvalidBlurHash but got %v", err)
+	}
+}
+
+func TestThumbHash_RoundTrip(t *testing.T) {
+	img := newHalvesImage(200, 100, color.RGBA{R: 255, A: 255}, color.RGBA{})
+	hash := images.EncodeThumbHash(img)
+
+	decoded, err := images.DecodeThumbHash(hash)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The aspect ratio is only kept roughly
+	if decoded.Bounds().Dx() != 32 || decoded.Bounds().Dy() >= 24 {
+		t.Errorf("expected a 32 pixel wide landscape image but got %v", decoded.Bounds())
+	}
+
+	if _, _, _, a := decoded.At(2, 8).RGBA(); a < 0xc000 {
+		t.Errorf("expected the left to be opaque but got alpha %d", a)
+	}
+
+	if _, _, _, a := decoded.At(29, 8).RGBA(); a > 0x4000 {
+		t.Errorf("expected the right to be transparent but got alpha %d", a)
+	}
+}
+
+func TestExtractPalette(t *testing.T) {
+	img := newHalvesImage(100, 100, color.RGBA{R: 200, G: 30, B: 30, A: 255}, color.RGBA{G: 180, A: 255})
+
+	for y := 0; y < 100; y++ {
+		for x := 80; x < 100; x++ {
+			img.Set(x, y, color.RGBA{R: 200, G: 30, B: 30, A: 255})
+		}
+	}
+
+	palette := images.ExtractPalette(img, 2)
+
+	if len(palette) != 2 {
+		t.Fatalf("expected 2 colors but got %+v", palette)
+	}
+
+	if red := palette[0].Color; red.R < 180 || red.G > 60 || palette[0].Share < 0.65 || palette[0].Share > 0.75 {
+		t.Errorf("expected red to cover about 70%% but got %s at %f", palette[0].Hex(), palette[0].Share)
+	}
+
+	if dominant := images.DominantColor(img); dominant.R < 180 || dominant.G > 60 {
+		t.Errorf("expected the dominant color to be red but got %v", dominant)
+	}
+}
@@ -6,11 +6,9 @@ package images
 
 import (
 	"bytes"
+	"fmt"
 	"image"
-	"image/jpeg"
-	"image/png"
 	"io"
-	"strings"
 
 	"github.com/nfnt/resize"
 )
@@ -24,33 +22,59 @@ type IResizer interface {
 }
 
 /*
-A Resizer contains methods for resizing images and re-encoding them.
+IFormatResizer is an interface to describe structs that resize images
+and encode them as described by EncodeOptions
 */
-type Resizer struct{}
+type IFormatResizer interface {
+	ResizeImageAs(source io.ReadSeeker, imageSize ImageSize, options EncodeOptions) (*bytes.Buffer, error)
+	ResizeImagePixelsAs(source io.ReadSeeker, width, height int, options EncodeOptions) (*bytes.Buffer, error)
+}
+
+/*
+A Resizer contains methods for resizing images and re-encoding them. It
+reads JPEG, PNG, GIF, WebP, BMP, and TIFF images. Animated GIFs are
+resized frame by frame, and keep their timing when written back out as
+GIF. Images over Limits are refused before they are decoded.
+*/
+type Resizer struct {
+	Limits ImageLimits
+}
 
 /*
 ResizeImage takes a source image, content type (MIME), and a image size (
-THUMBNAIL, SMALL, MEDIUM, LARGE) and resizes proportionally.
+THUMBNAIL, SMALL, MEDIUM, LARGE) and resizes proportionally. The result is
+encoded in the format named by the content type. ErrUnsupportedFormat is
+returned when that format can't be written. Use ResizeImageAs to pick
+another format.
 */
 func (r Resizer) ResizeImage(source io.ReadSeeker, contentType string, imageSize ImageSize) (*bytes.Buffer, error) {
+	options, err := r.optionsFromContentType(contentType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.ResizeImageAs(source, imageSize, options)
+}
+
+/*
+ResizeImageAs resizes proportionally, like ResizeImage, and encodes the
+result as described by options. The source format is worked out from the
+image itself.
+*/
+func (r Resizer) ResizeImageAs(source io.ReadSeeker, imageSize ImageSize, options EncodeOptions) (*bytes.Buffer, error) {
 	var (
 		err         error
 		result      *bytes.Buffer
-		sourceImage image.Image
+		sourceImage *decodedImage
 	)
 
-	if !r.isValidImageFormat(contentType) {
-		return result, ErrInvalidFileType
-	}
-
-	source.Seek(0, 0)
-
 	if sourceImage, err = r.readSourceImage(source); err != nil {
 		return result, err
 	}
 
-	sourceHeight := sourceImage.Bounds().Max.Y - sourceImage.Bounds().Min.Y
-	sourceWidth := sourceImage.Bounds().Max.X - sourceImage.Bounds().Min.Y
+	sourceHeight := sourceImage.image.Bounds().Dy()
+	sourceWidth := sourceImage.image.Bounds().Dx()
 
 	adjustedHeight := r.calculateHeight(sourceHeight, imageSize)
 	adjustedWidth := r.calculateWidth(sourceWidth, imageSize)
@@ -63,55 +87,81 @@ func (r Resizer) ResizeImage(source io.ReadSeeker, contentType string, imageSize
 	newHeight := r.calculateNewHeight(sourceHeight, percent)
 	newWidth := r.calculateNewWidth(sourceWidth, percent)
 
-	return r.resizeImage(sourceImage, contentType, newWidth, newHeight)
+	return r.resizeImage(sourceImage, newWidth, newHeight, options)
 }
 
 /*
 ResizeImagePixels resizes a source image to the specified widthxheight.
 */
 func (r Resizer) ResizeImagePixels(source io.ReadSeeker, contentType string, width, height int) (*bytes.Buffer, error) {
+	options, err := r.optionsFromContentType(contentType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.ResizeImagePixelsAs(source, width, height, options)
+}
+
+/*
+ResizeImagePixelsAs resizes a source image to the specified widthxheight,
+and encodes the result as described by options.
+*/
+func (r Resizer) ResizeImagePixelsAs(source io.ReadSeeker, width, height int, options EncodeOptions) (*bytes.Buffer, error) {
 	var (
 		err         error
 		result      *bytes.Buffer
-		sourceImage image.Image
+		sourceImage *decodedImage
 	)
 
-	if !r.isValidImageFormat(contentType) {
-		return result, ErrInvalidFileType
+	if sourceImage, err = r.readSourceImage(source); err != nil {
+		return result, err
 	}
 
-	source.Seek(0, 0)
+	return r.resizeImage(sourceImage, width, height, options)
+}
 
-	if sourceImage, err = r.readSourceImage(source); err != nil {
-		return result, err
+func (r Resizer) resizeImage(sourceImage *decodedImage, width, height int, options EncodeOptions) (*bytes.Buffer, error) {
+	err := sourceImage.transform(func(img image.Image) (image.Image, error) {
+		return resize.Resize(uint(width), uint(height), img, resize.Lanczos3), nil
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
-	return r.resizeImage(sourceImage, contentType, width, height)
+	return sourceImage.encode(options)
 }
 
-func (r Resizer) resizeImage(sourceImage image.Image, contentType string, width, height int) (*bytes.Buffer, error) {
-	result := new(bytes.Buffer)
-	var err error
+func (r Resizer) readSourceImage(source io.ReadSeeker) (*decodedImage, error) {
+	if _, err := source.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
 
-	resizedImage := resize.Resize(uint(width), uint(height), sourceImage, resize.Lanczos3)
-	encoderType := r.getEncoderType(contentType)
+	data, err := io.ReadAll(io.LimitReader(source, r.Limits.withDefaults().MaxFileSize+1))
 
-	if encoderType == "jpg" {
-		err = jpeg.Encode(result, resizedImage, nil)
-		return result, err
+	if err != nil {
+		return nil, err
 	}
 
-	err = png.Encode(result, resizedImage)
-	return result, err
+	return decode(data, r.Limits)
 }
 
-func (r Resizer) readSourceImage(sourceImage io.Reader) (image.Image, error) {
-	decodedImage, _, err := image.Decode(sourceImage)
+/*
+optionsFromContentType picks the output format named by a content type
+*/
+func (r Resizer) optionsFromContentType(contentType string) (EncodeOptions, error) {
+	format, err := FormatFromContentType(contentType)
+
 	if err != nil {
-		return nil, err
+		return EncodeOptions{}, err
+	}
+
+	if !CanEncode(format) {
+		return EncodeOptions{}, fmt.Errorf("%w: no encoder for %s", ErrUnsupportedFormat, format)
 	}
 
-	return decodedImage, nil
+	return EncodeOptions{Format: format}, nil
 }
 
 func (r Resizer) getMultiplierFromSize(imageSize ImageSize) float64 {
@@ -161,27 +211,3 @@ func (r Resizer) calculateNewHeight(originalHeight int, percentageChange float64
 func (r Resizer) calculateNewWidth(originalWidth int, percentageChange float64) int {
 	return int(float64(originalWidth) * percentageChange)
 }
-
-func (r Resizer) isValidImageFormat(contentType string) bool {
-	validMIMETypes := []string{
-		"jpg",
-		"jpeg",
-		"png",
-	}
-
-	for _, mimeType := range validMIMETypes {
-		if strings.Contains(contentType, mimeType) {
-			return true
-		}
-	}
-
-	return false
-}
-
-func (r Resizer) getEncoderType(contentType string) string {
-	if strings.Contains(contentType, "jpg") || strings.Contains(contentType, "jpeg") {
-		return "jpg"
-	}
-
-	return "png"
-}
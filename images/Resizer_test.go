@@ -0,0 +1,108 @@
+package images_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/images"
+	"golang.org/x/image/bmp"
+)
+
+func newTestImage(width, height int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+
+	return img
+}
+
+func TestFormatFromContentType(t *testing.T) {
+	if format, err := images.FormatFromContentType("image/webp; charset=binary"); err != nil || format != images.FormatWebP {
+		t.Errorf("expected webp but got %s, %v", format, err)
+	}
+
+	if _, err := images.FormatFromContentType("application/x-not-a-jpeg"); !errors.Is(err, images.ErrInvalidFileType) {
+		t.Errorf("expected ErrInvalidFileType but got %v", err)
+	}
+}
+
+func TestResizer_ResizesBMPToJPEG(t *testing.T) {
+	source := &bytes.Buffer{}
+	_ = bmp.Encode(source, newTestImage(40, 20, color.RGBA{R: 255, A: 255}))
+
+	resized, err := images.Resizer{}.ResizeImagePixelsAs(bytes.NewReader(source.Bytes()), 20, 10, images.EncodeOptions{
+		Format:  images.FormatJPEG,
+		Quality: 90,
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	config, err := jpeg.DecodeConfig(resized)
+
+	if err != nil || config.Width != 20 || config.Height != 10 {
+		t.Errorf("expected a 20x10 JPEG but got %+v, %v", config, err)
+	}
+}
+
+func TestResizer_RejectsContentTypesWithoutAnEncoder(t *testing.T) {
+	source := &bytes.Buffer{}
+	_ = bmp.Encode(source, newTestImage(40, 20, color.RGBA{R: 255, A: 255}))
+
+	if _, err := (images.Resizer{}).ResizeImagePixels(bytes.NewReader(source.Bytes()), "image/webp", 20, 10); !errors.Is(err, images.ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat but got %v", err)
+	}
+}
+
+func TestResizer_KeepsGIFAnimation(t *testing.T) {
+	palette := color.Palette{color.Black, color.White, color.RGBA{R: 255, A: 255}}
+	animation := &gif.GIF{LoopCount: 0}
+
+	for i, c := range []uint8{0, 1, 2} {
+		frame := image.NewPaletted(image.Rect(0, 0, 40, 40), palette)
+
+		for p := range frame.Pix {
+			frame.Pix[p] = c
+		}
+
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, 10*(i+1))
+	}
+
+	source := &bytes.Buffer{}
+	_ = gif.EncodeAll(source, animation)
+
+	resized, err := images.Resizer{}.ResizeImage(bytes.NewReader(source.Bytes()), "image/gif", images.SMALL)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err := gif.DecodeAll(resized)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(result.Image) != 3 || result.Delay[2] != 30 {
+		t.Fatalf("expected 3 frames with the original delays but got %d frames, %v", len(result.Image), result.Delay)
+	}
+
+	if bounds := result.Image[1].Bounds(); bounds.Dx() != 10 || bounds.Dy() != 10 {
+		t.Errorf("expected 10x10 frames but got %v", bounds)
+	}
+
+	if r, g, b, _ := result.Image[2].At(5, 5).RGBA(); r>>8 != 255 || g != 0 || b != 0 {
+		t.Errorf("expected the last frame to stay red but got %d, %d, %d", r>>8, g>>8, b>>8)
+	}
+}
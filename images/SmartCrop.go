@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"image"
+	"math"
+
+	"github.com/nfnt/resize"
+)
+
+/*
+smartCropSize is the size the image is shrunk to while looking for the
+best crop. Detail is judged on the small copy, which is much faster and
+just as good at finding the subject.
+*/
+const smartCropSize = 256
+
+/*
+smartCrop finds the width by height rectangle in img holding the most
+detail. Detail is measured as the strength of the edges in the image, so
+a sharp subject wins over a blurred background or a plain sky. Ties go
+to the rectangle nearest the center.
+*/
+func smartCrop(img image.Image, width, height int) image.Rectangle {
+	bounds := img.Bounds()
+	scale := math.Min(1, float64(smartCropSize)/float64(maxInt(bounds.Dx(), bounds.Dy())))
+	small := toNRGBA(resize.Resize(
+		uint(maxInt(1, int(float64(bounds.Dx())*scale))),
+		uint(maxInt(1, int(float64(bounds.Dy())*scale))),
+		img,
+		resize.Bilinear,
+	))
+
+	smallWidth, smallHeight := small.Bounds().Dx(), small.Bounds().Dy()
+	windowWidth := clampInt(int(math.Round(float64(width)*scale)), 1, smallWidth)
+	windowHeight := clampInt(int(math.Round(float64(height)*scale)), 1, smallHeight)
+
+	sums := edgeIntegral(small)
+	best, bestLeft, bestTop := -1.0, 0, 0
+	centerX, centerY := float64(smallWidth-windowWidth)/2, float64(smallHeight-windowHeight)/2
+
+	for top := 0; top <= smallHeight-windowHeight; top++ {
+		for left := 0; left <= smallWidth-windowWidth; left++ {
+			energy := sums[top+windowHeight][left+windowWidth] - sums[top][left+windowWidth] -
+				sums[top+windowHeight][left] + sums[top][left]
+
+			distance := math.Hypot(float64(left)-centerX, float64(top)-centerY) / float64(smallWidth+smallHeight)
+			score := energy * (1 - 0.25*distance)
+
+			if score > best {
+				best, bestLeft, bestTop = score, left, top
+			}
+		}
+	}
+
+	left := clampInt(int(math.Round(float64(bestLeft)/scale)), 0, bounds.Dx()-width)
+	top := clampInt(int(math.Round(float64(bestTop)/scale)), 0, bounds.Dy()-height)
+
+	return image.Rect(left, top, left+width, top+height).Add(bounds.Min)
+}
+
+/*
+edgeIntegral measures the edge strength at every pixel, and returns a
+summed area table of it, so the total in any rectangle takes four lookups
+*/
+func edgeIntegral(img *image.NRGBA) [][]float64 {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	luma := make([]float64, width*height)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := img.PixOffset(x, y)
+			alpha := float64(img.Pix[i+3]) / 255
+			luma[y*width+x] = (0.299*float64(img.Pix[i]) + 0.587*float64(img.Pix[i+1]) + 0.114*float64(img.Pix[i+2])) * alpha
+		}
+	}
+
+	sums := make([][]float64, height+1)
+
+	for y := range sums {
+		sums[y] = make([]float64, width+1)
+	}
+
+	for y := 0; y < height; y++ {
+		row := 0.0
+
+		for x := 0; x < width; x++ {
+			dx, dy := 0.0, 0.0
+
+			if x > 0 && x < width-1 {
+				dx = luma[y*width+x+1] - luma[y*width+x-1]
+			}
+
+			if y > 0 && y < height-1 {
+				dy = luma[(y+1)*width+x] - luma[(y-1)*width+x]
+			}
+
+			row += math.Hypot(dx, dy)
+			sums[y+1][x+1] = sums[y][x+1] + row
+		}
+	}
+
+	return sums
+}
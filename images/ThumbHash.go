@@ -0,0 +1,367 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"encoding/base64"
+	"fmt"
+	"image"
+	"math"
+)
+
+/*
+EncodeThumbHash returns a ThumbHash of img as base64. Like a BlurHash,
+it is a placeholder to show while the real image loads, but it keeps
+more detail, transparency, and the aspect ratio of the image.
+*/
+func EncodeThumbHash(img image.Image) string {
+	small := toNRGBA(shrink(img, 100))
+	width, height := small.Bounds().Dx(), small.Bounds().Dy()
+	count := width * height
+
+	// The average color, which transparent pixels are drawn over
+	var averageR, averageG, averageB, averageA float64
+
+	for i := 0; i < count; i++ {
+		alpha := float64(small.Pix[i*4+3]) / 255
+		averageR += alpha / 255 * float64(small.Pix[i*4])
+		averageG += alpha / 255 * float64(small.Pix[i*4+1])
+		averageB += alpha / 255 * float64(small.Pix[i*4+2])
+		averageA += alpha
+	}
+
+	if averageA > 0 {
+		averageR /= averageA
+		averageG /= averageA
+		averageB /= averageA
+	}
+
+	hasAlpha := averageA < float64(count)
+	limit := 7.0
+
+	if hasAlpha {
+		limit = 5
+	}
+
+	longest := float64(maxInt(width, height))
+	lx := maxInt(1, int(jsRound(limit*float64(width)/longest)))
+	ly := maxInt(1, int(jsRound(limit*float64(height)/longest)))
+
+	// Luminance, yellow to blue, red to green, and alpha
+	l := make([]float64, count)
+	p := make([]float64, count)
+	q := make([]float64, count)
+	a := make([]float64, count)
+
+	for i := 0; i < count; i++ {
+		alpha := float64(small.Pix[i*4+3]) / 255
+		r := averageR*(1-alpha) + alpha/255*float64(small.Pix[i*4])
+		g := averageG*(1-alpha) + alpha/255*float64(small.Pix[i*4+1])
+		b := averageB*(1-alpha) + alpha/255*float64(small.Pix[i*4+2])
+
+		l[i] = (r + g + b) / 3
+		p[i] = (r+g)/2 - b
+		q[i] = r - g
+		a[i] = alpha
+	}
+
+	encodeChannel := func(channel []float64, nx, ny int) (float64, []float64, float64) {
+		var (
+			dc    float64
+			ac    []float64
+			scale float64
+		)
+
+		fx := make([]float64, width)
+
+		for cy := 0; cy < ny; cy++ {
+			for cx := 0; cx*ny < nx*(ny-cy); cx++ {
+				f := 0.0
+
+				for x := 0; x < width; x++ {
+					fx[x] = math.Cos(math.Pi / float64(width) * float64(cx) * (float64(x) + 0.5))
+				}
+
+				for y := 0; y < height; y++ {
+					fy := math.Cos(math.Pi / float64(height) * float64(cy) * (float64(y) + 0.5))
+
+					for x := 0; x < width; x++ {
+						f += channel[x+y*width] * fx[x] * fy
+					}
+				}
+
+				f /= float64(count)
+
+				if cx > 0 || cy > 0 {
+					ac = append(ac, f)
+					scale = math.Max(scale, math.Abs(f))
+				} else {
+					dc = f
+				}
+			}
+		}
+
+		if scale > 0 {
+			for i := range ac {
+				ac[i] = 0.5 + 0.5/scale*ac[i]
+			}
+		}
+
+		return dc, ac, scale
+	}
+
+	lDC, lAC, lScale := encodeChannel(l, maxInt(3, lx), maxInt(3, ly))
+	pDC, pAC, pScale := encodeChannel(p, 3, 3)
+	qDC, qAC, qScale := encodeChannel(q, 3, 3)
+	channels := [][]float64{lAC, pAC, qAC}
+
+	isLandscape := width > height
+	header24 := int(jsRound(63*lDC)) | int(jsRound(31.5+31.5*pDC))<<6 | int(jsRound(31.5+31.5*qDC))<<12 | int(jsRound(31*lScale))<<18
+	header16 := int(jsRound(63*pScale))<<3 | int(jsRound(63*qScale))<<9
+
+	if isLandscape {
+		header16 |= ly | 1<<15
+	} else {
+		header16 |= lx
+	}
+
+	hash := []byte{byte(header24), byte(header24 >> 8), byte(header24 >> 16), byte(header16), byte(header16 >> 8)}
+
+	if hasAlpha {
+		aDC, aAC, aScale := encodeChannel(a, 5, 5)
+		hash[2] |= 0x80
+		hash = append(hash, byte(int(jsRound(15*aDC))|int(jsRound(15*aScale))<<4))
+		channels = append(channels, aAC)
+	}
+
+	start := len(hash)
+	index := 0
+
+	for _, ac := range channels {
+		for _, f := range ac {
+			if start+index/2 >= len(hash) {
+				hash = append(hash, 0)
+			}
+
+			hash[start+index/2] |= byte(int(jsRound(15*f)) << ((index & 1) * 4))
+			index++
+		}
+	}
+
+	return base64.StdEncoding.EncodeToString(hash)
+}
+
+/*
+DecodeThumbHash draws a ThumbHash as a small image, no more than 32
+pixels on its longest side, in the aspect ratio of the original. Scale it
+up with CSS or a resize.
+*/
+func DecodeThumbHash(s string) (image.Image, error) {
+	hash, err := base64.StdEncoding.DecodeString(s)
+
+	if err != nil {
+		hash, err = base64.RawStdEncoding.DecodeString(s)
+	}
+
+	if err != nil || len(hash) < 5 {
+		return nil, ErrInvalidThumbHash
+	}
+
+	header24 := int(hash[0]) | int(hash[1])<<8 | int(hash[2])<<16
+	header16 := int(hash[3]) | int(hash[4])<<8
+	lDC := float64(header24&63) / 63
+	pDC := float64((header24>>6)&63)/31.5 - 1
+	qDC := float64((header24>>12)&63)/31.5 - 1
+	lScale := float64((header24>>18)&31) / 31
+	hasAlpha := header24>>23 != 0
+	pScale := float64((header16>>3)&63) / 63
+	qScale := float64((header16>>9)&63) / 63
+	isLandscape := header16>>15 != 0
+
+	limit := 7
+
+	if hasAlpha {
+		limit = 5
+	}
+
+	lx, ly := maxInt(3, header16&7), maxInt(3, limit)
+
+	if isLandscape {
+		lx, ly = maxInt(3, limit), maxInt(3, header16&7)
+	}
+
+	start, aDC, aScale := 5, 1.0, 0.0
+
+	if hasAlpha {
+		if len(hash) < 6 {
+			return nil, ErrInvalidThumbHash
+		}
+
+		start = 6
+		aDC = float64(hash[5]&15) / 15
+		aScale = float64(hash[5]>>4) / 15
+	}
+
+	index := 0
+
+	decodeChannel := func(nx, ny int, scale float64) ([]float64, error) {
+		var ac []float64
+
+		for cy := 0; cy < ny; cy++ {
+			cx := 0
+
+			if cy == 0 {
+				cx = 1
+			}
+
+			for ; cx*ny < nx*(ny-cy); cx++ {
+				if start+index/2 >= len(hash) {
+					return nil, fmt.Errorf("%w: too short", ErrInvalidThumbHash)
+				}
+
+				value := (hash[start+index/2] >> ((index & 1) * 4)) & 15
+				ac = append(ac, (float64(value)/7.5-1)*scale)
+				index++
+			}
+		}
+
+		return ac, nil
+	}
+
+	// Saturation is boosted to make up for quantization
+	lAC, err := decodeChannel(lx, ly, lScale)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pAC, err := decodeChannel(3, 3, pScale*1.25)
+
+	if err != nil {
+		return nil, err
+	}
+
+	qAC, err := decodeChannel(3, 3, qScale*1.25)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var aAC []float64
+
+	if hasAlpha {
+		if aAC, err = decodeChannel(5, 5, aScale); err != nil {
+			return nil, err
+		}
+	}
+
+	ratio := thumbHashAspectRatio(hash)
+	width, height := maxInt(1, int(jsRound(32*ratio))), 32
+
+	if ratio > 1 {
+		width, height = 32, maxInt(1, int(jsRound(32/ratio)))
+	}
+
+	result := image.NewNRGBA(image.Rect(0, 0, width, height))
+	fx := make([]float64, maxInt(lx, 5))
+	fy := make([]float64, maxInt(ly, 5))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			l, p, q, a := lDC, pDC, qDC, aDC
+
+			for cx := range fx {
+				fx[cx] = math.Cos(math.Pi / float64(width) * (float64(x) + 0.5) * float64(cx))
+			}
+
+			for cy := range fy {
+				fy[cy] = math.Cos(math.Pi / float64(height) * (float64(y) + 0.5) * float64(cy))
+			}
+
+			j := 0
+
+			for cy := 0; cy < ly; cy++ {
+				for cx := boolInt(cy == 0); cx*ly < lx*(ly-cy); cx++ {
+					l += lAC[j] * fx[cx] * fy[cy] * 2
+					j++
+				}
+			}
+
+			j = 0
+
+			for cy := 0; cy < 3; cy++ {
+				for cx := boolInt(cy == 0); cx < 3-cy; cx++ {
+					f := fx[cx] * fy[cy] * 2
+					p += pAC[j] * f
+					q += qAC[j] * f
+					j++
+				}
+			}
+
+			if hasAlpha {
+				j = 0
+
+				for cy := 0; cy < 5; cy++ {
+					for cx := boolInt(cy == 0); cx < 5-cy; cx++ {
+						a += aAC[j] * fx[cx] * fy[cy] * 2
+						j++
+					}
+				}
+			}
+
+			b := l - 2.0/3.0*p
+			r := (3*l - b + q) / 2
+			g := r - q
+
+			i := result.PixOffset(x, y)
+			result.Pix[i] = unitToByte(r)
+			result.Pix[i+1] = unitToByte(g)
+			result.Pix[i+2] = unitToByte(b)
+			result.Pix[i+3] = unitToByte(a)
+		}
+	}
+
+	return result, nil
+}
+
+/*
+thumbHashAspectRatio is the width over the height of the original image,
+roughly
+*/
+func thumbHashAspectRatio(hash []byte) float64 {
+	hasAlpha := hash[2]&0x80 != 0
+	isLandscape := hash[4]&0x80 != 0
+	limit := 7
+
+	if hasAlpha {
+		limit = 5
+	}
+
+	if isLandscape {
+		return float64(limit) / float64(maxInt(1, int(hash[3]&7)))
+	}
+
+	return float64(hash[3]&7) / float64(limit)
+}
+
+/*
+jsRound rounds halves up, like JavaScript's Math.round, so hashes match
+those made by the reference encoder
+*/
+func jsRound(value float64) float64 {
+	return math.Floor(value + 0.5)
+}
+
+func unitToByte(value float64) uint8 {
+	return uint8(math.Max(0, 255*math.Min(1, value)))
+}
+
+func boolInt(value bool) int {
+	if value {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,324 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+)
+
+/*
+ImageLimits bounds the images that are decoded. Decoding allocates
+memory for every pixel, so a small file that claims to be huge, a
+decompression bomb, could otherwise exhaust memory. Any field left at
+zero uses the value in DefaultImageLimits.
+
+MaxPixels bounds a single frame. MaxTotalPixels bounds every frame of an
+animated GIF together, since each frame is drawn at the full size of the
+animation.
+*/
+type ImageLimits struct {
+	MaxFileSize    int64
+	MaxFrames      int
+	MaxHeight      int
+	MaxPixels      int64
+	MaxTotalPixels int64
+	MaxWidth       int
+}
+
+/*
+DefaultImageLimits are the limits used when none are given. They allow
+any photo from a modern camera.
+*/
+var DefaultImageLimits = ImageLimits{
+	MaxFileSize:    50 * 1024 * 1024,
+	MaxFrames:      500,
+	MaxHeight:      16384,
+	MaxPixels:      100_000_000,
+	MaxTotalPixels: 100_000_000,
+	MaxWidth:       16384,
+}
+
+/*
+ImageInfo describes an image that passed validation
+*/
+type ImageInfo struct {
+	ContentType string
+	Format      ImageFormat
+	Frames      int
+	Height      int
+	Size        int64
+	Width       int
+}
+
+/*
+ValidationError is returned when an image fails validation. Err is one
+of ErrFileTooLarge, ErrImageTooLarge, ErrContentTypeMismatch, or
+ErrInvalidFileType, so callers can use errors.Is. The message is safe to
+show to the person who uploaded the image.
+*/
+type ValidationError struct {
+	Err     error
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+/*
+StatusCode returns the HTTP status that suits the error
+*/
+func (e *ValidationError) StatusCode() int {
+	switch e.Err {
+	case ErrFileTooLarge:
+		return http.StatusRequestEntityTooLarge
+
+	case ErrImageTooLarge:
+		return http.StatusUnprocessableEntity
+	}
+
+	return http.StatusUnsupportedMediaType
+}
+
+func newValidationError(err error, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{Err: err, Message: fmt.Sprintf(format, args...)}
+}
+
+/*
+ValidateImage checks an image without decoding its pixels. The format is
+worked out from the first bytes of the file. When contentType is given,
+it must name the same format. The size, dimensions, and number of frames
+are then checked against limits. For a GIF, the frames are counted and
+the size of the animation times the number of frames is checked against
+MaxTotalPixels, before anything is decompressed.
+*/
+func ValidateImage(data []byte, contentType string, limits ImageLimits) (ImageInfo, error) {
+	limits = limits.withDefaults()
+
+	if int64(len(data)) > limits.MaxFileSize {
+		return ImageInfo{}, newValidationError(ErrFileTooLarge, "Image file is %d bytes. The most allowed is %d", len(data), limits.MaxFileSize)
+	}
+
+	format := sniffFormat(data)
+
+	if format == "" {
+		return ImageInfo{}, newValidationError(ErrInvalidFileType, ErrInvalidFileType.Error())
+	}
+
+	if contentType != "" {
+		declared, err := FormatFromContentType(contentType)
+
+		if err != nil {
+			return ImageInfo{}, newValidationError(ErrInvalidFileType, ErrInvalidFileType.Error())
+		}
+
+		if declared != format {
+			return ImageInfo{}, newValidationError(ErrContentTypeMismatch, "Image is %s, but was sent as %s", format, contentType)
+		}
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return ImageInfo{}, newValidationError(ErrInvalidFileType, "Image is not a valid %s file", format)
+	}
+
+	if config.Width > limits.MaxWidth || config.Height > limits.MaxHeight {
+		return ImageInfo{}, newValidationError(ErrImageTooLarge, "Image is %dx%d. The most allowed is %dx%d", config.Width, config.Height, limits.MaxWidth, limits.MaxHeight)
+	}
+
+	if int64(config.Width)*int64(config.Height) > limits.MaxPixels {
+		return ImageInfo{}, newValidationError(ErrImageTooLarge, "Image has %d pixels. The most allowed is %d", config.Width*config.Height, limits.MaxPixels)
+	}
+
+	frames := 1
+
+	if format == FormatGIF {
+		if frames = countGIFFrames(data); frames > limits.MaxFrames {
+			return ImageInfo{}, newValidationError(ErrImageTooLarge, "Image has %d frames. The most allowed is %d", frames, limits.MaxFrames)
+		}
+	}
+
+	if total := int64(config.Width) * int64(config.Height) * int64(frames); total > limits.MaxTotalPixels {
+		return ImageInfo{}, newValidationError(ErrImageTooLarge, "Image has %d pixels across %d frames. The most allowed is %d", total, frames, limits.MaxTotalPixels)
+	}
+
+	return ImageInfo{
+		ContentType: format.ContentType(),
+		Format:      format,
+		Frames:      frames,
+		Height:      config.Height,
+		Size:        int64(len(data)),
+		Width:       config.Width,
+	}, nil
+}
+
+/*
+ReadImage reads an upload and validates it with ValidateImage. No more
+than MaxFileSize bytes are read, however large the upload is.
+*/
+func ReadImage(source io.Reader, contentType string, limits ImageLimits) ([]byte, ImageInfo, error) {
+	limits = limits.withDefaults()
+	data, err := io.ReadAll(io.LimitReader(source, limits.MaxFileSize+1))
+
+	if err != nil {
+		return nil, ImageInfo{}, err
+	}
+
+	info, err := ValidateImage(data, contentType, limits)
+
+	if err != nil {
+		return nil, ImageInfo{}, err
+	}
+
+	return data, info, nil
+}
+
+/*
+UploadValidator returns a function that reads an upload with ReadImage
+and returns a reader over the validated bytes. It suits validation hooks
+such as database.MongoUploader's Validate.
+*/
+func UploadValidator(limits ImageLimits) func(reader io.Reader) (io.Reader, error) {
+	return func(reader io.Reader) (io.Reader, error) {
+		data, _, err := ReadImage(reader, "", limits)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return bytes.NewReader(data), nil
+	}
+}
+
+func (l ImageLimits) withDefaults() ImageLimits {
+	if l.MaxFileSize <= 0 {
+		l.MaxFileSize = DefaultImageLimits.MaxFileSize
+	}
+
+	if l.MaxFrames <= 0 {
+		l.MaxFrames = DefaultImageLimits.MaxFrames
+	}
+
+	if l.MaxHeight <= 0 {
+		l.MaxHeight = DefaultImageLimits.MaxHeight
+	}
+
+	if l.MaxPixels <= 0 {
+		l.MaxPixels = DefaultImageLimits.MaxPixels
+	}
+
+	if l.MaxTotalPixels <= 0 {
+		l.MaxTotalPixels = DefaultImageLimits.MaxTotalPixels
+	}
+
+	if l.MaxWidth <= 0 {
+		l.MaxWidth = DefaultImageLimits.MaxWidth
+	}
+
+	return l
+}
+
+/*
+sniffFormat works out the format of an image from its first bytes
+*/
+func sniffFormat(data []byte) ImageFormat {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8, 0xff}):
+		return FormatJPEG
+	case bytes.HasPrefix(data, pngSignature):
+		return FormatPNG
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return FormatGIF
+	case bytes.HasPrefix(data, []byte("BM")):
+		return FormatBMP
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return FormatTIFF
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return FormatWebP
+	}
+
+	return ""
+}
+
+/*
+countGIFFrames counts the images in a GIF by walking its blocks, without
+decompressing any of them. A damaged file counts the frames found before
+the damage.
+*/
+func countGIFFrames(data []byte) int {
+	const (
+		extensionIntroducer = 0x21
+		imageSeparator      = 0x2c
+	)
+
+	if len(data) < 13 {
+		return 0
+	}
+
+	// The header and logical screen descriptor, then the global color table
+	offset := 13
+
+	if flags := data[10]; flags&0x80 != 0 {
+		offset += 3 << (flags&0x07 + 1)
+	}
+
+	frames := 0
+
+	for offset < len(data) {
+		switch data[offset] {
+		case extensionIntroducer:
+			offset = skipGIFSubBlocks(data, offset+2)
+
+		case imageSeparator:
+			if offset+10 > len(data) {
+				return frames
+			}
+
+			frames++
+			flags := data[offset+9]
+			offset += 10
+
+			if flags&0x80 != 0 {
+				offset += 3 << (flags&0x07 + 1)
+			}
+
+			// The LZW minimum code size, then the image data
+			offset = skipGIFSubBlocks(data, offset+1)
+
+		default:
+			return frames
+		}
+	}
+
+	return frames
+}
+
+/*
+skipGIFSubBlocks returns the offset after a run of sub-blocks, each a
+length byte and that many bytes, ended by a zero length
+*/
+func skipGIFSubBlocks(data []byte, offset int) int {
+	for offset < len(data) {
+		size := int(data[offset])
+		offset++
+
+		if size == 0 {
+			return offset
+		}
+
+		offset += size
+	}
+
+	return len(data)
+}
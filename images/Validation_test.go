@@ -0,0 +1,136 @@
+package images_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/images"
+)
+
+/*
+newBombPNG makes a tiny PNG whose header claims it is width by height
+*/
+func newBombPNG(width, height uint32) []byte {
+	buffer := &bytes.Buffer{}
+	_ = png.Encode(buffer, image.NewGray(image.Rect(0, 0, 1, 1)))
+	data := buffer.Bytes()
+
+	// The IHDR chunk follows the 8 byte signature, its length, and its type
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	return data
+}
+
+func TestValidateImage(t *testing.T) {
+	var validationErr *images.ValidationError
+
+	_, err := images.ValidateImage(newBombPNG(60000, 60000), "image/png", images.ImageLimits{})
+
+	if !errors.Is(err, images.ErrImageTooLarge) || !errors.As(err, &validationErr) || validationErr.StatusCode() != http.StatusUnprocessableEntity {
+		t.Errorf("expected ErrImageTooLarge with a 422 but got %v", err)
+	}
+
+	if _, err = images.ValidateImage(newBombPNG(10, 10), "image/jpeg", images.ImageLimits{}); !errors.Is(err, images.ErrContentTypeMismatch) {
+		t.Errorf("expected ErrContentTypeMismatch but got %v", err)
+	}
+
+	if _, err = images.ValidateImage([]byte("<html></html>"), "", images.ImageLimits{}); !errors.Is(err, images.ErrInvalidFileType) {
+		t.Errorf("expected ErrInvalidFileType but got %v", err)
+	}
+
+	if _, err = images.ValidateImage(newBombPNG(10, 10), "", images.ImageLimits{MaxFileSize: 10}); !errors.Is(err, images.ErrFileTooLarge) {
+		t.Errorf("expected ErrFileTooLarge but got %v", err)
+	}
+
+	info, err := images.ValidateImage(newBombPNG(300, 200), "image/png", images.ImageLimits{})
+
+	if err != nil || info.Width != 300 || info.Height != 200 || info.Format != images.FormatPNG {
+		t.Errorf("expected a 300x200 PNG but got %+v, %v", info, err)
+	}
+}
+
+func TestValidateImage_CountsGIFFrames(t *testing.T) {
+	palette := color.Palette{color.Black, color.White}
+	animation := &gif.GIF{}
+
+	for i := 0; i < 3; i++ {
+		animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, 4, 4), palette))
+		animation.Delay = append(animation.Delay, 10)
+	}
+
+	buffer := &bytes.Buffer{}
+	_ = gif.EncodeAll(buffer, animation)
+
+	if info, err := images.ValidateImage(buffer.Bytes(), "image/gif", images.ImageLimits{}); err != nil || info.Frames != 3 {
+		t.Errorf("expected 3 frames but got %+v, %v", info, err)
+	}
+
+	if _, err := images.ValidateImage(buffer.Bytes(), "image/gif", images.ImageLimits{MaxFrames: 2}); !errors.Is(err, images.ErrImageTooLarge) {
+		t.Errorf("expected ErrImageTooLarge but got %v", err)
+	}
+}
+
+func TestValidateImage_LimitsPixelsAcrossGIFFrames(t *testing.T) {
+	palette := color.Palette{color.Black, color.White}
+	animation := &gif.GIF{Config: image.Config{ColorModel: palette, Width: 4000, Height: 4000}}
+
+	// Tiny frames on a huge canvas. Each frame is drawn at the full size
+	// of the canvas, so this small file would need gigabytes to decode.
+	for i := 0; i < 20; i++ {
+		animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, 1, 1), palette))
+		animation.Delay = append(animation.Delay, 10)
+	}
+
+	buffer := &bytes.Buffer{}
+
+	if err := gif.EncodeAll(buffer, animation); err != nil {
+		t.Fatalf("unexpected error encoding: %s", err)
+	}
+
+	if _, err := images.ValidateImage(buffer.Bytes(), "image/gif", images.ImageLimits{}); !errors.Is(err, images.ErrImageTooLarge) {
+		t.Errorf("expected ErrImageTooLarge but got %v", err)
+	}
+
+	if _, _, err := images.Decode(bytes.NewReader(buffer.Bytes())); !errors.Is(err, images.ErrImageTooLarge) {
+		t.Errorf("expected Decode to refuse the animation but got %v", err)
+	}
+}
+
+func TestResizer_RefusesImagesOverLimits(t *testing.T) {
+	resizer := images.Resizer{Limits: images.ImageLimits{MaxWidth: 100}}
+	_, err := resizer.ResizeImagePixels(bytes.NewReader(newBombPNG(200, 10)), "image/png", 10, 10)
+
+	if !errors.Is(err, images.ErrImageTooLarge) {
+		t.Errorf("expected ErrImageTooLarge but got %v", err)
+	}
+}
+
+func TestUploadValidator(t *testing.T) {
+	validate := images.UploadValidator(images.ImageLimits{})
+
+	if _, err := validate(bytes.NewReader(newBombPNG(60000, 60000))); !errors.Is(err, images.ErrImageTooLarge) {
+		t.Errorf("expected ErrImageTooLarge but got %v", err)
+	}
+
+	original := newBombPNG(300, 200)
+	reader, err := validate(bytes.NewReader(original))
+
+	if err != nil {
+		t.Fatalf("unexpected error from the validator: %v", err)
+	}
+
+	if data, _ := io.ReadAll(reader); !bytes.Equal(data, original) {
+		t.Errorf("expected the validated reader to return the original %d bytes but got %d", len(original), len(data))
+	}
+}
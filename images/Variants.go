@@ -0,0 +1,272 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/app-nerds/kit/v6/workerpool2"
+)
+
+/*
+VariantPreset is a named size for a responsive image. The image is
+scaled to fit inside MaxWidth by MaxHeight, keeping its aspect ratio.
+Either can be zero to leave that side unbounded. Images are never made
+larger than the original.
+*/
+type VariantPreset struct {
+	MaxHeight int
+	MaxWidth  int
+	Name      string
+}
+
+/*
+DefaultVariantPresets are sizes that suit most responsive layouts
+*/
+var DefaultVariantPresets = []VariantPreset{
+	{Name: "thumbnail", MaxWidth: 150, MaxHeight: 150},
+	{Name: "small", MaxWidth: 480},
+	{Name: "medium", MaxWidth: 1024},
+	{Name: "large", MaxWidth: 1920},
+}
+
+/*
+VariantGeneratorConfig configures a variant generator.
+
+  - Presets are the variants made from every image. Defaults to DefaultVariantPresets
+  - Output is how variants are encoded. Leave Format empty to keep the original format
+  - MaxWorkers is how many variants are made at once. Defaults to the number of CPUs
+  - Limits is the largest image that will be decoded. Defaults to DefaultImageLimits
+*/
+type VariantGeneratorConfig struct {
+	Limits     ImageLimits
+	MaxWorkers int
+	Output     EncodeOptions
+	Presets    []VariantPreset
+}
+
+/*
+Variant is one generated size of an image
+*/
+type Variant struct {
+	ContentType string
+	Data        []byte
+	Format      ImageFormat
+	Height      int
+	Name        string
+	Size        int
+	Width       int
+}
+
+/*
+VariantSet is every variant made from one image, in the order of the
+presets
+*/
+type VariantSet struct {
+	Height   int
+	Variants []Variant
+	Width    int
+}
+
+/*
+VariantGenerator makes every preset size of an image in one call. The
+image is decoded once, and the variants are resized and encoded in
+parallel on a workerpool2 pool.
+
+	generator := images.NewVariantGenerator(images.VariantGeneratorConfig{
+		Output: images.EncodeOptions{Format: images.FormatJPEG, Quality: 80},
+	})
+
+	set, err := generator.Generate(file)
+
+	for _, variant := range set.Variants {
+		_ = fsys.WriteFile("photos/cat-"+variant.Name+".jpg", variant.Data, 0644)
+	}
+
+	srcset := set.Srcset(func(variant images.Variant) string {
+		return "/photos/cat-" + variant.Name + ".jpg"
+	})
+*/
+type VariantGenerator struct {
+	limits  ImageLimits
+	output  EncodeOptions
+	pool    *workerpool2.Pool
+	presets []VariantPreset
+}
+
+/*
+NewVariantGenerator creates a new variant generator and starts its
+workers
+*/
+func NewVariantGenerator(config VariantGeneratorConfig) *VariantGenerator {
+	if config.MaxWorkers <= 0 {
+		config.MaxWorkers = runtime.NumCPU()
+	}
+
+	if len(config.Presets) == 0 {
+		config.Presets = DefaultVariantPresets
+	}
+
+	result := &VariantGenerator{
+		limits:  config.Limits,
+		output:  config.Output,
+		pool:    workerpool2.NewPool(workerpool2.PoolConfig{MaxWorkers: config.MaxWorkers}),
+		presets: config.Presets,
+	}
+
+	result.pool.Start()
+	return result
+}
+
+/*
+Generate reads an image and makes every preset from it. If any variant
+fails, the first error is returned.
+*/
+func (g *VariantGenerator) Generate(source io.Reader) (*VariantSet, error) {
+	var (
+		err      error
+		errMutex sync.Mutex
+		wait     sync.WaitGroup
+	)
+
+	data, err := io.ReadAll(io.LimitReader(source, g.limits.withDefaults().MaxFileSize+1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := decode(data, g.limits)
+
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding image in Generate: %w", err)
+	}
+
+	bounds := decoded.image.Bounds()
+
+	result := &VariantSet{
+		Height:   bounds.Dy(),
+		Variants: make([]Variant, len(g.presets)),
+		Width:    bounds.Dx(),
+	}
+
+	for index, preset := range g.presets {
+		index, preset := index, preset
+		wait.Add(1)
+
+		g.pool.QueueJob(func() error {
+			defer wait.Done()
+
+			variant, variantErr := g.makeVariant(decoded.clone(), preset)
+
+			if variantErr != nil {
+				errMutex.Lock()
+
+				if err == nil {
+					err = fmt.Errorf("Error generating %s variant: %w", preset.Name, variantErr)
+				}
+
+				errMutex.Unlock()
+				return nil
+			}
+
+			result.Variants[index] = variant
+			return nil
+		})
+	}
+
+	wait.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (g *VariantGenerator) makeVariant(decoded *decodedImage, preset VariantPreset) (Variant, error) {
+	bounds := decoded.image.Bounds()
+
+	options := ResizeOptions{
+		Height: minInt(preset.MaxHeight, bounds.Dy()),
+		Width:  minInt(preset.MaxWidth, bounds.Dx()),
+	}
+
+	if preset.MaxWidth <= 0 {
+		options.Width = 0
+	}
+
+	if preset.MaxHeight <= 0 {
+		options.Height = 0
+	}
+
+	if err := decoded.transform(func(img image.Image) (image.Image, error) {
+		return resizeImage(img, options)
+	}); err != nil {
+		return Variant{}, err
+	}
+
+	output, err := decoded.encode(g.output)
+
+	if err != nil {
+		return Variant{}, err
+	}
+
+	format, _ := formatOf(output.Bytes())
+	bounds = decoded.image.Bounds()
+
+	return Variant{
+		ContentType: format.ContentType(),
+		Data:        output.Bytes(),
+		Format:      format,
+		Height:      bounds.Dy(),
+		Name:        preset.Name,
+		Size:        output.Len(),
+		Width:       bounds.Dx(),
+	}, nil
+}
+
+/*
+Shutdown stops the generator's workers
+*/
+func (g *VariantGenerator) Shutdown() {
+	g.pool.Shutdown()
+}
+
+/*
+Srcset builds the value of an img srcset attribute, listing each variant
+by its width. urlFor returns the URL a variant is served from. Variants
+with the same width as one before them are left out.
+*/
+func (s *VariantSet) Srcset(urlFor func(variant Variant) string) string {
+	var (
+		parts []string
+		seen  = map[int]bool{}
+	)
+
+	for _, variant := range s.Variants {
+		if seen[variant.Width] {
+			continue
+		}
+
+		seen[variant.Width] = true
+		parts = append(parts, fmt.Sprintf("%s %dw", urlFor(variant), variant.Width))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+/*
+formatOf reads the format of encoded image data from its header
+*/
+func formatOf(data []byte) (ImageFormat, error) {
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	return ImageFormat(format), err
+}
@@ -0,0 +1,53 @@
+package images_test
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/images"
+)
+
+func TestVariantGenerator_Generate(t *testing.T) {
+	source := &bytes.Buffer{}
+	_ = png.Encode(source, newTestImage(400, 200, color.RGBA{G: 255, A: 255}))
+
+	generator := images.NewVariantGenerator(images.VariantGeneratorConfig{
+		MaxWorkers: 2,
+		Output:     images.EncodeOptions{Format: images.FormatJPEG},
+		Presets: []images.VariantPreset{
+			{Name: "thumbnail", MaxWidth: 50, MaxHeight: 50},
+			{Name: "small", MaxWidth: 200},
+			{Name: "large", MaxWidth: 1000},
+		},
+	})
+
+	defer generator.Shutdown()
+
+	set, err := generator.Generate(source)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := [][2]int{{50, 25}, {200, 100}, {400, 200}}
+
+	for i, variant := range set.Variants {
+		if variant.Width != expected[i][0] || variant.Height != expected[i][1] {
+			t.Errorf("expected %s to be %dx%d but got %dx%d", variant.Name, expected[i][0], expected[i][1], variant.Width, variant.Height)
+		}
+
+		if variant.ContentType != "image/jpeg" || variant.Size != len(variant.Data) {
+			t.Errorf("expected %s to be a JPEG of %d bytes but got %s, %d", variant.Name, len(variant.Data), variant.ContentType, variant.Size)
+		}
+	}
+
+	srcset := set.Srcset(func(variant images.Variant) string {
+		return "/cat-" + variant.Name + ".jpg"
+	})
+
+	if srcset != "/cat-thumbnail.jpg 50w, /cat-small.jpg 200w, /cat-large.jpg 400w" {
+		t.Errorf("unexpected srcset %s", srcset)
+	}
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sync"
+
+	"github.com/nfnt/resize"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+/*
+WatermarkOptions describes a watermark drawn over an image. The
+watermark is either Image, such as a logo, or Text. When both are set,
+Image is used.
+
+  - Anchor is where the watermark goes. Defaults to WatermarkAnchorBottomRight
+  - Margin is the space, in pixels, between the watermark and the edges. When tiling, it is the space between tiles
+  - Opacity runs from 0 to 1. Zero is treated as fully opaque
+  - Scale, when set, sizes the watermark to that part of the image's width, from 0 to 1, so it looks the same on every size of an image
+  - Tile repeats the watermark across the whole image. Anchor is ignored
+  - Color is the color of Text. Defaults to white
+  - Font is the TrueType or OpenType font for Text, from opentype.Parse. Defaults to Go Regular
+  - FontSize is the height of Text in pixels. Defaults to a twentieth of the image's shorter side
+*/
+type WatermarkOptions struct {
+	Anchor   WatermarkAnchor
+	Color    color.Color
+	Font     *opentype.Font
+	FontSize float64
+	Image    image.Image
+	Margin   int
+	Opacity  float64
+	Scale    float64
+	Text     string
+	Tile     bool
+}
+
+var (
+	defaultFont     *opentype.Font
+	defaultFontErr  error
+	defaultFontOnce sync.Once
+)
+
+/*
+fingerprint identifies what a watermark looks like, so images marked
+with it can be cached apart from images marked with anything else
+*/
+func (o WatermarkOptions) fingerprint() string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%d\n%g\n%g\n%q\n%t\n%g\n", o.Anchor, o.Margin, o.Opacity, o.Scale, o.Text, o.Tile, o.FontSize)
+
+	if o.Color != nil {
+		r, g, b, a := o.Color.RGBA()
+		fmt.Fprintf(hash, "%d,%d,%d,%d\n", r, g, b, a)
+	}
+
+	if o.Font != nil {
+		name, _ := o.Font.Name(nil, sfnt.NameIDFull)
+		fmt.Fprintf(hash, "%s\n%d\n", name, o.Font.NumGlyphs())
+	}
+
+	if o.Image != nil {
+		bounds := o.Image.Bounds()
+		pixel := make([]byte, 16)
+
+		fmt.Fprintf(hash, "%v\n", bounds)
+
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r, g, b, a := o.Image.At(x, y).RGBA()
+				binary.BigEndian.PutUint32(pixel[0:], r)
+				binary.BigEndian.PutUint32(pixel[4:], g)
+				binary.BigEndian.PutUint32(pixel[8:], b)
+				binary.BigEndian.PutUint32(pixel[12:], a)
+				hash.Write(pixel)
+			}
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func watermark(img image.Image, options WatermarkOptions) (image.Image, error) {
+	bounds := img.Bounds()
+	mark, err := watermarkImage(bounds.Dx(), bounds.Dy(), options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(result, result.Bounds(), img, bounds.Min, draw.Src)
+
+	opacity := options.Opacity
+
+	if opacity <= 0 || opacity > 1 {
+		opacity = 1
+	}
+
+	mask := image.NewUniform(color.Alpha{A: clampByte(opacity * 255)})
+	size := mark.Bounds().Size()
+
+	for _, at := range watermarkPositions(result.Bounds().Size(), size, options) {
+		draw.DrawMask(result, image.Rectangle{Min: at, Max: at.Add(size)}, mark, mark.Bounds().Min, mask, image.Point{}, draw.Over)
+	}
+
+	return result, nil
+}
+
+/*
+watermarkImage returns the watermark to draw on a width by height image,
+rendering text and scaling as needed
+*/
+func watermarkImage(width, height int, options WatermarkOptions) (image.Image, error) {
+	var (
+		err  error
+		mark = options.Image
+	)
+
+	if mark == nil {
+		if options.Text == "" {
+			return nil, ErrMissingWatermark
+		}
+
+		fontSize := options.FontSize
+
+		if fontSize <= 0 {
+			fontSize = math.Max(12, float64(minInt(width, height))/20)
+		}
+
+		if mark, err = renderText(options.Text, options.Font, fontSize, options.Color); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.Scale > 0 {
+		scaledWidth := maxInt(1, int(math.Round(float64(width)*math.Min(options.Scale, 1))))
+		mark = resize.Resize(uint(scaledWidth), 0, mark, resize.Lanczos3)
+	}
+
+	return mark, nil
+}
+
+/*
+watermarkPositions returns the top left corner of each copy of the
+watermark
+*/
+func watermarkPositions(canvas, mark image.Point, options WatermarkOptions) []image.Point {
+	margin := options.Margin
+
+	if options.Tile {
+		var result []image.Point
+
+		stepX, stepY := maxInt(1, mark.X+margin), maxInt(1, mark.Y+margin)
+
+		for y := margin; y < canvas.Y; y += stepY {
+			for x := margin; x < canvas.X; x += stepX {
+				result = append(result, image.Pt(x, y))
+			}
+		}
+
+		return result
+	}
+
+	left, top := margin, margin
+	right, bottom := canvas.X-mark.X-margin, canvas.Y-mark.Y-margin
+
+	switch options.Anchor {
+	case WatermarkAnchorTopLeft:
+		return []image.Point{{X: left, Y: top}}
+	case WatermarkAnchorTopRight:
+		return []image.Point{{X: right, Y: top}}
+	case WatermarkAnchorBottomLeft:
+		return []image.Point{{X: left, Y: bottom}}
+	case WatermarkAnchorCentered:
+		return []image.Point{{X: (canvas.X - mark.X) / 2, Y: (canvas.Y - mark.Y) / 2}}
+	}
+
+	return []image.Point{{X: right, Y: bottom}}
+}
+
+/*
+renderText draws text onto a transparent image just big enough to hold
+it
+*/
+func renderText(text string, f *opentype.Font, size float64, c color.Color) (image.Image, error) {
+	if f == nil {
+		defaultFontOnce.Do(func() {
+			defaultFont, defaultFontErr = opentype.Parse(goregular.TTF)
+		})
+
+		if defaultFontErr != nil {
+			return nil, defaultFontErr
+		}
+
+		f = defaultFont
+	}
+
+	if c == nil {
+		c = color.White
+	}
+
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+
+	if err != nil {
+		return nil, fmt.Errorf("Error loading watermark font: %w", err)
+	}
+
+	defer face.Close()
+
+	metrics := face.Metrics()
+	width := font.MeasureString(face, text).Ceil()
+	height := (metrics.Ascent + metrics.Descent).Ceil()
+
+	result := image.NewRGBA(image.Rect(0, 0, maxInt(1, width), maxInt(1, height)))
+
+	drawer := &font.Drawer{
+		Dst:  result,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.Point26_6{X: 0, Y: metrics.Ascent},
+	}
+
+	drawer.DrawString(text)
+	return result, nil
+}
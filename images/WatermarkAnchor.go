@@ -0,0 +1,23 @@
+/*
+ * Copyright (c) 2021. App Nerds LLC. All rights reserved
+ */
+
+package images
+
+// WatermarkAnchor is used to describe where a watermark is placed
+type WatermarkAnchor string
+
+// WatermarkAnchorTopLeft places the watermark in the top left corner
+var WatermarkAnchorTopLeft WatermarkAnchor = "top-left"
+
+// WatermarkAnchorTopRight places the watermark in the top right corner
+var WatermarkAnchorTopRight WatermarkAnchor = "top-right"
+
+// WatermarkAnchorBottomLeft places the watermark in the bottom left corner
+var WatermarkAnchorBottomLeft WatermarkAnchor = "bottom-left"
+
+// WatermarkAnchorBottomRight places the watermark in the bottom right corner
+var WatermarkAnchorBottomRight WatermarkAnchor = "bottom-right"
+
+// WatermarkAnchorCentered places the watermark in the center
+var WatermarkAnchorCentered WatermarkAnchor = "centered"
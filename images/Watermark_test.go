@@ -0,0 +1,92 @@
+package images_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/app-nerds/kit/v6/images"
+)
+
+func TestWatermark_TextOnResizeOutput(t *testing.T) {
+	source := &bytes.Buffer{}
+	_ = png.Encode(source, newTestImage(400, 200, color.Black))
+
+	resizer := images.Resizer{}
+	output, err := resizer.ResizeImagePixelsAs(bytes.NewReader(source.Bytes()), 200, 100, images.EncodeOptions{
+		Format:    images.FormatPNG,
+		Watermark: &images.WatermarkOptions{Text: "Sample", FontSize: 24, Margin: 4},
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, _ := png.Decode(output)
+	countBright := func(area image.Rectangle) int {
+		count := 0
+
+		for y := area.Min.Y; y < area.Max.Y; y++ {
+			for x := area.Min.X; x < area.Max.X; x++ {
+				if r, _, _, _ := result.At(x, y).RGBA(); r > 0x8000 {
+					count++
+				}
+			}
+		}
+
+		return count
+	}
+
+	if count := countBright(image.Rect(100, 60, 200, 100)); count < 50 {
+		t.Errorf("expected text in the bottom right but got %d bright pixels", count)
+	}
+
+	if count := countBright(image.Rect(0, 0, 100, 50)); count != 0 {
+		t.Errorf("expected the top left to be untouched but got %d bright pixels", count)
+	}
+}
+
+func TestWatermark_Tile(t *testing.T) {
+	logo := newTestImage(10, 10, color.RGBA{R: 255, A: 255})
+
+	result, err := images.NewPipeline().
+		Watermark(images.WatermarkOptions{Image: logo, Margin: 10, Tile: true}).
+		Apply(newTestImage(100, 100, color.Black))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, point := range []image.Point{{X: 12, Y: 12}, {X: 32, Y: 32}, {X: 92, Y: 52}} {
+		if r, _, _, _ := result.At(point.X, point.Y).RGBA(); r != 0xffff {
+			t.Errorf("expected a tile at %v", point)
+		}
+	}
+
+	if r, _, _, _ := result.At(25, 25).RGBA(); r != 0 {
+		t.Errorf("expected a gap between tiles at 25, 25")
+	}
+}
+
+func TestWatermark_AnchorAndOpacity(t *testing.T) {
+	logo := newTestImage(10, 10, color.White)
+
+	result, err := images.NewPipeline().
+		Watermark(images.WatermarkOptions{Image: logo, Anchor: images.WatermarkAnchorTopLeft, Opacity: 0.5}).
+		Apply(newTestImage(50, 50, color.Black))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if r, _, _, _ := result.At(5, 5).RGBA(); r < 0x7000 || r > 0x9000 {
+		t.Errorf("expected a half opaque watermark but got %d", r)
+	}
+
+	if _, err = images.NewPipeline().Watermark(images.WatermarkOptions{}).Apply(logo); !errors.Is(err, images.ErrMissingWatermark) {
+		t.Errorf("expected ErrMissingWatermark but got %v", err)
+	}
+}